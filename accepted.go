@@ -0,0 +1,73 @@
+package luddite
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ContentTypeAccepter may be implemented by resource handler types to restrict
+// the content types of request bodies they accept. POST, PUT and PATCH requests
+// whose body has any other content type are rejected with 415 Unsupported Media
+// Type before the handler runs, and the allowed types are listed in an
+// Accept-Patch (for PATCH) or Accept-Post (otherwise) response header.
+type ContentTypeAccepter interface {
+	// AcceptedContentTypes returns the accepted media types, e.g.
+	// "application/json". Parameters such as charset are ignored.
+	AcceptedContentTypes() []string
+}
+
+type resourceAccepted struct {
+	types  []string
+	header string
+}
+
+func newResourceAccepted(types []string) *resourceAccepted {
+	a := &resourceAccepted{types: make([]string, 0, len(types))}
+	for _, ct := range types {
+		if mt, _, err := mime.ParseMediaType(ct); err == nil {
+			a.types = append(a.types, mt)
+		}
+	}
+	a.header = strings.Join(a.types, ", ")
+	return a
+}
+
+// allows returns true if a request may be passed to the resource's handler.
+// Requests w/o bodies and methods that don't carry resource representations
+// are always allowed.
+func (a *resourceAccepted) allows(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return true
+	}
+	ct := req.Header.Get(HeaderContentType)
+	if ct == "" && req.ContentLength == 0 {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return stringInSlice(mt, a.types)
+}
+
+func (a *resourceAccepted) reject(rw http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPatch {
+		rw.Header().Set(HeaderAcceptPatch, a.header)
+	} else {
+		rw.Header().Set(HeaderAcceptPost, a.header)
+	}
+	_ = WriteResponse(rw, ErrorStatus(EcodeUnsupportedMediaType), NewError(nil, EcodeUnsupportedMediaType, req.Header.Get(HeaderContentType)))
+}
+
+// resourceAccepted returns the content type allowlist for the resource that
+// serves the request, if any.
+func (d *handlerDetails) resourceAccepted() *resourceAccepted {
+	r := d.resource.find(func(r *resourceRegistration) bool { return r.accepted != nil })
+	if r == nil {
+		return nil
+	}
+	return r.accepted
+}
@@ -0,0 +1,65 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type gadget struct {
+	Name string `json:"name"`
+}
+
+type gadgetResource struct{}
+
+func (r *gadgetResource) AcceptedContentTypes() []string {
+	return []string{ContentTypeJson}
+}
+
+func (r *gadgetResource) New() interface{} {
+	return &gadget{}
+}
+
+func (r *gadgetResource) Id(value interface{}) string {
+	return value.(*gadget).Name
+}
+
+func (r *gadgetResource) Create(req *http.Request, value interface{}) (int, interface{}) {
+	return http.StatusOK, value
+}
+
+func TestAcceptedContentTypes(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/gadgets", &gadgetResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(ct, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/gadgets", strings.NewReader(body))
+		req.Header.Set(HeaderAccept, ContentTypeJson)
+		if ct != "" {
+			req.Header.Set(HeaderContentType, ct)
+		}
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if rw := serve("application/json; charset=utf-8", `{"name":"foo"}`); rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK for an accepted content type, got %d", rw.Code)
+	}
+
+	for _, ct := range []string{ContentTypeXml, ContentTypeWwwFormUrlencoded, "application/json;;", ""} {
+		rw := serve(ct, `<gadget><name>foo</name></gadget>`)
+		if rw.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("%q: expected 415/Unsupported Media Type, got %d", ct, rw.Code)
+		}
+		if accept := rw.Header().Get(HeaderAcceptPost); accept != ContentTypeJson {
+			t.Errorf("%q: unexpected %s header: %q", ct, HeaderAcceptPost, accept)
+		}
+		if !strings.Contains(rw.Body.String(), EcodeUnsupportedMediaType) {
+			t.Errorf("%q: expected %s error, got %s", ct, EcodeUnsupportedMediaType, rw.Body.String())
+		}
+	}
+}
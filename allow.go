@@ -0,0 +1,190 @@
+package luddite
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+// allowedRoute records the methods registered for a route path pattern.
+type allowedRoute struct {
+	path    string
+	segs    []string
+	methods []string
+}
+
+// routeMethods returns the methods that a route allows. GET routes implicitly
+// allow HEAD.
+func routeMethods(method string) []string {
+	if method == http.MethodGet {
+		return []string{http.MethodGet, http.MethodHead}
+	}
+	return []string{method}
+}
+
+// AllowedMethods returns the sorted HTTP methods allowed on a request path by
+// the API routes known to the service, i.e. those added by AddResource or by a
+// RouteAdder, in any API version. It returns nil if no route matches the path.
+func (s *Service) AllowedMethods(path string) []string {
+	var methods []string
+	for v := s.config.Version.Min; v <= s.config.Version.Max; v++ {
+		methods = append(methods, s.allowedMethods(v, path)...)
+	}
+	if methods == nil {
+		return nil
+	}
+	return sortedMethods(methods)
+}
+
+// allowedMethods returns the methods allowed on a request path in an API
+// version, using the most specific matching route, i.e. preferring static
+// segments over parameters and parameters over catch-alls.
+func (s *Service) allowedMethods(version int, path string) []string {
+	if route := s.matchRoute(version, splitPath(path)); route != nil {
+		return route.methods
+	}
+	return nil
+}
+
+// matchRoute finds the most specific route that matches request path
+// segments in an API version, if any.
+func (s *Service) matchRoute(version int, segs []string) *allowedRoute {
+	router := s.apiRouters[version]
+	if router == nil {
+		return nil
+	}
+	return matchAllowedRoute(s.routerTable(router).load().allowed, segs)
+}
+
+// matchRequest splits a request's path into segments and finds the API route
+// and resource that serve it, if any, so that they are matched just once per
+// request. NB: It runs before the version handler validates the request's API
+// version, which rejects requests for other versions than the one used here.
+func (s *Service) matchRequest(req *http.Request) (segs []string, route *allowedRoute, r *resourceRegistration) {
+	segs = splitPath(req.URL.Path)
+	version := s.config.Version.Max
+	if v := req.Header.Get(HeaderSpirentApiVersion); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil {
+			return segs, nil, nil
+		}
+	}
+	return segs, s.matchRoute(version, segs), s.lookupResource(version, req.URL.Path)
+}
+
+// matchAllowedRoute finds the most specific route that matches request path
+// segments, if any.
+func matchAllowedRoute(routes []*allowedRoute, segs []string) (best *allowedRoute) {
+	var score []int
+	for _, route := range routes {
+		if sc := matchPath(route.segs, segs); sc != nil && compareScores(sc, score) > 0 {
+			best, score = route, sc
+		}
+	}
+	return
+}
+
+// methodNotAllowedHandler responds to requests whose path matches a route
+// but whose method doesn't, listing the methods that the router has for the
+// route in an Allow header.
+func (s *Service) methodNotAllowedHandler(rw http.ResponseWriter, req *http.Request, methods map[string]httptreemux.HandlerFunc) {
+	allowed := make([]string, 0, len(methods)+1)
+	for m := range methods {
+		allowed = append(allowed, m)
+	}
+	if s.config.Response.AutoOptions {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	rw.Header().Set(HeaderAllow, strings.Join(sortedMethods(allowed), ", "))
+	rw.WriteHeader(http.StatusMethodNotAllowed)
+}
+
+// routerOptionsHandler returns a handler that answers OPTIONS requests on a
+// router's global routes that lack an OPTIONS handler when
+// Response.AutoOptions is enabled. Routes are added to the router after the
+// handler is created, so the router's route table is consulted per request.
+func (s *Service) routerOptionsHandler(router *httptreemux.ContextMux) func(http.ResponseWriter, *http.Request, map[string]string) {
+	return func(rw http.ResponseWriter, req *http.Request, _ map[string]string) {
+		var allowed []string
+		if route := matchAllowedRoute(s.routerTable(router).load().allowed, splitPath(req.URL.Path)); route != nil {
+			allowed = route.methods
+		}
+		writeAutoOptions(rw, allowed)
+	}
+}
+
+// apiOptionsHandler answers OPTIONS requests on API routes that lack an
+// OPTIONS handler when Response.AutoOptions is enabled.
+func (s *Service) apiOptionsHandler(rw http.ResponseWriter, req *http.Request, _ map[string]string) {
+	var allowed []string
+	if d := contextHandlerDetails(req.Context()); d != nil && d.route != nil {
+		allowed = d.route.methods
+	}
+	writeAutoOptions(rw, allowed)
+}
+
+// writeAutoOptions writes a 204 No Content response listing the allowed
+// methods, including OPTIONS itself, in an Allow header.
+func writeAutoOptions(rw http.ResponseWriter, allowed []string) {
+	methods := append([]string{http.MethodOptions}, allowed...)
+	rw.Header().Set(HeaderAllow, strings.Join(sortedMethods(methods), ", "))
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func splitPath(p string) []string {
+	return strings.Split(strings.TrimPrefix(p, "/"), "/")
+}
+
+// matchPath matches request path segments against a route's pattern segments
+// and returns a per-segment specificity score, or nil if they don't match.
+func matchPath(pattern, segs []string) []int {
+	score := make([]int, 0, len(pattern))
+	for i, p := range pattern {
+		switch {
+		case strings.HasPrefix(p, "*"):
+			return append(score, 0)
+		case i >= len(segs):
+			return nil
+		case strings.HasPrefix(p, ":"):
+			if segs[i] == "" {
+				return nil
+			}
+			score = append(score, 1)
+		case p == segs[i]:
+			score = append(score, 2)
+		default:
+			return nil
+		}
+	}
+	if len(pattern) != len(segs) {
+		return nil
+	}
+	return score
+}
+
+func compareScores(a, b []int) int {
+	if b == nil {
+		return 1
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return len(a) - len(b)
+}
+
+// sortedMethods sorts and de-duplicates methods in place.
+func sortedMethods(methods []string) []string {
+	sort.Strings(methods)
+	out := methods[:0]
+	for i, m := range methods {
+		if i == 0 || m != methods[i-1] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
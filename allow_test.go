@@ -0,0 +1,148 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+func TestAllowedMethods(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/gadgets", &gadgetResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		methods []string
+	}{
+		{"/gadgets", []string{"POST"}},
+		{"/ping", []string{"GET", "HEAD"}},
+		{"/gadgets/foo", nil},
+		{"/nope", nil},
+	}
+	for _, test := range tests {
+		if methods := s.AllowedMethods(test.path); !reflect.DeepEqual(methods, test.methods) {
+			t.Errorf("%s: expected %v, got %v", test.path, test.methods, methods)
+		}
+	}
+
+	req, _ := http.NewRequest("DELETE", "/ping", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405/Method Not Allowed, got %d", rw.Code)
+	}
+	if allow := rw.Header().Get(HeaderAllow); allow != "GET, HEAD" {
+		t.Errorf("unexpected %s header: %q", HeaderAllow, allow)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	s := newTestService(t, nil)
+	a, _ := s.RouteAdder(1)
+	h := func(http.ResponseWriter, *http.Request) {}
+	a.Handle(http.MethodGet, "/users/:seg1", h)
+	a.Handle(http.MethodPut, "/users/me", h)
+	a.Handle(http.MethodDelete, "/files/*path", h)
+	a.Handle(http.MethodPost, "/users/me", h)
+	routes := s.routerTable(s.apiRouters[1]).load().allowed
+
+	tests := []struct {
+		path    string
+		methods []string
+	}{
+		{"/users/42", []string{"GET", "HEAD"}},
+		{"/users/me", []string{"POST", "PUT"}},
+		{"/users/", nil},
+		{"/files/a/b", []string{"DELETE"}},
+		{"/users/42/x", nil},
+	}
+	for _, test := range tests {
+		var methods []string
+		if route := matchAllowedRoute(routes, splitPath(test.path)); route != nil {
+			methods = route.methods
+		}
+		if !reflect.DeepEqual(methods, test.methods) {
+			t.Errorf("%s: expected %v, got %v", test.path, test.methods, methods)
+		}
+	}
+}
+
+func TestMethodNotAllowedDirectRoute(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Routes unknown to the service are still listed by the router
+	router, _ := s.Router(1)
+	router.PUT("/ping", func(http.ResponseWriter, *http.Request) {})
+
+	req, _ := http.NewRequest("DELETE", "/ping", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405/Method Not Allowed, got %d", rw.Code)
+	}
+	if allow := rw.Header().Get(HeaderAllow); allow != "GET, HEAD, PUT" {
+		t.Errorf("unexpected %s header: %q", HeaderAllow, allow)
+	}
+}
+
+func TestGlobalRoutesHeadAndOptions(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Health.Enabled = true
+		config.Schema.Enabled = true
+		config.Schema.URIPath = "/schema"
+		config.Schema.FileName = "widget.json"
+		config.Response.AutoOptions = true
+	})
+	s.SetSchemas(httpfs.New(mapfs.New(map[string]string{"v1/widget.json": widgetSchema})))
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	s.addSchemaRoutes() // as Run would
+	s.addHealthRoute()
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{"HEAD", "/health/ready", http.StatusOK, ""},
+		{"HEAD", "/schema", http.StatusTemporaryRedirect, ""},
+		{"HEAD", "/schema/v1/widget.json", http.StatusOK, ""},
+		{"OPTIONS", "/health/ready", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/schema/v1/widget.json", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/ping", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		if rw.Code != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, rw.Code)
+		}
+		if allow := rw.Header().Get(HeaderAllow); allow != test.allow {
+			t.Errorf("%s %s: unexpected %s header: %q", test.method, test.path, HeaderAllow, allow)
+		}
+	}
+
+	// Global routes added while running are answered too
+	s.EnableProfiler(true)
+	req, _ := http.NewRequest("OPTIONS", "/debug/pprof/profile", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if allow := rw.Header().Get(HeaderAllow); rw.Code != http.StatusNoContent || allow != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("expected 204/No Content allowing the profiler's methods, got %d: %q", rw.Code, allow)
+	}
+}
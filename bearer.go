@@ -0,0 +1,81 @@
+package luddite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrBearerTokenInvalid may be returned (or wrapped) by bearer token
+// verifiers to reject a token. Other errors are treated as failures of the
+// verifier's dependencies, e.g. an unreachable introspection endpoint.
+var ErrBearerTokenInvalid = errors.New("invalid bearer token")
+
+// BearerAuthOptions configures the middleware returned by
+// NewBearerAuthHandler.
+type BearerAuthOptions struct {
+	// FailMode selects what happens to requests when the verifier fails with
+	// an error other than ErrBearerTokenInvalid: FailClosed (the default)
+	// rejects them with 503 Service Unavailable, while FailOpen lets them
+	// through without an identity. Either way the failure is logged and, when
+	// metrics are enabled, counted by the
+	// luddite_middleware_dependency_failures_total metric.
+	FailMode FailMode
+	// Prefixes, when set, limits authentication to requests whose URL paths
+	// begin with one of them at a path segment boundary.
+	Prefixes []string
+}
+
+type bearerAuthHandler struct {
+	verify func(ctx context.Context, token string) (Identity, error)
+	opts   BearerAuthOptions
+}
+
+// NewBearerAuthHandler returns a middleware handler that requires requests to
+// present a bearer token (see RequestBearerToken). Tokens are resolved to
+// identities using verify; requests with missing or invalid tokens are
+// rejected with 401 Unauthorized. The resolved identity is available to
+// downstream handlers via ContextIdentity.
+func NewBearerAuthHandler(verify func(ctx context.Context, token string) (Identity, error), opts BearerAuthOptions) http.Handler {
+	if opts.FailMode == "" {
+		opts.FailMode = FailClosed
+	}
+
+	return &bearerAuthHandler{
+		verify: verify,
+		opts:   opts,
+	}
+}
+
+func (h *bearerAuthHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !hasPathPrefixes(req.URL.Path, h.opts.Prefixes) {
+		return
+	}
+
+	token := RequestBearerToken(req)
+	if token == "" {
+		h.reject(rw)
+		return
+	}
+	identity, err := h.verify(req.Context(), token)
+	if errors.Is(err, ErrBearerTokenInvalid) {
+		h.reject(rw)
+		return
+	}
+	if err != nil {
+		recordDependencyFailure(req.Context(), ContextLogger(req.Context()), "bearer_auth", h.opts.FailMode, err)
+		if h.opts.FailMode != FailOpen {
+			_ = WriteResponse(rw, ErrorStatus(EcodeServiceUnavailable), NewError(nil, EcodeServiceUnavailable, "authentication"))
+		}
+		return
+	}
+
+	if d := contextHandlerDetails(req.Context()); d != nil {
+		d.identity = &identity
+	}
+}
+
+func (h *bearerAuthHandler) reject(rw http.ResponseWriter) {
+	rw.Header().Set(HeaderWWWAuthenticate, "Bearer")
+	_ = WriteResponse(rw, ErrorStatus(EcodeTokenInvalid), NewError(nil, EcodeTokenInvalid))
+}
@@ -0,0 +1,95 @@
+package luddite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+var errIntrospection = errors.New("introspection endpoint unreachable")
+
+func TestBearerAuthHandler(t *testing.T) {
+	for _, mode := range []FailMode{FailClosed, FailOpen} {
+		s := newTestService(t, nil)
+		s.AddHandler(NewBearerAuthHandler(func(ctx context.Context, token string) (Identity, error) {
+			switch token {
+			case "good":
+				return Identity{ID: "acme"}, nil
+			case "flaky":
+				return Identity{}, errIntrospection
+			}
+			return Identity{}, ErrBearerTokenInvalid
+		}, BearerAuthOptions{FailMode: mode}))
+		r := &identityResource{}
+		if err := s.AddResource(1, "/things", r); err != nil {
+			t.Fatal(err)
+		}
+
+		serve := func(token string) *httptest.ResponseRecorder {
+			r.identity, r.ok = Identity{}, false
+			req, _ := http.NewRequest("GET", "/things", nil)
+			if token != "" {
+				req.Header.Set(HeaderAuthorization, "Bearer "+token)
+			}
+			rw := httptest.NewRecorder()
+			s.ServeHTTP(rw, req)
+			return rw
+		}
+
+		if rw := serve(""); rw.Code != http.StatusUnauthorized || rw.Header().Get(HeaderWWWAuthenticate) != "Bearer" {
+			t.Errorf("%s: expected 401/Unauthorized with challenge without token, got %d", mode, rw.Code)
+		}
+		if rw := serve("bad"); rw.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401/Unauthorized with invalid token, got %d", mode, rw.Code)
+		}
+		if rw := serve("good"); rw.Code != http.StatusOK || !r.ok || r.identity.ID != "acme" {
+			t.Errorf("%s: expected 200/OK with identity acme, got %d %+v", mode, rw.Code, r.identity)
+		}
+
+		failures := testutil.ToFloat64(dependencyFailures.WithLabelValues("bearer_auth", string(mode)))
+		rw := serve("flaky")
+		switch mode {
+		case FailClosed:
+			if rw.Code != http.StatusServiceUnavailable {
+				t.Errorf("expected 503/Service Unavailable failing closed, got %d", rw.Code)
+			}
+		case FailOpen:
+			if rw.Code != http.StatusOK || r.ok {
+				t.Errorf("expected 200/OK without identity failing open, got %d %+v", rw.Code, r.identity)
+			}
+		}
+		if n := testutil.ToFloat64(dependencyFailures.WithLabelValues("bearer_auth", string(mode))); n != failures+1 {
+			t.Errorf("%s: expected dependency failure to be counted", mode)
+		}
+	}
+}
+
+func TestDependencyFailuresRegistration(t *testing.T) {
+	prometheus.Unregister(dependencyFailures)
+	NewBearerAuthHandler(func(context.Context, string) (Identity, error) { return Identity{}, nil }, BearerAuthOptions{})
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Schema.Validation.Requests = true
+		config.Schema.Validation.FailMode = FailOpen
+	})
+	s.SetSchemas(httpfs.New(mapfs.New(map[string]string{})))
+	if err := s.AddResource(1, "/widgets", &widgetResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if prometheus.Unregister(dependencyFailures) {
+		t.Error("expected dependency failures metric not to be registered with metrics disabled")
+	}
+
+	newTestService(t, func(config *ServiceConfig) {
+		config.Metrics.Enabled = true
+	})
+	if !prometheus.Unregister(dependencyFailures) {
+		t.Error("expected dependency failures metric to be registered by services with metrics enabled")
+	}
+}
@@ -4,33 +4,60 @@ import (
 	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"io/ioutil"
 	"mime"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/schema"
 )
 
+// responseChunkSize is the size of the chunks in which WriteResponse writes
+// bodies, checking for canceled requests between chunks.
+const responseChunkSize = 32 * 1024
+
+// maxPooledBufferSize caps the capacity of the serialization buffers returned
+// to the pool, so that occasional large responses don't pin memory.
+const maxPooledBufferSize = 1024 * 1024
+
+var responseBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
 const (
-	ContentTypeCss               = "text/css"
-	ContentTypeCsv               = "text/csv"
-	ContentTypeGif               = "image/gif"
-	ContentTypeHtml              = "text/html"
-	ContentTypeJson              = "application/json"
-	ContentTypeMsgpack           = "application/msgpack"
-	ContentTypeMultipartFormData = "multipart/form-data"
-	ContentTypeOctetStream       = "application/octet-stream"
-	ContentTypePlain             = "text/plain"
-	ContentTypePng               = "image/png"
-	ContentTypeProtobuf          = "application/protobuf"
-	ContentTypeWwwFormUrlencoded = "application/x-www-form-urlencoded"
-	ContentTypeXml               = "application/xml"
+	ContentTypeCss                 = "text/css"
+	ContentTypeCsv                 = "text/csv"
+	ContentTypeEventStream         = "text/event-stream"
+	ContentTypeGif                 = "image/gif"
+	ContentTypeHtml                = "text/html"
+	ContentTypeJavascript          = "application/javascript"
+	ContentTypeJson                = "application/json"
+	ContentTypeJsonApi             = "application/vnd.api+json"
+	ContentTypeMsgpack             = "application/msgpack"
+	ContentTypeMultipartByteranges = "multipart/byteranges"
+	ContentTypeMultipartFormData   = "multipart/form-data"
+	ContentTypeOctetStream         = "application/octet-stream"
+	ContentTypePlain               = "text/plain"
+	ContentTypePng                 = "image/png"
+	ContentTypeProblemJson         = "application/problem+json"
+	ContentTypeProtobuf            = "application/protobuf"
+	ContentTypeWwwFormUrlencoded   = "application/x-www-form-urlencoded"
+	ContentTypeXml                 = "application/xml"
+	ContentTypeYaml                = "text/yaml"
 
 	maxFormDataMemoryUsage = 10 * 1024 * 1024
 )
 
-var FormDecoder = schema.NewDecoder()
+var (
+	FormDecoder = schema.NewDecoder()
+
+	// serializableContentTypes are the content types that WriteResponse is
+	// able to serialize arbitrary values to.
+	serializableContentTypes = []string{ContentTypeJson, ContentTypeXml, ContentTypeHtml}
+)
 
 func init() {
 	t := time.Time{}
@@ -67,17 +94,47 @@ func ReadRequest(req *http.Request, v interface{}) error {
 		}
 		return nil
 	case ContentTypeJson:
-		decoder := json.NewDecoder(req.Body)
-		err := decoder.Decode(v)
-		if err != nil {
-			return NewError(nil, EcodeDeserializationFailed, err)
+		body := limitDecodeBody(req)
+		d := contextHandlerDetails(req.Context())
+		if d == nil {
+			return decodeJSONRequest(req, body, v, false)
 		}
-		return nil
+		var (
+			fieldNames func(string) string
+			timeFormat string
+		)
+		if d.s != nil {
+			fieldNames = d.s.fieldNames
+			timeFormat = d.s.timeFormat
+		}
+		if (d.validation != nil && d.validation.request != nil) || fieldNames != nil || timeFormat != "" {
+			b, err := ioutil.ReadAll(body)
+			if err != nil {
+				return decodeError(req, err)
+			}
+			if d.validation != nil && d.validation.request != nil {
+				if err = d.validation.checkRequest(b); err != nil {
+					return err
+				}
+			}
+			if fieldNames != nil {
+				if b, err = restoreJSONFieldNames(b, reflect.TypeOf(v), fieldNames); err != nil {
+					return decodeError(req, err)
+				}
+			}
+			if timeFormat != "" {
+				if b, err = parseJSONTimes(b, reflect.TypeOf(v), timeFormat); err != nil {
+					return decodeError(req, err)
+				}
+			}
+			body = bytes.NewReader(b)
+		}
+		return decodeJSONRequest(req, body, v, d.disallowUnknownFields)
 	case ContentTypeXml:
-		decoder := xml.NewDecoder(req.Body)
+		decoder := xml.NewDecoder(limitDecodeBody(req))
 		err := decoder.Decode(v)
 		if err != nil {
-			return NewError(nil, EcodeDeserializationFailed, err)
+			return decodeError(req, err)
 		}
 		return nil
 	case "":
@@ -87,8 +144,96 @@ func ReadRequest(req *http.Request, v interface{}) error {
 	}
 }
 
+// defaultBodylessStatuses are the statuses whose responses are always written
+// without a body, Content-Type or Content-Length (in addition to 1xx statuses).
+var defaultBodylessStatuses = map[int]bool{
+	http.StatusNoContent:          true,
+	http.StatusResetContent:       true,
+	http.StatusNotModified:        true,
+	http.StatusPreconditionFailed: true,
+}
+
+// isBodylessStatus returns true if responses with the given status must not
+// carry a body.
+func isBodylessStatus(rw http.ResponseWriter, status int) bool {
+	if status/100 == 1 {
+		return true
+	}
+	if res, ok := rw.(*responseWriter); ok && res.bodylessStatuses != nil {
+		return res.bodylessStatuses[status]
+	}
+	return defaultBodylessStatuses[status]
+}
+
+// writeBodyless writes a status without a body, removing any negotiated
+// entity headers.
+func writeBodyless(rw http.ResponseWriter, status int) {
+	h := rw.Header()
+	h.Del(HeaderContentType)
+	h.Del(HeaderContentLength)
+	h.Del(HeaderSpirentInhibitResponse)
+	rw.WriteHeader(status)
+}
+
+// NoBody may be returned by resource handlers (e.g. actioners) to declare that
+// a response intrinsically has no body. WriteResponse writes the handler's
+// status without a body.
+var NoBody = &noBody{}
+
+type noBody struct{}
+
+// WriteStatus writes a status without a body, e.g. for conditional requests or
+// accepted asynchronous operations. Negotiated entity headers are removed and
+// nothing is serialized. Responses that were already written are left as-is.
+func WriteStatus(rw http.ResponseWriter, status int) {
+	if res, ok := rw.(ResponseWriter); ok && res.Written() {
+		return
+	}
+	writeBodyless(rw, status)
+}
+
 // WriteResponse serializes a response body according to the negotiated Content-Type.
+//
+// Handler intent takes precedence over the X-Spirent-Inhibit-Response header:
+// when v is NoBody the status is written as-is without a body whether or not
+// the header was set. Otherwise, when the header was set, 2xx responses are
+// written as 204 without a body.
+//
+// Responses with statuses that never carry a body (1xx, 204, 205, 304, 412 and
+// any configured in Response.BodylessStatuses) are written without a body,
+// Content-Type or Content-Length regardless of v and content negotiation.
+//
+// A MultiStatusResult is always written with a 207 Multi-Status status. Errors
+// written with a zero status use the status registered for their error code,
+// see RegisterErrorStatus.
 func WriteResponse(rw http.ResponseWriter, status int, v interface{}) (err error) {
+	if status == 0 {
+		switch e := v.(type) {
+		case *Error:
+			status = ErrorStatus(e.Code)
+		case error:
+			status = ErrorStatus(EcodeInternal)
+		}
+	}
+	if res, ok := rw.(*responseWriter); ok && res.checkCanceled() {
+		return ErrResponseCanceled
+	}
+	switch m := v.(type) {
+	case *MultiStatusResult:
+		status, v = http.StatusMultiStatus, m.render(rw)
+	case MultiStatusResult:
+		status, v = http.StatusMultiStatus, m.render(rw)
+	}
+	if isBodylessStatus(rw, status) {
+		writeBodyless(rw, status)
+		return
+	}
+	if v == NoBody {
+		rw.Header().Del(HeaderSpirentInhibitResponse)
+		rw.WriteHeader(status)
+		return
+	}
+
 	var inhibitResp bool
 	if rw.Header().Get(HeaderSpirentInhibitResponse) != "" {
 		if status/100 == 2 {
@@ -104,17 +249,46 @@ func WriteResponse(rw http.ResponseWriter, status int, v interface{}) (err error
 		case error:
 			v = NewError(nil, EcodeInternal, v)
 		}
+		if e, ok := v.(*Error); ok {
+			v = withHelpURL(e)
+		}
+		if e, ok := v.(*Error); ok && rw.Header().Get(HeaderContentType) == ContentTypeJson {
+			if res, ok := rw.(*responseWriter); ok && res.problemDetails {
+				v = newProblem(e, status, res.instance)
+				rw.Header().Set(HeaderContentType, ContentTypeProblemJson)
+			} else if ok && res.jsonAPIErrors {
+				v = newJSONAPIErrors(e, status)
+				rw.Header().Set(HeaderContentType, ContentTypeJsonApi)
+			}
+		}
 		switch ct := rw.Header().Get(HeaderContentType); ct {
-		case ContentTypeJson:
-			b, err = json.Marshal(v)
+		case ContentTypeJson, ContentTypeProblemJson, ContentTypeJsonApi:
+			buf := getResponseBuffer(rw)
+			defer putResponseBuffer(buf)
+			b, err = encodeJSON(rw, buf, v)
 			if err != nil {
 				rw.WriteHeader(http.StatusInternalServerError)
-				b, err = json.Marshal(NewError(nil, EcodeSerializationFailed, err))
+				b, err = marshalJSON(rw, NewError(nil, EcodeSerializationFailed, err))
 				if err != nil {
 					_, _ = rw.Write(b)
 				}
 				return
 			}
+			if res, ok := rw.(*responseWriter); ok && res.validation != nil && status/100 == 2 && status != http.StatusMultiStatus {
+				if verr := res.validation.checkResponse(b); verr != nil && res.validation.s.config.Schema.Validation.FailResponses {
+					rw.Header().Del(HeaderSpirentInhibitResponse)
+					rw.WriteHeader(http.StatusInternalServerError)
+					if b, err = marshalJSON(rw, NewError(nil, EcodeResponseInvalid, verr)); err == nil {
+						_, err = rw.Write(b)
+					}
+					return
+				}
+			}
+			if res, ok := rw.(*responseWriter); ok && res.jsonpCallback != "" {
+				b = wrapJSONP(res.jsonpCallback, b)
+				rw.Header().Set(HeaderContentType, ContentTypeJavascript)
+				rw.Header().Set(HeaderContentTypeOptions, "nosniff")
+			}
 		case ContentTypeXml:
 			b, err = xml.Marshal(v)
 			if err != nil {
@@ -158,18 +332,220 @@ func WriteResponse(rw http.ResponseWriter, status int, v interface{}) (err error
 					rw.Header().Set(HeaderContentType, ContentTypePlain)
 				}
 			default:
-				rw.WriteHeader(http.StatusNotAcceptable)
+				writeNotAcceptable(rw)
 				return
 			}
 		}
 	}
+	if setAutoETag(rw, status, b) {
+		writeBodyless(rw, http.StatusNotModified)
+		return
+	}
 	if inhibitResp {
-		rw.WriteHeader(http.StatusNoContent)
+		writeBodyless(rw, http.StatusNoContent)
 		return
 	}
+	if res, ok := rw.(*responseWriter); ok && res.checkCanceled() {
+		return ErrResponseCanceled
+	}
 	rw.WriteHeader(status)
 	if b != nil {
-		_, err = rw.Write(b)
+		err = writeResponseBody(rw, b)
 	}
 	return
 }
+
+// writeResponseBody writes a serialized response body. Bodies are written in
+// chunks so that writes stop once the request's context is done.
+func writeResponseBody(rw http.ResponseWriter, b []byte) error {
+	res, ok := rw.(*responseWriter)
+	if !ok || res.ctx == nil {
+		_, err := rw.Write(b)
+		return err
+	}
+	for len(b) > 0 {
+		if res.checkCanceled() {
+			return ErrResponseCanceled
+		}
+		n := len(b)
+		if n > responseChunkSize {
+			n = responseChunkSize
+		}
+		if _, err := rw.Write(b[:n]); err != nil {
+			if res.checkCanceled() {
+				return ErrResponseCanceled
+			}
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// writeNotAcceptable writes a 406 response when a value can't be serialized
+// to the negotiated content type. Since the client's preferences can't be
+// honored the body is always written as JSON.
+func writeNotAcceptable(rw http.ResponseWriter) {
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+	rw.Header().Del(HeaderSpirentInhibitResponse)
+	b, err := marshalJSON(rw, NewError(nil, EcodeNotAcceptable, strings.Join(serializableContentTypes, ", ")))
+	rw.WriteHeader(ErrorStatus(EcodeNotAcceptable))
+	if err == nil {
+		_, _ = rw.Write(b)
+	}
+}
+
+// getResponseBuffer returns an empty pooled buffer for serializing a response
+// body, pre-sized using the service's Response.BufferHint.
+func getResponseBuffer(rw http.ResponseWriter) *bytes.Buffer {
+	buf := responseBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if res, ok := rw.(*responseWriter); ok && res.bufferHint > 0 {
+		buf.Grow(res.bufferHint)
+	}
+	return buf
+}
+
+// putResponseBuffer returns a buffer to the pool once the response body it
+// holds has been written.
+func putResponseBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		responseBufferPool.Put(buf)
+	}
+}
+
+// marshalJSON serializes v using the JSON encoder settings of the current
+// response, i.e. indentation, HTML escaping, null field omission, field names
+// and time format. If rw isn't a luddite response writer then the encoding/json
+// defaults apply.
+func marshalJSON(rw http.ResponseWriter, v interface{}) ([]byte, error) {
+	return encodeJSON(rw, new(bytes.Buffer), v)
+}
+
+// encodeJSON serializes v like marshalJSON, using buf. The returned bytes may
+// alias buf and so are only valid until buf is reused.
+func encodeJSON(rw http.ResponseWriter, buf *bytes.Buffer, v interface{}) ([]byte, error) {
+	var (
+		indent     string
+		escapeHTML = true
+		omitNull   bool
+		fieldNames func(string) string
+		timeFormat string
+	)
+	if res, ok := rw.(*responseWriter); ok {
+		indent = res.jsonIndent
+		escapeHTML = res.jsonEscapeHTML
+		omitNull = res.jsonOmitNull
+		fieldNames = res.jsonFieldNames
+		timeFormat = res.jsonTimeFormat
+	}
+	rewrite := omitNull || fieldNames != nil || timeFormat != ""
+
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(escapeHTML)
+	if !rewrite {
+		enc.SetIndent("", indent)
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	// NB: Encode always appends a newline, which json.Marshal does not
+	b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if !rewrite {
+		return b, nil
+	}
+
+	// Rewrite the compact encoding's times and keys, then indent
+	var err error
+	if timeFormat != "" {
+		if b, err = formatJSONTimes(b, reflect.ValueOf(v), timeFormat, escapeHTML); err != nil {
+			return nil, err
+		}
+	}
+	if omitNull {
+		if b, err = stripJSONNulls(b, escapeHTML); err != nil {
+			return nil, err
+		}
+	}
+	if fieldNames != nil {
+		if b, err = renameJSONFields(b, reflect.ValueOf(v), escapeHTML, fieldNames); err != nil {
+			return nil, err
+		}
+	}
+	if indent == "" {
+		return b, nil
+	}
+	// NB: b may still alias buf, e.g. for scalar documents
+	out := new(bytes.Buffer)
+	if err = json.Indent(out, b, "", indent); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// stripJSONNulls removes null-valued keys from the objects in a compact JSON
+// document, recursively. Keys are re-encoded using the response's HTML
+// escaping setting. Key order and array elements (including null elements)
+// are preserved, as are scalar documents.
+func stripJSONNulls(b []byte, escapeHTML bool) ([]byte, error) {
+	if len(b) == 0 || (b[0] != '{' && b[0] != '[') {
+		return b, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	out := new(bytes.Buffer)
+	out.WriteByte(b[0])
+	first := true
+	for dec.More() {
+		var key []byte
+		if b[0] == '{' {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			if key, err = marshalJSONString(t.(string), escapeHTML); err != nil {
+				return nil, err
+			}
+		}
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return nil, err
+		}
+		if key != nil && string(elem) == "null" {
+			continue
+		}
+		elem, err := stripJSONNulls(elem, escapeHTML)
+		if err != nil {
+			return nil, err
+		}
+		if !first {
+			out.WriteByte(',')
+		}
+		first = false
+		if key != nil {
+			out.Write(key)
+			out.WriteByte(':')
+		}
+		out.Write(elem)
+	}
+	if b[0] == '{' {
+		out.WriteByte('}')
+	} else {
+		out.WriteByte(']')
+	}
+	return out.Bytes(), nil
+}
+
+func marshalJSONString(s string, escapeHTML bool) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(escapeHTML)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
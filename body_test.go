@@ -2,6 +2,7 @@ package luddite
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"net/http"
 	"net/http/httptest"
@@ -226,3 +227,346 @@ func TestReadUrlencoded(t *testing.T) {
 		t.Error("Urlencoded date deserialization failed")
 	}
 }
+
+func TestWriteJsonEncoding(t *testing.T) {
+	v := map[string]string{"url": "http://example.com/?a=1&b=2"}
+
+	// Defaults: compact and HTML-escaped
+	rw := httptest.NewRecorder()
+	rw.Header().Add(HeaderContentType, ContentTypeJson)
+	res := new(responseWriter)
+	res.init(rw)
+
+	if err := WriteResponse(res, http.StatusOK, v); err != nil {
+		t.Fatal(err)
+	}
+	if body, expected := rw.Body.String(), "{\"url\":\"http://example.com/?a=1\\u0026b=2\"}"; body != expected {
+		t.Errorf("JSON serialization failed, got: %s, expected: %s\n", body, expected)
+	}
+
+	// Indented and unescaped
+	rw = httptest.NewRecorder()
+	rw.Header().Add(HeaderContentType, ContentTypeJson)
+	res.init(rw)
+	res.jsonIndent = "  "
+	res.jsonEscapeHTML = false
+
+	if err := WriteResponse(res, http.StatusOK, v); err != nil {
+		t.Fatal(err)
+	}
+	if body, expected := rw.Body.String(), "{\n  \"url\": \"http://example.com/?a=1&b=2\"\n}"; body != expected {
+		t.Errorf("JSON serialization failed, got: %s, expected: %s\n", body, expected)
+	}
+}
+
+func TestWriteJsonPooledBuffer(t *testing.T) {
+	write := func(hint int, v interface{}) string {
+		rw := httptest.NewRecorder()
+		rw.Header().Add(HeaderContentType, ContentTypeJson)
+		res := new(responseWriter)
+		res.init(rw)
+		res.bufferHint = hint
+		if err := WriteResponse(res, http.StatusOK, v); err != nil {
+			t.Fatal(err)
+		}
+		return rw.Body.String()
+	}
+
+	// Reused buffers don't leak earlier responses' bodies
+	if body, expected := write(0, strings.Repeat("x", 100)), `"`+strings.Repeat("x", 100)+`"`; body != expected {
+		t.Errorf("JSON serialization failed, got: %s, expected: %s", body, expected)
+	}
+	if body, expected := write(4096, map[string]int{"a": 1}), `{"a":1}`; body != expected {
+		t.Errorf("JSON serialization failed, got: %s, expected: %s", body, expected)
+	}
+	if body, expected := write(0, 42), "42"; body != expected {
+		t.Errorf("JSON serialization failed, got: %s, expected: %s", body, expected)
+	}
+
+	buf := getResponseBuffer(&responseWriter{bufferHint: 4096})
+	if buf.Len() != 0 || buf.Cap() < 4096 {
+		t.Errorf("expected an empty buffer with capacity for the hint, got len %d cap %d", buf.Len(), buf.Cap())
+	}
+	putResponseBuffer(buf)
+}
+
+// discardResponseWriter is a minimal http.ResponseWriter for benchmarks.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (rw *discardResponseWriter) Header() http.Header         { return rw.header }
+func (rw *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (rw *discardResponseWriter) WriteHeader(int)             {}
+
+func benchmarkWriteJson(b *testing.B, write func(res *responseWriter, v interface{})) {
+	v := make([]sample, 20)
+	for i := range v {
+		v[i] = sample{Id: i, Name: "sample", Flag: true, Data: []byte("data"), Timestamp: time.Unix(0, 0).UTC()}
+	}
+	base := &discardResponseWriter{header: http.Header{HeaderContentType: []string{ContentTypeJson}}}
+	res := new(responseWriter)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res.init(base)
+		res.bufferHint = 4096
+		write(res, v)
+	}
+}
+
+// BenchmarkWriteJson measures WriteResponse, which serializes into pooled
+// buffers. Compare its allocations with BenchmarkWriteJsonUnpooled.
+func BenchmarkWriteJson(b *testing.B) {
+	benchmarkWriteJson(b, func(res *responseWriter, v interface{}) {
+		_ = WriteResponse(res, http.StatusOK, v)
+	})
+}
+
+func BenchmarkWriteJsonUnpooled(b *testing.B) {
+	benchmarkWriteJson(b, func(res *responseWriter, v interface{}) {
+		body, _ := marshalJSON(res, v)
+		res.WriteHeader(http.StatusOK)
+		_, _ = res.Write(body)
+	})
+}
+
+type nullable struct {
+	Id     int         `json:"id"`
+	Name   *string     `json:"name"`
+	Tags   []string    `json:"tags"`
+	Nested *nullable   `json:"nested"`
+	Items  []*nullable `json:"items"`
+}
+
+func TestWriteJsonOmitNull(t *testing.T) {
+	v := &nullable{Id: 1, Nested: &nullable{Id: 2}, Items: []*nullable{nil, {Id: 3}}}
+
+	write := func(ct string, indent string, v interface{}) string {
+		rw := httptest.NewRecorder()
+		rw.Header().Add(HeaderContentType, ct)
+		res := new(responseWriter)
+		res.init(rw)
+		res.jsonOmitNull = true
+		res.jsonIndent = indent
+		if err := WriteResponse(res, http.StatusOK, v); err != nil {
+			t.Fatal(err)
+		}
+		return rw.Body.String()
+	}
+
+	if body, expected := write(ContentTypeJson, "", v), `{"id":1,"nested":{"id":2},"items":[null,{"id":3}]}`; body != expected {
+		t.Errorf("JSON null omission failed, got: %s, expected: %s", body, expected)
+	}
+	if body, expected := write(ContentTypeJson, "  ", &nullable{Id: 1}), "{\n  \"id\": 1\n}"; body != expected {
+		t.Errorf("JSON null omission failed, got: %s, expected: %s", body, expected)
+	}
+	if body, expected := write(ContentTypeJson, "", []interface{}{nil, "a<b"}), `[null,"a\u003cb"]`; body != expected {
+		t.Errorf("JSON null omission failed, got: %s, expected: %s", body, expected)
+	}
+	if body, expected := write(ContentTypeJson, "", 42), "42"; body != expected {
+		t.Errorf("JSON null omission failed, got: %s, expected: %s", body, expected)
+	}
+	if body, expected := write(ContentTypeXml, "", &nullable{Id: 1}), "<nullable><Id>1</Id></nullable>"; body != expected {
+		t.Errorf("XML serialization failed, got: %s, expected: %s", body, expected)
+	}
+}
+
+func TestWriteNotAcceptable(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderAccept, "application/csv")
+	rw := httptest.NewRecorder()
+
+	n := newNegotiatorHandler(negotiatedContentTypes)
+	n.ServeHTTP(rw, req)
+
+	s := &sample{
+		Id:   sampleId,
+		Name: sampleName,
+	}
+	if err := WriteResponse(rw, http.StatusOK, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if rw.Code != http.StatusNotAcceptable {
+		t.Errorf("expected 406/Not Acceptable, got %d", rw.Code)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJson {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	expected := "{\"code\":\"NOT_ACCEPTABLE\",\"message\":\"Not acceptable, supported media types: application/json, application/xml, text/html\"}"
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("406 body incorrect, got: %s, expected: %s\n", body, expected)
+	}
+}
+
+func TestWriteNoBody(t *testing.T) {
+	tests := []struct {
+		inhibit  bool
+		status   int
+		v        interface{}
+		expected int
+		body     bool
+	}{
+		{false, http.StatusOK, NoBody, http.StatusOK, false},
+		{true, http.StatusOK, NoBody, http.StatusOK, false},
+		{false, http.StatusNoContent, NoBody, http.StatusNoContent, false},
+		{true, http.StatusNoContent, NoBody, http.StatusNoContent, false},
+		{false, http.StatusOK, sampleData, http.StatusOK, true},
+		{true, http.StatusOK, sampleData, http.StatusNoContent, false},
+		{true, http.StatusOK, nil, http.StatusNoContent, false},
+	}
+
+	for i, test := range tests {
+		rw := httptest.NewRecorder()
+		rw.Header().Set(HeaderContentType, ContentTypeJson)
+		if test.inhibit {
+			rw.Header().Set(HeaderSpirentInhibitResponse, "1")
+		}
+
+		if err := WriteResponse(rw, test.status, test.v); err != nil {
+			t.Fatal(err)
+		}
+		if rw.Code != test.expected {
+			t.Errorf("test %d: expected status %d, got %d", i, test.expected, rw.Code)
+		}
+		if hasBody := rw.Body.Len() != 0; hasBody != test.body {
+			t.Errorf("test %d: unexpected body: %s", i, rw.Body.String())
+		}
+		if _, ok := rw.Header()[HeaderSpirentInhibitResponse]; ok && test.v == NoBody {
+			t.Errorf("test %d: unexpected %s header", i, HeaderSpirentInhibitResponse)
+		}
+	}
+}
+
+func TestWriteBodylessStatuses(t *testing.T) {
+	for _, status := range []int{
+		http.StatusNoContent,
+		http.StatusResetContent,
+		http.StatusNotModified,
+		http.StatusPreconditionFailed,
+	} {
+		rw := httptest.NewRecorder()
+		rw.Header().Set(HeaderContentType, ContentTypeJson)
+		rw.Header().Set(HeaderContentLength, "42")
+
+		if err := WriteResponse(rw, status, NewError(nil, EcodeUpdatePreempted, "stale")); err != nil {
+			t.Fatal(err)
+		}
+		if rw.Code != status {
+			t.Errorf("expected status %d, got %d", status, rw.Code)
+		}
+		if rw.Body.Len() != 0 {
+			t.Errorf("status %d: unexpected body: %s", status, rw.Body.String())
+		}
+		if ct := rw.Header().Get(HeaderContentType); ct != "" {
+			t.Errorf("status %d: unexpected content type: %s", status, ct)
+		}
+		if cl := rw.Header().Get(HeaderContentLength); cl != "" {
+			t.Errorf("status %d: unexpected content length: %s", status, cl)
+		}
+	}
+
+	// Inhibited responses are also written without a content type
+	rw := httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+	rw.Header().Set(HeaderSpirentInhibitResponse, "1")
+	if err := WriteResponse(rw, http.StatusOK, sampleData); err != nil {
+		t.Fatal(err)
+	}
+	if ct := rw.Header().Get(HeaderContentType); rw.Code != http.StatusNoContent || ct != "" {
+		t.Errorf("expected 204/No Content without content type, got %d with %s", rw.Code, ct)
+	}
+
+	// Services may configure additional bodyless statuses
+	res := &responseWriter{}
+	res.init(httptest.NewRecorder())
+	res.bodylessStatuses = map[int]bool{http.StatusAccepted: true}
+	res.Header().Set(HeaderContentType, ContentTypeJson)
+	if err := WriteResponse(res, http.StatusAccepted, sampleData); err != nil {
+		t.Fatal(err)
+	}
+	if res.Size() != 0 || res.Header().Get(HeaderContentType) != "" {
+		t.Errorf("expected configured bodyless status to have no body or content type")
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	res := &responseWriter{}
+	res.init(rec)
+	res.Header().Set(HeaderContentType, ContentTypeJson)
+
+	WriteStatus(res, http.StatusAccepted)
+	if !res.Written() || res.Status() != http.StatusAccepted {
+		t.Errorf("expected written status 202, got %d", res.Status())
+	}
+	if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+		t.Errorf("expected 202 w/o body, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get(HeaderContentType); ct != "" {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+
+	// Once written, the status can't change
+	WriteStatus(res, http.StatusNotModified)
+	if res.Status() != http.StatusAccepted {
+		t.Errorf("expected status to remain 202, got %d", res.Status())
+	}
+}
+
+type bulkyResource struct{}
+
+func (r *bulkyResource) Get(req *http.Request) (int, interface{}) {
+	return http.StatusOK, strings.Repeat("x", 3*responseChunkSize)
+}
+
+// cancelingRecorder cancels the request's context after its first write, as
+// if the client disconnected mid-response.
+type cancelingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel func()
+}
+
+func (rw *cancelingRecorder) Write(b []byte) (int, error) {
+	n, err := rw.ResponseRecorder.Write(b)
+	rw.cancel()
+	return n, err
+}
+
+func TestWriteResponseCanceled(t *testing.T) {
+	s := newTestService(t, nil)
+	var status int
+	s.AddErrorHandler(func(ctx context.Context, st int, rw http.ResponseWriter, req *http.Request) {
+		status = st
+	})
+	if err := s.AddResource(1, "/bulky", &bulkyResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", "/bulky", nil)
+	rw := &cancelingRecorder{httptest.NewRecorder(), cancel}
+	s.ServeHTTP(rw, req.WithContext(ctx))
+	if n := rw.Body.Len(); n == 0 || n >= 3*responseChunkSize {
+		t.Errorf("expected the body to be cut short, got %d bytes", n)
+	}
+	if status != http.StatusTeapot {
+		t.Errorf("expected canceled response to be marked 418, got %d", status)
+	}
+
+	// Responses to requests canceled before the response is written are
+	// discarded entirely
+	res := &responseWriter{}
+	res.init(httptest.NewRecorder())
+	res.Header().Set(HeaderContentType, ContentTypeJson)
+	res.ctx = ctx
+	if err := WriteResponse(res, http.StatusOK, "late"); err != ErrResponseCanceled {
+		t.Errorf("expected ErrResponseCanceled, got %v", err)
+	}
+	if res.Written() {
+		t.Error("expected nothing to be written")
+	}
+}
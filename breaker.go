@@ -0,0 +1,206 @@
+package luddite
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitHalfOpen = "half_open"
+	CircuitOpen     = "open"
+
+	defaultCircuitWindow           = 10 * time.Second
+	defaultCircuitMinRequests      = 10
+	defaultCircuitFailureThreshold = 0.5
+	defaultCircuitOpenDuration     = 30 * time.Second
+)
+
+var (
+	circuitBreakerStates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "luddite",
+		Subsystem: "circuit_breaker",
+		Name:      "state",
+		Help:      "Circuit breaker state: 0 (closed), 1 (half open) or 2 (open).",
+	}, []string{"breaker"})
+
+	circuitBreakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "circuit_breaker",
+		Name:      "transitions_total",
+		Help:      "Number of circuit breaker state transitions by new state.",
+	}, []string{"breaker", "state"})
+
+	circuitStateValues = map[string]float64{
+		CircuitClosed:   0,
+		CircuitHalfOpen: 1,
+		CircuitOpen:     2,
+	}
+)
+
+// CircuitBreakerOptions configures a CircuitBreaker.
+type CircuitBreakerOptions struct {
+	// Name identifies the breaker in metrics, trace annotations and errors,
+	// e.g. the name of the protected backend.
+	Name string
+	// Window sets the period over which failure rates are measured. Defaults
+	// to 10s.
+	Window time.Duration
+	// MinRequests sets the number of calls in a window below which the
+	// breaker never opens. Defaults to 10.
+	MinRequests int
+	// FailureThreshold sets the failure rate, between 0 and 1, above which
+	// the breaker opens. Defaults to 0.5.
+	FailureThreshold float64
+	// OpenDuration sets how long the breaker stays open before letting a
+	// trial call through. Defaults to 30s.
+	OpenDuration time.Duration
+	// Clock sets the clock used to measure windows and open durations.
+	// Defaults to the real clock.
+	Clock Clock
+}
+
+// CircuitBreaker protects a downstream dependency by failing calls fast while
+// the dependency is unhealthy. Once the failure rate of calls in a window
+// exceeds a threshold the breaker opens and rejects calls. After a while it
+// lets a single trial call through: the breaker closes if the call succeeds
+// and opens again otherwise.
+//
+// Breaker states and transitions are exposed as metrics by services with
+// metrics enabled, and transitions annotate the trace span of the call that
+// caused them.
+type CircuitBreaker struct {
+	opts     CircuitBreakerOptions
+	mu       sync.Mutex
+	state    string
+	start    time.Time
+	calls    int
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker, applying defaults to
+// unset options.
+func NewCircuitBreaker(opts CircuitBreakerOptions) *CircuitBreaker {
+	if opts.Window <= 0 {
+		opts.Window = defaultCircuitWindow
+	}
+	if opts.MinRequests < 1 {
+		opts.MinRequests = defaultCircuitMinRequests
+	}
+	if opts.FailureThreshold <= 0 || opts.FailureThreshold > 1 {
+		opts.FailureThreshold = defaultCircuitFailureThreshold
+	}
+	if opts.OpenDuration <= 0 {
+		opts.OpenDuration = defaultCircuitOpenDuration
+	}
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
+
+	circuitBreakerStates.WithLabelValues(opts.Name).Set(circuitStateValues[CircuitClosed])
+
+	return &CircuitBreaker{opts: opts, state: CircuitClosed, start: opts.Clock.Now()}
+}
+
+// State returns the breaker's current state: CircuitClosed, CircuitHalfOpen
+// or CircuitOpen.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && b.opts.Clock.Since(b.openedAt) >= b.opts.OpenDuration {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// Do calls fn unless the breaker is open, recording whether it failed. While
+// the breaker is open Do returns an EcodeServiceUnavailable error, which
+// WriteResponse writes as a 503 response, without calling fn. Otherwise it
+// returns fn's error. If fn panics the call is recorded as a failure before
+// the panic continues.
+func (b *CircuitBreaker) Do(ctx context.Context, fn func() error) (err error) {
+	if !b.allow(ctx) {
+		ContextTraceAnnotate(ctx)["circuit_breaker."+b.opts.Name] = CircuitOpen
+		return NewError(nil, EcodeServiceUnavailable, b.opts.Name)
+	}
+	success := false
+	defer func() {
+		// NB: Otherwise a panicking trial call would leave the breaker half
+		// open and rejecting calls forever
+		b.record(ctx, success)
+	}()
+	err = fn()
+	success = err == nil
+	return
+}
+
+func (b *CircuitBreaker) allow(ctx context.Context) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if b.opts.Clock.Since(b.openedAt) < b.opts.OpenDuration {
+			return false
+		}
+		b.transition(ctx, CircuitHalfOpen)
+		b.trial = true
+		return true
+	case CircuitHalfOpen:
+		// Only one trial call at a time
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+func (b *CircuitBreaker) record(ctx context.Context, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.trial = false
+		if success {
+			b.transition(ctx, CircuitClosed)
+		} else {
+			b.transition(ctx, CircuitOpen)
+		}
+		return
+	}
+	if b.state != CircuitClosed {
+		return
+	}
+
+	now := b.opts.Clock.Now()
+	if now.Sub(b.start) >= b.opts.Window {
+		b.start, b.calls, b.failures = now, 0, 0
+	}
+	b.calls++
+	if !success {
+		b.failures++
+	}
+	if b.calls >= b.opts.MinRequests && float64(b.failures)/float64(b.calls) > b.opts.FailureThreshold {
+		b.transition(ctx, CircuitOpen)
+	}
+}
+
+// transition changes the breaker's state. The caller must hold the lock.
+func (b *CircuitBreaker) transition(ctx context.Context, state string) {
+	b.state = state
+	switch state {
+	case CircuitOpen:
+		b.openedAt = b.opts.Clock.Now()
+	case CircuitClosed:
+		b.start, b.calls, b.failures = b.opts.Clock.Now(), 0, 0
+	}
+	circuitBreakerStates.WithLabelValues(b.opts.Name).Set(circuitStateValues[state])
+	circuitBreakerTransitions.WithLabelValues(b.opts.Name, state).Inc()
+	ContextTraceAnnotate(ctx)["circuit_breaker."+b.opts.Name] = state
+}
@@ -0,0 +1,126 @@
+package luddite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(CircuitBreakerOptions{
+		Name:             "backend",
+		MinRequests:      4,
+		FailureThreshold: 0.5,
+		OpenDuration:     50 * time.Millisecond,
+	})
+	ctx := context.Background()
+	failed := errors.New("backend failed")
+	fail := func() error { return failed }
+	succeed := func() error { return nil }
+
+	// Failure rates at or below the threshold keep the breaker closed
+	for _, fn := range []func() error{succeed, fail, succeed, fail} {
+		_ = b.Do(ctx, fn)
+	}
+	if state := b.State(); state != CircuitClosed {
+		t.Fatalf("expected closed breaker, got %s", state)
+	}
+
+	// Exceeding the threshold opens the breaker
+	if err := b.Do(ctx, fail); err != failed {
+		t.Errorf("expected backend error, got %v", err)
+	}
+	if state := b.State(); state != CircuitOpen {
+		t.Fatalf("expected open breaker, got %s", state)
+	}
+	called := false
+	err := b.Do(ctx, func() error { called = true; return nil })
+	if called {
+		t.Error("open breaker called function")
+	}
+	if e, ok := err.(*Error); !ok || e.Code != EcodeServiceUnavailable {
+		t.Errorf("expected %s error, got %v", EcodeServiceUnavailable, err)
+	}
+	if v := testutil.ToFloat64(circuitBreakerStates.WithLabelValues("backend")); v != 2 {
+		t.Errorf("expected state metric 2, got %v", v)
+	}
+
+	// A failed trial call reopens the breaker
+	time.Sleep(60 * time.Millisecond)
+	if state := b.State(); state != CircuitHalfOpen {
+		t.Fatalf("expected half open breaker, got %s", state)
+	}
+	_ = b.Do(ctx, fail)
+	if state := b.State(); state != CircuitOpen {
+		t.Fatalf("expected reopened breaker, got %s", state)
+	}
+
+	// A successful trial call closes the breaker
+	time.Sleep(60 * time.Millisecond)
+	if err = b.Do(ctx, succeed); err != nil {
+		t.Errorf("expected trial call to succeed, got %v", err)
+	}
+	if state := b.State(); state != CircuitClosed {
+		t.Fatalf("expected closed breaker, got %s", state)
+	}
+	if v := testutil.ToFloat64(circuitBreakerTransitions.WithLabelValues("backend", CircuitOpen)); v != 2 {
+		t.Errorf("expected 2 transitions to open, got %v", v)
+	}
+}
+
+func TestCircuitBreakerTrialPanic(t *testing.T) {
+	clock := newFakeClock()
+	b := NewCircuitBreaker(CircuitBreakerOptions{
+		Name:        "panicky",
+		MinRequests: 1,
+		Clock:       clock,
+	})
+	ctx := context.Background()
+	_ = b.Do(ctx, func() error { return errors.New("backend failed") })
+	if state := b.State(); state != CircuitOpen {
+		t.Fatalf("expected open breaker, got %s", state)
+	}
+
+	// A panicking trial call reopens the breaker
+	clock.Advance(defaultCircuitOpenDuration)
+	func() {
+		defer func() {
+			if rcv := recover(); rcv == nil {
+				t.Error("expected the trial call's panic to continue")
+			}
+		}()
+		_ = b.Do(ctx, func() error { panic("zz") })
+	}()
+	if state := b.State(); state != CircuitOpen {
+		t.Fatalf("expected reopened breaker, got %s", state)
+	}
+
+	// ...and a later trial call is let through
+	clock.Advance(defaultCircuitOpenDuration)
+	called := false
+	if err := b.Do(ctx, func() error { called = true; return nil }); err != nil || !called {
+		t.Errorf("expected trial call to be made, got %v", err)
+	}
+	if state := b.State(); state != CircuitClosed {
+		t.Errorf("expected closed breaker, got %s", state)
+	}
+}
+
+func TestCircuitBreakerMetricsRegistration(t *testing.T) {
+	prometheus.Unregister(circuitBreakerStates)
+	NewCircuitBreaker(CircuitBreakerOptions{Name: "unregistered"})
+	if prometheus.Unregister(circuitBreakerStates) {
+		t.Error("expected breaker metrics not to be registered by breakers")
+	}
+
+	newTestService(t, func(config *ServiceConfig) {
+		config.Metrics.Enabled = true
+	})
+	if !prometheus.Unregister(circuitBreakerStates) {
+		t.Error("expected breaker metrics to be registered by services with metrics enabled")
+	}
+}
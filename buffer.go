@@ -0,0 +1,60 @@
+package luddite
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// bufferedBody is a request body that has been read into memory.
+type bufferedBody struct {
+	*bytes.Reader
+	b []byte
+}
+
+func (*bufferedBody) Close() error {
+	return nil
+}
+
+// BufferRequestBody reads a request's body into memory and replaces req.Body
+// with a reader positioned at the start of the buffered bytes, so that several
+// consumers (e.g. signature verification middleware, schema validation and the
+// handler) can each read the whole body. It may be called any number of
+// times: later calls return the same bytes and rewind req.Body.
+//
+// Bodies larger than the service's Limits.MaxRequestBodyBytes are rejected
+// with an EcodeRequestTooLarge error, which WriteResponse writes as a 413
+// response.
+func BufferRequestBody(req *http.Request) ([]byte, error) {
+	if bb, ok := req.Body.(*bufferedBody); ok {
+		req.Body = &bufferedBody{bytes.NewReader(bb.b), bb.b}
+		return bb.b, nil
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	var (
+		r   io.Reader = req.Body
+		max int64
+	)
+	if s := ContextService(req.Context()); s != nil {
+		max = s.config.Limits.MaxRequestBodyBytes
+	}
+	if max > 0 {
+		r = io.LimitReader(r, max+1)
+	}
+	b, err := ioutil.ReadAll(r)
+	_ = req.Body.Close()
+	// NB: ServeHTTP also caps the body, in which case reading beyond the limit
+	// fails instead of returning the extra byte
+	if max > 0 && (int64(len(b)) > max || err != nil && int64(len(b)) == max) {
+		return nil, NewError(nil, EcodeRequestTooLarge, max)
+	}
+	if err != nil {
+		return nil, NewError(nil, EcodeDeserializationFailed, err)
+	}
+	req.Body = &bufferedBody{bytes.NewReader(b), b}
+	return b, nil
+}
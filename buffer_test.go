@@ -0,0 +1,62 @@
+package luddite
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBufferRequestBody(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Limits.MaxRequestBodyBytes = 32
+	})
+	var signed string
+	s.AddHandler(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// A middleware consumer, e.g. signature verification
+		b, err := BufferRequestBody(req)
+		if err != nil {
+			_ = WriteResponse(rw, 0, err)
+			return
+		}
+		signed = string(b)
+
+		// Consumers may buffer again and read from the start
+		if b, _ = BufferRequestBody(req); string(b) != signed {
+			t.Errorf("expected same buffered body, got %s", b)
+		}
+		b, _ = ioutil.ReadAll(req.Body)
+		if string(b) != signed {
+			t.Errorf("expected rewound body, got %s", b)
+		}
+		_, _ = BufferRequestBody(req)
+	}))
+	if err := s.AddResource(1, "/gadgets", &gadgetResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/gadgets", strings.NewReader(body))
+		req.Header.Set(HeaderContentType, ContentTypeJson)
+		req.Header.Set(HeaderAccept, ContentTypeJson)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	// The handler still sees the whole body
+	body := `{"name":"foo"}`
+	rw := serve(body)
+	if rw.Code != http.StatusOK || !strings.Contains(rw.Body.String(), `"foo"`) {
+		t.Errorf("expected 200/OK with decoded body, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if signed != body {
+		t.Errorf("expected middleware to read body, got %s", signed)
+	}
+
+	rw = serve(`{"name":"` + strings.Repeat("x", 32) + `"}`)
+	if rw.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rw.Body.String(), EcodeRequestTooLarge) {
+		t.Errorf("expected 413/Request Entity Too Large, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
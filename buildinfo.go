@@ -0,0 +1,46 @@
+package luddite
+
+import (
+	"encoding/xml"
+	"net/http"
+	"runtime"
+)
+
+// Build metadata reported by the build info endpoint. These are intended to be
+// set by the embedding binary at link time, e.g.:
+//
+//	go build -ldflags "-X github.com/SpirentOrion/luddite.v2/v2.BuildVersion=1.2.3"
+var (
+	BuildVersion string
+	BuildCommit  string
+	BuildTime    string
+)
+
+// BuildInfo is a transfer object that describes a service's build. It is
+// served in response to `GET` requests on the service's build info path.
+type BuildInfo struct {
+	XMLName       xml.Name `json:"-" xml:"build_info"`
+	Version       string   `json:"version" xml:"version"`
+	Commit        string   `json:"commit" xml:"commit"`
+	BuildTime     string   `json:"build_time" xml:"build_time"`
+	GoVersion     string   `json:"go_version" xml:"go_version"`
+	MinApiVersion int      `json:"min_api_version" xml:"min_api_version"`
+	MaxApiVersion int      `json:"max_api_version" xml:"max_api_version"`
+}
+
+func (s *Service) buildInfo() *BuildInfo {
+	return &BuildInfo{
+		Version:       BuildVersion,
+		Commit:        BuildCommit,
+		BuildTime:     BuildTime,
+		GoVersion:     runtime.Version(),
+		MinApiVersion: s.config.Version.Min,
+		MaxApiVersion: s.config.Version.Max,
+	}
+}
+
+func (s *Service) addBuildInfoRoute() {
+	s.addRoute(s.globalRouter, http.MethodGet, s.config.BuildInfo.URIPath, func(rw http.ResponseWriter, req *http.Request) {
+		_ = WriteResponse(rw, http.StatusOK, s.buildInfo())
+	})
+}
@@ -0,0 +1,39 @@
+package luddite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Version.Max = 3
+		config.BuildInfo.Enabled = true
+	})
+	s.addBuildInfoRoute()
+
+	BuildVersion, BuildCommit, BuildTime = "1.2.3", "abc123", "2020-09-01T00:00:00Z"
+	defer func() {
+		BuildVersion, BuildCommit, BuildTime = "", "", ""
+	}()
+
+	req, _ := http.NewRequest("GET", "/version", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200/OK, got %d", rw.Code)
+	}
+
+	info := new(BuildInfo)
+	if err := json.Unmarshal(rw.Body.Bytes(), info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "1.2.3" || info.Commit != "abc123" || info.BuildTime != "2020-09-01T00:00:00Z" {
+		t.Errorf("unexpected build metadata: %+v", info)
+	}
+	if info.MinApiVersion != 1 || info.MaxApiVersion != 3 {
+		t.Errorf("unexpected API version range: %d-%d", info.MinApiVersion, info.MaxApiVersion)
+	}
+}
@@ -0,0 +1,56 @@
+package luddite
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachePolicy describes the Cache-Control directives that apply to a
+// resource's successful GET responses.
+type CachePolicy struct {
+	// MaxAge sets how long a response may be cached.
+	MaxAge time.Duration
+	// Private, when true, restricts caching to the client (i.e. no shared caches).
+	Private bool
+	// NoStore, when true, prevents caching altogether. MaxAge and Private are ignored.
+	NoStore bool
+}
+
+// String formats the policy as a Cache-Control header value.
+func (p CachePolicy) String() string {
+	if p.NoStore {
+		return "no-store"
+	}
+	directives := make([]string, 0, 2)
+	if p.Private {
+		directives = append(directives, "private")
+	} else {
+		directives = append(directives, "public")
+	}
+	directives = append(directives, "max-age="+strconv.Itoa(int(p.MaxAge/time.Second)))
+	return strings.Join(directives, ", ")
+}
+
+// CachePolicyProvider is implemented by resources that declare their own cache
+// policy. Luddite applies the policy to the resource's successful GET
+// responses. Successful responses to mutating requests are marked "no-store".
+type CachePolicyProvider interface {
+	// CachePolicy returns the resource's cache policy.
+	CachePolicy() CachePolicy
+}
+
+// setCacheControl sets the Cache-Control header for a resource's response
+// unless the resource handler has already set one.
+func setCacheControl(rw http.ResponseWriter, r interface{}, status int, mutating bool) {
+	p, ok := r.(CachePolicyProvider)
+	if !ok || status/100 != 2 || rw.Header().Get(HeaderCacheControl) != "" {
+		return
+	}
+	if mutating {
+		rw.Header().Set(HeaderCacheControl, CachePolicy{NoStore: true}.String())
+	} else {
+		rw.Header().Set(HeaderCacheControl, p.CachePolicy().String())
+	}
+}
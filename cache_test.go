@@ -0,0 +1,52 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type cachedResource struct{}
+
+func (r *cachedResource) CachePolicy() CachePolicy {
+	return CachePolicy{MaxAge: time.Minute}
+}
+
+func TestCachePolicyString(t *testing.T) {
+	if s := (CachePolicy{MaxAge: time.Minute}).String(); s != "public, max-age=60" {
+		t.Errorf("unexpected Cache-Control value: %s", s)
+	}
+	if s := (CachePolicy{MaxAge: 5 * time.Second, Private: true}).String(); s != "private, max-age=5" {
+		t.Errorf("unexpected Cache-Control value: %s", s)
+	}
+	if s := (CachePolicy{MaxAge: time.Minute, NoStore: true}).String(); s != "no-store" {
+		t.Errorf("unexpected Cache-Control value: %s", s)
+	}
+}
+
+func TestSetCacheControl(t *testing.T) {
+	rw := httptest.NewRecorder()
+	setCacheControl(rw, &cachedResource{}, http.StatusOK, false)
+	if cc := rw.Header().Get(HeaderCacheControl); cc != "public, max-age=60" {
+		t.Errorf("unexpected Cache-Control value for GET: %s", cc)
+	}
+
+	rw = httptest.NewRecorder()
+	setCacheControl(rw, &cachedResource{}, http.StatusCreated, true)
+	if cc := rw.Header().Get(HeaderCacheControl); cc != "no-store" {
+		t.Errorf("unexpected Cache-Control value for POST: %s", cc)
+	}
+
+	rw = httptest.NewRecorder()
+	setCacheControl(rw, &cachedResource{}, http.StatusNotFound, false)
+	if cc, ok := rw.Header()[HeaderCacheControl]; ok {
+		t.Errorf("unexpected Cache-Control value for error: %s", cc)
+	}
+
+	rw = httptest.NewRecorder()
+	setCacheControl(rw, struct{}{}, http.StatusOK, false)
+	if cc, ok := rw.Header()[HeaderCacheControl]; ok {
+		t.Errorf("unexpected Cache-Control value for resource without a policy: %s", cc)
+	}
+}
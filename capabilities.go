@@ -0,0 +1,86 @@
+package luddite
+
+import (
+	"encoding/xml"
+	"net/http"
+	"path"
+)
+
+// Capabilities is a transfer object that describes a service to clients such
+// as API gateways. It is served in response to `OPTIONS` requests on the
+// service's capabilities path.
+type Capabilities struct {
+	XMLName       xml.Name               `json:"-" xml:"capabilities"`
+	MinApiVersion int                    `json:"min_api_version" xml:"min_api_version"`
+	MaxApiVersion int                    `json:"max_api_version" xml:"max_api_version"`
+	Features      []string               `json:"features" xml:"features>feature"`
+	Resources     []CapabilitiesResource `json:"resources" xml:"resources>resource"`
+}
+
+// CapabilitiesResource describes a resource registered with AddResource.
+type CapabilitiesResource struct {
+	ApiVersion int    `json:"api_version" xml:"api_version"`
+	Path       string `json:"path" xml:"path"`
+}
+
+type resourceRegistration struct {
+	version       int
+	basePath      string
+	validation    *resourceValidation
+	limiter       *resourceLimiter
+	rateLimiter   *resourceRateLimiter
+	describer     OpenAPIDescriber
+	params        *resourceParams
+	accepted      *resourceAccepted
+	continuer     ContinueChecker
+	middleware    []http.Handler
+	unknownFields UnknownFieldsPolicy
+	autoETag      AutoETagPolicy
+	next          *resourceRegistration // at the same base path
+}
+
+func (s *Service) capabilities() *Capabilities {
+	config := s.config
+	c := &Capabilities{
+		MinApiVersion: config.Version.Min,
+		MaxApiVersion: config.Version.Max,
+		Features:      make([]string, 0, 7),
+		Resources:     make([]CapabilitiesResource, 0, len(s.resources)),
+	}
+
+	if config.BuildInfo.Enabled {
+		c.Features = append(c.Features, "build_info")
+	}
+	if config.CORS.Enabled {
+		c.Features = append(c.Features, "cors")
+	}
+	if config.Metrics.Enabled {
+		c.Features = append(c.Features, "metrics")
+	}
+	if config.OpenAPI.Enabled {
+		c.Features = append(c.Features, "openapi")
+	}
+	if config.Profiler.Enabled {
+		c.Features = append(c.Features, "profiler")
+	}
+	if config.Schema.Enabled {
+		c.Features = append(c.Features, "schema")
+	}
+	if s.tracer != nil {
+		c.Features = append(c.Features, "trace")
+	}
+
+	for _, r := range s.resources {
+		c.Resources = append(c.Resources, CapabilitiesResource{
+			ApiVersion: r.version,
+			Path:       path.Join("/", config.Prefix, r.basePath),
+		})
+	}
+	return c
+}
+
+func (s *Service) addCapabilitiesRoute() {
+	s.addRoute(s.globalRouter, http.MethodOptions, s.config.Capabilities.URIPath, func(rw http.ResponseWriter, req *http.Request) {
+		_ = WriteResponse(rw, http.StatusOK, s.capabilities())
+	})
+}
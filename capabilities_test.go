@@ -0,0 +1,75 @@
+package luddite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Prefix = "/api"
+		config.Version.Max = 2
+		config.Metrics.Enabled = true
+		config.Capabilities.Enabled = true
+	})
+	if err := s.AddResource(2, "/widgets", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	s.addCapabilitiesRoute()
+
+	req, _ := http.NewRequest("OPTIONS", "/api/", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200/OK, got %d", rw.Code)
+	}
+
+	c := new(Capabilities)
+	if err := json.Unmarshal(rw.Body.Bytes(), c); err != nil {
+		t.Fatal(err)
+	}
+	if c.MinApiVersion != 1 || c.MaxApiVersion != 2 {
+		t.Errorf("unexpected API version range: %d-%d", c.MinApiVersion, c.MaxApiVersion)
+	}
+	if len(c.Features) != 1 || c.Features[0] != "metrics" {
+		t.Errorf("unexpected features: %v", c.Features)
+	}
+	if len(c.Resources) != 1 || c.Resources[0].ApiVersion != 2 || c.Resources[0].Path != "/api/widgets" {
+		t.Errorf("unexpected resources: %v", c.Resources)
+	}
+}
+
+func TestCapabilitiesWithCORS(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Capabilities.Enabled = true
+		config.CORS.Enabled = true
+		config.CORS.AllowedOrigins = []string{"https://app.example.com"}
+	})
+	s.addCapabilitiesRoute()
+	s.cors, _ = newCORSPolicy(s.config) // as Run would
+
+	// Cross-origin OPTIONS requests that aren't preflights are routed
+	req, _ := http.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set(HeaderOrigin, "https://app.example.com")
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK || rw.Body.Len() == 0 {
+		t.Errorf("expected capabilities document, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if origin := rw.Header().Get("Access-Control-Allow-Origin"); origin != "https://app.example.com" {
+		t.Errorf("expected CORS headers, got origin %q", origin)
+	}
+
+	// Preflight requests end with the CORS response
+	req.Header.Set(HeaderAccessControlRequestMethod, "GET")
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Body.Len() != 0 {
+		t.Errorf("expected preflight response w/o body, got %s", rw.Body.String())
+	}
+	if methods := rw.Header().Get("Access-Control-Allow-Methods"); methods == "" {
+		t.Error("expected preflight response to allow methods")
+	}
+}
@@ -0,0 +1,207 @@
+package luddite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redactedHeaderValue = "REDACTED"
+
+var defaultCaptureRedactedHeaders = []string{
+	HeaderAuthorization,
+	HeaderApiKey,
+	"Cookie",
+	"Proxy-Authorization",
+}
+
+var defaultCaptureRedactedQueryParams = []string{
+	"access_token",
+	"api_key",
+}
+
+// CapturedRequest is a request recorded by the request capture debug tool.
+// Captured requests are appended to the capture file as JSON lines. The bodies
+// of requests that expect 100 Continue aren't captured, since reading them
+// would make the client send them before the service decides whether to
+// accept them.
+type CapturedRequest struct {
+	Time      time.Time   `json:"time"`
+	RequestId string      `json:"request_id"`
+	Method    string      `json:"method"`
+	URI       string      `json:"uri"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+type requestCapturer struct {
+	mu            sync.Mutex
+	f             *os.File
+	bodyLimit     int64
+	redacted      map[string]bool
+	redactedQuery map[string]bool
+}
+
+func newRequestCapturer(path string, bodyLimit int, redactedHeaders, redactedQueryParams []string) (*requestCapturer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	c := &requestCapturer{
+		f:             f,
+		bodyLimit:     int64(bodyLimit),
+		redacted:      make(map[string]bool),
+		redactedQuery: make(map[string]bool),
+	}
+	for _, hdr := range defaultCaptureRedactedHeaders {
+		c.redacted[http.CanonicalHeaderKey(hdr)] = true
+	}
+	for _, hdr := range redactedHeaders {
+		c.redacted[http.CanonicalHeaderKey(hdr)] = true
+	}
+	for _, p := range defaultCaptureRedactedQueryParams {
+		c.redactedQuery[p] = true
+	}
+	for _, p := range redactedQueryParams {
+		c.redactedQuery[p] = true
+	}
+	return c, nil
+}
+
+// Close closes the capture file. Requests captured afterwards fail.
+func (c *requestCapturer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.f.Close()
+}
+
+// redactURI returns a request's URI with the values of redacted query
+// parameters replaced.
+func (c *requestCapturer) redactURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	query := u.Query()
+	redacted := false
+	for p, v := range query {
+		if c.redactedQuery[p] {
+			for i := range v {
+				v[i] = redactedHeaderValue
+			}
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.RequestURI()
+	}
+	r := *u
+	r.RawQuery = query.Encode()
+	return r.RequestURI()
+}
+
+// capture records a request received at a given time. Up to the body limit of
+// the request body is read and then restored so that handlers see the complete
+// body, unless the client is waiting for 100 Continue.
+func (c *requestCapturer) capture(req *http.Request, requestId string, t time.Time) error {
+	cr := &CapturedRequest{
+		Time:      t.UTC(),
+		RequestId: requestId,
+		Method:    req.Method,
+		URI:       c.redactURI(req.URL),
+		Header:    make(http.Header, len(req.Header)),
+	}
+	for k, v := range req.Header {
+		if c.redacted[k] {
+			cr.Header[k] = []string{redactedHeaderValue}
+		} else {
+			cr.Header[k] = v
+		}
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && c.bodyLimit > 0 && !expectsContinue(req) {
+		body, err := ioutil.ReadAll(io.LimitReader(req.Body, c.bodyLimit+1))
+		req.Body = &capturedBody{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+		if err != nil {
+			return err
+		}
+		if int64(len(body)) > c.bodyLimit {
+			body = body[:c.bodyLimit]
+			cr.Truncated = true
+		}
+		cr.Body = body
+	}
+
+	buf, err := json.Marshal(cr)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.f.Write(append(buf, '\n'))
+	return err
+}
+
+type capturedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// ReplayRequests reads requests captured using the Debug.CaptureRequestsPath
+// config and sends them, in order, to a target base URL such as
+// "http://localhost:8000". Redacted headers are sent as captured, so callers
+// that need credentials should supply them with a custom client transport.
+// Truncated bodies are sent truncated. It returns the number of requests sent.
+//
+// ReplayRequests is a debugging tool, intended to reproduce issues against a
+// fixed version of a service in staging.
+func ReplayRequests(path string, target string) (int, error) {
+	return replayRequests(http.DefaultClient, path, target)
+}
+
+func replayRequests(client *http.Client, path string, target string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	target = strings.TrimSuffix(target, "/")
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	n := 0
+	for scanner.Scan() {
+		cr := new(CapturedRequest)
+		if err = json.Unmarshal(scanner.Bytes(), cr); err != nil {
+			return n, err
+		}
+
+		req, err := http.NewRequest(cr.Method, target+cr.URI, bytes.NewReader(cr.Body))
+		if err != nil {
+			return n, err
+		}
+		for k, v := range cr.Header {
+			if k == HeaderContentLength {
+				continue
+			}
+			req.Header[k] = v
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return n, err
+		}
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+		n++
+	}
+	return n, scanner.Err()
+}
@@ -0,0 +1,148 @@
+package luddite
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type echoResource struct {
+	body string
+}
+
+func (r *echoResource) New() interface{} {
+	return &map[string]string{}
+}
+
+func (r *echoResource) Id(value interface{}) string {
+	return ""
+}
+
+func (r *echoResource) Create(req *http.Request, value interface{}) (int, interface{}) {
+	b, _ := json.Marshal(value)
+	r.body = string(b)
+	return http.StatusOK, value
+}
+
+func TestCaptureAndReplayRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "luddite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	capturePath := filepath.Join(dir, "requests.jsonl")
+
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Debug.CaptureRequestsPath = capturePath
+		config.Debug.CaptureBodyLimit = 8
+		config.Debug.CaptureRedactHeaders = []string{"X-Secret"}
+	})
+	r := &echoResource{}
+	if err = s.AddResource(1, "/echo", r); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"name":"widget"}`
+	req, _ := http.NewRequest("POST", "/echo?x=1", bytes.NewBufferString(body))
+	req.Header.Set(HeaderContentType, ContentTypeJson)
+	req.Header.Set(HeaderAuthorization, "Bearer token")
+	req.Header.Set("X-Secret", "shh")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if r.body != body {
+		t.Errorf("expected handler to see the full body, got %s", r.body)
+	}
+
+	buf, err := ioutil.ReadFile(capturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := new(CapturedRequest)
+	if err = json.Unmarshal(buf, cr); err != nil {
+		t.Fatal(err)
+	}
+	if cr.Method != "POST" || cr.URI != "/echo?x=1" || cr.RequestId == "" {
+		t.Errorf("unexpected captured request: %+v", cr)
+	}
+	if string(cr.Body) != body[:8] || !cr.Truncated {
+		t.Errorf("expected truncated body, got %q (truncated=%t)", cr.Body, cr.Truncated)
+	}
+	if cr.Header.Get(HeaderAuthorization) != redactedHeaderValue || cr.Header.Get("X-Secret") != redactedHeaderValue {
+		t.Errorf("expected sensitive headers to be redacted, got %v", cr.Header)
+	}
+	if strings.Contains(string(buf), "token") || strings.Contains(string(buf), "shh") {
+		t.Error("sensitive header values leaked into capture file")
+	}
+
+	var replayed []*http.Request
+	target := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		replayed = append(replayed, req)
+	}))
+	defer target.Close()
+
+	n, err := ReplayRequests(capturePath, target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(replayed) != 1 {
+		t.Fatalf("expected 1 replayed request, got %d", n)
+	}
+	if replayed[0].Method != "POST" || replayed[0].URL.RequestURI() != "/echo?x=1" || replayed[0].Header.Get(HeaderContentType) != ContentTypeJson {
+		t.Errorf("unexpected replayed request: %s %s %v", replayed[0].Method, replayed[0].URL, replayed[0].Header)
+	}
+}
+
+func TestCaptureRedactionAndContinue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "luddite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	capturePath := filepath.Join(dir, "requests.jsonl")
+
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Debug.CaptureRequestsPath = capturePath
+		config.Debug.CaptureRedactQueryParams = []string{"sig"}
+	})
+	r := &echoResource{}
+	if err = s.AddResource(1, "/echo", r); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bodies of requests that expect 100 Continue are left unread
+	body := `{"name":"widget"}`
+	req, _ := http.NewRequest("POST", "/echo?x=1&access_token=abc&sig=xyz", bytes.NewBufferString(body))
+	req.Header.Set(HeaderContentType, ContentTypeJson)
+	req.Header.Set(HeaderExpect, "100-continue")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if r.body != body {
+		t.Errorf("expected handler to see the full body, got %s", r.body)
+	}
+
+	buf, err := ioutil.ReadFile(capturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := new(CapturedRequest)
+	if err = json.Unmarshal(buf, cr); err != nil {
+		t.Fatal(err)
+	}
+	if cr.URI != "/echo?access_token=REDACTED&sig=REDACTED&x=1" {
+		t.Errorf("expected redacted query parameters, got %s", cr.URI)
+	}
+	if len(cr.Body) != 0 {
+		t.Errorf("expected body not to be captured, got %q", cr.Body)
+	}
+
+	// The capture file is closed on teardown
+	s.teardown(&http.Server{})
+	if err = s.capturer.capture(req, "1", time.Now()); err == nil {
+		t.Error("expected capture to fail after teardown")
+	}
+}
@@ -0,0 +1,87 @@
+package luddite
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AcceptQueryParam names the query parameter that selects a representation in
+// place of the Accept header, as in the alternatives of 300 responses.
+const AcceptQueryParam = "accept"
+
+// RepresentationLister is implemented by resources that offer several
+// representations and want clients to choose between them. When a `GET`
+// request's content negotiation is ambiguous (i.e. its Accept header is absent
+// or only `*/*`) and the resource is found, the service responds with `300
+// Multiple Choices` listing the representations instead of silently picking
+// the first. Each alternative's href selects its representation using the
+// AcceptQueryParam query parameter.
+type RepresentationLister interface {
+	// Representations returns the content types the resource can be served as.
+	Representations() []string
+}
+
+// MultipleChoices is a transfer object that is serialized as the body in 300
+// responses.
+type MultipleChoices struct {
+	XMLName xml.Name `json:"-" xml:"choices"`
+	Choices []Choice `json:"choices" xml:"choice"`
+}
+
+// Choice describes one of the alternative representations of a resource.
+type Choice struct {
+	ContentType string `json:"content_type" xml:"content_type"`
+	Href        string `json:"href" xml:"href"`
+}
+
+// isAmbiguousAccept returns true if an Accept header value doesn't express a
+// preference for any particular media type.
+func isAmbiguousAccept(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		if i := strings.IndexByte(mediaRange, ';'); i >= 0 {
+			mediaRange = mediaRange[:i]
+		}
+		if mediaRange = strings.TrimSpace(mediaRange); mediaRange != "" && mediaRange != "*/*" {
+			return false
+		}
+	}
+	return true
+}
+
+// writeMultipleChoices writes a 300 response listing the representations of a
+// resource when the request's content negotiation was ambiguous. It is called
+// once the resource handler has found the resource. Resources
+// implementing RepresentationLister opt in individually; otherwise the
+// Response.MultipleChoices config opts in all resources using the media types
+// that the service can serialize. It returns true if a response was written.
+func writeMultipleChoices(rw http.ResponseWriter, req *http.Request, r interface{}) bool {
+	d := contextHandlerDetails(req.Context())
+	if d == nil || !d.ambiguousAccept {
+		return false
+	}
+
+	var contentTypes []string
+	if x, ok := r.(RepresentationLister); ok {
+		contentTypes = x.Representations()
+	} else if d.s != nil && d.s.config.Response.MultipleChoices {
+		contentTypes = serializableContentTypes
+	}
+	if len(contentTypes) < 2 {
+		return false
+	}
+
+	choices := &MultipleChoices{Choices: make([]Choice, len(contentTypes))}
+	for i, ct := range contentTypes {
+		u := *req.URL
+		query := u.Query()
+		query.Set(AcceptQueryParam, ct)
+		u.RawQuery = query.Encode()
+		href := u.RequestURI()
+		choices.Choices[i] = Choice{ContentType: ct, Href: href}
+		rw.Header().Add(HeaderLink, fmt.Sprintf("<%s>; rel=\"alternate\"; type=%q", href, ct))
+	}
+	_ = WriteResponse(rw, http.StatusMultipleChoices, choices)
+	return true
+}
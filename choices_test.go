@@ -0,0 +1,113 @@
+package luddite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type report struct {
+	Total int `json:"total" xml:"total"`
+}
+
+type reportResource struct{}
+
+func (r *reportResource) Get(req *http.Request) (int, interface{}) {
+	return http.StatusOK, &report{Total: 1}
+}
+
+func (r *reportResource) Representations() []string {
+	return []string{ContentTypeJson, ContentTypeXml}
+}
+
+type reportCollection struct{}
+
+func (r *reportCollection) Representations() []string {
+	return []string{ContentTypeJson, ContentTypeXml}
+}
+
+func (r *reportCollection) Get(req *http.Request, id string) (int, interface{}) {
+	if id != "1" {
+		return http.StatusNotFound, nil
+	}
+	return http.StatusOK, &report{Total: 1}
+}
+
+func TestIsAmbiguousAccept(t *testing.T) {
+	tests := []struct {
+		accept    string
+		ambiguous bool
+	}{
+		{"", true},
+		{"*/*", true},
+		{"*/*;q=0.8", true},
+		{"application/json", false},
+		{"application/json, */*;q=0.1", false},
+		{"text/*", false},
+	}
+	for _, test := range tests {
+		if ambiguous := isAmbiguousAccept(test.accept); ambiguous != test.ambiguous {
+			t.Errorf("%q: expected ambiguous=%t", test.accept, test.ambiguous)
+		}
+	}
+}
+
+func TestMultipleChoices(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/report", &reportResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set(HeaderAccept, accept)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := serve("/report", "*/*")
+	if rw.Code != http.StatusMultipleChoices {
+		t.Fatalf("expected 300/Multiple Choices, got %d", rw.Code)
+	}
+	choices := new(MultipleChoices)
+	if err := json.Unmarshal(rw.Body.Bytes(), choices); err != nil {
+		t.Fatal(err)
+	}
+	if len(choices.Choices) != 2 || choices.Choices[1].ContentType != ContentTypeXml || choices.Choices[1].Href != "/report?accept=application%2Fxml" {
+		t.Errorf("unexpected choices: %+v", choices.Choices)
+	}
+	if links := rw.Header()[HeaderLink]; len(links) != 2 || links[0] != `</report?accept=application%2Fjson>; rel="alternate"; type="application/json"` {
+		t.Errorf("unexpected Link headers: %v", links)
+	}
+
+	if rw = serve("/report", ContentTypeXml); rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK for specific Accept, got %d", rw.Code)
+	}
+
+	// The alternatives' hrefs select their representations
+	rw = serve(choices.Choices[1].Href, "")
+	if rw.Code != http.StatusOK || rw.Header().Get(HeaderContentType) != ContentTypeXml {
+		t.Errorf("expected 200/OK with an XML body, got %d (%s)", rw.Code, rw.Header().Get(HeaderContentType))
+	}
+
+	// Missing resources aren't offered as choices
+	if err := s.AddResource(1, "/reports", &reportCollection{}); err != nil {
+		t.Fatal(err)
+	}
+	if rw = serve("/reports/1", "*/*"); rw.Code != http.StatusMultipleChoices {
+		t.Errorf("expected 300/Multiple Choices for existing report, got %d", rw.Code)
+	}
+	if rw = serve("/reports/2", "*/*"); rw.Code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found for missing report, got %d", rw.Code)
+	}
+
+	// Resources that don't opt in keep the silent default
+	if rw = serve("/ping", "*/*"); rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK for resource without representations, got %d", rw.Code)
+	}
+}
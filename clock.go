@@ -0,0 +1,57 @@
+package luddite
+
+import "time"
+
+// Clock tells the time and creates timers. Services use a real clock by
+// default; tests may inject a fake clock using Service.SetClock to control
+// latency measurements and timeouts.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Since returns the time elapsed since t.
+	Since(t time.Time) time.Duration
+	// NewTimer creates a timer that fires once d elapses.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single-use timer created by a Clock.
+type Timer interface {
+	// C returns the channel on which the timer's time is delivered.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the timer
+	// already fired or was stopped.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// SetClock allows a service to replace its clock, e.g. with a fake clock in
+// tests. The clock is used for request latencies, capture timestamps,
+// concurrency limit waits and shutdown timeouts. It should be set before the
+// service handles requests.
+func (s *Service) SetClock(clock Clock) {
+	if clock == nil {
+		clock = realClock{}
+	}
+	s.clock = clock
+}
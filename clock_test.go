@@ -0,0 +1,122 @@
+package luddite
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c        chan time.Time
+	deadline time.Time
+	stopped  bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: make(chan time.Time, 1), deadline: c.now.Add(d)}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward, firing timers whose deadlines pass.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if !t.stopped && !c.now.Before(t.deadline) {
+			t.stopped = true
+			t.c <- c.now
+		}
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	stopped := t.stopped
+	t.stopped = true
+	return !stopped
+}
+
+type slowResource struct {
+	clock *fakeClock
+}
+
+func (r *slowResource) Get(req *http.Request) (int, interface{}) {
+	r.clock.Advance(250 * time.Millisecond)
+	return http.StatusOK, "done"
+}
+
+func TestServiceClock(t *testing.T) {
+	s := newTestService(t, nil)
+	clock := newFakeClock()
+	s.SetClock(clock)
+	if err := s.AddResource(1, "/slow", &slowResource{clock: clock}); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	s.accessLogger.Out = out
+
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if entry := out.String(); !strings.Contains(entry, `"latency":"0.250000"`) {
+		t.Errorf("expected exact latency in access log entry, got %s", entry)
+	}
+}
+
+func TestResourceLimiterClock(t *testing.T) {
+	clock := newFakeClock()
+	l := newResourceLimiter(1, "/clocked", 1, time.Second)
+	if !l.acquire(context.Background(), clock) {
+		t.Fatal("expected first acquire to succeed")
+	}
+	defer l.release()
+
+	acquired := make(chan bool)
+	go func() { acquired <- l.acquire(context.Background(), clock) }()
+
+	// Wait for the second acquire's timer, then make it fire
+	for {
+		clock.mu.Lock()
+		n := len(clock.timers)
+		clock.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	if <-acquired {
+		t.Error("expected second acquire to time out")
+	}
+}
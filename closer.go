@@ -0,0 +1,77 @@
+package luddite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type orderedCloser struct {
+	order  int
+	closer io.Closer
+}
+
+// AddCloser registers a dependency, e.g. a database pool or message queue
+// connection, to be closed during graceful shutdown once the service's
+// listener is closed and in-flight requests have drained. Closers run in
+// ascending order, and in registration order for equal orders. Errors are
+// logged and don't prevent subsequent closers from running. Closers must be
+// registered before Run is called.
+func (s *Service) AddCloser(order int, c io.Closer) {
+	s.closers = append(s.closers, orderedCloser{order: order, closer: c})
+}
+
+// teardown drains the server's in-flight requests, runs closers, closes the
+// request capture file and then stops trace recording. All are bounded by the
+// configured teardown timeout; closers that haven't run by then are skipped.
+func (s *Service) teardown(server *http.Server) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := server.Shutdown(ctx); err != nil && err != context.Canceled {
+			s.defaultLogger.WithError(err).Warn("failed to drain requests")
+		}
+		s.runClosers(ctx)
+
+		if s.capturer != nil {
+			_ = s.capturer.Close()
+		}
+
+		// Record the spans of the requests and closers above last
+		if s.traceQueue != nil {
+			_ = s.traceQueue.Close()
+		}
+	}()
+
+	timer := s.clock.NewTimer(s.config.Shutdown.TeardownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C():
+		cancel()
+		s.defaultLogger.Warnf("shutdown teardown did not complete within %s", s.config.Shutdown.TeardownTimeout)
+	}
+}
+
+func (s *Service) runClosers(ctx context.Context) {
+	closers := make([]orderedCloser, len(s.closers))
+	copy(closers, s.closers)
+	sort.SliceStable(closers, func(i, j int) bool { return closers[i].order < closers[j].order })
+
+	for _, c := range closers {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.closer.Close(); err != nil {
+			s.defaultLogger.WithFields(log.Fields{
+				"order": c.order,
+			}).WithError(err).Error("failed to close dependency")
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package luddite
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func TestAddCloser(t *testing.T) {
+	s := newTestService(t, nil)
+	out := new(strings.Builder)
+	s.defaultLogger.Out = out
+
+	var closed []string
+	add := func(order int, name string, err error) {
+		s.AddCloser(order, closerFunc(func() error {
+			closed = append(closed, name)
+			return err
+		}))
+	}
+	add(2, "queue", nil)
+	add(1, "db", errors.New("boom"))
+	add(2, "cache", nil)
+	add(0, "workers", nil)
+
+	s.teardown(&http.Server{})
+	if actual := strings.Join(closed, ","); actual != "workers,db,queue,cache" {
+		t.Errorf("unexpected close order: %s", actual)
+	}
+	if !strings.Contains(out.String(), "boom") {
+		t.Errorf("expected closer error to be logged, got %s", out.String())
+	}
+}
+
+func TestAddCloserTimeout(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Shutdown.TeardownTimeout = time.Second
+	})
+	clock := newFakeClock()
+	s.SetClock(clock)
+	out := new(strings.Builder)
+	s.defaultLogger.Out = out
+
+	release := make(chan struct{})
+	defer close(release)
+	s.AddCloser(1, closerFunc(func() error {
+		<-release
+		return nil
+	}))
+	later := false
+	s.AddCloser(2, closerFunc(func() error {
+		later = true
+		return nil
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		s.teardown(&http.Server{})
+		close(done)
+	}()
+
+	// Wait for the teardown timer, then make it fire
+	for {
+		clock.mu.Lock()
+		n := len(clock.timers)
+		clock.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	<-done
+	if later {
+		t.Error("expected closers after the deadline to be skipped")
+	}
+	if !strings.Contains(out.String(), "did not complete") {
+		t.Errorf("expected teardown timeout to be logged, got %s", out.String())
+	}
+}
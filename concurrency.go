@@ -0,0 +1,103 @@
+package luddite
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	resourceConcurrentRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "luddite",
+		Subsystem: "resource",
+		Name:      "concurrent_requests",
+		Help:      "Number of requests executing in concurrency-limited resources.",
+	}, []string{"api_version", "resource"})
+
+	resourceConcurrencyRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "resource",
+		Name:      "concurrency_rejections_total",
+		Help:      "Number of requests rejected because a resource was at its concurrency limit.",
+	}, []string{"api_version", "resource"})
+)
+
+// ConcurrencyLimited may be implemented by resource handler types to cap the
+// number of their requests that execute concurrently, e.g. to protect a
+// backend with limited capacity. Requests over the limit wait up to the given
+// duration for a slot and are otherwise rejected with 503 Service Unavailable
+// and a Retry-After header.
+type ConcurrencyLimited interface {
+	ConcurrencyLimit() (max int, wait time.Duration)
+}
+
+type resourceLimiter struct {
+	sem        chan struct{}
+	wait       time.Duration
+	retryAfter string
+	active     prometheus.Gauge
+	rejections prometheus.Counter
+}
+
+func newResourceLimiter(version int, basePath string, max int, wait time.Duration) *resourceLimiter {
+	if max < 1 {
+		max = 1
+	}
+	labels := prometheus.Labels{"api_version": strconv.Itoa(version), "resource": basePath}
+	return &resourceLimiter{
+		sem:        make(chan struct{}, max),
+		wait:       wait,
+		retryAfter: strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))),
+		active:     resourceConcurrentRequests.With(labels),
+		rejections: resourceConcurrencyRejections.With(labels),
+	}
+}
+
+// acquire reserves an execution slot, waiting up to the limiter's wait
+// duration as measured by clock. It returns false if no slot became available.
+func (l *resourceLimiter) acquire(ctx context.Context, clock Clock) bool {
+	select {
+	case l.sem <- struct{}{}:
+		l.active.Inc()
+		return true
+	default:
+	}
+
+	if l.wait > 0 {
+		timer := clock.NewTimer(l.wait)
+		defer timer.Stop()
+		select {
+		case l.sem <- struct{}{}:
+			l.active.Inc()
+			return true
+		case <-timer.C():
+		case <-ctx.Done():
+		}
+	}
+	l.rejections.Inc()
+	return false
+}
+
+func (l *resourceLimiter) release() {
+	l.active.Dec()
+	<-l.sem
+}
+
+func (l *resourceLimiter) reject(rw http.ResponseWriter) {
+	rw.Header().Set(HeaderRetryAfter, l.retryAfter)
+	_ = WriteResponse(rw, ErrorStatus(EcodeResourceBusy), NewError(nil, EcodeResourceBusy))
+}
+
+// resourceLimiter returns the concurrency limiter for the resource that serves
+// the request, if any.
+func (d *handlerDetails) resourceLimiter() *resourceLimiter {
+	r := d.resource.find(func(r *resourceRegistration) bool { return r.limiter != nil })
+	if r == nil {
+		return nil
+	}
+	return r.limiter
+}
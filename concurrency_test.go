@@ -0,0 +1,118 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type reportsResource struct {
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (r *reportsResource) ConcurrencyLimit() (int, time.Duration) {
+	return 1, 200 * time.Millisecond
+}
+
+func (r *reportsResource) Get(req *http.Request) (int, interface{}) {
+	r.started <- struct{}{}
+	<-r.done
+	return http.StatusOK, "report"
+}
+
+func TestResourceConcurrencyLimit(t *testing.T) {
+	s := newTestService(t, nil)
+	reports := &reportsResource{started: make(chan struct{}), done: make(chan struct{})}
+	if err := s.AddResource(1, "/reports", reports); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	first := make(chan int)
+	go func() { first <- serve("/reports").Code }()
+	<-reports.started
+
+	gauge := resourceConcurrentRequests.WithLabelValues("1", "/reports")
+	if active := testutil.ToFloat64(gauge); active != 1 {
+		t.Errorf("expected 1 concurrent request, got %v", active)
+	}
+	rw := serve("/reports")
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503/Service Unavailable over the limit, got %d", rw.Code)
+	}
+	if retryAfter := rw.Header().Get(HeaderRetryAfter); retryAfter != "1" {
+		t.Errorf("expected Retry-After of 1, got %q", retryAfter)
+	}
+	if code := serve("/ping").Code; code != http.StatusOK {
+		t.Errorf("expected unlimited resource to be served, got %d", code)
+	}
+
+	reports.done <- struct{}{}
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", code)
+	}
+	if active := testutil.ToFloat64(gauge); active != 0 {
+		t.Errorf("expected no concurrent requests, got %v", active)
+	}
+
+	// Queued requests are served once a slot frees up
+	go func() { first <- serve("/reports").Code }()
+	<-reports.started
+	second := make(chan int)
+	go func() { second <- serve("/reports").Code }()
+	reports.done <- struct{}{}
+	<-reports.started
+	reports.done <- struct{}{}
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", code)
+	}
+	if code := <-second; code != http.StatusOK {
+		t.Errorf("expected queued request to be served, got %d", code)
+	}
+}
+
+func TestNestedResourceConcurrencyLimit(t *testing.T) {
+	s := newTestService(t, nil)
+	reports := &reportsResource{started: make(chan struct{}), done: make(chan struct{})}
+	if err := s.AddResource(1, "/a", reports); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/a/b", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := make(chan int)
+	go func() {
+		req, _ := http.NewRequest("GET", "/a", nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		first <- rw.Code
+	}()
+	<-reports.started
+
+	// The nested resource doesn't inherit its parent's limit
+	req, _ := http.NewRequest("GET", "/a/b", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Errorf("expected nested resource to be served, got %d", rw.Code)
+	}
+
+	reports.done <- struct{}{}
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", code)
+	}
+}
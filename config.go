@@ -3,14 +3,32 @@ package luddite
 import (
 	"errors"
 	"io/ioutil"
+	"mime"
+	"runtime"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 const (
-	defaultMetricsURIPath  = "/metrics"
-	defaultProfilerURIPath = "/debug/pprof"
-	maxStackSize           = 8 * 1024
+	defaultBuildInfoURIPath    = "/version"
+	defaultCapabilitiesURIPath = "/"
+	defaultHealthURIPath       = "/health/ready"
+	defaultDryRunQueryParam    = "dry_run"
+	defaultMetricsURIPath      = "/metrics"
+	defaultOpenAPIURIPath      = "/openapi.json"
+	defaultProfilerURIPath     = "/debug/pprof"
+	defaultJSONIndent          = "  "
+	defaultShutdownTimeout     = 30 * time.Second
+	defaultReadHeaderTimeout   = 10 * time.Second
+	defaultCaptureBodyLimit    = 64 * 1024
+	defaultMaxDecodeBytes      = 1 << 20
+	defaultIdleTimeout         = 2 * time.Minute
+	defaultWorkersWait         = time.Second
+	defaultTraceNodeBits       = 8
+	maxTraceNodeBits           = 16
+	maxStackSize               = 8 * 1024
 )
 
 var (
@@ -23,17 +41,86 @@ var (
 	// ErrMismatchedApiVersions occurs when a service's minimum API version > its maximum API version.
 	ErrMismatchedApiVersions = errors.New("service's maximum API version must be greater than or equal to the minimum API version")
 
+	// ErrInvalidErrorFormat occurs when a service's error format is neither "luddite", "problem" nor "jsonapi".
+	ErrInvalidErrorFormat = errors.New("service's error format must be either \"luddite\", \"problem\" or \"jsonapi\"")
+
+	// ErrInvalidCORSOrigin occurs when a service's per-origin CORS override doesn't name an exact origin.
+	ErrInvalidCORSOrigin = errors.New("service's per-origin CORS overrides must name exact origins without wildcards")
+
+	// ErrInvalidTraceNodeID occurs when a service's trace node ID doesn't fit in its node bits.
+	ErrInvalidTraceNodeID = errors.New("service's trace node ID must fit in its node bits (at most 16)")
+
+	// ErrInvalidTraceOverflowPolicy occurs when a service's trace overflow policy is neither "block" nor "drop".
+	ErrInvalidTraceOverflowPolicy = errors.New("service's trace overflow policy must be either \"block\" or \"drop\"")
+
+	// ErrInvalidTraceHighWater occurs when a service's trace high water mark is negative or exceeds its trace queue size.
+	ErrInvalidTraceHighWater = errors.New("service's trace high water mark must be between 0 and the trace queue size")
+
+	// ErrInvalidWorkers occurs when a service's worker pool size or wait is negative.
+	ErrInvalidWorkers = errors.New("service's worker pool size and wait must not be negative")
+
+	// ErrInvalidTimeFormat occurs when a service's JSON time format is not "rfc3339", "unix", "unixmilli" or a time layout.
+	ErrInvalidTimeFormat = errors.New("service's time format must be either \"rfc3339\", \"unix\", \"unixmilli\" or a time layout")
+
+	// ErrInvalidFieldNameStyle occurs when a service's JSON field name style is not "asis", "snake" or "camel".
+	ErrInvalidFieldNameStyle = errors.New("service's field name style must be either \"asis\", \"snake\" or \"camel\"")
+
+	// ErrInvalidPaginationLinks occurs when a service's pagination links style is not "spirent", "link" or "both".
+	ErrInvalidPaginationLinks = errors.New("service's pagination links must be either \"spirent\", \"link\" or \"both\"")
+
+	// ErrInvalidForceContentType occurs when a service's forced content type isn't one of its negotiated content types.
+	ErrInvalidForceContentType = errors.New("service's forced content type must be one of its negotiated content types")
+
+	// ErrInvalidFormat occurs when one of a service's additional formats lacks a name or MIME types, or has a malformed MIME type.
+	ErrInvalidFormat = errors.New("service's additional formats must have a name and well-formed MIME types")
+
+	// ErrDuplicateFormatMimeType occurs when a service's additional formats repeat a format name or MIME type, including the built-in negotiated content types.
+	ErrDuplicateFormatMimeType = errors.New("service's additional formats must not repeat format names or MIME types")
+
+	// ErrInvalidPriorityHeadroom occurs when a service's priority headroom isn't between 0 and 0.5.
+	ErrInvalidPriorityHeadroom = errors.New("service's priority headroom must be between 0 and 0.5")
+
+	// ErrInvalidValidationFailMode occurs when a service's schema validation fail mode is neither "closed" nor "open".
+	ErrInvalidValidationFailMode = errors.New("service's schema validation fail mode must be either \"closed\" or \"open\"")
+
+	// ErrInvalidMetricsBackend occurs when a service's metrics backend is neither "prometheus" nor "statsd".
+	ErrInvalidMetricsBackend = errors.New("service's metrics backend must be either \"prometheus\" or \"statsd\"")
+
+	// ErrInvalidStatsDFormat occurs when a service's StatsD format is neither "statsd" nor "dogstatsd".
+	ErrInvalidStatsDFormat = errors.New("service's StatsD format must be either \"statsd\" or \"dogstatsd\"")
+
+	// ErrInvalidStaticURIPath occurs when a service serves static assets from the root path.
+	ErrInvalidStaticURIPath = errors.New("service's static URI path must not be empty or \"/\"")
+
 	defaultCORSAllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	defaultShutdownSignals    = []string{"SIGINT", "SIGTERM"}
 )
 
 // ServiceConfig holds a service's config values.
 type ServiceConfig struct {
-	// Addr is the address:port pair that the HTTP server listens on.
+	// Addr is the address:port pair that the HTTP server listens on, or a Unix domain socket path prefixed with "unix:", e.g. "unix:/var/run/service.sock".
 	Addr string
 
 	// Prefix is a prefix to add to every path
 	Prefix string
 
+	// StartUnready, when true, causes the service to respond to resource requests with 503 until Service.SetReady(true) is called.
+	StartUnready bool `yaml:"start_unready"`
+
+	BuildInfo struct {
+		// Enabled, when true, serves the service's build metadata (see BuildVersion, BuildCommit and BuildTime).
+		Enabled bool
+		// URIPath sets the build info path. Defaults to "/version".
+		URIPath string `yaml:"uri_path"`
+	} `yaml:"build_info"`
+
+	Capabilities struct {
+		// Enabled, when true, serves a capabilities document in response to OPTIONS requests.
+		Enabled bool
+		// URIPath sets the capabilities path. Defaults to "/".
+		URIPath string `yaml:"uri_path"`
+	}
+
 	CORS struct {
 		// Enabled, when true, enables CORS.
 		Enabled bool
@@ -45,8 +132,12 @@ type ServiceConfig struct {
 		AllowedHeaders []string `yaml:"allowed_headers"`
 		// ExposedHeaders contains the list of non-simple headers clients are allowed to access in cross-origin responses.  An empty list is interpreted literally.
 		ExposedHeaders []string `yaml:"exposed_headers"`
-		// AllowCredentials indicates whether the request can include user credentials like cookies or HTTP auth.
+		// AllowCredentials indicates whether the request can include user credentials like cookies or HTTP auth. Credentials are only allowed when AllowedOrigins explicitly lists origins without wildcards.
 		AllowCredentials bool `yaml:"allow_credentials"`
+		// MaxAge sets how long (in seconds) clients may cache preflight responses. Zero omits the Access-Control-Max-Age header.
+		MaxAge int `yaml:"max_age"`
+		// Origins lists per-origin policy overrides. Listed origins are allowed in addition to AllowedOrigins.
+		Origins []CORSOrigin
 	}
 
 	// Credentials is a generic map of strings that may be used to store tokens, AWS keys, etc.
@@ -57,6 +148,49 @@ type ServiceConfig struct {
 		Stacks bool
 		// StackSize sets an upper limit on the length of stack traces that appear in 500 error responses.
 		StackSize int `yaml:"stack_size"`
+		// CaptureRequestsPath, when set, appends a JSON record of every request (method, URI, headers and body) to the given file for later replay using ReplayRequests. Sensitive headers are redacted. This is a debug tool: captured requests may contain sensitive data, so it must not be enabled in production.
+		CaptureRequestsPath string `yaml:"capture_requests_path"`
+		// CaptureBodyLimit bounds the number of request body bytes captured. Defaults to 64 KiB.
+		CaptureBodyLimit int `yaml:"capture_body_limit"`
+		// CaptureRedactHeaders lists additional request headers to redact from captured requests. Authorization, Cookie, Proxy-Authorization and X-Api-Key are always redacted.
+		CaptureRedactHeaders []string `yaml:"capture_redact_headers"`
+		// CaptureRedactQueryParams lists additional query parameters whose values are redacted from captured request URIs. access_token and api_key are always redacted.
+		CaptureRedactQueryParams []string `yaml:"capture_redact_query_params"`
+		// Pretty, when true, allows clients to override JSON indentation per request using the "pretty" query parameter.
+		Pretty bool
+		// TracesURIPath, when set, serves the spans kept by the "memory" trace recorder as JSON at the given path. This is a debug tool: spans may contain sensitive data, so it must not be exposed publicly.
+		TracesURIPath string `yaml:"traces_uri_path"`
+	}
+
+	DryRun struct {
+		// Enabled, when true, detects dry run requests. Resource handlers use ContextDryRun to skip persistence.
+		Enabled bool
+		// QueryParam sets the query parameter that requests a dry run. Defaults to "dry_run".
+		QueryParam string `yaml:"query_param"`
+		// Header sets the request header that requests a dry run. Defaults to "X-Dry-Run".
+		Header string
+	}
+
+	Health struct {
+		// Enabled, when true, enables the service's readiness endpoint.
+		Enabled bool
+		// URIPath sets the readiness endpoint path. Defaults to "/health/ready".
+		URIPath string `yaml:"uri_path"`
+	}
+
+	Limits struct {
+		// MaxRequestsPerClient, when positive, caps the number of in-flight requests (not connections) per client IP address. Additional requests receive 429 responses.
+		MaxRequestsPerClient int `yaml:"max_requests_per_client"`
+		// MaxInFlight, when positive, caps the number of requests served at once. Additional requests receive 503 responses, with lower priority requests (see SetQoSClassifier) shed first.
+		MaxInFlight int `yaml:"max_in_flight"`
+		// PriorityHeadroom sets the fraction of MaxInFlight kept free for each higher priority, e.g. with 0.1 low priority requests are shed at 80% of capacity and normal priority requests at 90%. Defaults to 0.1.
+		PriorityHeadroom float64 `yaml:"priority_headroom"`
+		// TrustForwardedFor, when true, identifies clients by the right-most X-Forwarded-For address, i.e. the one added by the proxy. Only enable this behind a single trusted proxy. Superseded by Proxy.TrustedCIDRs, when set.
+		TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+		// ExemptCIDRs lists networks (e.g. internal CIDRs) whose clients are never limited.
+		ExemptCIDRs []string `yaml:"exempt_cidrs"`
+		// MaxRequestBodyBytes, when positive, limits the size of request bodies. Reads beyond the limit fail and BufferRequestBody rejects larger bodies with 413 responses. Defaults to unlimited.
+		MaxRequestBodyBytes int64 `yaml:"max_request_body_bytes"`
 	}
 
 	Log struct {
@@ -73,6 +207,28 @@ type ServiceConfig struct {
 		Enabled bool
 		// UriPath sets the metrics path. Defaults to "/metrics".
 		URIPath string `yaml:"uri_path"`
+		// Backend selects where request metrics are sent: prometheus | statsd. Defaults to "prometheus", which serves them on URIPath; "statsd" emits request counts, latencies and in-flight gauges to a StatsD or DogStatsD collector.
+		Backend string
+		// StatsD configures the statsd metrics backend.
+		StatsD struct {
+			// Addr sets the collector's UDP address. Defaults to "127.0.0.1:8125".
+			Addr string
+			// Prefix sets the prefix of metric names. Defaults to "luddite.".
+			Prefix string
+			// Format selects the line format: statsd | dogstatsd. Defaults to "dogstatsd", which tags metrics with the request method, route and status; plain "statsd" omits tags.
+			Format string
+		} `yaml:"statsd"`
+		// SessionLimit, when positive, enables per-session request counts for up to this many distinct session IDs. Requests from additional sessions are counted together to bound cardinality.
+		SessionLimit int `yaml:"session_limit"`
+	}
+
+	OpenAPI struct {
+		// Enabled, when true, serves a skeleton OpenAPI 3 document generated from the service's routes.
+		Enabled bool
+		// URIPath sets the OpenAPI document path. Defaults to "/openapi.json".
+		URIPath string `yaml:"uri_path"`
+		// Title sets the document's title. Optional.
+		Title string
 	}
 
 	Profiler struct {
@@ -82,6 +238,55 @@ type ServiceConfig struct {
 		URIPath string `yaml:"uri_path"`
 	}
 
+	Proxy struct {
+		// TrustedCIDRs lists the networks of trusted reverse proxies. When set, forwarded headers (X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto) are ignored unless the immediate peer is in one of these networks.
+		TrustedCIDRs []string `yaml:"trusted_cidrs"`
+	}
+
+	Request struct {
+		// DisallowUnknownFields, when true, rejects JSON request bodies containing fields that the target value lacks with 400 responses naming the field. Resources may override this by implementing UnknownFieldsPolicy. Defaults to ignoring unknown fields.
+		DisallowUnknownFields bool `yaml:"disallow_unknown_fields"`
+	}
+
+	Response struct {
+		// JSONIndent sets the indentation used for JSON response bodies. If unset, JSON responses are compact.
+		JSONIndent string `yaml:"json_indent"`
+		// DisableHTMLEscape, when true, disables escaping of <, >, and & in JSON response bodies.
+		DisableHTMLEscape bool `yaml:"disable_html_escape"`
+		// ForceContentType, when set, skips content negotiation and always responds with the given content type, e.g. "application/json", whatever the request's Accept header. This saves per-request work for single-format services.
+		ForceContentType string `yaml:"force_content_type"`
+		// PaginationLinks selects how SetPageLinks links adjacent pages: spirent | link | both. Defaults to "spirent", i.e. the X-Spirent-Next-Link header; "link" uses RFC 8288 Link headers with first/prev/next relations.
+		PaginationLinks string `yaml:"pagination_links"`
+		// OmitNullFields, when true, drops null-valued keys from objects in JSON response bodies. XML responses and null array elements are unaffected.
+		OmitNullFields bool `yaml:"omit_null_fields"`
+		// FieldNameStyle transforms the field names of JSON bodies: asis | snake | camel. Defaults to "asis". With "snake" or "camel", the keys of objects in JSON response bodies are rewritten in that style (e.g. "UserID" becomes "user_id" or "userID"), and keys of JSON request bodies that match transformed struct field names are mapped back to the fields. Names given by explicit json tags aren't transformed. Map keys are transformed in responses but not in requests.
+		FieldNameStyle string `yaml:"field_name_style"`
+		// TimeFormat sets how times are serialized in JSON bodies: rfc3339 | unix | unixmilli | a custom layout, e.g. "2006-01-02 15:04:05". Defaults to "rfc3339", encoding/json's own format. "unix" and "unixmilli" serialize times as numbers of seconds or milliseconds since the epoch. Times in JSON request bodies are decoded from the same format. Times within values with custom marshalers and within request values decoded into interfaces are unaffected.
+		TimeFormat string `yaml:"time_format"`
+		// JSONP, when true, wraps JSON response bodies to GET requests with a valid "callback" query parameter in a call to the named function and responds with Content-Type "application/javascript". Intended only for legacy browser clients.
+		JSONP bool `yaml:"jsonp"`
+		// ResponseId, when true, gives each response a short, human-dictatable id (e.g. "7KQ2M9XD") in the X-Response-Id header, separate from the request's trace id. The id is included in access logs and request traces, so users can read it to support staff.
+		ResponseId bool `yaml:"response_id"`
+		// ErrorFormat selects how errors are serialized in JSON responses: luddite | problem | jsonapi. Defaults to "luddite"; "problem" uses RFC 7807 application/problem+json documents and "jsonapi" uses JSON:API application/vnd.api+json error documents.
+		ErrorFormat string `yaml:"error_format"`
+		// MultipleChoices, when true, responds to GET requests whose Accept header is absent or only "*/*" with 300 Multiple Choices listing the serializable content types. Resources may opt in individually by implementing RepresentationLister.
+		MultipleChoices bool `yaml:"multiple_choices"`
+		// MaxResponseBytes, when positive, limits the size of response bodies as a safety valve against runaway handlers. Writes beyond the limit are dropped and logged as errors. Streaming responses are exempt. Defaults to unlimited.
+		MaxResponseBytes int64 `yaml:"max_response_bytes"`
+		// MaxDecodeBytes limits the size of JSON and XML request bodies decoded by ReadRequest, independently of Limits.MaxRequestBodyBytes (which also covers raw uploads). Larger bodies receive 413 responses. Defaults to 1MiB; set it to -1 for unlimited.
+		MaxDecodeBytes int64 `yaml:"max_decode_bytes"`
+		// Formats declares additional negotiable formats and their MIME types, e.g. for representations whose serializers are registered in code. They are registered using RegisterFormat and negotiated after the built-in content types.
+		Formats []FormatSpec
+		// BodylessStatuses lists additional statuses whose responses are written without a body or Content-Type. 1xx, 204, 205, 304 and 412 responses never carry a body.
+		BodylessStatuses []int `yaml:"bodyless_statuses"`
+		// BufferHint sets the initial capacity, in bytes, of the pooled buffers that JSON response bodies are serialized into before being written, e.g. the typical response size of a read-heavy service. Defaults to 0, i.e. buffers grow as needed.
+		BufferHint int `yaml:"buffer_hint"`
+		// AutoETag, when true, sets a strong ETag computed from the serialized body on 200 responses to GET requests written by WriteResponse, unless the handler set one, and responds 304 Not Modified to requests whose If-None-Match header matches. Hashing adds CPU, so resources may opt in or out individually by implementing AutoETagPolicy.
+		AutoETag bool `yaml:"auto_etag"`
+		// AutoOptions, when true, answers OPTIONS requests on routes without an OPTIONS handler, including global routes such as the schema and health routes, with 204 No Content and an Allow header listing the route's methods. GET routes, global or not, always answer HEAD requests.
+		AutoOptions bool `yaml:"auto_options"`
+	}
+
 	Schema struct {
 		// Enabled, when true, self-serve the service's own schema.
 		Enabled bool
@@ -93,6 +298,41 @@ type ServiceConfig struct {
 		FileName string `yaml:"file_name"`
 		// RootRedirect, when true, redirects the service's root to the default schema.
 		RootRedirect bool `yaml:"root_redirect"`
+		// ContentTypes maps schema file extensions (e.g. ".yaml") to response content types, overriding the defaults. YAML is served as "text/yaml; charset=utf-8" by default; map it to "application/octet-stream" to force downloads.
+		ContentTypes map[string]string `yaml:"content_types"`
+		// Compress, when true, gzips schema files on the fly for clients that accept gzip encoding. Precompressed ".br" and ".gz" sidecar files are served when present regardless.
+		Compress bool
+		// Validation controls validation of JSON bodies for resources that implement SchemaValidated.
+		Validation struct {
+			// Requests, when true, rejects request bodies that violate their resource's request schema with 422 responses.
+			Requests bool
+			// Responses, when true, logs response bodies that violate their resource's response schema. Intended for debugging and testing.
+			Responses bool
+			// FailResponses, when true, replaces response bodies that violate their resource's response schema with 500 responses.
+			FailResponses bool `yaml:"fail_responses"`
+			// FailMode selects what happens when a resource's schemas can't be loaded: closed | open. Defaults to "closed", which fails AddResource; "open" logs the failure and serves the resource without validation.
+			FailMode FailMode `yaml:"fail_mode"`
+		}
+	}
+
+	Shutdown struct {
+		// Timeout bounds the time spent running shutdown hooks, e.g. "10s". Defaults to 30 seconds.
+		Timeout time.Duration
+		// TeardownTimeout bounds the time spent draining in-flight requests and then closing dependencies registered with AddCloser, once the listener is closed, e.g. "10s". Defaults to 30 seconds.
+		TeardownTimeout time.Duration `yaml:"teardown_timeout"`
+		// Signals lists the signals that trigger graceful shutdown: SIGINT | SIGTERM | SIGQUIT. Defaults to SIGINT and SIGTERM.
+		Signals []string
+	}
+
+	Static struct {
+		// Enabled, when true, serves static assets (e.g. a bundled UI).
+		Enabled bool
+		// URIPath sets the URI path prefix for static assets, e.g. "/ui". Must not be empty or "/".
+		URIPath string `yaml:"uri_path"`
+		// FilePath sets the base file path for static assets.
+		FilePath string `yaml:"file_path"`
+		// SPA, when true, serves index.html in place of any asset that doesn't exist, as required by single-page applications.
+		SPA bool `yaml:"spa"`
 	}
 
 	Trace struct {
@@ -100,9 +340,27 @@ type ServiceConfig struct {
 		Enabled bool
 		// Buffer sets the trace package's buffer size.
 		Buffer int
-		// Recorder selects the trace recorder implementation: json | other.
+		// QueueSize sets the size of luddite's queue of spans awaiting the recorder, whose depth is reported by the luddite_trace_queue_depth metric. Defaults to Buffer.
+		QueueSize int `yaml:"queue_size"`
+		// HighWater, when positive, is the queue depth at which the recorder is considered to be falling behind: reaching it is logged and increments the luddite_trace_queue_high_water_total metric, and the "drop" overflow policy discards spans from then on rather than once the queue is full.
+		HighWater int `yaml:"high_water"`
+		// FlushInterval sets how often buffered trace output is flushed, e.g. "5s". If unset, spans are written through to the recorder as they arrive.
+		FlushInterval time.Duration `yaml:"flush_interval"`
+		// OverflowPolicy selects what happens to spans when the recorder falls behind: block | drop. Defaults to "block", which preserves spans at the expense of memory and recorder latency; "drop" discards them and increments the luddite_trace_spans_dropped_total metric.
+		OverflowPolicy string `yaml:"overflow_policy"`
+		// MaxSpans, when positive, bounds the number of requests traced at once. Requests over the limit are served without trace spans (but still get request ids) and increment the luddite_trace_spans_skipped_total metric.
+		MaxSpans int `yaml:"max_spans"`
+		// Required, when true, causes Run to fail if any trace recorder can't be initialized. By default tracing is best-effort: failed recorders are logged and the service runs without them.
+		Required bool
+		// Recorder selects the trace recorder implementation: json | yaml | other. Deprecated: use Recorders.
 		Recorder string
-		// Params is a map of trace recorder parameters.
+		// Recorders selects one or more trace recorder implementations: json | yaml | memory | other. Each span is recorded by all of them.
+		Recorders []string
+		// NodeID, when positive, is embedded in the most significant bits of generated trace (and request) IDs so that they are unique across nodes or regions.
+		NodeID int `yaml:"node_id"`
+		// NodeBits sets the number of ID bits reserved for NodeID. Defaults to 8.
+		NodeBits int `yaml:"node_bits"`
+		// Params is a map of trace recorder parameters. Parameters may be given per recorder using "<recorder>.<param>" keys, e.g. "json.path".
 		Params map[string]string
 	}
 
@@ -113,6 +371,16 @@ type ServiceConfig struct {
 		CertFilePath string `yaml:"cert_file_path"`
 		// KeyFilePath sets the path to the server's key file.
 		KeyFilePath string `yaml:"key_file_path"`
+		// Certificates lists additional certificate/key pairs. Certificates are selected using the client's SNI server name; CertFilePath/KeyFilePath (or else the first pair) serves clients that don't send a matching name.
+		Certificates []TLSCertificate
+		// ReadHeaderTimeout bounds the time allowed to read request headers, e.g. "10s". Defaults to 10 seconds.
+		ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+		// ReadTimeout bounds the time allowed to read an entire request, including the body. If unset, there is no limit.
+		ReadTimeout time.Duration `yaml:"read_timeout"`
+		// WriteTimeout bounds the time allowed to write a response. If unset, there is no limit.
+		WriteTimeout time.Duration `yaml:"write_timeout"`
+		// IdleTimeout bounds the time a keep-alive connection may wait for its next request. Defaults to 2 minutes.
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
 	}
 
 	Version struct {
@@ -120,12 +388,69 @@ type ServiceConfig struct {
 		Min int
 		// Max sets the maximum API version that the service supports.
 		Max int
+		// Deprecated maps deprecated API versions to details that are returned to clients using them.
+		Deprecated map[int]DeprecationInfo
+		// MigrationURL sets a link to migration docs that is included in API_VERSION_TOO_OLD error responses. Optional.
+		MigrationURL string `yaml:"migration_url"`
+	}
+
+	Workers struct {
+		// Enabled, when true, caps the number of resource handlers executing at once, independent of connection limits, e.g. to bound CPU contention from CPU-bound handlers.
+		Enabled bool
+		// Size sets the number of resource handlers that may execute at once. Defaults to GOMAXPROCS.
+		Size int
+		// Wait sets how long requests wait for a worker before receiving 503 responses, e.g. "500ms". Requests stop waiting when canceled, e.g. by client disconnects. Defaults to 1s.
+		Wait time.Duration
 	}
 }
 
+// TLSCertificate names a certificate file and its key file.
+type TLSCertificate struct {
+	// CertFilePath sets the path to the certificate file.
+	CertFilePath string `yaml:"cert_file_path"`
+	// KeyFilePath sets the path to the key file.
+	KeyFilePath string `yaml:"key_file_path"`
+}
+
+// CORSOrigin overrides the CORS policy for a single, explicitly-named origin.
+type CORSOrigin struct {
+	// Origin is the exact origin, e.g. "https://partner.example.com". Wildcards are not allowed.
+	Origin string
+	// AllowCredentials indicates whether requests from the origin can include user credentials.
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// ExposedHeaders overrides the headers the origin is allowed to access in responses. Optional.
+	ExposedHeaders []string `yaml:"exposed_headers"`
+	// MaxAge overrides how long (in seconds) the origin may cache preflight responses. Optional.
+	MaxAge int `yaml:"max_age"`
+}
+
+// FormatSpec declares an additional negotiable format.
+type FormatSpec struct {
+	// Name sets the format's name, e.g. "msgpack".
+	Name string
+	// MimeTypes lists the format's MIME types, e.g. "application/msgpack".
+	MimeTypes []string `yaml:"mime_types"`
+}
+
+// DeprecationInfo describes a deprecated API version.
+type DeprecationInfo struct {
+	// Sunset sets the time after which the API version will no longer be supported. Optional.
+	Sunset time.Time
+	// Message sets a human-readable warning, e.g. migration instructions. Optional.
+	Message string
+}
+
 // Normalize applies sensible defaults to service config values when they are
 // otherwise unspecified or invalid.
 func (config *ServiceConfig) Normalize() {
+	if config.BuildInfo.Enabled && config.BuildInfo.URIPath == "" {
+		config.BuildInfo.URIPath = defaultBuildInfoURIPath
+	}
+
+	if config.Capabilities.Enabled && config.Capabilities.URIPath == "" {
+		config.Capabilities.URIPath = defaultCapabilitiesURIPath
+	}
+
 	if config.CORS.Enabled && len(config.CORS.AllowedMethods) == 0 {
 		config.CORS.AllowedMethods = defaultCORSAllowedMethods
 	}
@@ -134,13 +459,119 @@ func (config *ServiceConfig) Normalize() {
 		config.Debug.StackSize = maxStackSize
 	}
 
+	if config.DryRun.Enabled {
+		if config.DryRun.QueryParam == "" {
+			config.DryRun.QueryParam = defaultDryRunQueryParam
+		}
+		if config.DryRun.Header == "" {
+			config.DryRun.Header = HeaderDryRun
+		}
+	}
+
+	if config.Health.Enabled && config.Health.URIPath == "" {
+		config.Health.URIPath = defaultHealthURIPath
+	}
+
 	if config.Metrics.Enabled && config.Metrics.URIPath == "" {
 		config.Metrics.URIPath = defaultMetricsURIPath
 	}
 
+	if config.Metrics.Enabled && config.Metrics.Backend == "" {
+		config.Metrics.Backend = MetricsBackendPrometheus
+	}
+
+	if config.Metrics.Backend == MetricsBackendStatsD {
+		if config.Metrics.StatsD.Addr == "" {
+			config.Metrics.StatsD.Addr = defaultStatsDAddr
+		}
+		if config.Metrics.StatsD.Prefix == "" {
+			config.Metrics.StatsD.Prefix = defaultStatsDPrefix
+		}
+		if config.Metrics.StatsD.Format == "" {
+			config.Metrics.StatsD.Format = StatsDFormatDogStatsD
+		}
+	}
+
+	if config.OpenAPI.Enabled && config.OpenAPI.URIPath == "" {
+		config.OpenAPI.URIPath = defaultOpenAPIURIPath
+	}
+
 	if config.Profiler.Enabled && config.Profiler.URIPath == "" {
 		config.Profiler.URIPath = defaultProfilerURIPath
 	}
+
+	if config.Response.ErrorFormat == "" {
+		config.Response.ErrorFormat = ErrorFormatLuddite
+	}
+
+	if config.Response.FieldNameStyle == "" {
+		config.Response.FieldNameStyle = FieldNameStyleAsIs
+	}
+
+	if config.Response.TimeFormat == "" {
+		config.Response.TimeFormat = TimeFormatRFC3339
+	}
+
+	if config.Response.PaginationLinks == "" {
+		config.Response.PaginationLinks = PaginationLinksSpirent
+	}
+
+	if config.Shutdown.Timeout <= 0 {
+		config.Shutdown.Timeout = defaultShutdownTimeout
+	}
+
+	if config.Shutdown.TeardownTimeout <= 0 {
+		config.Shutdown.TeardownTimeout = defaultShutdownTimeout
+	}
+
+	if len(config.Shutdown.Signals) == 0 {
+		config.Shutdown.Signals = defaultShutdownSignals
+	}
+
+	if config.Transport.ReadHeaderTimeout <= 0 {
+		config.Transport.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+
+	if config.Transport.IdleTimeout <= 0 {
+		config.Transport.IdleTimeout = defaultIdleTimeout
+	}
+
+	if config.Trace.Enabled && len(config.Trace.Recorders) == 0 && config.Trace.Recorder != "" {
+		config.Trace.Recorders = []string{config.Trace.Recorder}
+	}
+
+	if config.Debug.CaptureRequestsPath != "" && config.Debug.CaptureBodyLimit <= 0 {
+		config.Debug.CaptureBodyLimit = defaultCaptureBodyLimit
+	}
+
+	if config.Trace.NodeID > 0 && config.Trace.NodeBits < 1 {
+		config.Trace.NodeBits = defaultTraceNodeBits
+	}
+
+	if config.Response.MaxDecodeBytes == 0 {
+		config.Response.MaxDecodeBytes = defaultMaxDecodeBytes
+	}
+
+	if config.Limits.MaxInFlight > 0 && config.Limits.PriorityHeadroom == 0 {
+		config.Limits.PriorityHeadroom = defaultPriorityHeadroom
+	}
+
+	if config.Trace.Enabled && config.Trace.OverflowPolicy == "" {
+		config.Trace.OverflowPolicy = TraceOverflowBlock
+	}
+
+	if config.Trace.QueueSize == 0 {
+		config.Trace.QueueSize = config.Trace.Buffer
+	}
+
+	if config.Workers.Enabled {
+		if config.Workers.Size == 0 {
+			config.Workers.Size = runtime.GOMAXPROCS(0)
+		}
+		if config.Workers.Wait == 0 {
+			config.Workers.Wait = defaultWorkersWait
+		}
+	}
 }
 
 // Validate sanity-checks service config values.
@@ -154,9 +585,76 @@ func (config *ServiceConfig) Validate() error {
 	if config.Version.Min > config.Version.Max {
 		return ErrMismatchedApiVersions
 	}
+	if ef := config.Response.ErrorFormat; ef != ErrorFormatLuddite && ef != ErrorFormatProblem && ef != ErrorFormatJSONAPI {
+		return ErrInvalidErrorFormat
+	}
+	if fs := config.Response.FieldNameStyle; fs != "" && fs != FieldNameStyleAsIs && fs != FieldNameStyleSnake && fs != FieldNameStyleCamel {
+		return ErrInvalidFieldNameStyle
+	}
+	if tf := config.Response.TimeFormat; tf != "" && !validTimeFormat(tf) {
+		return ErrInvalidTimeFormat
+	}
+	if pl := config.Response.PaginationLinks; pl != "" && pl != PaginationLinksSpirent && pl != PaginationLinksLink && pl != PaginationLinksBoth {
+		return ErrInvalidPaginationLinks
+	}
+	if !config.Schema.Validation.FailMode.valid() {
+		return ErrInvalidValidationFailMode
+	}
+	if h := config.Limits.PriorityHeadroom; h < 0 || h >= 0.5 {
+		return ErrInvalidPriorityHeadroom
+	}
+	if b := config.Metrics.Backend; b != "" && b != MetricsBackendPrometheus && b != MetricsBackendStatsD {
+		return ErrInvalidMetricsBackend
+	}
+	if f := config.Metrics.StatsD.Format; f != "" && f != StatsDFormatStatsD && f != StatsDFormatDogStatsD {
+		return ErrInvalidStatsDFormat
+	}
+	if err := validateFormats(config.Response.Formats); err != nil {
+		return err
+	}
+	if config.Response.ForceContentType != "" && !stringInSlice(config.Response.ForceContentType, config.negotiatedContentTypes()) {
+		return ErrInvalidForceContentType
+	}
+	for _, o := range config.CORS.Origins {
+		if o.Origin == "" || strings.Contains(o.Origin, "*") {
+			return ErrInvalidCORSOrigin
+		}
+	}
+	if _, err := parseSignals(config.Shutdown.Signals); err != nil {
+		return err
+	}
+	if config.Trace.NodeID > 0 && (config.Trace.NodeBits > maxTraceNodeBits || config.Trace.NodeID >= 1<<uint(config.Trace.NodeBits)) {
+		return ErrInvalidTraceNodeID
+	}
+	if config.Trace.Enabled && config.Trace.OverflowPolicy != TraceOverflowBlock && config.Trace.OverflowPolicy != TraceOverflowDrop {
+		return ErrInvalidTraceOverflowPolicy
+	}
+	if config.Trace.HighWater < 0 || config.Trace.QueueSize > 0 && config.Trace.HighWater > config.Trace.QueueSize {
+		return ErrInvalidTraceHighWater
+	}
+	if config.Workers.Enabled && (config.Workers.Size < 0 || config.Workers.Wait < 0) {
+		return ErrInvalidWorkers
+	}
+	if config.Static.Enabled && strings.Trim(config.Static.URIPath, "/") == "" {
+		// NB: A catch-all global route would shadow every API route
+		return ErrInvalidStaticURIPath
+	}
 	return nil
 }
 
+// tlsCertificates returns the configured certificate/key pairs, with the
+// default pair (if any) first.
+func (config *ServiceConfig) tlsCertificates() []TLSCertificate {
+	certs := make([]TLSCertificate, 0, len(config.Transport.Certificates)+1)
+	if config.Transport.CertFilePath != "" || config.Transport.KeyFilePath != "" {
+		certs = append(certs, TLSCertificate{
+			CertFilePath: config.Transport.CertFilePath,
+			KeyFilePath:  config.Transport.KeyFilePath,
+		})
+	}
+	return append(certs, config.Transport.Certificates...)
+}
+
 // ReadConfig reads a YAML config file from path. The file is parsed into the struct pointed to by cfg.
 func ReadConfig(path string, cfg interface{}) error {
 	buf, err := ioutil.ReadFile(path)
@@ -165,3 +663,46 @@ func ReadConfig(path string, cfg interface{}) error {
 	}
 	return yaml.Unmarshal(buf, cfg)
 }
+
+// validateFormats checks additional formats for missing or malformed values
+// and for names or MIME types that conflict with each other or with the
+// built-in negotiated content types.
+func validateFormats(formats []FormatSpec) error {
+	names := make(map[string]bool, len(formats))
+	mimeTypes := make(map[string]bool, len(negotiatedContentTypes))
+	for _, ct := range negotiatedContentTypes {
+		mimeTypes[ct] = true
+	}
+	for _, f := range formats {
+		if f.Name == "" || len(f.MimeTypes) == 0 {
+			return ErrInvalidFormat
+		}
+		if names[f.Name] {
+			return ErrDuplicateFormatMimeType
+		}
+		names[f.Name] = true
+		for _, mt := range f.MimeTypes {
+			if parsed, _, err := mime.ParseMediaType(mt); err != nil || parsed != mt || !strings.Contains(mt, "/") {
+				return ErrInvalidFormat
+			}
+			if mimeTypes[mt] {
+				return ErrDuplicateFormatMimeType
+			}
+			mimeTypes[mt] = true
+		}
+	}
+	return nil
+}
+
+// negotiatedContentTypes returns the content types the service negotiates,
+// i.e. the built-in ones followed by those of any additional formats.
+func (config *ServiceConfig) negotiatedContentTypes() []string {
+	if len(config.Response.Formats) == 0 {
+		return negotiatedContentTypes
+	}
+	contentTypes := append([]string(nil), negotiatedContentTypes...)
+	for _, f := range config.Response.Formats {
+		contentTypes = append(contentTypes, f.MimeTypes...)
+	}
+	return contentTypes
+}
@@ -3,6 +3,7 @@ package luddite
 import (
 	"context"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -14,23 +15,53 @@ const contextHandlerDetailsKey = contextKey(0)
 // NB: New fields added to this structure must be explicitly initialized in the
 // init method below. This enables pool-based allocation.
 type handlerDetails struct {
-	s               *Service
-	rw              ResponseWriter
-	request         *http.Request
-	requestId       string
-	requestProgress string
-	apiVersion      int
-	external        map[interface{}]interface{}
+	s                     *Service
+	rw                    ResponseWriter
+	request               *http.Request
+	requestId             string
+	start                 time.Time
+	requestProgress       string
+	sessionId             string
+	tenant                string
+	apiVersion            int
+	dryRun                bool
+	preferReturn          string
+	identity              *Identity
+	segs                  []string
+	route                 *allowedRoute
+	resource              *resourceRegistration
+	validation            *resourceValidation
+	disallowUnknownFields bool
+	ambiguousAccept       bool
+	flags                 map[string]bool
+	flagsResolved         bool
+	external              map[interface{}]interface{}
+	scratch               map[string]interface{}
 }
 
-func (d *handlerDetails) init(s *Service, rw ResponseWriter, request *http.Request, requestId, requestProgress string) {
+func (d *handlerDetails) init(s *Service, rw ResponseWriter, request *http.Request, requestId, requestProgress string, start time.Time, segs []string, route *allowedRoute, resource *resourceRegistration) {
 	d.s = s
 	d.rw = rw
 	d.request = request
 	d.requestId = requestId
+	d.start = start
 	d.requestProgress = requestProgress
+	d.sessionId = request.Header.Get(HeaderSessionId)
+	d.tenant = ""
 	d.apiVersion = 0
+	d.dryRun = false
+	d.preferReturn = ""
+	d.identity = nil
+	d.segs = segs
+	d.route = route
+	d.resource = resource
+	d.validation = nil
+	d.disallowUnknownFields = false
+	d.ambiguousAccept = false
+	d.flags = nil
+	d.flagsResolved = false
 	d.external = nil
+	d.scratch = nil
 }
 
 func withHandlerDetails(ctx context.Context, d *handlerDetails) context.Context {
@@ -80,6 +111,16 @@ func ContextResponseHeaders(ctx context.Context) (header http.Header) {
 	return
 }
 
+// ContextBytesWritten returns the number of response body bytes written so far
+// for the current HTTP request from a context.Context, if possible. It may be
+// called mid-handler, e.g. by streaming handlers that break pages by size.
+func ContextBytesWritten(ctx context.Context) (n int) {
+	if rw := ContextResponseWriter(ctx); rw != nil {
+		n = int(rw.Size())
+	}
+	return
+}
+
 // ContextRequest returns the current HTTP request from a context.Context, if
 // possible.
 func ContextRequest(ctx context.Context) (request *http.Request) {
@@ -98,11 +139,46 @@ func ContextRequestId(ctx context.Context) (requestId string) {
 	return
 }
 
+// ContextElapsed returns the time elapsed since the current HTTP request
+// started from a context.Context, if possible. It is measured the same way as
+// the latency recorded in the access log, so handlers may use it to stay
+// within a time budget, e.g. by skipping an expensive fallback.
+func ContextElapsed(ctx context.Context) (elapsed time.Duration) {
+	if d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok && !d.start.IsZero() {
+		elapsed = d.s.clock.Since(d.start)
+	}
+	return
+}
+
 // ContextSessionId returns the current HTTP request's session ID value from a
-// context.Context, if possible.
+// context.Context, if possible. This is either the request's X-Session-Id
+// header value or a value set using SetContextSessionId.
 func ContextSessionId(ctx context.Context) (sessionId string) {
 	if d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok {
-		sessionId = d.request.Header.Get(HeaderSessionId)
+		sessionId = d.sessionId
+		if sessionId == "" && d.request != nil {
+			sessionId = d.request.Header.Get(HeaderSessionId)
+		}
+	}
+	return
+}
+
+// SetContextSessionId sets the current HTTP request's session ID in a
+// context.Context and in the X-Session-Id response header. This may be used by
+// handlers that create sessions and ensures that the access log and trace use
+// the same session ID.
+func SetContextSessionId(ctx context.Context, sessionId string) {
+	if d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok {
+		d.sessionId = sessionId
+		d.rw.Header().Set(HeaderSessionId, sessionId)
+	}
+}
+
+// ContextIdentity returns the identity resolved from the current HTTP
+// request's API key from a context.Context, if possible.
+func ContextIdentity(ctx context.Context) (identity Identity, ok bool) {
+	if d, ok2 := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok2 && d.identity != nil {
+		identity, ok = *d.identity, true
 	}
 	return
 }
@@ -133,6 +209,28 @@ func ContextApiVersion(ctx context.Context) (apiVersion int) {
 	return
 }
 
+// ContextDryRun returns true if the current HTTP request asked for a dry run,
+// i.e. validation without persistence, if possible. Resource handlers that
+// support dry runs should skip persistence and return the validated
+// representation.
+func ContextDryRun(ctx context.Context) (dryRun bool) {
+	if d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok {
+		dryRun = d.dryRun
+	}
+	return
+}
+
+// ContextPreferReturn returns the current HTTP request's "return" preference,
+// i.e. PreferReturnMinimal or PreferReturnRepresentation, from a
+// context.Context, if possible. Resource handlers may use it to decide how much
+// of a resource to serialize.
+func ContextPreferReturn(ctx context.Context) (preferReturn string) {
+	if d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok {
+		preferReturn = d.preferReturn
+	}
+	return
+}
+
 // SetContextDetail sets a detail in the current HTTP request's context. This
 // may be used by the service's own middleware and avoids allocating a new
 // request with additional context.
@@ -153,3 +251,25 @@ func ContextDetail(ctx context.Context, key interface{}) (value interface{}) {
 	}
 	return
 }
+
+// ContextSet stores a request-scoped value under a string key in the current
+// HTTP request's context, so no new context is allocated per value. Values are
+// kept apart from those set using SetContextDetail. Packages should prefix
+// their keys (e.g. "tenant.id") to avoid collisions.
+func ContextSet(ctx context.Context, key string, v interface{}) {
+	if d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok {
+		if d.scratch == nil {
+			d.scratch = make(map[string]interface{})
+		}
+		d.scratch[key] = v
+	}
+}
+
+// ContextGet returns a request-scoped value stored using ContextSet and
+// whether it was present.
+func ContextGet(ctx context.Context, key string) (v interface{}, ok bool) {
+	if d, ok2 := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok2 && d.scratch != nil {
+		v, ok = d.scratch[key]
+	}
+	return
+}
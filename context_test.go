@@ -0,0 +1,91 @@
+package luddite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextSetGet(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	d := new(handlerDetails)
+	d.init(nil, nil, req, "1", "", time.Time{}, nil, nil, nil)
+	ctx := withHandlerDetails(context.Background(), d)
+
+	if _, ok := ContextGet(ctx, "tenant.id"); ok {
+		t.Error("expected missing value")
+	}
+	ContextSet(ctx, "tenant.id", "acme")
+	ContextSet(ctx, "flags.beta", nil)
+	if v, ok := ContextGet(ctx, "tenant.id"); !ok || v != "acme" {
+		t.Errorf("expected acme, got %v", v)
+	}
+	if v, ok := ContextGet(ctx, "flags.beta"); !ok || v != nil {
+		t.Errorf("expected present nil value, got %v (%t)", v, ok)
+	}
+
+	// Values are kept apart from context details with the same key
+	SetContextDetail(ctx, "tenant.id", "detail")
+	if v, ok := ContextGet(ctx, "tenant.id"); !ok || v != "acme" {
+		t.Errorf("expected acme after setting a context detail, got %v", v)
+	}
+	if v := ContextDetail(ctx, "tenant.id"); v != "detail" {
+		t.Errorf("expected detail, got %v", v)
+	}
+	ContextSet(ctx, "flags.beta", true)
+	if v := ContextDetail(ctx, "flags.beta"); v != nil {
+		t.Errorf("expected no context detail, got %v", v)
+	}
+
+	// Pooled handler details must not leak values between requests
+	d.init(nil, nil, req, "2", "", time.Time{}, nil, nil, nil)
+	if _, ok := ContextGet(ctx, "tenant.id"); ok {
+		t.Error("expected values to be reset")
+	}
+
+	// Without handler details values are silently dropped
+	ContextSet(context.Background(), "tenant.id", "acme")
+	if _, ok := ContextGet(context.Background(), "tenant.id"); ok {
+		t.Error("expected missing value without handler details")
+	}
+}
+
+func TestContextBytesWritten(t *testing.T) {
+	if n := ContextBytesWritten(context.Background()); n != 0 {
+		t.Errorf("expected 0 bytes without handler details, got %d", n)
+	}
+
+	req, _ := http.NewRequest("GET", "/export", nil)
+	TestDispatch(httptest.NewRecorder(), req, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		if n := ContextBytesWritten(ctx); n != 0 {
+			t.Errorf("expected 0 bytes before writing, got %d", n)
+		}
+		chunk := make([]byte, 100)
+		for i := 1; i <= 3; i++ {
+			_, _ = rw.Write(chunk)
+			if n := ContextBytesWritten(ctx); n != i*len(chunk) {
+				t.Errorf("expected %d bytes after chunk %d, got %d", i*len(chunk), i, n)
+			}
+		}
+	}))
+}
+
+func TestContextElapsed(t *testing.T) {
+	if elapsed := ContextElapsed(context.Background()); elapsed != 0 {
+		t.Errorf("expected no elapsed time without handler details, got %v", elapsed)
+	}
+
+	req, _ := http.NewRequest("GET", "/report", nil)
+	TestDispatch(httptest.NewRecorder(), req, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		before := ContextElapsed(ctx)
+		time.Sleep(5 * time.Millisecond)
+		after := ContextElapsed(ctx)
+		if after-before < 5*time.Millisecond {
+			t.Errorf("expected elapsed time to increase by at least 5ms, got %v then %v", before, after)
+		}
+	}))
+}
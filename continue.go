@@ -0,0 +1,46 @@
+package luddite
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ContinueChecker is implemented by resource handler types that accept large
+// uploads and want to check cheap preconditions (e.g. quotas or the state of
+// the target resource) before the client sends its body. CheckContinue is
+// called for requests that carry an "Expect: 100-continue" header, after
+// middleware handlers run but before the body is read. A non-nil error
+// rejects the request: *Error values are written with their usual status and
+// other errors as 417 Expectation Failed.
+type ContinueChecker interface {
+	CheckContinue(req *http.Request) error
+}
+
+// expectsContinue returns true if a request's client is waiting for a 100
+// Continue response before sending its body.
+func expectsContinue(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get(HeaderExpect), "100-continue") && req.ContentLength != 0
+}
+
+// checkContinue evaluates upload preconditions for a request that expects 100
+// Continue, writing a rejection and returning false if any fail. Go's server
+// sends 100 Continue once the body is first read, so rejecting here means the
+// client never sends it.
+func (s *Service) checkContinue(rw http.ResponseWriter, req *http.Request, d *handlerDetails) bool {
+	if max := s.config.Limits.MaxRequestBodyBytes; max > 0 && req.ContentLength > max {
+		_ = WriteResponse(rw, ErrorStatus(EcodeRequestTooLarge), NewError(nil, EcodeRequestTooLarge, max))
+		return false
+	}
+	r := d.resource.find(func(r *resourceRegistration) bool { return r.continuer != nil })
+	if r == nil {
+		return true
+	}
+	if err := r.continuer.CheckContinue(req); err != nil {
+		if _, ok := err.(*Error); !ok {
+			err = NewError(nil, EcodeExpectationFailed, err)
+		}
+		_ = WriteResponse(rw, 0, err)
+		return false
+	}
+	return true
+}
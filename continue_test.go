@@ -0,0 +1,78 @@
+package luddite
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type uploadResource struct {
+	gadgetResource
+}
+
+func (r *uploadResource) CheckContinue(req *http.Request) error {
+	switch req.Header.Get("X-Quota") {
+	case "exceeded":
+		return errors.New("quota exceeded")
+	case "locked":
+		return NewError(nil, EcodeLocked)
+	}
+	return nil
+}
+
+// watchedReader records whether a client sent its request body.
+type watchedReader struct {
+	io.Reader
+	read bool
+}
+
+func (r *watchedReader) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+func TestExpectContinue(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Limits.MaxRequestBodyBytes = 64
+	})
+	if err := s.AddResource(1, "/uploads", &uploadResource{}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+
+	upload := func(body, quota string) (int, bool) {
+		r := &watchedReader{Reader: strings.NewReader(body)}
+		req, _ := http.NewRequest("POST", server.URL+"/uploads", r)
+		req.ContentLength = int64(len(body))
+		req.Header.Set(HeaderContentType, ContentTypeJson)
+		req.Header.Set(HeaderExpect, "100-continue")
+		if quota != "" {
+			req.Header.Set("X-Quota", quota)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode, r.read
+	}
+
+	if code, sent := upload(`{"name":"widget"}`, ""); code != http.StatusOK || !sent {
+		t.Errorf("expected 200/OK after 100 Continue, got %d (body sent: %v)", code, sent)
+	}
+	if code, sent := upload(`{"name":"`+strings.Repeat("x", 64)+`"}`, ""); code != http.StatusRequestEntityTooLarge || sent {
+		t.Errorf("expected early 413/Request Entity Too Large, got %d (body sent: %v)", code, sent)
+	}
+	if code, sent := upload(`{"name":"widget"}`, "exceeded"); code != http.StatusExpectationFailed || sent {
+		t.Errorf("expected early 417/Expectation Failed, got %d (body sent: %v)", code, sent)
+	}
+	if code, sent := upload(`{"name":"widget"}`, "locked"); code != http.StatusLocked || sent {
+		t.Errorf("expected early 423/Locked, got %d (body sent: %v)", code, sent)
+	}
+}
@@ -0,0 +1,89 @@
+package luddite
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// corsPolicy applies a service's CORS config. Requests from origins with
+// per-origin overrides are handled by dedicated policies; all others use the
+// default policy. Credentials are never allowed for wildcard origins.
+type corsPolicy struct {
+	defaultPolicy *cors.Cors
+	origins       map[string]*cors.Cors
+}
+
+func newCORSPolicy(config *ServiceConfig) (p *corsPolicy, credentialsDropped bool) {
+	c := config.CORS
+
+	// Credentials are only allowed for explicitly-listed origins: an empty
+	// list and any wildcard pattern are treated as open to all origins.
+	allowCredentials := c.AllowCredentials
+	if allowCredentials && corsOriginsWildcard(c.AllowedOrigins) {
+		allowCredentials = false
+		credentialsDropped = true
+	}
+
+	p = &corsPolicy{
+		defaultPolicy: cors.New(cors.Options{
+			AllowedOrigins:   c.AllowedOrigins,
+			AllowedMethods:   c.AllowedMethods,
+			AllowedHeaders:   c.AllowedHeaders,
+			ExposedHeaders:   c.ExposedHeaders,
+			MaxAge:           c.MaxAge,
+			AllowCredentials: allowCredentials,
+		}),
+		origins: make(map[string]*cors.Cors, len(c.Origins)),
+	}
+
+	for _, o := range c.Origins {
+		exposedHeaders := o.ExposedHeaders
+		if exposedHeaders == nil {
+			exposedHeaders = c.ExposedHeaders
+		}
+		maxAge := o.MaxAge
+		if maxAge == 0 {
+			maxAge = c.MaxAge
+		}
+		p.origins[strings.ToLower(o.Origin)] = cors.New(cors.Options{
+			AllowedOrigins:   []string{o.Origin},
+			AllowedMethods:   c.AllowedMethods,
+			AllowedHeaders:   c.AllowedHeaders,
+			ExposedHeaders:   exposedHeaders,
+			MaxAge:           maxAge,
+			AllowCredentials: o.AllowCredentials,
+		})
+	}
+	return
+}
+
+func (p *corsPolicy) HandlerFunc(rw http.ResponseWriter, req *http.Request) {
+	if c, ok := p.origins[strings.ToLower(req.Header.Get(HeaderOrigin))]; ok {
+		c.HandlerFunc(rw, req)
+		return
+	}
+	p.defaultPolicy.HandlerFunc(rw, req)
+}
+
+// isCORSPreflight returns true for CORS preflight requests, i.e. cross-origin
+// OPTIONS requests with Origin and Access-Control-Request-Method headers. The
+// CORS policy answers preflight requests itself. All other OPTIONS requests,
+// notably those without an Origin header, are routed like any other request,
+// e.g. to the auto-OPTIONS response when response.auto_options is enabled.
+func isCORSPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get(HeaderOrigin) != "" && req.Header.Get(HeaderAccessControlRequestMethod) != ""
+}
+
+func corsOriginsWildcard(origins []string) bool {
+	if len(origins) == 0 {
+		return true
+	}
+	for _, origin := range origins {
+		if strings.Contains(origin, "*") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func corsRequest(p *corsPolicy, method, origin string) http.Header {
+	req, _ := http.NewRequest(method, "/", nil)
+	req.Header.Set("Origin", origin)
+	if method == "OPTIONS" {
+		req.Header.Set(HeaderAccessControlRequestMethod, "GET")
+	}
+	rw := httptest.NewRecorder()
+	p.HandlerFunc(rw, req)
+	return rw.Header()
+}
+
+func TestCORSCredentialsNeverWildcard(t *testing.T) {
+	for _, origins := range [][]string{nil, {"*"}, {"https://*.example.com"}} {
+		config := new(ServiceConfig)
+		config.CORS.AllowedOrigins = origins
+		config.CORS.AllowCredentials = true
+		config.Normalize()
+
+		p, dropped := newCORSPolicy(config)
+		if !dropped {
+			t.Errorf("%v: expected credentials to be dropped", origins)
+		}
+		h := corsRequest(p, "GET", "https://app.example.com")
+		if h.Get("Access-Control-Allow-Origin") == "" {
+			t.Errorf("%v: expected origin to be allowed", origins)
+		}
+		if h.Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("%v: unexpected credentials for wildcard origin", origins)
+		}
+	}
+
+	config := new(ServiceConfig)
+	config.CORS.AllowedOrigins = []string{"https://app.example.com"}
+	config.CORS.AllowCredentials = true
+	config.Normalize()
+	p, dropped := newCORSPolicy(config)
+	if dropped {
+		t.Error("expected credentials for explicit origins")
+	}
+	if h := corsRequest(p, "GET", "https://app.example.com"); h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("expected credentials for explicit origin")
+	}
+}
+
+func TestCORSOriginOverrides(t *testing.T) {
+	config := new(ServiceConfig)
+	config.CORS.ExposedHeaders = []string{HeaderETag}
+	config.CORS.MaxAge = 60
+	config.CORS.Origins = []CORSOrigin{{
+		Origin:           "https://partner.example.com",
+		AllowCredentials: true,
+		ExposedHeaders:   []string{HeaderLocation},
+		MaxAge:           600,
+	}}
+	config.Normalize()
+	p, _ := newCORSPolicy(config)
+
+	h := corsRequest(p, "GET", "https://partner.example.com")
+	if h.Get("Access-Control-Allow-Origin") != "https://partner.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("expected credentialed response for trusted origin, got %v", h)
+	}
+	if h.Get("Access-Control-Expose-Headers") != HeaderLocation {
+		t.Errorf("expected overridden exposed headers, got %v", h)
+	}
+	if h = corsRequest(p, "OPTIONS", "https://partner.example.com"); h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("expected overridden max age, got %v", h)
+	}
+
+	h = corsRequest(p, "GET", "https://other.example.com")
+	if h.Get("Access-Control-Allow-Origin") != "*" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("expected uncredentialed wildcard response for other origin, got %v", h)
+	}
+	if h.Get("Access-Control-Expose-Headers") != http.CanonicalHeaderKey(HeaderETag) {
+		t.Errorf("expected default exposed headers, got %v", h)
+	}
+	if h = corsRequest(p, "OPTIONS", "https://other.example.com"); h.Get("Access-Control-Max-Age") != "60" {
+		t.Errorf("expected default max age, got %v", h)
+	}
+}
+
+func TestCORSOriginValidation(t *testing.T) {
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.CORS.Origins = []CORSOrigin{{Origin: "https://*.example.com"}}
+	config.Normalize()
+	if err := config.Validate(); err != ErrInvalidCORSOrigin {
+		t.Errorf("expected ErrInvalidCORSOrigin, got %v", err)
+	}
+}
+
+func TestCORSAutoOptionsPrecedence(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.CORS.Enabled = true
+		config.CORS.AllowedOrigins = []string{"https://app.example.com"}
+		config.CORS.AllowedMethods = []string{"GET"}
+		config.Response.AutoOptions = true
+	})
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	s.cors, _ = newCORSPolicy(s.config) // as Run would
+
+	serve := func(origin string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("OPTIONS", "/ping", nil)
+		if origin != "" {
+			req.Header.Set(HeaderOrigin, origin)
+		}
+		req.Header.Set(HeaderAccessControlRequestMethod, "GET")
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	// Cross-origin requests get the CORS preflight response
+	rw := serve("https://app.example.com")
+	if rw.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("expected a CORS preflight response, got headers %v", rw.Header())
+	}
+	if allow := rw.Header().Get(HeaderAllow); allow != "" {
+		t.Errorf("unexpected %s header in preflight response: %q", HeaderAllow, allow)
+	}
+
+	// Requests without an Origin get the auto-OPTIONS response
+	rw = serve("")
+	if rw.Code != http.StatusNoContent {
+		t.Errorf("expected 204/No Content, got %d", rw.Code)
+	}
+	if allow := rw.Header().Get(HeaderAllow); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("unexpected %s header: %q", HeaderAllow, allow)
+	}
+	if rw.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unexpected CORS headers: %v", rw.Header())
+	}
+}
@@ -1 +1,87 @@
 package luddite
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Identity describes the client that presented an API key.
+type Identity struct {
+	// ID uniquely identifies the client, e.g. a partner account ID.
+	ID string
+	// Name is a human-readable client name.
+	Name string
+	// Attributes holds optional client metadata, e.g. rate limit tiers.
+	Attributes map[string]string
+}
+
+type apiKeyHandler struct {
+	lookup   func(key string) (Identity, bool)
+	prefixes []string
+}
+
+// NewAPIKeyHandler returns a middleware handler that requires requests to
+// present a known API key in the X-Api-Key header. Keys are resolved to
+// identities using lookup; requests with missing or unknown keys are rejected
+// with 401 Unauthorized and a WWW-Authenticate challenge. The resolved
+// identity is available to downstream handlers via ContextIdentity.
+//
+// When path prefixes are given only requests whose URL paths begin with one of
+// them require a key. Prefixes are matched against the full request path,
+// including any service prefix, at path segment boundaries, i.e. "/admin"
+// matches "/admin/users" but not "/administrator".
+func NewAPIKeyHandler(lookup func(key string) (Identity, bool), prefixes ...string) http.Handler {
+	return &apiKeyHandler{
+		lookup:   lookup,
+		prefixes: prefixes,
+	}
+}
+
+func (h *apiKeyHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !hasPathPrefixes(req.URL.Path, h.prefixes) {
+		return
+	}
+
+	key := req.Header.Get(HeaderApiKey)
+	if key == "" {
+		h.reject(rw)
+		return
+	}
+	identity, ok := h.lookup(key)
+	if !ok {
+		h.reject(rw)
+		return
+	}
+
+	if d := contextHandlerDetails(req.Context()); d != nil {
+		d.identity = &identity
+	}
+}
+
+func (h *apiKeyHandler) reject(rw http.ResponseWriter) {
+	rw.Header().Set(HeaderWWWAuthenticate, "ApiKey header=\""+HeaderApiKey+"\"")
+	_ = WriteResponse(rw, ErrorStatus(EcodeApiKeyInvalid), NewError(nil, EcodeApiKeyInvalid))
+}
+
+// hasPathPrefix returns true if a URL path is prefix or lies beneath it, i.e.
+// the prefix ends at a path segment boundary.
+func hasPathPrefix(p, prefix string) bool {
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	return len(p) == len(prefix) || strings.HasSuffix(prefix, "/") || p[len(prefix)] == '/'
+}
+
+// hasPathPrefixes returns true if a URL path has any of the prefixes, as
+// hasPathPrefix does, or if there are none, i.e. all paths are covered.
+func hasPathPrefixes(p string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if hasPathPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
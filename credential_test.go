@@ -0,0 +1,94 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type identityResource struct {
+	identity Identity
+	ok       bool
+}
+
+func (r *identityResource) Get(req *http.Request) (int, interface{}) {
+	r.identity, r.ok = ContextIdentity(req.Context())
+	return http.StatusOK, "ok"
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	s := newTestService(t, nil)
+	s.AddHandler(NewAPIKeyHandler(func(key string) (Identity, bool) {
+		if key == "secret" {
+			return Identity{ID: "acme", Name: "Acme"}, true
+		}
+		return Identity{}, false
+	}, "/partner"))
+	partner := &identityResource{}
+	public := &identityResource{}
+	if err := s.AddResource(1, "/partner", partner); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/public", public); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddResource(1, "/partnership", &identityResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var challenge string
+	serve := func(path, key string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set(HeaderApiKey, key)
+		}
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		challenge = rw.Header().Get(HeaderWWWAuthenticate)
+		return rw.Code
+	}
+
+	if code := serve("/partner", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401/Unauthorized without key, got %d", code)
+	}
+	if challenge == "" {
+		t.Errorf("expected a %s challenge", HeaderWWWAuthenticate)
+	}
+	if code := serve("/partner", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401/Unauthorized with unknown key, got %d", code)
+	}
+	if code := serve("/partner", "secret"); code != http.StatusOK {
+		t.Errorf("expected 200/OK with known key, got %d", code)
+	}
+	if !partner.ok || partner.identity.ID != "acme" {
+		t.Errorf("expected identity acme in context, got %v", partner.identity)
+	}
+	if code := serve("/public", ""); code != http.StatusOK {
+		t.Errorf("expected 200/OK for unscoped path, got %d", code)
+	}
+	if public.ok {
+		t.Error("expected no identity for unscoped path")
+	}
+	if code := serve("/partnership", ""); code != http.StatusOK {
+		t.Errorf("expected 200/OK for path that only shares the prefix's characters, got %d", code)
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	for _, test := range []struct {
+		path, prefix string
+		match        bool
+	}{
+		{"/admin", "/admin", true},
+		{"/admin/users", "/admin", true},
+		{"/admin/users", "/admin/", true},
+		{"/administrator", "/admin", false},
+		{"/admin", "/admin/", false},
+		{"/anything", "/", true},
+	} {
+		if match := hasPathPrefix(test.path, test.prefix); match != test.match {
+			t.Errorf("hasPathPrefix(%q, %q): expected %t", test.path, test.prefix, test.match)
+		}
+	}
+}
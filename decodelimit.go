@@ -0,0 +1,57 @@
+package luddite
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// errDecodeLimit occurs when a request body exceeds the service's decode
+// limit.
+var errDecodeLimit = errors.New("request body exceeds the decode limit")
+
+// decodeLimitReader fails reads once more than n bytes have been read.
+type decodeLimitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *decodeLimitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Probe for more data: only fail if the body actually continues
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n == 0 {
+			return 0, err
+		}
+		return 0, errDecodeLimit
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// limitDecodeBody returns a request's body capped at the service's decode
+// limit, if any.
+func limitDecodeBody(req *http.Request) io.Reader {
+	if s := ContextService(req.Context()); s != nil && s.config.Response.MaxDecodeBytes > 0 {
+		return &decodeLimitReader{r: req.Body, n: s.config.Response.MaxDecodeBytes}
+	}
+	return req.Body
+}
+
+// decodeError converts an error from reading or decoding a request body to an
+// *Error, distinguishing bodies over the decode limit from those over the
+// transport limit (see http.MaxBytesReader).
+func decodeError(req *http.Request, err error) *Error {
+	s := ContextService(req.Context())
+	switch {
+	case err == errDecodeLimit && s != nil:
+		return NewError(nil, EcodeDecodeTooLarge, s.config.Response.MaxDecodeBytes)
+	case err.Error() == "http: request body too large" && s != nil:
+		return NewError(nil, EcodeRequestTooLarge, s.config.Limits.MaxRequestBodyBytes)
+	}
+	return NewError(nil, EcodeDeserializationFailed, err)
+}
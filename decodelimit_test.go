@@ -0,0 +1,61 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxDecodeBytes(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Response.MaxDecodeBytes = 32
+		config.Limits.MaxRequestBodyBytes = 64
+	})
+	if err := s.AddResource(1, "/gadgets", &gadgetResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/signed", &signedResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(ct, body string) *httptest.ResponseRecorder {
+		path := "/gadgets"
+		if ct == ContentTypeXml {
+			path = "/signed"
+		}
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set(HeaderContentType, ct)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+	name := func(n int) string {
+		return `{"name":"` + strings.Repeat("x", n) + `"}`
+	}
+
+	if rw := post(ContentTypeJson, name(20)); rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK within the decode limit, got %d", rw.Code)
+	}
+	if rw := post(ContentTypeJson, name(21)); rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK at exactly the decode limit, got %d", rw.Code)
+	}
+	rw := post(ContentTypeJson, name(40))
+	if rw.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rw.Body.String(), EcodeDecodeTooLarge) {
+		t.Errorf("expected 413/Request Entity Too Large with %s, got %d: %s", EcodeDecodeTooLarge, rw.Code, rw.Body.String())
+	}
+	rw = post(ContentTypeXml, "<gadget><name>"+strings.Repeat("x", 40)+"</name></gadget>")
+	if rw.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rw.Body.String(), EcodeDecodeTooLarge) {
+		t.Errorf("expected 413/Request Entity Too Large for XML, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	// Without a decode limit the transport limit applies
+	s.config.Response.MaxDecodeBytes = -1
+	if rw := post(ContentTypeJson, name(40)); rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK without a decode limit, got %d", rw.Code)
+	}
+	rw = post(ContentTypeJson, name(100))
+	if rw.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rw.Body.String(), EcodeRequestTooLarge) {
+		t.Errorf("expected 413/Request Entity Too Large with %s, got %d: %s", EcodeRequestTooLarge, rw.Code, rw.Body.String())
+	}
+}
@@ -0,0 +1,111 @@
+package luddite
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrEnvelopeStreamClosed occurs when sending to an envelope stream that has
+// been closed.
+var ErrEnvelopeStreamClosed = errors.New("envelope stream closed")
+
+// EnvelopeStream writes a JSON collection response of the form
+// `{"meta": {...}, "data": [...]}` without buffering the data array. The meta
+// object is written first, then each element is flushed to the client as it is
+// sent. Elements are serialized using the response's JSON settings. It is safe
+// to send elements from multiple goroutines.
+type EnvelopeStream struct {
+	sync.Mutex
+	rw      http.ResponseWriter
+	flusher http.Flusher
+	done    <-chan struct{}
+	count   int
+	closed  bool
+}
+
+// NewEnvelopeStream begins an enveloped JSON response with the given status
+// and meta object, e.g. pagination and total count information. Resource
+// handlers must call Close before returning a zero status.
+func NewEnvelopeStream(rw http.ResponseWriter, req *http.Request, status int, meta interface{}) (*EnvelopeStream, error) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	b, err := marshalJSON(rw, meta)
+	if err != nil {
+		return nil, err
+	}
+	ExemptResponseSizeLimit(rw)
+
+	h := rw.Header()
+	h.Set(HeaderContentType, ContentTypeJson)
+	h.Del(HeaderContentLength)
+	rw.WriteHeader(status)
+
+	es := &EnvelopeStream{
+		rw:      rw,
+		flusher: flusher,
+		done:    req.Context().Done(),
+	}
+	if err = es.write([]byte(`{"meta":`), b, []byte(`,"data":[`)); err != nil {
+		return nil, err
+	}
+	return es, nil
+}
+
+// Send writes an element to the stream's data array.
+func (es *EnvelopeStream) Send(v interface{}) error {
+	b, err := marshalJSON(es.rw, v)
+	if err != nil {
+		return err
+	}
+
+	es.Lock()
+	defer es.Unlock()
+	if es.closed {
+		return ErrEnvelopeStreamClosed
+	}
+	if es.count > 0 {
+		err = es.write([]byte(","), b)
+	} else {
+		err = es.write(b)
+	}
+	if err == nil {
+		es.count++
+	}
+	return err
+}
+
+// Count returns the number of elements sent.
+func (es *EnvelopeStream) Count() int {
+	es.Lock()
+	defer es.Unlock()
+	return es.count
+}
+
+// Close ends the data array and the envelope. Subsequent sends fail.
+func (es *EnvelopeStream) Close() error {
+	es.Lock()
+	defer es.Unlock()
+	if es.closed {
+		return nil
+	}
+	es.closed = true
+	return es.write([]byte("]}"))
+}
+
+func (es *EnvelopeStream) write(bs ...[]byte) error {
+	select {
+	case <-es.done:
+		return ErrResponseCanceled
+	default:
+	}
+	for _, b := range bs {
+		if _, err := es.rw.Write(b); err != nil {
+			return err
+		}
+	}
+	es.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,63 @@
+package luddite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnvelopeStream(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/widgets", nil)
+	rw := httptest.NewRecorder()
+
+	es, err := NewEnvelopeStream(rw, req, http.StatusOK, map[string]int{"total": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJson {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	if !rw.Flushed {
+		t.Error("envelope meta not flushed")
+	}
+
+	if err = es.Send(map[string]string{"name": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = es.Send(map[string]string{"name": "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = es.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"meta":{"total":2},"data":[{"name":"a"},{"name":"b"}]}`
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("unexpected envelope, got: %q, expected: %q", body, expected)
+	}
+	if !json.Valid(rw.Body.Bytes()) {
+		t.Error("envelope is not valid JSON")
+	}
+	if n := es.Count(); n != 2 {
+		t.Errorf("expected 2 elements, got %d", n)
+	}
+	if err = es.Send("closed"); err != ErrEnvelopeStreamClosed {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEnvelopeStreamEmpty(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/widgets", nil)
+	rw := httptest.NewRecorder()
+
+	es, err := NewEnvelopeStream(rw, req, http.StatusOK, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = es.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if body := rw.Body.String(); body != `{"meta":null,"data":[]}` {
+		t.Errorf("unexpected envelope: %q", body)
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"fmt"
 )
 
+const (
+	ErrorFormatLuddite = "luddite"
+	ErrorFormatProblem = "problem"
+	ErrorFormatJSONAPI = "jsonapi"
+)
+
 const (
 	EcodeUnknown               = "UNKNOWN_ERROR"
 	EcodeInternal              = "INTERNAL_ERROR"
 	EcodeUnsupportedMediaType  = "UNSUPPORTED_MEDIA_TYPE"
+	EcodeNotAcceptable         = "NOT_ACCEPTABLE"
 	EcodeSerializationFailed   = "SERIALIZATION_FAILED"
 	EcodeDeserializationFailed = "DESERIALIZATION_FAILED"
 	EcodeResourceIdMismatch    = "RESOURCE_ID_MISMATCH"
@@ -22,12 +29,26 @@ const (
 	EcodeMissingViewParameter  = "MISSING_VIEW_PARAMETER"
 	EcodeInvalidViewParameter  = "INVALID_VIEW_PARAMETER"
 	EcodeInvalidParameterValue = "INVALID_PARAMETER_VALUE"
+	EcodeServiceNotReady       = "SERVICE_NOT_READY"
+	EcodeTooManyRequests       = "TOO_MANY_REQUESTS"
+	EcodeApiKeyInvalid         = "API_KEY_INVALID"
+	EcodeResponseInvalid       = "RESPONSE_INVALID"
+	EcodeBadRequest            = "BAD_REQUEST"
+	EcodeResourceBusy          = "RESOURCE_BUSY"
+	EcodeServiceUnavailable    = "SERVICE_UNAVAILABLE"
+	EcodeRequestTooLarge       = "REQUEST_TOO_LARGE"
+	EcodeDecodeTooLarge        = "DECODE_TOO_LARGE"
+	EcodeExpectationFailed     = "EXPECTATION_FAILED"
+	EcodeSignatureInvalid      = "SIGNATURE_INVALID"
+	EcodeTokenInvalid          = "TOKEN_INVALID"
+	EcodeRateLimited           = "RATE_LIMITED"
 )
 
 var commonErrorMap = map[string]string{
 	EcodeUnknown:               "Unknown error: %d",
 	EcodeInternal:              "Internal error: %v",
 	EcodeUnsupportedMediaType:  "Unsupported media type: %s",
+	EcodeNotAcceptable:         "Not acceptable, supported media types: %s",
 	EcodeSerializationFailed:   "Serialization failed: %s",
 	EcodeDeserializationFailed: "Deserialization failed: %s",
 	EcodeResourceIdMismatch:    "Resource identifier in URL doesn't match value in body",
@@ -41,6 +62,19 @@ var commonErrorMap = map[string]string{
 	EcodeMissingViewParameter:  "Missing view parameter: %s",
 	EcodeInvalidViewParameter:  "Invalid view parameter: %s",
 	EcodeInvalidParameterValue: "Invalid parameter value: %s -> %s",
+	EcodeServiceNotReady:       "Service is not ready to handle requests",
+	EcodeTooManyRequests:       "Too many concurrent requests",
+	EcodeApiKeyInvalid:         "Missing or unknown API key",
+	EcodeResponseInvalid:       "Response violates schema: %s",
+	EcodeBadRequest:            "Bad request: %s",
+	EcodeResourceBusy:          "Resource is at its concurrency limit",
+	EcodeServiceUnavailable:    "Service unavailable: %s",
+	EcodeRequestTooLarge:       "Request body exceeds %d bytes",
+	EcodeDecodeTooLarge:        "Request body too large to decode: exceeds %d bytes",
+	EcodeExpectationFailed:     "Upload rejected: %s",
+	EcodeSignatureInvalid:      "Missing, invalid or stale request signature",
+	EcodeTokenInvalid:          "Missing or invalid bearer token",
+	EcodeRateLimited:           "Rate limit exceeded",
 }
 
 // Error is a transfer object that is serialized as the body in 4xx and 5xx responses.
@@ -49,6 +83,7 @@ type Error struct {
 	Code    string   `json:"code" xml:"code"`
 	Message string   `json:"message" xml:"message"`
 	Stack   string   `json:"stack,omitempty" xml:"stack,omitempty"`
+	HelpURL string   `json:"help_url,omitempty" xml:"help_url,omitempty"`
 }
 
 func (e *Error) Error() string {
@@ -0,0 +1,63 @@
+package luddite
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/K-Phoen/negotiation"
+)
+
+type errorPage struct {
+	body        []byte
+	contentType string
+	mediaType   string
+}
+
+// SetErrorPage registers a custom document, e.g. a branded HTML page, for
+// responses with the given status that luddite generates itself: 404s for
+// unknown routes and 500s for recovered panics. The document is only served to
+// clients whose Accept header accepts its content type; other clients receive
+// the standard response. Error pages must be set before the service is run.
+func (s *Service) SetErrorPage(status int, body []byte, contentType string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	if s.errorPages == nil {
+		s.errorPages = make(map[int]*errorPage)
+	}
+	s.errorPages[status] = &errorPage{
+		body:        body,
+		contentType: contentType,
+		mediaType:   mediaType,
+	}
+}
+
+// writeErrorPage writes the custom error page for a status if one is
+// registered and acceptable to the client. It returns true if a response was
+// written.
+func (s *Service) writeErrorPage(rw http.ResponseWriter, req *http.Request, status int) bool {
+	page, ok := s.errorPages[status]
+	if !ok {
+		return false
+	}
+	accept := req.Header.Get(HeaderAccept)
+	if accept == "" {
+		return false
+	}
+	if _, err := negotiation.NegotiateAccept(accept, []string{page.mediaType}); err != nil {
+		return false
+	}
+
+	rw.Header().Set(HeaderContentType, page.contentType)
+	rw.Header().Del(HeaderSpirentInhibitResponse)
+	rw.WriteHeader(status)
+	_, _ = rw.Write(page.body)
+	return true
+}
+
+func (s *Service) notFoundHandler(rw http.ResponseWriter, req *http.Request) {
+	if !s.writeErrorPage(rw, req, http.StatusNotFound) {
+		notFoundHandler(rw, req)
+	}
+}
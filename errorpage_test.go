@@ -0,0 +1,64 @@
+package luddite
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type panicResource struct{}
+
+func (r *panicResource) Get(req *http.Request) (int, interface{}) {
+	panic("boom")
+}
+
+func TestErrorPages(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/panic", &panicResource{}); err != nil {
+		t.Fatal(err)
+	}
+	s.defaultLogger.Out = ioutil.Discard
+	s.SetErrorPage(http.StatusNotFound, []byte("<h1>Not here</h1>"), "text/html; charset=utf-8")
+	s.SetErrorPage(http.StatusInternalServerError, []byte("<h1>Oops</h1>"), "text/html; charset=utf-8")
+
+	serve := func(path, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set(HeaderAccept, accept)
+		}
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	tests := []struct {
+		path   string
+		accept string
+		status int
+		body   string
+	}{
+		{"/missing", "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusNotFound, "<h1>Not here</h1>"},
+		{"/missing", ContentTypeJson, http.StatusNotFound, ""},
+		{"/missing", "", http.StatusNotFound, ""},
+		{"/panic", ContentTypeHtml, http.StatusInternalServerError, "<h1>Oops</h1>"},
+	}
+	for _, test := range tests {
+		rw := serve(test.path, test.accept)
+		if rw.Code != test.status {
+			t.Errorf("%s (%s): expected status %d, got %d", test.path, test.accept, test.status, rw.Code)
+		}
+		if test.body != "" && rw.Body.String() != test.body {
+			t.Errorf("%s (%s): expected custom body, got %s", test.path, test.accept, rw.Body.String())
+		}
+		if test.body == "" && rw.Body.String() != "" {
+			t.Errorf("%s (%s): unexpected body %s", test.path, test.accept, rw.Body.String())
+		}
+	}
+
+	// Clients that don't accept the page get the standard error
+	rw := serve("/panic", ContentTypeJson)
+	if rw.Code != http.StatusInternalServerError || rw.Header().Get(HeaderContentType) != ContentTypeJson {
+		t.Errorf("expected standard JSON error, got %d %s", rw.Code, rw.Header().Get(HeaderContentType))
+	}
+}
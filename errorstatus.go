@@ -0,0 +1,153 @@
+package luddite
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errorStatuses maps error codes to the HTTP statuses that luddite responds
+// with. RegisterErrorStatus overrides entries.
+var errorStatuses = map[string]int{
+	EcodeUnknown:               http.StatusInternalServerError,
+	EcodeInternal:              http.StatusInternalServerError,
+	EcodeUnsupportedMediaType:  http.StatusUnsupportedMediaType,
+	EcodeNotAcceptable:         http.StatusNotAcceptable,
+	EcodeSerializationFailed:   http.StatusInternalServerError,
+	EcodeDeserializationFailed: http.StatusBadRequest,
+	EcodeResourceIdMismatch:    http.StatusBadRequest,
+	EcodeApiVersionInvalid:     http.StatusBadRequest,
+	EcodeApiVersionTooOld:      http.StatusGone,
+	EcodeApiVersionTooNew:      http.StatusNotImplemented,
+	EcodeValidationFailed:      http.StatusUnprocessableEntity,
+	EcodeLocked:                http.StatusLocked,
+	EcodeUpdatePreempted:       http.StatusConflict,
+	EcodeInvalidViewName:       http.StatusBadRequest,
+	EcodeMissingViewParameter:  http.StatusBadRequest,
+	EcodeInvalidViewParameter:  http.StatusBadRequest,
+	EcodeInvalidParameterValue: http.StatusBadRequest,
+	EcodeServiceNotReady:       http.StatusServiceUnavailable,
+	EcodeTooManyRequests:       http.StatusTooManyRequests,
+	EcodeApiKeyInvalid:         http.StatusUnauthorized,
+	EcodeResponseInvalid:       http.StatusInternalServerError,
+	EcodeBadRequest:            http.StatusBadRequest,
+	EcodeResourceBusy:          http.StatusServiceUnavailable,
+	EcodeServiceUnavailable:    http.StatusServiceUnavailable,
+	EcodeRequestTooLarge:       http.StatusRequestEntityTooLarge,
+	EcodeDecodeTooLarge:        http.StatusRequestEntityTooLarge,
+	EcodeExpectationFailed:     http.StatusExpectationFailed,
+	EcodeSignatureInvalid:      http.StatusUnauthorized,
+	EcodeTokenInvalid:          http.StatusUnauthorized,
+	EcodeRateLimited:           http.StatusTooManyRequests,
+}
+
+// errorHelpURLs maps error codes to documentation links for WriteResponse.
+// RegisterErrorHelpURL adds entries.
+var errorHelpURLs = make(map[string]string)
+
+// errorMappers convert domain errors to *Error values for WriteError.
+// RegisterErrorMapper appends entries.
+var errorMappers []func(err error) (*Error, bool)
+
+// RegisterErrorStatus sets the HTTP status used for an error code, both by
+// luddite's own error responses and by WriteResponse for errors written
+// without an explicit status. Like RegisterProblemType, it should be called
+// during initialization, before the service handles requests.
+func RegisterErrorStatus(code string, status int) {
+	errorStatuses[code] = status
+}
+
+// RegisterErrorHelpURL associates a documentation link, e.g. a migration
+// guide, with an error code. WriteResponse includes the link in the bodies of
+// errors with the code that don't carry their own HelpURL. Like
+// RegisterErrorStatus, it should be called during initialization, before the
+// service handles requests.
+func RegisterErrorHelpURL(code string, url string) {
+	errorHelpURLs[code] = url
+}
+
+// withHelpURL returns an error with its code's registered help URL, copying
+// it rather than modifying errors that may be shared.
+func withHelpURL(e *Error) *Error {
+	if e.HelpURL != "" {
+		return e
+	}
+	url, ok := errorHelpURLs[e.Code]
+	if !ok {
+		return e
+	}
+	c := *e
+	c.HelpURL = url
+	return &c
+}
+
+// ErrorStatus returns the HTTP status for an error code. Codes without a
+// registered status map to 500 Internal Server Error.
+func ErrorStatus(code string) int {
+	if status, ok := errorStatuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterErrorMapper adds a function that converts domain errors, e.g. a
+// storage layer's ErrNotFound, to *Error values for WriteError. Mappers are
+// consulted in registration order and the first match wins. Like
+// RegisterErrorStatus, it should be called during initialization, before the
+// service handles requests.
+func RegisterErrorMapper(mapper func(err error) (*Error, bool)) {
+	errorMappers = append(errorMappers, mapper)
+}
+
+// MapErrorIs returns an error mapper that converts errors matching target (as
+// determined by errors.Is) to *Error values with the given code and the
+// error's message.
+func MapErrorIs(target error, code string) func(err error) (*Error, bool) {
+	return func(err error) (*Error, bool) {
+		if !errors.Is(err, target) {
+			return nil, false
+		}
+		return &Error{Code: code, Message: err.Error()}, true
+	}
+}
+
+// MapErrorAs returns an error mapper that converts errors whose chain contains
+// an error of the type target points to (as determined by errors.As) to *Error
+// values with the given code and the error's message, e.g.
+// MapErrorAs(new(*os.PathError), code). Target is only used for its type.
+func MapErrorAs(target interface{}, code string) func(err error) (*Error, bool) {
+	typ := reflect.TypeOf(target).Elem()
+	return func(err error) (*Error, bool) {
+		if !errors.As(err, reflect.New(typ).Interface()) {
+			return nil, false
+		}
+		return &Error{Code: code, Message: err.Error()}, true
+	}
+}
+
+// WriteError writes an error response for a handler error. *Error values
+// (including wrapped ones) are written as-is; other errors are converted
+// using the registered error mappers. Errors that no mapper converts are
+// logged and written as 500 Internal Server Error. In all cases the status
+// is determined by the error code, as with ErrorStatus.
+func WriteError(rw http.ResponseWriter, req *http.Request, err error) error {
+	var e *Error
+	if !errors.As(err, &e) {
+		for _, mapper := range errorMappers {
+			var ok bool
+			if e, ok = mapper(err); ok {
+				break
+			}
+		}
+	}
+	if e == nil {
+		ContextLogger(req.Context()).WithFields(log.Fields{
+			"error":      err.Error(),
+			"request_id": ContextRequestId(req.Context()),
+		}).Error("unmapped handler error")
+		e = NewError(nil, EcodeInternal, err)
+	}
+	return WriteResponse(rw, ErrorStatus(e.Code), e)
+}
@@ -0,0 +1,135 @@
+package luddite
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteErrorStatus(t *testing.T) {
+	customErrors := map[string]string{"CUSTOM_ERROR": "Custom error"}
+	write := func(v interface{}) int {
+		rw := httptest.NewRecorder()
+		rw.Header().Set(HeaderContentType, ContentTypeJson)
+		if err := WriteResponse(rw, 0, v); err != nil {
+			t.Fatal(err)
+		}
+		return rw.Code
+	}
+
+	if status := write(NewError(nil, EcodeTooManyRequests)); status != http.StatusTooManyRequests {
+		t.Errorf("expected 429/Too Many Requests, got %d", status)
+	}
+	if status := write(NewError(customErrors, "CUSTOM_ERROR")); status != http.StatusInternalServerError {
+		t.Errorf("expected 500/Internal Server Error for an unregistered code, got %d", status)
+	}
+	if status := write(errors.New("boom")); status != http.StatusInternalServerError {
+		t.Errorf("expected 500/Internal Server Error, got %d", status)
+	}
+
+	RegisterErrorStatus("CUSTOM_ERROR", http.StatusTeapot)
+	defer delete(errorStatuses, "CUSTOM_ERROR")
+	if status := write(NewError(customErrors, "CUSTOM_ERROR")); status != http.StatusTeapot {
+		t.Errorf("expected 418/I'm a teapot, got %d", status)
+	}
+}
+
+func TestRegisterErrorStatus(t *testing.T) {
+	defer RegisterErrorStatus(EcodeApiVersionTooNew, ErrorStatus(EcodeApiVersionTooNew))
+	RegisterErrorStatus(EcodeApiVersionTooNew, http.StatusBadRequest)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderSpirentApiVersion, "3")
+	rw := httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+	newVersionHandler(1, 2, nil, "").ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("expected overridden 400/Bad Request, got %d", rw.Code)
+	}
+}
+
+func TestRegisterErrorHelpURL(t *testing.T) {
+	RegisterErrorHelpURL("CUSTOM_ERROR", "https://example.com/custom")
+	defer delete(errorHelpURLs, "CUSTOM_ERROR")
+
+	e := NewError(map[string]string{"CUSTOM_ERROR": "Custom error"}, "CUSTOM_ERROR")
+	rw := httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+	if err := WriteResponse(rw, http.StatusBadRequest, e); err != nil {
+		t.Fatal(err)
+	}
+	if body := rw.Body.String(); !strings.Contains(body, `"help_url":"https://example.com/custom"`) {
+		t.Errorf("expected registered help URL in body, got %s", body)
+	}
+	if e.HelpURL != "" {
+		t.Error("expected the written error not to be modified")
+	}
+
+	e.HelpURL = "https://example.com/specific"
+	rw = httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+	if err := WriteResponse(rw, http.StatusBadRequest, e); err != nil {
+		t.Fatal(err)
+	}
+	if body := rw.Body.String(); !strings.Contains(body, `"help_url":"https://example.com/specific"`) {
+		t.Errorf("expected error's own help URL in body, got %s", body)
+	}
+}
+
+var (
+	errWidgetMissing = errors.New("widget missing")
+	errWidgetTaken   = errors.New("widget taken")
+)
+
+type widgetLockedError struct {
+	owner string
+}
+
+func (e *widgetLockedError) Error() string {
+	return "widget locked by " + e.owner
+}
+
+func TestWriteError(t *testing.T) {
+	saved := errorMappers
+	defer func() { errorMappers = saved }()
+	RegisterErrorStatus("WIDGET_MISSING", http.StatusNotFound)
+	defer delete(errorStatuses, "WIDGET_MISSING")
+	RegisterErrorMapper(MapErrorIs(errWidgetMissing, "WIDGET_MISSING"))
+	RegisterErrorMapper(MapErrorAs(new(*widgetLockedError), EcodeLocked))
+	RegisterErrorMapper(func(err error) (*Error, bool) {
+		if err == errWidgetTaken {
+			return NewError(nil, EcodeUpdatePreempted), true
+		}
+		return nil, false
+	})
+
+	write := func(err error) (int, string) {
+		req, _ := http.NewRequest("GET", "/widgets/1", nil)
+		rw := httptest.NewRecorder()
+		rw.Header().Set(HeaderContentType, ContentTypeJson)
+		if err := WriteError(rw, req, err); err != nil {
+			t.Fatal(err)
+		}
+		return rw.Code, rw.Body.String()
+	}
+
+	if status, body := write(fmt.Errorf("get widget: %w", errWidgetMissing)); status != http.StatusNotFound || !strings.Contains(body, `"WIDGET_MISSING"`) {
+		t.Errorf("expected wrapped error to map to 404/Not Found, got %d: %s", status, body)
+	}
+	if status, body := write(fmt.Errorf("update: %w", &widgetLockedError{owner: "bob"})); status != http.StatusLocked || !strings.Contains(body, "locked by bob") {
+		t.Errorf("expected typed error to map to 423/Locked, got %d: %s", status, body)
+	}
+	if status, _ := write(errWidgetTaken); status != http.StatusConflict {
+		t.Errorf("expected custom mapper to map to 409/Conflict, got %d", status)
+	}
+	if status, body := write(fmt.Errorf("wrapped: %w", NewError(nil, EcodeTooManyRequests))); status != http.StatusTooManyRequests || !strings.Contains(body, EcodeTooManyRequests) {
+		t.Errorf("expected wrapped *Error to be written as-is, got %d: %s", status, body)
+	}
+	if status, body := write(errors.New("boom")); status != http.StatusInternalServerError || !strings.Contains(body, EcodeInternal) {
+		t.Errorf("expected unmapped error to be 500/Internal Server Error, got %d: %s", status, body)
+	}
+}
@@ -0,0 +1,60 @@
+package luddite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// AutoETagPolicy may be implemented by resource handler types to override the
+// service's response.auto_etag setting for their GET responses, e.g. to enable
+// automatic ETags only for cheap-to-hash endpoints.
+type AutoETagPolicy interface {
+	AutoETag() bool
+}
+
+// autoETag returns true if luddite computes ETags for the GET responses of the
+// resource that serves a request.
+func (s *Service) autoETag(d *handlerDetails) bool {
+	r := d.resource.find(func(r *resourceRegistration) bool { return r.autoETag != nil })
+	if r == nil {
+		return s.config.Response.AutoETag
+	}
+	return r.autoETag.AutoETag()
+}
+
+// bodyETag returns a strong ETag for a serialized response body.
+func bodyETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches returns true if an If-None-Match header value matches an ETag,
+// using the weak comparison that RFC 7232 specifies for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setAutoETag sets the ETag header of a successful GET response from its
+// serialized body, unless the handler has set one. It returns true if the
+// request's If-None-Match header matches, i.e. the client's copy is current.
+func setAutoETag(rw http.ResponseWriter, status int, b []byte) bool {
+	res, ok := rw.(*responseWriter)
+	if !ok || !res.autoETag || status != http.StatusOK || b == nil {
+		return false
+	}
+	etag := rw.Header().Get(HeaderETag)
+	if etag == "" {
+		etag = bodyETag(b)
+		rw.Header().Set(HeaderETag, etag)
+	}
+	return res.ifNoneMatch != "" && etagMatches(res.ifNoneMatch, etag)
+}
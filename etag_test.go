@@ -0,0 +1,79 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type unhashedResource struct {
+	pingResource
+}
+
+func (r *unhashedResource) AutoETag() bool {
+	return false
+}
+
+func TestAutoETag(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Response.AutoETag = true
+	})
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/unhashed", &unhashedResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set(HeaderIfNoneMatch, ifNoneMatch)
+		}
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := serve("/ping", "")
+	etag := rw.Header().Get(HeaderETag)
+	if rw.Code != http.StatusOK || etag != bodyETag(rw.Body.Bytes()) {
+		t.Fatalf("expected 200/OK with a body ETag, got %d with %q", rw.Code, etag)
+	}
+	rw = serve("/ping", `"other", `+etag)
+	if rw.Code != http.StatusNotModified {
+		t.Errorf("expected 304/Not Modified for a matching ETag, got %d", rw.Code)
+	}
+	if rw.Body.Len() != 0 || rw.Header().Get(HeaderETag) != etag {
+		t.Errorf("expected an empty 304 response with the ETag, got %q with %q", rw.Body.String(), rw.Header().Get(HeaderETag))
+	}
+	if code := serve("/ping", `"other"`).Code; code != http.StatusOK {
+		t.Errorf("expected 200/OK for a stale ETag, got %d", code)
+	}
+
+	rw = serve("/unhashed", "*")
+	if rw.Code != http.StatusOK || rw.Header().Get(HeaderETag) != "" {
+		t.Errorf("expected opted-out resource to be served without an ETag, got %d with %q", rw.Code, rw.Header().Get(HeaderETag))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		etag        string
+		matches     bool
+	}{
+		{`"a"`, `"a"`, true},
+		{`"b", "a"`, `"a"`, true},
+		{`W/"a"`, `"a"`, true},
+		{`"a"`, `W/"a"`, true},
+		{`*`, `"a"`, true},
+		{`"b"`, `"a"`, false},
+		{`a`, `"a"`, false},
+	}
+	for _, test := range tests {
+		if matches := etagMatches(test.ifNoneMatch, test.etag); matches != test.matches {
+			t.Errorf("%s vs %s: expected %v, got %v", test.ifNoneMatch, test.etag, test.matches, matches)
+		}
+	}
+}
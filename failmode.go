@@ -0,0 +1,57 @@
+package luddite
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// FailMode selects how a middleware handler behaves when one of its
+// dependencies (e.g. a token introspection endpoint or a schema file) fails.
+type FailMode string
+
+const (
+	// FailClosed denies requests when a dependency fails. It is the default
+	// and should always be used for sensitive endpoints.
+	FailClosed FailMode = "closed"
+	// FailOpen allows requests when a dependency fails, trading security
+	// for availability, e.g. for public endpoints.
+	FailOpen FailMode = "open"
+)
+
+var dependencyFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "luddite",
+	Subsystem: "middleware",
+	Name:      "dependency_failures_total",
+	Help:      "Number of middleware dependency failures by middleware and fail mode.",
+}, []string{"middleware", "fail_mode"})
+
+func (m FailMode) valid() bool {
+	return m == "" || m == FailClosed || m == FailOpen
+}
+
+// recordDependencyFailure logs and meters a middleware dependency failure
+// along with the fail mode applied to it. Services with metrics enabled
+// register the dependencyFailures metric.
+func recordDependencyFailure(ctx context.Context, logger *log.Logger, middleware string, mode FailMode, err error) {
+	if mode == "" {
+		mode = FailClosed
+	}
+	dependencyFailures.WithLabelValues(middleware, string(mode)).Inc()
+
+	fields := log.Fields{
+		"middleware": middleware,
+		"fail_mode":  string(mode),
+		"error":      err.Error(),
+	}
+	if requestId := ContextRequestId(ctx); requestId != "" {
+		fields["request_id"] = requestId
+	}
+	entry := logger.WithFields(fields)
+	if mode == FailOpen {
+		entry.Warn("middleware dependency failed: failing open")
+	} else {
+		entry.Error("middleware dependency failed: failing closed")
+	}
+}
@@ -0,0 +1,318 @@
+package luddite
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	FieldNameStyleAsIs  = "asis"
+	FieldNameStyleSnake = "snake"
+	FieldNameStyleCamel = "camel"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	// jsonFieldsCache maps struct types to their JSON field names.
+	jsonFieldsCache sync.Map
+)
+
+// fieldNameFunc returns the function that transforms JSON field names in a
+// style, or nil for the "asis" style.
+func fieldNameFunc(style string) func(string) string {
+	switch style {
+	case FieldNameStyleSnake:
+		return snakeCase
+	case FieldNameStyleCamel:
+		return camelCase
+	}
+	return nil
+}
+
+// snakeCase converts a field name to snake_case, treating runs of capitals as
+// acronyms, e.g. "UserID" and "HTTPServer" become "user_id" and "http_server".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					b.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// camelCase converts a field name to camelCase, e.g. "UserID", "HTTPServer"
+// and "user_id" become "userID", "httpServer" and "userId".
+func camelCase(s string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(s, "_") {
+		if part == "" {
+			continue
+		}
+		if i == 0 || b.Len() == 0 {
+			b.WriteString(lowerInitialism(part))
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(part)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(part[size:])
+	}
+	return b.String()
+}
+
+// lowerInitialism lowercases a name's leading run of capitals, leaving the last
+// one if it starts a word, e.g. "HTTPServer" becomes "httpServer".
+func lowerInitialism(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsUpper(r) {
+			break
+		}
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(r)
+	}
+	return string(runes)
+}
+
+// renameJSONFields transforms the keys of the objects in a compact JSON
+// document that was encoded from v, recursively. Keys named by explicit json
+// tags, such as those of luddite's error envelopes, and the output of JSON
+// and text marshalers are left as they are. Keys are re-encoded using the
+// response's HTML escaping setting.
+func renameJSONFields(b []byte, v reflect.Value, escapeHTML bool, rename func(string) string) ([]byte, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return b, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return b, nil
+	}
+	t := v.Type()
+	if hasCustomMarshaler(t) {
+		return b, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFields(t, identityFieldName)
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			f, ok := fields[key]
+			if !ok {
+				return key, elem, nil
+			}
+			if fv, ok := fieldByIndex(v, f.index); ok {
+				var err error
+				if elem, err = renameJSONFields(elem, fv, escapeHTML, rename); err != nil {
+					return key, elem, err
+				}
+			}
+			if f.tagged {
+				return key, elem, nil
+			}
+			return rename(key), elem, nil
+		}, escapeHTML)
+	case reflect.Map:
+		values := make(map[string]reflect.Value, v.Len())
+		for _, k := range v.MapKeys() {
+			if name, ok := jsonMapKey(k); ok {
+				values[name] = v.MapIndex(k)
+			}
+		}
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			elem, err := renameJSONFields(elem, values[key], escapeHTML, rename)
+			return rename(key), elem, err
+		}, escapeHTML)
+	case reflect.Slice, reflect.Array:
+		i := 0
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			if i >= v.Len() {
+				return key, elem, nil
+			}
+			elem, err := renameJSONFields(elem, v.Index(i), escapeHTML, rename)
+			i++
+			return key, elem, err
+		}, escapeHTML)
+	}
+	return b, nil
+}
+
+// restoreJSONFieldNames reverses renameJSONFields for a request body that is
+// decoded into a value of type t: keys that are transformed names of struct
+// fields are replaced with the fields' JSON names. Other keys, including those
+// of maps and of values decoded into interfaces, are left as they are.
+func restoreJSONFieldNames(b []byte, t reflect.Type, rename func(string) string) ([]byte, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return b, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFields(t, rename)
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			f, ok := fields[key]
+			if !ok {
+				return key, elem, nil
+			}
+			elem, err := restoreJSONFieldNames(elem, f.typ, rename)
+			return f.name, elem, err
+		}, false)
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			elem, err := restoreJSONFieldNames(elem, t.Elem(), rename)
+			return key, elem, err
+		}, false)
+	}
+	return b, nil
+}
+
+type jsonField struct {
+	name   string
+	typ    reflect.Type
+	index  []int
+	tagged bool
+}
+
+// jsonFields maps the transformed JSON names of a struct type's fields to
+// their JSON names, types and indexes, including the promoted fields of
+// embedded structs, as encoding/json would see them. Names given by explicit
+// json tags aren't transformed.
+func jsonFields(t reflect.Type, rename func(string) string) map[string]jsonField {
+	type cacheKey struct {
+		t      reflect.Type
+		rename uintptr
+	}
+	key := cacheKey{t, reflect.ValueOf(rename).Pointer()}
+	if fields, ok := jsonFieldsCache.Load(key); ok {
+		return fields.(map[string]jsonField)
+	}
+
+	type embeddedStruct struct {
+		t     reflect.Type
+		index int
+	}
+	fields := make(map[string]jsonField)
+	var embedded []embeddedStruct
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("json")
+		if i := strings.IndexByte(name, ','); i >= 0 {
+			name = name[:i]
+		}
+		if name == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, embeddedStruct{ft, i})
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+		}
+		if name != "" {
+			fields[name] = jsonField{name, f.Type, []int{i}, true}
+			continue
+		}
+		fields[rename(f.Name)] = jsonField{f.Name, f.Type, []int{i}, false}
+	}
+
+	// NB: Fields of the outer struct take precedence over promoted fields
+	for _, e := range embedded {
+		for k, f := range jsonFields(e.t, rename) {
+			if _, ok := fields[k]; !ok {
+				f.index = append([]int{e.index}, f.index...)
+				fields[k] = f
+			}
+		}
+	}
+
+	jsonFieldsCache.Store(key, fields)
+	return fields
+}
+
+// rewriteJSONObjects rewrites the members of the top-level object or array of a
+// compact JSON document using fn, which is given an empty key for array
+// elements. Scalar documents are returned as they are.
+func rewriteJSONObjects(b []byte, fn func(key string, elem json.RawMessage) (string, json.RawMessage, error), escapeHTML bool) ([]byte, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || (b[0] != '{' && b[0] != '[') {
+		return b, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	out := new(bytes.Buffer)
+	out.WriteByte(b[0])
+	first := true
+	for dec.More() {
+		var key string
+		if b[0] == '{' {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key = t.(string)
+		}
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return nil, err
+		}
+		key, elem, err := fn(key, elem)
+		if err != nil {
+			return nil, err
+		}
+		if !first {
+			out.WriteByte(',')
+		}
+		first = false
+		if b[0] == '{' {
+			k, err := marshalJSONString(key, escapeHTML)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(k)
+			out.WriteByte(':')
+		}
+		out.Write(elem)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if b[0] == '{' {
+		out.WriteByte('}')
+	} else {
+		out.WriteByte(']')
+	}
+	return out.Bytes(), nil
+}
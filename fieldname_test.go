@@ -0,0 +1,145 @@
+package luddite
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFieldNameStyles(t *testing.T) {
+	for _, c := range []struct {
+		name, snake, camel string
+	}{
+		{"Name", "name", "name"},
+		{"UserID", "user_id", "userID"},
+		{"HTTPServer", "http_server", "httpServer"},
+		{"ID", "id", "id"},
+		{"Port8080", "port8080", "port8080"},
+		{"user_id", "user_id", "userId"},
+		{"createdAt", "created_at", "createdAt"},
+	} {
+		if s := snakeCase(c.name); s != c.snake {
+			t.Errorf("expected snakeCase(%q) to be %q, got %q", c.name, c.snake, s)
+		}
+		if s := camelCase(c.name); s != c.camel {
+			t.Errorf("expected camelCase(%q) to be %q, got %q", c.name, c.camel, s)
+		}
+	}
+}
+
+type styledOwner struct {
+	UserID string
+}
+
+type styledBase struct {
+	CreatedBy string
+}
+
+type styledThing struct {
+	styledBase
+	ThingID     string
+	DisplayName string `json:"display_name"`
+	Owner       *styledOwner
+	Tags        map[string]int
+}
+
+type styledResource struct {
+	created *styledThing
+}
+
+func (r *styledResource) New() interface{} {
+	return new(styledThing)
+}
+
+func (r *styledResource) Id(value interface{}) string {
+	return value.(*styledThing).ThingID
+}
+
+func (r *styledResource) Create(req *http.Request, value interface{}) (int, interface{}) {
+	r.created = value.(*styledThing)
+	return http.StatusCreated, value
+}
+
+func TestFieldNameStyleSnake(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Response.FieldNameStyle = FieldNameStyleSnake
+	})
+	r := &styledResource{}
+	if err := s.AddResource(1, "/things", r); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"thing_id":"1","display_name":"Thing","created_by":"me","owner":{"user_id":"u1"},"tags":{"HotPink":1}}`
+	req, _ := http.NewRequest("POST", "/things", bytes.NewBufferString(body))
+	req.Header.Set(HeaderContentType, ContentTypeJson)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("expected 201/Created, got %d: %s", rw.Code, rw.Body.String())
+	}
+	c := r.created
+	if c.ThingID != "1" || c.DisplayName != "Thing" || c.CreatedBy != "me" || c.Owner == nil || c.Owner.UserID != "u1" || c.Tags["HotPink"] != 1 {
+		t.Errorf("expected snake_case fields to be decoded, got %+v", c)
+	}
+	expected := `{"created_by":"me","thing_id":"1","display_name":"Thing","owner":{"user_id":"u1"},"tags":{"hot_pink":1}}`
+	if rw.Body.String() != expected {
+		t.Errorf("expected snake_case response %s, got %s", expected, rw.Body.String())
+	}
+}
+
+func TestFieldNameStyleInvalid(t *testing.T) {
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.Response.FieldNameStyle = "kebab"
+	if _, err := NewService(config); err != ErrInvalidFieldNameStyle {
+		t.Errorf("expected ErrInvalidFieldNameStyle, got %v", err)
+	}
+}
+
+type helpErrorResource struct{}
+
+func (r *helpErrorResource) Get(req *http.Request) (int, interface{}) {
+	e := NewError(nil, EcodeInternal)
+	e.HelpURL = "https://example.com/help"
+	return http.StatusInternalServerError, e
+}
+
+func TestFieldNameStyleExplicitTags(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Response.FieldNameStyle = FieldNameStyleCamel
+	})
+	r := &styledResource{}
+	if err := s.AddResource(1, "/things", r); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"thingID":"1","display_name":"Thing","createdBy":"me"}`
+	req, _ := http.NewRequest("POST", "/things", bytes.NewBufferString(body))
+	req.Header.Set(HeaderContentType, ContentTypeJson)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("expected 201/Created, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if r.created.DisplayName != "Thing" {
+		t.Errorf("expected explicitly tagged field to be decoded, got %+v", r.created)
+	}
+	expected := `{"createdBy":"me","thingID":"1","display_name":"Thing","owner":null,"tags":null}`
+	if rw.Body.String() != expected {
+		t.Errorf("expected camelCase response %s, got %s", expected, rw.Body.String())
+	}
+
+	// Error envelopes keep their field names
+	if err := s.AddResource(1, "/broken", &helpErrorResource{}); err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest("GET", "/broken", nil)
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if b := rw.Body.String(); !strings.Contains(b, `"help_url"`) {
+		t.Errorf("expected help_url in error response, got %s", b)
+	}
+}
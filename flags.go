@@ -0,0 +1,59 @@
+package luddite
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// FeatureFlagProvider resolves feature flags for a request, e.g. based on its
+// tenant or user. Flags is called at most once per request, the first time a
+// handler asks for a flag.
+type FeatureFlagProvider interface {
+	Flags(ctx context.Context) map[string]bool
+}
+
+// SetFeatureFlagProvider sets the provider used to resolve per-request feature
+// flags, which are available to handlers via ContextFlag.
+func (s *Service) SetFeatureFlagProvider(provider FeatureFlagProvider) {
+	s.flagProvider = provider
+}
+
+// ContextFlag returns whether a feature flag is enabled for the current HTTP
+// request from a context.Context, if possible. Flags are resolved using the
+// service's FeatureFlagProvider on first use and cached for the remainder of
+// the request. Unknown flags are disabled.
+func ContextFlag(ctx context.Context, name string) bool {
+	d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails)
+	if !ok || d.s.flagProvider == nil {
+		return false
+	}
+	if !d.flagsResolved {
+		d.flags = d.s.flagProvider.Flags(ctx)
+		d.flagsResolved = true
+	}
+	return d.flags[name]
+}
+
+// formatFlags formats resolved flags for trace annotations, e.g.
+// "a=true,b=false".
+func formatFlags(flags map[string]bool) string {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		if flags[name] {
+			b.WriteString("=true")
+		} else {
+			b.WriteString("=false")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package luddite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type countingFlagProvider struct {
+	calls int
+}
+
+func (p *countingFlagProvider) Flags(ctx context.Context) map[string]bool {
+	p.calls++
+	return map[string]bool{"beta": ContextRequest(ctx).Header.Get("X-Tenant") == "acme"}
+}
+
+type flaggedResource struct{}
+
+func (r *flaggedResource) Get(req *http.Request) (int, interface{}) {
+	ctx := req.Context()
+	if ContextFlag(ctx, "beta") && !ContextFlag(ctx, "unknown") {
+		return http.StatusOK, "beta"
+	}
+	return http.StatusOK, "stable"
+}
+
+func TestContextFlag(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/flagged", &flaggedResource{}); err != nil {
+		t.Fatal(err)
+	}
+	provider := &countingFlagProvider{}
+	s.SetFeatureFlagProvider(provider)
+
+	serve := func(tenant string) string {
+		req, _ := http.NewRequest("GET", "/flagged", nil)
+		req.Header.Set(HeaderAccept, ContentTypePlain)
+		req.Header.Set("X-Tenant", tenant)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw.Body.String()
+	}
+
+	if body := serve("acme"); body != "beta" {
+		t.Errorf("expected flag to be enabled, got %s", body)
+	}
+	if body := serve("other"); body != "stable" {
+		t.Errorf("expected flag to be disabled, got %s", body)
+	}
+	if provider.calls != 2 {
+		t.Errorf("expected flags to be resolved once per request, got %d calls", provider.calls)
+	}
+
+	if ContextFlag(context.Background(), "beta") {
+		t.Error("expected flag to be disabled outside a request")
+	}
+}
+
+func TestFormatFlags(t *testing.T) {
+	if s := formatFlags(map[string]bool{"b": false, "a": true}); s != "a=true,b=false" {
+		t.Errorf("unexpected formatted flags: %s", s)
+	}
+}
@@ -1,35 +1,76 @@
 package luddite
 
 import (
+	"fmt"
 	"math"
 	"net/http"
 	"net/url"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 const (
-	HeaderAccept                 = "Accept"
-	HeaderAcceptEncoding         = "Accept-Encoding"
-	HeaderAuthorization          = "Authorization"
-	HeaderCacheControl           = "Cache-Control"
-	HeaderContentDisposition     = "Content-Disposition"
-	HeaderContentEncoding        = "Content-Encoding"
-	HeaderContentLength          = "Content-Length"
-	HeaderContentType            = "Content-Type"
-	HeaderETag                   = "ETag"
-	HeaderExpect                 = "Expect"
-	HeaderForwardedFor           = "X-Forwarded-For"
-	HeaderForwardedHost          = "X-Forwarded-Host"
-	HeaderIfNoneMatch            = "If-None-Match"
-	HeaderLocation               = "Location"
-	HeaderRequestId              = "X-Request-Id"
-	HeaderSessionId              = "X-Session-Id"
-	HeaderSpirentApiVersion      = "X-Spirent-Api-Version"
-	HeaderSpirentInhibitResponse = "X-Spirent-Inhibit-Response"
-	HeaderSpirentNextLink        = "X-Spirent-Next-Link"
-	HeaderSpirentPageSize        = "X-Spirent-Page-Size"
-	HeaderSpirentResourceNonce   = "X-Spirent-Resource-Nonce"
-	HeaderUserAgent              = "User-Agent"
+	HeaderAccept                     = "Accept"
+	HeaderAcceptEncoding             = "Accept-Encoding"
+	HeaderAcceptPatch                = "Accept-Patch"
+	HeaderAcceptPost                 = "Accept-Post"
+	HeaderAcceptRanges               = "Accept-Ranges"
+	HeaderAccelBuffering             = "X-Accel-Buffering"
+	HeaderAllow                      = "Allow"
+	HeaderAccessControlRequestMethod = "Access-Control-Request-Method"
+	HeaderApiKey                     = "X-Api-Key"
+	HeaderAuthorization              = "Authorization"
+	HeaderCacheControl               = "Cache-Control"
+	HeaderContentDisposition         = "Content-Disposition"
+	HeaderContentEncoding            = "Content-Encoding"
+	HeaderContentLength              = "Content-Length"
+	HeaderContentRange               = "Content-Range"
+	HeaderContentSHA256              = "X-Content-Sha256"
+	HeaderContentType                = "Content-Type"
+	HeaderContentTypeOptions         = "X-Content-Type-Options"
+	HeaderDeprecation                = "Deprecation"
+	HeaderDryRun                     = "X-Dry-Run"
+	HeaderETag                       = "ETag"
+	HeaderExpect                     = "Expect"
+	HeaderForwardedFor               = "X-Forwarded-For"
+	HeaderForwardedHost              = "X-Forwarded-Host"
+	HeaderForwardedProto             = "X-Forwarded-Proto"
+	HeaderIfNoneMatch                = "If-None-Match"
+	HeaderIfRange                    = "If-Range"
+	HeaderLastModified               = "Last-Modified"
+	HeaderLink                       = "Link"
+	HeaderLocation                   = "Location"
+	HeaderOrigin                     = "Origin"
+	HeaderPrefer                     = "Prefer"
+	HeaderPreferenceApplied          = "Preference-Applied"
+	HeaderRange                      = "Range"
+	HeaderRetryAfter                 = "Retry-After"
+	HeaderRequestId                  = "X-Request-Id"
+	HeaderResponseId                 = "X-Response-Id"
+	HeaderSessionId                  = "X-Session-Id"
+	HeaderSignature                  = "X-Signature"
+	HeaderSignatureKeyId             = "X-Signature-Key-Id"
+	HeaderSignatureTimestamp         = "X-Signature-Timestamp"
+	HeaderSpirentApiVersion          = "X-Spirent-Api-Version"
+	HeaderSpirentInhibitResponse     = "X-Spirent-Inhibit-Response"
+	HeaderSpirentNextLink            = "X-Spirent-Next-Link"
+	HeaderSpirentPageSize            = "X-Spirent-Page-Size"
+	HeaderSpirentResourceNonce       = "X-Spirent-Resource-Nonce"
+	HeaderSunset                     = "Sunset"
+	HeaderTotalCount                 = "X-Total-Count"
+	HeaderTrailer                    = "Trailer"
+	HeaderUserAgent                  = "User-Agent"
+	HeaderVary                       = "Vary"
+	HeaderWarning                    = "Warning"
+	HeaderWWWAuthenticate            = "WWW-Authenticate"
+)
+
+const (
+	PreferCountExact           = "exact"
+	PreferReturnMinimal        = "minimal"
+	PreferReturnRepresentation = "representation"
 )
 
 func RequestBearerToken(r *http.Request) string {
@@ -40,18 +81,28 @@ func RequestBearerToken(r *http.Request) string {
 }
 
 func RequestExternalHost(r *http.Request) string {
-	if host := r.Header.Get(HeaderForwardedHost); host != "" {
+	if host := r.Header.Get(HeaderForwardedHost); host != "" && requestTrustsForwardedHeaders(r) {
 		return host
 	}
 	return r.Host
 }
 
+func RequestExternalScheme(r *http.Request) string {
+	if proto := r.Header.Get(HeaderForwardedProto); proto != "" && requestTrustsForwardedHeaders(r) {
+		// Use the client-facing (i.e. first) proxy's protocol
+		if i := strings.IndexByte(proto, ','); i >= 0 {
+			proto = proto[:i]
+		}
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
 func RequestNextLink(r *http.Request, cursor string) *url.URL {
-	next := *r.URL
-	v := next.Query()
-	v.Set("cursor", cursor)
-	next.RawQuery = v.Encode()
-	return &next
+	return RequestPageLink(r, cursor)
 }
 
 func RequestPageSize(r *http.Request) (pageSize int) {
@@ -62,10 +113,125 @@ func RequestPageSize(r *http.Request) (pageSize int) {
 	return
 }
 
+// RequestPageSizeStrict is like RequestPageSize but rejects malformed
+// X-Spirent-Page-Size header values, i.e. values that aren't positive
+// integers, with an EcodeInvalidParameterValue error that handlers may return
+// in a 400 response. Surrounding whitespace is ignored and an absent header
+// means no limit (math.MaxInt32).
+func RequestPageSizeStrict(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.Header.Get(HeaderSpirentPageSize))
+	if v == "" {
+		return math.MaxInt32, nil
+	}
+	pageSize, err := strconv.Atoi(v)
+	if err != nil || pageSize < 1 {
+		return 0, NewError(nil, EcodeInvalidParameterValue, HeaderSpirentPageSize, v)
+	}
+	return pageSize, nil
+}
+
+// RequestPreferReturn returns the "return" preference from a request's Prefer
+// header (RFC 7240), i.e. "minimal" or "representation", or an empty string.
+func RequestPreferReturn(r *http.Request) string {
+	for _, v := range requestPreferences(r, "return") {
+		switch v {
+		case PreferReturnMinimal, PreferReturnRepresentation:
+			return v
+		}
+	}
+	return ""
+}
+
+// RequestPreferCount returns the "count" preference from a request's Prefer
+// header, i.e. "exact", or an empty string. Clients use it to request the total
+// number of elements alongside a collection listing.
+func RequestPreferCount(r *http.Request) string {
+	for _, v := range requestPreferences(r, "count") {
+		if v == PreferCountExact {
+			return v
+		}
+	}
+	return ""
+}
+
+// requestPreferences returns the lowercased values of a named preference from
+// a request's Prefer headers.
+func requestPreferences(r *http.Request, name string) []string {
+	var values []string
+	for _, hdr := range r.Header[HeaderPrefer] {
+		for _, pref := range strings.Split(hdr, ",") {
+			// Ignore preference parameters, e.g. "return=minimal; foo=bar"
+			if i := strings.IndexByte(pref, ';'); i >= 0 {
+				pref = pref[:i]
+			}
+			parts := strings.SplitN(pref, "=", 2)
+			if len(parts) != 2 || !strings.EqualFold(strings.TrimSpace(parts[0]), name) {
+				continue
+			}
+			values = append(values, strings.ToLower(strings.Trim(strings.TrimSpace(parts[1]), `"`)))
+		}
+	}
+	return values
+}
+
 func RequestQueryCursor(r *http.Request) string {
 	return r.URL.Query().Get("cursor")
 }
 
+// StrictQuery checks that a request's query string is well-formed and doesn't
+// repeat any parameter. When allowed parameter names are given it also checks
+// that no other parameters are present. Handlers may opt in to strict query
+// handling by rejecting requests with a 400 response when an error is
+// returned.
+func StrictQuery(r *http.Request, allowed ...string) *Error {
+	values, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return NewError(nil, EcodeBadRequest, fmt.Sprintf("malformed query: %v", err))
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if len(allowed) > 0 && !stringInSlice(key, allowed) {
+			return NewError(nil, EcodeBadRequest, fmt.Sprintf("unexpected query parameter %q", key))
+		}
+		if len(values[key]) > 1 {
+			return NewError(nil, EcodeBadRequest, fmt.Sprintf("duplicate query parameter %q", key))
+		}
+	}
+	return nil
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func RequestResourceNonce(r *http.Request) string {
 	return r.Header.Get(HeaderSpirentResourceNonce)
 }
+
+// ResourceSelfLink returns a fully-qualified URL for a resource, honoring
+// X-Forwarded-Host and X-Forwarded-Proto and the service's path prefix. Since
+// API versions are selected using the X-Spirent-Api-Version header they don't
+// appear in the link.
+func ResourceSelfLink(r *http.Request, basePath string, id string) *url.URL {
+	var prefix string
+	if s := ContextService(r.Context()); s != nil {
+		prefix = s.config.Prefix
+	}
+	self := url.URL{
+		Scheme: RequestExternalScheme(r),
+		Host:   RequestExternalHost(r),
+		Path:   path.Join("/", prefix, basePath, id),
+	}
+	return &self
+}
@@ -0,0 +1,122 @@
+package luddite
+
+import (
+	"crypto/tls"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResourceSelfLink(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://internal:8000/users", nil)
+	if link := ResourceSelfLink(req, "/users", "dave").String(); link != "http://internal:8000/users/dave" {
+		t.Errorf("unexpected self link: %s", link)
+	}
+
+	req.TLS = &tls.ConnectionState{}
+	if link := ResourceSelfLink(req, "/users", "dave").String(); link != "https://internal:8000/users/dave" {
+		t.Errorf("unexpected self link: %s", link)
+	}
+
+	req.TLS = nil
+	req.Header.Set(HeaderForwardedHost, "api.example.com")
+	req.Header.Set(HeaderForwardedProto, "HTTPS, http")
+	if link := ResourceSelfLink(req, "/users", "dave").String(); link != "https://api.example.com/users/dave" {
+		t.Errorf("unexpected self link: %s", link)
+	}
+}
+
+func TestResourceSelfLinkPrefix(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://internal:8000/api/users", nil)
+	rw := httptest.NewRecorder()
+	TestDispatch(rw, req, http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		ContextService(req.Context()).config.Prefix = "/api"
+		if link := ResourceSelfLink(req, "/users", "dave").String(); link != "http://internal:8000/api/users/dave" {
+			t.Errorf("unexpected self link: %s", link)
+		}
+	}))
+}
+
+func TestRequestPreferReturn(t *testing.T) {
+	for hdr, expected := range map[string]string{
+		"":                                     "",
+		"return=minimal":                       PreferReturnMinimal,
+		"respond-async, return=representation": PreferReturnRepresentation,
+		"return=\"minimal\"; foo=bar":          PreferReturnMinimal,
+		"return=everything":                    "",
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if hdr != "" {
+			req.Header.Set(HeaderPrefer, hdr)
+		}
+		if pref := RequestPreferReturn(req); pref != expected {
+			t.Errorf("%q: expected %q, got %q", hdr, expected, pref)
+		}
+	}
+}
+
+func TestStrictQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		allowed []string
+		ok      bool
+	}{
+		{"", nil, true},
+		{"cursor=a&size=2", nil, true},
+		{"cursor=a&cursor=b", nil, false},
+		{"cursor=a&cursor=a", []string{"cursor"}, false},
+		{"cursor=a", []string{"cursor", "size"}, true},
+		{"cursor=a&sort=name", []string{"cursor", "size"}, false},
+		{"cursor=%zz", nil, false},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/widgets", nil)
+		req.URL.RawQuery = test.query
+		err := StrictQuery(req, test.allowed...)
+		if test.ok && err != nil {
+			t.Errorf("%q: unexpected error: %v", test.query, err)
+		} else if !test.ok && (err == nil || err.Code != EcodeBadRequest) {
+			t.Errorf("%q: expected %s error, got %v", test.query, EcodeBadRequest, err)
+		}
+	}
+}
+
+func TestRequestPageSizeStrict(t *testing.T) {
+	tests := []struct {
+		value    string
+		pageSize int
+		ok       bool
+	}{
+		{"", math.MaxInt32, true},
+		{"25", 25, true},
+		{" 25 ", 25, true},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"ten", 0, false},
+		{"25, 50", 0, false},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/widgets", nil)
+		if test.value != "" {
+			req.Header.Set(HeaderSpirentPageSize, test.value)
+		}
+		pageSize, err := RequestPageSizeStrict(req)
+		if test.ok && (err != nil || pageSize != test.pageSize) {
+			t.Errorf("%q: expected %d, got %d, %v", test.value, test.pageSize, pageSize, err)
+		} else if !test.ok {
+			if e, ok := err.(*Error); !ok || e.Code != EcodeInvalidParameterValue {
+				t.Errorf("%q: expected %s error, got %v", test.value, EcodeInvalidParameterValue, err)
+			}
+		}
+	}
+
+	// The lenient version still masks malformed values
+	req, _ := http.NewRequest("GET", "/widgets", nil)
+	req.Header.Set(HeaderSpirentPageSize, "ten")
+	if pageSize := RequestPageSize(req); pageSize != math.MaxInt32 {
+		t.Errorf("expected lenient page size of %d, got %d", math.MaxInt32, pageSize)
+	}
+}
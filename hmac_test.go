@@ -0,0 +1,111 @@
+package luddite
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type signedResource struct {
+	identity Identity
+	name     string
+}
+
+func (r *signedResource) New() interface{} {
+	return new(gadget)
+}
+
+func (r *signedResource) Id(value interface{}) string {
+	return ""
+}
+
+func (r *signedResource) Create(req *http.Request, value interface{}) (int, interface{}) {
+	r.identity, _ = ContextIdentity(req.Context())
+	r.name = value.(*gadget).Name
+	return http.StatusCreated, value
+}
+
+func signRequest(req *http.Request, keyId string, secret []byte, ts time.Time, body string) {
+	stamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	for _, c := range []string{req.Method, req.URL.RequestURI(), stamp, body} {
+		mac.Write([]byte(c))
+		mac.Write([]byte{'\n'})
+	}
+	req.Header.Set(HeaderSignatureKeyId, keyId)
+	req.Header.Set(HeaderSignatureTimestamp, stamp)
+	req.Header.Set(HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestHMACAuthHandler(t *testing.T) {
+	s := newTestService(t, nil)
+	clock := newFakeClock()
+	s.SetClock(clock)
+	secret := []byte("s3cr3t")
+	s.AddHandler(NewHMACAuthHandler(func(keyId string) ([]byte, bool) {
+		if keyId == "acme" {
+			return secret, true
+		}
+		return nil, false
+	}, HMACOptions{MaxAge: time.Minute}))
+	signed := &signedResource{}
+	if err := s.AddResource(1, "/signed", signed); err != nil {
+		t.Fatal(err)
+	}
+
+	const body = `{"name":"widget"}`
+	var challenge string
+	serve := func(sign func(req *http.Request)) int {
+		req, _ := http.NewRequest("POST", "/signed", bytes.NewBufferString(body))
+		req.Header.Set(HeaderContentType, ContentTypeJson)
+		sign(req)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		challenge = rw.Header().Get(HeaderWWWAuthenticate)
+		return rw.Code
+	}
+
+	if code := serve(func(req *http.Request) {}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401/Unauthorized without signature, got %d", code)
+	}
+	if challenge != "HMAC" {
+		t.Errorf("expected an HMAC challenge, got %q", challenge)
+	}
+	if code := serve(func(req *http.Request) {
+		signRequest(req, "acme", secret, clock.Now(), body)
+	}); code != http.StatusCreated {
+		t.Errorf("expected 201/Created with valid signature, got %d", code)
+	}
+	if signed.identity.ID != "acme" {
+		t.Errorf("expected identity acme, got %q", signed.identity.ID)
+	}
+	if signed.name != "widget" {
+		t.Errorf("expected body to remain decodable, got name %q", signed.name)
+	}
+	if code := serve(func(req *http.Request) {
+		signRequest(req, "acme", []byte("wrong"), clock.Now(), body)
+	}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401/Unauthorized with wrong secret, got %d", code)
+	}
+	if code := serve(func(req *http.Request) {
+		signRequest(req, "acme", secret, clock.Now(), `{"name":"other"}`)
+	}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401/Unauthorized with tampered body, got %d", code)
+	}
+	if code := serve(func(req *http.Request) {
+		signRequest(req, "nobody", secret, clock.Now(), body)
+	}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401/Unauthorized with unknown key, got %d", code)
+	}
+	if code := serve(func(req *http.Request) {
+		signRequest(req, "acme", secret, clock.Now().Add(-2*time.Minute), body)
+	}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401/Unauthorized with stale timestamp, got %d", code)
+	}
+}
@@ -0,0 +1,48 @@
+package luddite
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// JSONAPIErrors is a transfer object that is serialized as the body in 4xx and
+// 5xx responses when JSON:API error documents are enabled.
+type JSONAPIErrors struct {
+	Errors []JSONAPIError `json:"errors"`
+}
+
+// JSONAPIError is a JSON:API error object.
+type JSONAPIError struct {
+	Status string             `json:"status"`
+	Code   string             `json:"code"`
+	Title  string             `json:"title"`
+	Detail string             `json:"detail,omitempty"`
+	Links  *JSONAPIErrorLinks `json:"links,omitempty"`
+	Meta   *JSONAPIErrorMeta  `json:"meta,omitempty"`
+}
+
+// JSONAPIErrorLinks holds the links of a JSON:API error object.
+type JSONAPIErrorLinks struct {
+	About string `json:"about"`
+}
+
+// JSONAPIErrorMeta holds the non-standard members of a JSON:API error object.
+type JSONAPIErrorMeta struct {
+	Stack string `json:"stack"`
+}
+
+func newJSONAPIErrors(e *Error, status int) *JSONAPIErrors {
+	o := JSONAPIError{
+		Status: strconv.Itoa(status),
+		Code:   e.Code,
+		Title:  http.StatusText(status),
+		Detail: e.Message,
+	}
+	if e.HelpURL != "" {
+		o.Links = &JSONAPIErrorLinks{About: e.HelpURL}
+	}
+	if e.Stack != "" {
+		o.Meta = &JSONAPIErrorMeta{Stack: e.Stack}
+	}
+	return &JSONAPIErrors{Errors: []JSONAPIError{o}}
+}
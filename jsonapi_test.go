@@ -0,0 +1,53 @@
+package luddite
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONAPIErrors(t *testing.T) {
+	rw := httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+	res := new(responseWriter)
+	res.init(rw)
+	res.jsonAPIErrors = true
+
+	e := NewError(nil, EcodeResourceIdMismatch)
+	e.HelpURL = "https://example.com/errors/resource-id-mismatch"
+	if err := WriteResponse(res, http.StatusBadRequest, e); err != nil {
+		t.Fatal(err)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJsonApi {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	expected := `{"errors":[{"status":"400","code":"RESOURCE_ID_MISMATCH","title":"Bad Request","detail":"Resource identifier in URL doesn't match value in body","links":{"about":"https://example.com/errors/resource-id-mismatch"}}]}`
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("JSON:API error serialization failed, got: %s, expected: %s\n", body, expected)
+	}
+}
+
+func TestJSONAPIErrorFormat(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Response.ErrorFormat = ErrorFormatJSONAPI
+	})
+	s.defaultLogger.Out = ioutil.Discard
+	s.accessLogger.Out = ioutil.Discard
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	req.Header.Set(HeaderSpirentApiVersion, "2")
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJsonApi {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	if body := rw.Body.String(); !strings.HasPrefix(body, `{"errors":[{"status":"501","code":"API_VERSION_TOO_NEW"`) {
+		t.Errorf("expected JSON:API error document, got %s", body)
+	}
+
+	s.config.Response.ErrorFormat = "jsonapi2"
+	if err := s.config.Validate(); err != ErrInvalidErrorFormat {
+		t.Errorf("expected ErrInvalidErrorFormat, got %v", err)
+	}
+}
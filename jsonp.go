@@ -0,0 +1,36 @@
+package luddite
+
+import "net/http"
+
+const (
+	jsonpCallbackParam     = "callback"
+	maxJSONPCallbackLength = 64
+)
+
+// jsonpCallback returns the validated JSONP callback name for a request, or an
+// empty string. To prevent XSS only ASCII letters, digits and underscores are
+// allowed; other callbacks are ignored and responses are plain JSON.
+func jsonpCallback(req *http.Request) string {
+	cb := req.URL.Query().Get(jsonpCallbackParam)
+	if cb == "" || len(cb) > maxJSONPCallbackLength {
+		return ""
+	}
+	for i := 0; i < len(cb); i++ {
+		c := cb[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return ""
+		}
+	}
+	return cb
+}
+
+// wrapJSONP wraps a JSON body in a call to a JSONP callback. The leading empty
+// comment guards against content sniffing attacks that abuse callbacks.
+func wrapJSONP(callback string, b []byte) []byte {
+	w := make([]byte, 0, len(b)+len(callback)+7)
+	w = append(w, "/**/"...)
+	w = append(w, callback...)
+	w = append(w, '(')
+	w = append(w, b...)
+	return append(w, ");"...)
+}
@@ -0,0 +1,62 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONP(t *testing.T) {
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.Response.JSONP = true
+
+	s, err := NewService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		uri         string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"/ping?callback=jQuery_123", ContentTypeJson, ContentTypeJavascript, `/**/jQuery_123("pong");`},
+		{"/ping", ContentTypeJson, ContentTypeJson, `"pong"`},
+		{"/ping?callback=alert(1)//", ContentTypeJson, ContentTypeJson, `"pong"`},
+		{"/ping?callback=a.b", ContentTypeJson, ContentTypeJson, `"pong"`},
+		{"/ping?callback=cb", ContentTypeXml, ContentTypeXml, `<string>pong</string>`},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.uri, nil)
+		req.Header.Set(HeaderAccept, test.accept)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		if ct := rw.Header().Get(HeaderContentType); ct != test.contentType {
+			t.Errorf("%s: expected content type %s, got %s", test.uri, test.contentType, ct)
+		}
+		if body := rw.Body.String(); body != test.body {
+			t.Errorf("%s: expected body %s, got %s", test.uri, test.body, body)
+		}
+	}
+
+	// JSONP is off by default
+	config.Response.JSONP = false
+	if s, err = NewService(config); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/ping?callback=cb", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if body := rw.Body.String(); body != `"pong"` {
+		t.Errorf("expected plain JSON body, got %s", body)
+	}
+}
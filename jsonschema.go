@@ -0,0 +1,497 @@
+package luddite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// jsonSchema validates decoded JSON values against a JSON Schema document. It
+// supports the commonly used subset of the specification: type, enum, const,
+// properties, required, additionalProperties, items, allOf/anyOf/oneOf/not,
+// numeric and length bounds, pattern and local "$ref" pointers (e.g.
+// "#/definitions/widget"). Both the draft-4 boolean and the draft-6 numeric
+// forms of exclusiveMinimum and exclusiveMaximum are supported.
+type jsonSchema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// loadJSONSchema reads a JSON or YAML schema document from a filesystem.
+func loadJSONSchema(fs http.FileSystem, name string) (*jsonSchema, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf []byte
+	if buf, err = ioutil.ReadAll(f); err != nil {
+		return nil, err
+	}
+
+	var root interface{}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		if err = yaml.Unmarshal(buf, &root); err != nil {
+			return nil, err
+		}
+		root = normalizeYAML(root)
+	default:
+		if err = json.Unmarshal(buf, &root); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := root.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("schema %s is not an object", name)
+	}
+	js, err := newJSONSchema(root)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %v", name, err)
+	}
+	return js, nil
+}
+
+// newJSONSchema prepares a decoded schema document for validation. Patterns
+// are compiled and references resolved up front, and schemas that would apply
+// themselves to the same value through references and compositions, and so
+// never finish validating, are rejected.
+func newJSONSchema(root interface{}) (*jsonSchema, error) {
+	js := &jsonSchema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	var schemas []map[string]interface{}
+	if err := js.prepare(root, make(map[uintptr]bool), &schemas); err != nil {
+		return nil, err
+	}
+	state := make(map[uintptr]int)
+	for _, schema := range schemas {
+		if err := js.checkCycles(schema, state); err != nil {
+			return nil, err
+		}
+	}
+	return js, nil
+}
+
+// prepare compiles the patterns of a schema and the schemas nested in it or
+// referenced by it, collecting them in schemas.
+func (js *jsonSchema) prepare(node interface{}, seen map[uintptr]bool, schemas *[]map[string]interface{}) error {
+	schema, ok := node.(map[string]interface{})
+	if !ok || seen[schemaID(schema)] {
+		return nil
+	}
+	seen[schemaID(schema)] = true
+	*schemas = append(*schemas, schema)
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		js.patterns[pattern] = re
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := js.resolve(ref)
+		if err != nil {
+			return err
+		}
+		if err = js.prepare(target, seen, schemas); err != nil {
+			return err
+		}
+	}
+	for _, k := range []string{"properties", "definitions", "$defs"} {
+		if m, ok := schema[k].(map[string]interface{}); ok {
+			for _, sub := range m {
+				if err := js.prepare(sub, seen, schemas); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, k := range []string{"additionalProperties", "items"} {
+		if err := js.prepare(schema[k], seen, schemas); err != nil {
+			return err
+		}
+	}
+	for _, sub := range sameValueSchemas(schema) {
+		if err := js.prepare(sub, seen, schemas); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	schemaChecking = iota + 1
+	schemaChecked
+)
+
+// checkCycles rejects a schema that, following references and compositions,
+// leads back to itself without descending into a property or an item.
+func (js *jsonSchema) checkCycles(schema map[string]interface{}, state map[uintptr]int) error {
+	id := schemaID(schema)
+	switch state[id] {
+	case schemaChecking:
+		return errors.New("schema references itself without nesting")
+	case schemaChecked:
+		return nil
+	}
+	state[id] = schemaChecking
+
+	subs := sameValueSchemas(schema)
+	if ref, ok := schema["$ref"].(string); ok {
+		// NB: Other keywords are ignored alongside a reference
+		target, err := js.resolve(ref)
+		if err != nil {
+			return err
+		}
+		subs = []interface{}{target}
+	}
+	for _, sub := range subs {
+		if sub, ok := sub.(map[string]interface{}); ok {
+			if err := js.checkCycles(sub, state); err != nil {
+				return err
+			}
+		}
+	}
+	state[id] = schemaChecked
+	return nil
+}
+
+// sameValueSchemas returns the schemas that a schema's compositions apply to
+// the value that it validates.
+func sameValueSchemas(schema map[string]interface{}) []interface{} {
+	var subs []interface{}
+	for _, k := range []string{"allOf", "anyOf", "oneOf"} {
+		if a, ok := schema[k].([]interface{}); ok {
+			subs = append(subs, a...)
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		subs = append(subs, not)
+	}
+	return subs
+}
+
+func schemaID(schema map[string]interface{}) uintptr {
+	return reflect.ValueOf(schema).Pointer()
+}
+
+// normalizeYAML converts YAML-decoded maps into JSON-compatible maps and
+// numbers into float64 values.
+func normalizeYAML(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			m[fmt.Sprint(k)] = normalizeYAML(v)
+		}
+		return m
+	case []interface{}:
+		for i := range x {
+			x[i] = normalizeYAML(x[i])
+		}
+		return x
+	case int:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	default:
+		return v
+	}
+}
+
+// validate checks a decoded JSON value and returns the first violation found.
+func (js *jsonSchema) validate(v interface{}) error {
+	return js.validateNode(js.root, v, "$")
+}
+
+// validateBytes decodes and checks a serialized JSON value.
+func (js *jsonSchema) validateBytes(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return js.validate(v)
+}
+
+// isArray returns true if the schema's root describes an array.
+func (js *jsonSchema) isArray() bool {
+	root, _ := js.root.(map[string]interface{})
+	t, ok := root["type"]
+	return ok && schemaTypeAllowed(t, "array")
+}
+
+func (js *jsonSchema) validateNode(node interface{}, v interface{}, at string) error {
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		// Boolean schemas: true accepts everything, false nothing
+		if b, ok := node.(bool); ok && !b {
+			return fmt.Errorf("%s: no value is allowed", at)
+		}
+		return nil
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := js.resolve(ref)
+		if err != nil {
+			return err
+		}
+		return js.validateNode(target, v, at)
+	}
+
+	if t, ok := schema["type"]; ok && !schemaTypeAllowed(t, jsonTypeOf(v)) {
+		return fmt.Errorf("%s: expected type %v, got %s", at, t, jsonTypeOf(v))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of %v", at, enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, v) {
+		return fmt.Errorf("%s: value must be %v", at, c)
+	}
+
+	if err := js.validateComposition(schema, v, at); err != nil {
+		return err
+	}
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return js.validateObject(schema, x, at)
+	case []interface{}:
+		return js.validateArray(schema, x, at)
+	case string:
+		return js.validateString(schema, x, at)
+	case float64:
+		return validateNumber(schema, x, at)
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateComposition(schema map[string]interface{}, v interface{}, at string) error {
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if err := js.validateNode(sub, v, at); err != nil {
+				return err
+			}
+		}
+	}
+	if any, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range any {
+			if js.validateNode(sub, v, at) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value doesn't match any allowed schema", at)
+		}
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range one {
+			if js.validateNode(sub, v, at) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: value must match exactly one schema, matched %d", at, matches)
+		}
+	}
+	if not, ok := schema["not"]; ok && js.validateNode(not, v, at) == nil {
+		return fmt.Errorf("%s: value matches a disallowed schema", at)
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateObject(schema map[string]interface{}, obj map[string]interface{}, at string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, ok := obj[name]; !ok {
+					return fmt.Errorf("%s: missing required property %q", at, name)
+				}
+			}
+		}
+	}
+
+	// Check properties in a stable order so that violations are reported consistently
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	props, _ := schema["properties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, name := range names {
+		if sub, ok := props[name]; ok {
+			if err := js.validateNode(sub, obj[name], at+"."+name); err != nil {
+				return err
+			}
+		} else if hasAdditional {
+			if b, ok := additional.(bool); ok && !b {
+				return fmt.Errorf("%s: unexpected property %q", at, name)
+			}
+			if err := js.validateNode(additional, obj[name], at+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n, ok := schema["minProperties"].(float64); ok && float64(len(obj)) < n {
+		return fmt.Errorf("%s: expected at least %v properties", at, n)
+	}
+	if n, ok := schema["maxProperties"].(float64); ok && float64(len(obj)) > n {
+		return fmt.Errorf("%s: expected at most %v properties", at, n)
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateArray(schema map[string]interface{}, arr []interface{}, at string) error {
+	if n, ok := schema["minItems"].(float64); ok && float64(len(arr)) < n {
+		return fmt.Errorf("%s: expected at least %v items", at, n)
+	}
+	if n, ok := schema["maxItems"].(float64); ok && float64(len(arr)) > n {
+		return fmt.Errorf("%s: expected at most %v items", at, n)
+	}
+	if items, ok := schema["items"]; ok {
+		for i, item := range arr {
+			if err := js.validateNode(items, item, at+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if reflect.DeepEqual(arr[i], arr[j]) {
+					return fmt.Errorf("%s: items must be unique", at)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateString(schema map[string]interface{}, s string, at string) error {
+	length := float64(len([]rune(s)))
+	if n, ok := schema["minLength"].(float64); ok && length < n {
+		return fmt.Errorf("%s: expected at least %v characters", at, n)
+	}
+	if n, ok := schema["maxLength"].(float64); ok && length > n {
+		return fmt.Errorf("%s: expected at most %v characters", at, n)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if !js.patterns[pattern].MatchString(s) {
+			return fmt.Errorf("%s: value doesn't match pattern %q", at, pattern)
+		}
+	}
+	return nil
+}
+
+func validateNumber(schema map[string]interface{}, f float64, at string) error {
+	if n, ok := schema["minimum"].(float64); ok {
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && f <= n || f < n {
+			return fmt.Errorf("%s: value %v is below the minimum %v", at, f, n)
+		}
+	}
+	if n, ok := schema["maximum"].(float64); ok {
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && f >= n || f > n {
+			return fmt.Errorf("%s: value %v is above the maximum %v", at, f, n)
+		}
+	}
+	// NB: Since draft 6, exclusive bounds are numbers rather than flags
+	if n, ok := schema["exclusiveMinimum"].(float64); ok && f <= n {
+		return fmt.Errorf("%s: value %v must be above %v", at, f, n)
+	}
+	if n, ok := schema["exclusiveMaximum"].(float64); ok && f >= n {
+		return fmt.Errorf("%s: value %v must be below %v", at, f, n)
+	}
+	if n, ok := schema["multipleOf"].(float64); ok && n > 0 {
+		if q := f / n; q != math.Trunc(q) {
+			return fmt.Errorf("%s: value %v is not a multiple of %v", at, f, n)
+		}
+	}
+	return nil
+}
+
+// resolve follows a local JSON pointer reference, e.g. "#/definitions/widget".
+func (js *jsonSchema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported schema reference %q", ref)
+	}
+	node := js.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref[1:], "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable schema reference %q", ref)
+		}
+		if node, ok = m[token]; !ok {
+			return nil, fmt.Errorf("unresolvable schema reference %q", ref)
+		}
+	}
+	return node, nil
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if x == math.Trunc(x) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func schemaTypeAllowed(t interface{}, actual string) bool {
+	switch x := t.(type) {
+	case string:
+		return x == actual || x == "number" && actual == "integer"
+	case []interface{}:
+		for _, e := range x {
+			if schemaTypeAllowed(e, actual) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
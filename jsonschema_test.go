@@ -0,0 +1,80 @@
+package luddite
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	tests := []struct {
+		schema string
+		value  string
+		valid  bool
+	}{
+		{`{"type": "string"}`, `"a"`, true},
+		{`{"type": "string"}`, `1`, false},
+		{`{"type": "number"}`, `1`, true},
+		{`{"type": "integer"}`, `1.5`, false},
+		{`{"type": ["string", "null"]}`, `null`, true},
+		{`{"enum": ["a", "b"]}`, `"c"`, false},
+		{`{"const": 3}`, `3`, true},
+		{`{"type": "string", "pattern": "^[a-z]+$"}`, `"abc"`, true},
+		{`{"type": "string", "maxLength": 2}`, `"abc"`, false},
+		{`{"type": "number", "minimum": 1, "exclusiveMinimum": true}`, `1`, false},
+		{`{"type": "number", "maximum": 10}`, `10`, true},
+		{`{"type": "number", "exclusiveMinimum": 1}`, `1`, false},
+		{`{"type": "number", "exclusiveMinimum": 1}`, `1.5`, true},
+		{`{"type": "number", "exclusiveMaximum": 10}`, `10`, false},
+		{`{"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#"}}}}`, `{"children": [{"children": [1]}]}`, false},
+		{`{"type": "number", "multipleOf": 5}`, `12`, false},
+		{`{"type": "array", "items": {"type": "integer"}}`, `[1, 2, "3"]`, false},
+		{`{"type": "array", "uniqueItems": true}`, `[1, 1]`, false},
+		{`{"type": "array", "minItems": 1}`, `[]`, false},
+		{`{"required": ["a"]}`, `{"b": 1}`, false},
+		{`{"additionalProperties": {"type": "integer"}}`, `{"b": 1}`, true},
+		{`{"additionalProperties": false, "properties": {"a": {}}}`, `{"b": 1}`, false},
+		{`{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `true`, false},
+		{`{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `1`, false},
+		{`{"not": {"type": "null"}}`, `null`, false},
+		{`{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, `2`, true},
+		{`{"properties": {"a": {"$ref": "#/definitions/a"}}, "definitions": {"a": {"type": "boolean"}}}`, `{"a": 1}`, false},
+	}
+
+	for _, test := range tests {
+		var root, v interface{}
+		if err := json.Unmarshal([]byte(test.schema), &root); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(test.value), &v); err != nil {
+			t.Fatal(err)
+		}
+		js, err := newJSONSchema(root)
+		if err != nil {
+			t.Fatalf("schema %s: %v", test.schema, err)
+		}
+		err = js.validate(v)
+		if test.valid && err != nil {
+			t.Errorf("schema %s: expected %s to be valid, got %v", test.schema, test.value, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("schema %s: expected %s to be invalid", test.schema, test.value)
+		}
+	}
+}
+
+func TestJSONSchemaLoadErrors(t *testing.T) {
+	for _, schema := range []string{
+		`{"properties": {"a": {"type": "string", "pattern": "("}}}`,
+		`{"properties": {"a": {"$ref": "#/definitions/missing"}}}`,
+		`{"$ref": "#/definitions/a", "definitions": {"a": {"$ref": "#/definitions/b"}, "b": {"$ref": "#/definitions/a"}}}`,
+		`{"definitions": {"a": {"allOf": [{"$ref": "#/definitions/a"}]}}}`,
+		`{"anyOf": [{"not": {"$ref": "#"}}]}`,
+	} {
+		var root interface{}
+		if err := json.Unmarshal([]byte(schema), &root); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := newJSONSchema(root); err == nil {
+			t.Errorf("schema %s: expected an error", schema)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package luddite
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// clientLimiter caps the number of in-flight requests per client IP address.
+// It counts requests rather than connections, so that clients behind a shared
+// proxy connection are told apart and idle keep-alive connections don't count.
+// Clients in exempt networks (e.g. internal CIDRs) are never limited.
+type clientLimiter struct {
+	sync.Mutex
+	max     int
+	proxies *proxyPolicy
+	exempt  []*net.IPNet
+	active  map[string]int
+}
+
+func newClientLimiter(max int, proxies *proxyPolicy, exemptCIDRs []string) (*clientLimiter, error) {
+	l := &clientLimiter{
+		max:     max,
+		proxies: proxies,
+		active:  make(map[string]int),
+	}
+	for _, cidr := range exemptCIDRs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		l.exempt = append(l.exempt, n)
+	}
+	return l, nil
+}
+
+// acquire reserves a request slot for a client. It returns the client's key,
+// which must be passed to release, and false if the client is at its limit.
+func (l *clientLimiter) acquire(req *http.Request) (string, bool) {
+	ip := l.proxies.clientIP(req)
+	if parsed := net.ParseIP(ip); parsed != nil {
+		for _, n := range l.exempt {
+			if n.Contains(parsed) {
+				return "", true
+			}
+		}
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if l.active[ip] >= l.max {
+		return "", false
+	}
+	l.active[ip]++
+	return ip, true
+}
+
+func (l *clientLimiter) release(ip string) {
+	if ip == "" {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.active[ip]--; l.active[ip] <= 0 {
+		delete(l.active, ip)
+	}
+}
+
+// reject responds to a request from a client that is at its limit.
+func (l *clientLimiter) reject(rw http.ResponseWriter) {
+	// NB: The request hasn't been through content negotiation yet
+	if rw.Header().Get(HeaderContentType) == "" {
+		rw.Header().Set(HeaderContentType, ContentTypeJson)
+	}
+	rw.Header().Set(HeaderRetryAfter, "1")
+	_ = WriteResponse(rw, ErrorStatus(EcodeTooManyRequests), NewError(nil, EcodeTooManyRequests))
+}
+
+// requestClientIP returns a request's client IP address. When trustForwardedFor
+// is true, i.e. the service is behind a single trusted proxy, the right-most
+// address in the X-Forwarded-For header is preferred. It's the one the proxy
+// added; addresses to its left were sent by the client and may be spoofed.
+func requestClientIP(req *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		xffs := req.Header[HeaderForwardedFor]
+		for i := len(xffs) - 1; i >= 0; i-- {
+			hops := strings.Split(xffs[i], ",")
+			for j := len(hops) - 1; j >= 0; j-- {
+				if hop := strings.TrimSpace(hops[j]); hop != "" {
+					return hop
+				}
+			}
+		}
+	}
+	return remoteIP(req)
+}
@@ -0,0 +1,96 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientLimiter(t *testing.T) {
+	l, err := newClientLimiter(1, &proxyPolicy{trustForwardedFor: true}, []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	key, ok := l.acquire(req)
+	if !ok {
+		t.Fatal("first request was limited")
+	}
+	if _, ok = l.acquire(req); ok {
+		t.Error("second concurrent request was not limited")
+	}
+
+	// Forwarded clients are identified by the address the proxy added, not
+	// by addresses that clients may spoof
+	fwd, _ := http.NewRequest("GET", "/", nil)
+	fwd.RemoteAddr = "192.0.2.1:1234"
+	fwd.Header.Set(HeaderForwardedFor, "192.0.2.1, 198.51.100.1")
+	fwdKey, ok := l.acquire(fwd)
+	if !ok {
+		t.Error("forwarded client was limited")
+	}
+	if fwdKey != "198.51.100.1" {
+		t.Errorf("expected right-most forwarded address, got %s", fwdKey)
+	}
+	l.release(fwdKey)
+
+	// Exempt clients are never limited
+	internal, _ := http.NewRequest("GET", "/", nil)
+	internal.RemoteAddr = "10.1.2.3:1234"
+	for i := 0; i < 3; i++ {
+		if _, ok = l.acquire(internal); !ok {
+			t.Error("exempt client was limited")
+		}
+	}
+
+	l.release(key)
+	if _, ok = l.acquire(req); !ok {
+		t.Error("request was limited after release")
+	}
+}
+
+func TestClientLimiterServeHTTP(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Limits.MaxRequestsPerClient = 1
+	})
+	reports := &reportsResource{started: make(chan struct{}), done: make(chan struct{})}
+	if err := s.AddResource(1, "/reports", reports); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	first := make(chan int)
+	go func() { first <- serve("/reports").Code }()
+	<-reports.started
+
+	rw := serve("/ping")
+	if rw.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429/Too Many Requests, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if retryAfter := rw.Header().Get(HeaderRetryAfter); retryAfter != "1" {
+		t.Errorf("expected Retry-After of 1, got %q", retryAfter)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJson {
+		t.Errorf("expected %s response, got %q", ContentTypeJson, ct)
+	}
+
+	reports.done <- struct{}{}
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", code)
+	}
+	if code := serve("/ping").Code; code != http.StatusOK {
+		t.Errorf("expected 200/OK after release, got %d", code)
+	}
+}
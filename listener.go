@@ -2,13 +2,23 @@ package luddite
 
 import (
 	"crypto/tls"
+	"errors"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// UnixAddrPrefix marks service addresses that name Unix domain socket paths,
+// e.g. "unix:/var/run/service.sock".
+const UnixAddrPrefix = "unix:"
+
+// ErrNoTLSCertificates occurs when a TLS listener has neither certificates nor
+// a GetCertificate callback.
+var ErrNoTLSCertificates = errors.New("TLS requires a certificate or a GetCertificate callback")
+
 // Based on http://www.hydrogen18.com/blog/stop-listening-http-server-go.html,
 // but stops on SIGINT instead of explicit Stop() call
 
@@ -57,7 +67,88 @@ func (sl *StoppableTCPListener) Accept() (net.Conn, error) {
 	}
 }
 
+type StoppableUnixListener struct {
+	*net.UnixListener
+	stop chan os.Signal
+}
+
+func (sl *StoppableUnixListener) Accept() (net.Conn, error) {
+	for {
+		// Wait up to one second for a new connection
+		err := sl.UnixListener.SetDeadline(time.Now().Add(time.Second))
+		if err != nil {
+			return nil, err
+		}
+		newConn, err := sl.UnixListener.AcceptUnix()
+
+		// Check for the channel being closed
+		select {
+		case <-sl.stop:
+			return nil, &ListenerStoppedError{}
+		default:
+			// If nothing came in on the channel, continue as normal
+		}
+
+		if err != nil {
+			// If this is a timeout, then continue to wait for new connections
+			if e, ok := err.(net.Error); ok && e.Timeout() && e.Temporary() {
+				continue
+			}
+			return nil, err
+		}
+		return newConn, err
+	}
+}
+
 func NewStoppableTCPListener(addr string, keepalives bool) (net.Listener, error) {
+	stop := make(chan os.Signal, 1)
+	l, err := newStoppableTCPListener(addr, keepalives, stop)
+	if err != nil {
+		return nil, err
+	}
+	signal.Notify(stop, syscall.SIGINT)
+	return l, nil
+}
+
+// NewStoppableUnixListener creates a stoppable listener on a Unix domain socket.
+// A stale socket file left behind by a previous process is removed first, and
+// the socket file is removed when the listener is closed. File permissions on
+// the socket follow the process umask.
+func NewStoppableUnixListener(path string) (net.Listener, error) {
+	stop := make(chan os.Signal, 1)
+	l, err := newStoppableUnixListener(path, stop)
+	if err != nil {
+		return nil, err
+	}
+	signal.Notify(stop, syscall.SIGINT)
+	return l, nil
+}
+
+func NewStoppableTLSListener(addr string, keepalives bool, certFile string, keyFile string) (net.Listener, error) {
+	tlsConfig, err := newTLSConfig([]TLSCertificate{{CertFilePath: certFile, KeyFilePath: keyFile}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewStoppableTLSConfigListener(addr, keepalives, tlsConfig)
+}
+
+// NewStoppableTLSConfigListener is like NewStoppableTLSListener but uses a
+// caller-provided TLS config, e.g. one with several certificates or a
+// GetCertificate callback for SNI-based certificate selection.
+func NewStoppableTLSConfigListener(addr string, keepalives bool, tlsConfig *tls.Config) (net.Listener, error) {
+	stop := make(chan os.Signal, 1)
+	l, err := newStoppableTLSListener(addr, keepalives, tlsConfig, stop)
+	if err != nil {
+		return nil, err
+	}
+	signal.Notify(stop, syscall.SIGINT)
+	return l, nil
+}
+
+// newStoppableTCPListener creates a listener that stops once a value is
+// received on the stop channel, leaving the caller in control of when (and
+// why) that happens.
+func newStoppableTCPListener(addr string, keepalives bool, stop chan os.Signal) (net.Listener, error) {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -65,25 +156,69 @@ func NewStoppableTCPListener(addr string, keepalives bool) (net.Listener, error)
 
 	sl := &StoppableTCPListener{
 		TCPListener: l.(*net.TCPListener),
-		stop:        make(chan os.Signal, 1),
+		stop:        stop,
 		keepalives:  keepalives,
 	}
-	signal.Notify(sl.stop, syscall.SIGINT)
 	return sl, nil
 }
 
-func NewStoppableTLSListener(addr string, keepalives bool, certFile string, keyFile string) (net.Listener, error) {
+// newStoppableListener creates a stoppable TCP listener, or a stoppable Unix
+// listener when addr has the "unix:" prefix.
+func newStoppableListener(addr string, keepalives bool, stop chan os.Signal) (net.Listener, error) {
+	if strings.HasPrefix(addr, UnixAddrPrefix) {
+		return newStoppableUnixListener(strings.TrimPrefix(addr, UnixAddrPrefix), stop)
+	}
+	return newStoppableTCPListener(addr, keepalives, stop)
+}
+
+func newStoppableUnixListener(path string, stop chan os.Signal) (net.Listener, error) {
+	// Remove a stale socket file, unless another process is still listening
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, syscall.EADDRINUSE
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	sl := &StoppableUnixListener{
+		UnixListener: l.(*net.UnixListener),
+		stop:         stop,
+	}
+	return sl, nil
+}
+
+// newTLSConfig loads certificate/key pairs into a TLS config. When several
+// pairs are given, certificates are selected by SNI server name, with the first
+// pair serving clients that don't send a matching name. When getCertificate is
+// non-nil it takes precedence over the loaded certificates.
+func newTLSConfig(certs []TLSCertificate, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tls.Config, error) {
+	if len(certs) == 0 && getCertificate == nil {
+		return nil, ErrNoTLSCertificates
+	}
 	tlsConfig := &tls.Config{
-		NextProtos:   []string{"http/1.1", "h2"},
-		Certificates: make([]tls.Certificate, 1),
+		NextProtos:     []string{"http/1.1", "h2"},
+		Certificates:   make([]tls.Certificate, len(certs)),
+		GetCertificate: getCertificate,
 	}
 
 	var err error
-	if tlsConfig.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile); err != nil {
-		return nil, err
+	for i, cert := range certs {
+		if tlsConfig.Certificates[i], err = tls.LoadX509KeyPair(cert.CertFilePath, cert.KeyFilePath); err != nil {
+			return nil, err
+		}
 	}
+	return tlsConfig, nil
+}
 
-	stl, err := NewStoppableTCPListener(addr, keepalives)
+func newStoppableTLSListener(addr string, keepalives bool, tlsConfig *tls.Config, stop chan os.Signal) (net.Listener, error) {
+	stl, err := newStoppableListener(addr, keepalives, stop)
 	if err != nil {
 		return nil, err
 	}
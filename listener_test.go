@@ -0,0 +1,169 @@
+package luddite
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(t *testing.T, dir, host string) TLSCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := TLSCertificate{
+		CertFilePath: filepath.Join(dir, host+".crt"),
+		KeyFilePath:  filepath.Join(dir, host+".key"),
+	}
+	if err = ioutil.WriteFile(cert.CertFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(cert.KeyFilePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestTLSListenerSNI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "luddite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := new(ServiceConfig)
+	def := writeTestCertificate(t, dir, "a.example.com")
+	config.Transport.CertFilePath = def.CertFilePath
+	config.Transport.KeyFilePath = def.KeyFilePath
+	config.Transport.Certificates = []TLSCertificate{writeTestCertificate(t, dir, "b.example.com")}
+
+	tlsConfig, err := newTLSConfig(config.tlsCertificates(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	l, err := newStoppableTLSListener("127.0.0.1:0", false, tlsConfig, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	for serverName, expected := range map[string]string{
+		"a.example.com": "a.example.com",
+		"b.example.com": "b.example.com",
+		"c.example.com": "a.example.com",
+	} {
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cn := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != expected {
+			t.Errorf("%s: expected certificate for %s, got %s", serverName, expected, cn)
+		}
+		conn.Close()
+	}
+	stop <- os.Interrupt
+}
+
+func TestTLSConfigRequiresCertificates(t *testing.T) {
+	if _, err := newTLSConfig(new(ServiceConfig).tlsCertificates(), nil); err != ErrNoTLSCertificates {
+		t.Errorf("expected ErrNoTLSCertificates, got %v", err)
+	}
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil }
+	if _, err := newTLSConfig(nil, getCertificate); err != nil {
+		t.Errorf("expected a GetCertificate callback to suffice, got %v", err)
+	}
+}
+
+func TestStoppableUnixListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "luddite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "service.sock")
+
+	stop := make(chan os.Signal, 1)
+	l, err := newStoppableListener(UnixAddrPrefix+path, true, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newStoppableListener(UnixAddrPrefix+path, true, make(chan os.Signal, 1)); err == nil {
+		t.Error("expected a socket in use to be rejected")
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- http.Serve(l, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, _ = rw.Write([]byte("pong"))
+		}))
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	res, err := client.Get("http://unix/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "pong" {
+		t.Errorf("unexpected response: %s", body)
+	}
+	client.CloseIdleConnections()
+
+	stop <- os.Interrupt
+	if err = <-served; err == nil {
+		t.Error("expected serving to stop")
+	} else if _, ok := err.(*ListenerStoppedError); !ok {
+		t.Errorf("expected ListenerStoppedError, got %v", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected socket file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package luddite
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"gopkg.in/SpirentOrion/trace.v2"
+)
+
+const defaultMemoryTraceSize = 1000
+
+// MemoryRecorder is a trace recorder that keeps the most recent spans in
+// memory, e.g. for tests and debugging. It is used when "memory" is among the
+// service's configured trace recorders; its "size" parameter (or
+// "memory.size") sets the number of spans kept, defaulting to 1000.
+type MemoryRecorder struct {
+	mu    sync.Mutex
+	spans []trace.Span
+	next  int
+	full  bool
+}
+
+// NewMemoryRecorder returns a MemoryRecorder that keeps the last size spans.
+func NewMemoryRecorder(size int) *MemoryRecorder {
+	if size < 1 {
+		size = defaultMemoryTraceSize
+	}
+	return &MemoryRecorder{spans: make([]trace.Span, size)}
+}
+
+// Record keeps a copy of a span, evicting the oldest span if the recorder is
+// full.
+func (r *MemoryRecorder) Record(s *trace.Span) error {
+	span := *s
+	if s.Data != nil {
+		span.Data = make(map[string]interface{}, len(s.Data))
+		for k, v := range s.Data {
+			span.Data[k] = v
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans[r.next] = span
+	if r.next++; r.next == len(r.spans) {
+		r.next = 0
+		r.full = true
+	}
+	return nil
+}
+
+// Spans returns the recorded spans, oldest first.
+func (r *MemoryRecorder) Spans() []trace.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]trace.Span(nil), r.spans[:r.next]...)
+	}
+	spans := make([]trace.Span, 0, len(r.spans))
+	spans = append(spans, r.spans[r.next:]...)
+	return append(spans, r.spans[:r.next]...)
+}
+
+// RecentTraces returns the spans kept by the service's memory trace recorder,
+// oldest first. It returns nil unless "memory" is among the configured trace
+// recorders and the service is running.
+func (s *Service) RecentTraces() []trace.Span {
+	if s.memTraces == nil {
+		return nil
+	}
+	return s.memTraces.Spans()
+}
+
+func (s *Service) openMemoryRecorder() *MemoryRecorder {
+	p := s.config.Trace.Params["memory.size"]
+	if p == "" {
+		p = s.config.Trace.Params["size"]
+	}
+	size, _ := strconv.Atoi(p)
+	s.memTraces = NewMemoryRecorder(size)
+	return s.memTraces
+}
+
+func (s *Service) addTracesRoute() {
+	s.addRoute(s.globalRouter, http.MethodGet, s.config.Debug.TracesURIPath, func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set(HeaderContentType, ContentTypeJson)
+		_ = WriteResponse(rw, http.StatusOK, s.RecentTraces())
+	})
+}
@@ -0,0 +1,63 @@
+package luddite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/SpirentOrion/trace.v2"
+)
+
+func TestMemoryRecorder(t *testing.T) {
+	r := NewMemoryRecorder(3)
+	if spans := r.Spans(); len(spans) != 0 {
+		t.Errorf("expected no spans, got %d", len(spans))
+	}
+
+	for id := int64(1); id <= 5; id++ {
+		_ = r.Record(&trace.Span{SpanID: id, Data: map[string]interface{}{"id": id}})
+	}
+	spans := r.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	for i, span := range spans {
+		if span.SpanID != int64(i+3) || span.Data["id"] != int64(i+3) {
+			t.Errorf("expected span %d, got %d", i+3, span.SpanID)
+		}
+	}
+}
+
+func TestMemoryRecorderService(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Debug.TracesURIPath = "/debug/traces"
+		config.Trace.Params = map[string]string{"memory.size": "2"}
+	})
+	if s.RecentTraces() != nil {
+		t.Error("expected no recent traces without a memory recorder")
+	}
+
+	rec, _, err := s.openTraceRecorder("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rec.Record(&trace.Span{SpanID: 1, Name: "a"})
+	_ = rec.Record(&trace.Span{SpanID: 2, Name: "b"})
+	_ = rec.Record(&trace.Span{SpanID: 3, Name: "c"})
+	if spans := s.RecentTraces(); len(spans) != 2 || spans[1].Name != "c" {
+		t.Errorf("unexpected recent traces: %v", spans)
+	}
+
+	s.addTracesRoute()
+	req, _ := http.NewRequest("GET", "/debug/traces", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	var spans []trace.Span
+	if err = json.Unmarshal(rw.Body.Bytes(), &spans); err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 2 || spans[0].SpanID != 2 {
+		t.Errorf("unexpected traces response: %s", rw.Body.String())
+	}
+}
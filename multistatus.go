@@ -0,0 +1,55 @@
+package luddite
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// MultiStatusResult is a response body for batch operations whose items succeed
+// or fail independently. WriteResponse always writes it with a 207
+// Multi-Status status, whatever status the handler returns. Error bodies of
+// failed items are serialized like other errors, i.e. as RFC 7807 problem
+// details or JSON:API error documents when those error formats are configured.
+type MultiStatusResult struct {
+	XMLName xml.Name           `json:"-" xml:"multistatus"`
+	Results []MultiStatusEntry `json:"results" xml:"result"`
+}
+
+// MultiStatusEntry is the outcome of one item of a batch operation.
+type MultiStatusEntry struct {
+	Id     string      `json:"id,omitempty" xml:"id,omitempty"`
+	Status int         `json:"status" xml:"status"`
+	Body   interface{} `json:"body,omitempty" xml:"body,omitempty"`
+}
+
+// Add appends an item's outcome to a MultiStatusResult. Items that failed
+// should have a 4xx or 5xx status and an error (ideally an *Error) body.
+func (m *MultiStatusResult) Add(id string, status int, body interface{}) {
+	m.Results = append(m.Results, MultiStatusEntry{Id: id, Status: status, Body: body})
+}
+
+// render returns a copy of a MultiStatusResult with error bodies converted to
+// the response's error format.
+func (m *MultiStatusResult) render(rw http.ResponseWriter) *MultiStatusResult {
+	res, _ := rw.(*responseWriter)
+	jsonBody := res != nil && rw.Header().Get(HeaderContentType) == ContentTypeJson
+
+	out := &MultiStatusResult{Results: make([]MultiStatusEntry, len(m.Results))}
+	for i, entry := range m.Results {
+		switch body := entry.Body.(type) {
+		case *Error:
+		case error:
+			entry.Body = NewError(nil, EcodeInternal, body)
+		}
+		if e, ok := entry.Body.(*Error); ok {
+			entry.Body = withHelpURL(e)
+			if jsonBody && res.problemDetails {
+				entry.Body = newProblem(entry.Body.(*Error), entry.Status, res.instance)
+			} else if jsonBody && res.jsonAPIErrors {
+				entry.Body = newJSONAPIErrors(entry.Body.(*Error), entry.Status)
+			}
+		}
+		out.Results[i] = entry
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package luddite
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newBatchResult() *MultiStatusResult {
+	m := new(MultiStatusResult)
+	m.Add("1", http.StatusCreated, map[string]string{"id": "1"})
+	m.Add("2", http.StatusConflict, NewError(nil, EcodeLocked, "already exists"))
+	m.Add("3", http.StatusInternalServerError, errors.New("boom"))
+	return m
+}
+
+func TestWriteMultiStatus(t *testing.T) {
+	write := func(ct string, errorFormat string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		rw.Header().Set(HeaderContentType, ct)
+		res := new(responseWriter)
+		res.init(rw)
+		res.problemDetails = errorFormat == ErrorFormatProblem
+		res.jsonAPIErrors = errorFormat == ErrorFormatJSONAPI
+		res.instance = "/batch"
+		if err := WriteResponse(res, http.StatusOK, newBatchResult()); err != nil {
+			t.Fatal(err)
+		}
+		return rw
+	}
+
+	rw := write(ContentTypeJson, ErrorFormatLuddite)
+	if rw.Code != http.StatusMultiStatus {
+		t.Errorf("expected 207/Multi-Status, got %d", rw.Code)
+	}
+	expected := `{"results":[{"id":"1","status":201,"body":{"id":"1"}},` +
+		`{"id":"2","status":409,"body":{"code":"LOCKED","message":"Lock error: already exists"}},` +
+		`{"id":"3","status":500,"body":{"code":"INTERNAL_ERROR","message":"Internal error: boom"}}]}`
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("unexpected body, got: %s, expected: %s", body, expected)
+	}
+
+	rw = write(ContentTypeJson, ErrorFormatProblem)
+	expected = `{"results":[{"id":"1","status":201,"body":{"id":"1"}},` +
+		`{"id":"2","status":409,"body":{"type":"urn:luddite:error:locked","title":"Conflict","status":409,"detail":"Lock error: already exists","instance":"/batch","code":"LOCKED"}},` +
+		`{"id":"3","status":500,"body":{"type":"urn:luddite:error:internal-error","title":"Internal Server Error","status":500,"detail":"Internal error: boom","instance":"/batch","code":"INTERNAL_ERROR"}}]}`
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("unexpected problem body, got: %s, expected: %s", body, expected)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJson {
+		t.Errorf("expected %s, got %s", ContentTypeJson, ct)
+	}
+
+	rw = write(ContentTypeJson, ErrorFormatJSONAPI)
+	expected = `{"results":[{"id":"1","status":201,"body":{"id":"1"}},` +
+		`{"id":"2","status":409,"body":{"errors":[{"status":"409","code":"LOCKED","title":"Conflict","detail":"Lock error: already exists"}]}},` +
+		`{"id":"3","status":500,"body":{"errors":[{"status":"500","code":"INTERNAL_ERROR","title":"Internal Server Error","detail":"Internal error: boom"}]}}]}`
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("unexpected JSON:API body, got: %s, expected: %s", body, expected)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJson {
+		t.Errorf("expected %s, got %s", ContentTypeJson, ct)
+	}
+
+	// XML bodies keep their own element names
+	expected = `<multistatus><result><id>2</id><status>409</status><error><code>LOCKED</code><message>Lock error: already exists</message></error></result></multistatus>`
+	m := new(MultiStatusResult)
+	m.Add("2", http.StatusConflict, NewError(nil, EcodeLocked, "already exists"))
+	rw = httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeXml)
+	if err := WriteResponse(rw, http.StatusOK, m); err != nil {
+		t.Fatal(err)
+	}
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("unexpected XML body, got: %s, expected: %s", body, expected)
+	}
+}
@@ -18,8 +18,23 @@ func newNegotiatorHandler(acceptedFormats []string) http.Handler {
 }
 
 func (n *negotiator) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// Fast path: with a single accepted format there's nothing to negotiate
+	if len(n.acceptedFormats) == 1 {
+		rw.Header().Set(HeaderContentType, n.acceptedFormats[0])
+		n.inhibitResponse(rw, req)
+		return
+	}
+
 	// If no Accept header was included, default to the first accepted format
 	accept := req.Header.Get(HeaderAccept)
+	if req.URL.RawQuery != "" {
+		if v := req.URL.Query().Get(AcceptQueryParam); v != "" {
+			accept = v
+		}
+	}
+	if d := contextHandlerDetails(req.Context()); d != nil {
+		d.ambiguousAccept = isAmbiguousAccept(accept)
+	}
 	if accept == "" {
 		accept = n.acceptedFormats[0]
 	}
@@ -30,11 +45,15 @@ func (n *negotiator) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	// resource handlers to potentially inspect/handle certain rarely-used
 	// content types on their own. If a negotiation failure has occurred and
 	// the resource handler doesn't deal with it, then we can expect a 406
-	// from WriteResponse.
+	// from WriteResponse, with a JSON body listing the media types that it
+	// is able to serialize.
 	if format, err := negotiation.NegotiateAccept(accept, n.acceptedFormats); err == nil {
 		rw.Header().Set(HeaderContentType, format.Value)
 	}
+	n.inhibitResponse(rw, req)
+}
 
+func (n *negotiator) inhibitResponse(rw http.ResponseWriter, req *http.Request) {
 	// If the X-Spirent-Inhibit-Response header is set and true-ish, then
 	// set the same response header. This will cause subsequent calls to
 	// WriteResponse to omit the response body for 2xx responses and also
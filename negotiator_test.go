@@ -52,3 +52,94 @@ func TestUnsupportedContentType(t *testing.T) {
 		t.Errorf("incorrect content type negotiated: %s", ct)
 	}
 }
+
+func TestSingleFormatContentType(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderAccept, ContentTypeXml)
+	req.Header.Set(HeaderSpirentInhibitResponse, "true")
+	rw := httptest.NewRecorder()
+
+	n := newNegotiatorHandler([]string{ContentTypeJson})
+	n.ServeHTTP(rw, req)
+
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJson {
+		t.Errorf("expected forced content type, got %s", ct)
+	}
+	if rw.Header().Get(HeaderSpirentInhibitResponse) == "" {
+		t.Error("inhibit response header not set")
+	}
+
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.Response.ErrorFormat = ErrorFormatLuddite
+	config.Response.ForceContentType = "application/yaml"
+	if err := config.Validate(); err != ErrInvalidForceContentType {
+		t.Errorf("expected ErrInvalidForceContentType, got %v", err)
+	}
+}
+
+func TestConfigFormats(t *testing.T) {
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.Response.Formats = []FormatSpec{{Name: "msgpack", MimeTypes: []string{ContentTypeMsgpack}}}
+
+	s, err := NewService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, _ := s.Router(1)
+	router.GET("/packed", func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/packed", nil)
+	req.Header.Set(HeaderAccept, ContentTypeMsgpack)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeMsgpack {
+		t.Errorf("expected configured format to be negotiated, got %q", ct)
+	}
+
+	tests := []struct {
+		formats  []FormatSpec
+		expected error
+	}{
+		{[]FormatSpec{{Name: "msgpack"}}, ErrInvalidFormat},
+		{[]FormatSpec{{MimeTypes: []string{ContentTypeMsgpack}}}, ErrInvalidFormat},
+		{[]FormatSpec{{Name: "msgpack", MimeTypes: []string{"msgpack"}}}, ErrInvalidFormat},
+		{[]FormatSpec{{Name: "json", MimeTypes: []string{ContentTypeJson}}}, ErrDuplicateFormatMimeType},
+		{[]FormatSpec{
+			{Name: "msgpack", MimeTypes: []string{ContentTypeMsgpack}},
+			{Name: "msgpack2", MimeTypes: []string{ContentTypeMsgpack}},
+		}, ErrDuplicateFormatMimeType},
+	}
+	for i, test := range tests {
+		config.Response.Formats = test.formats
+		if err := config.Validate(); err != test.expected {
+			t.Errorf("test %d: expected %v, got %v", i, test.expected, err)
+		}
+	}
+}
+
+func benchmarkNegotiator(b *testing.B, acceptedFormats []string) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderAccept, "application/json, text/plain;q=0.9, */*;q=0.8")
+	rw := httptest.NewRecorder()
+	n := newNegotiatorHandler(acceptedFormats)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.ServeHTTP(rw, req)
+	}
+}
+
+func BenchmarkNegotiator(b *testing.B) {
+	benchmarkNegotiator(b, negotiatedContentTypes)
+}
+
+func BenchmarkNegotiatorSingleFormat(b *testing.B) {
+	benchmarkNegotiator(b, []string{ContentTypeJson})
+}
@@ -0,0 +1,156 @@
+package luddite
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const openAPIVersion = "3.0.3"
+
+// OpenAPIDescriber may be implemented by resource handler types to contribute
+// metadata for their operations to the service's OpenAPI document.
+type OpenAPIDescriber interface {
+	// OpenAPIOperation returns metadata for an operation, given its HTTP
+	// method and OpenAPI path, e.g. "GET" and "/users/{seg1}". It may
+	// return nil to use the generated skeleton. Missing path parameters and
+	// responses are filled in.
+	OpenAPIOperation(method, path string) *OpenAPIOperation
+}
+
+// OpenAPIDocument is a minimal OpenAPI 3 document.
+type OpenAPIDocument struct {
+	OpenAPI string                                  `json:"openapi"`
+	Info    OpenAPIInfo                             `json:"info"`
+	Paths   map[string]map[string]*OpenAPIOperation `json:"paths"`
+}
+
+// OpenAPIInfo describes an API in an OpenAPI document.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIOperation describes an operation, i.e. a method on a path, in an
+// OpenAPI document.
+type OpenAPIOperation struct {
+	OperationId string                     `json:"operationId,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter describes an operation parameter in an OpenAPI document.
+type OpenAPIParameter struct {
+	Name        string                 `json:"name"`
+	In          string                 `json:"in"`
+	Description string                 `json:"description,omitempty"`
+	Required    bool                   `json:"required,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+}
+
+// OpenAPIRequestBody describes an operation's request body in an OpenAPI
+// document.
+type OpenAPIRequestBody struct {
+	Description string                      `json:"description,omitempty"`
+	Required    bool                        `json:"required,omitempty"`
+	Content     map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse describes an operation's response in an OpenAPI document.
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType describes a request or response body representation in an
+// OpenAPI document.
+type OpenAPIMediaType struct {
+	Schema map[string]interface{} `json:"schema,omitempty"`
+}
+
+// OpenAPI assembles a skeleton OpenAPI 3 document for an API version from
+// the service's routes, with operations contributed by resources that
+// implement OpenAPIDescriber. Since API versions are selected using the
+// X-Spirent-Api-Version header, each version has its own document.
+func (s *Service) OpenAPI(version int) *OpenAPIDocument {
+	title := s.config.OpenAPI.Title
+	if title == "" {
+		title = "API"
+	}
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    OpenAPIInfo{Title: title, Version: strconv.Itoa(version)},
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+	}
+
+	for _, route := range s.Routes() {
+		if route.Version != version {
+			continue
+		}
+		p, params := openAPIPath(route.Path)
+
+		var op *OpenAPIOperation
+		if r := s.lookupResource(version, route.Path).find(func(r *resourceRegistration) bool { return r.describer != nil }); r != nil {
+			op = r.describer.OpenAPIOperation(route.Method, p)
+		}
+		if op == nil {
+			op = &OpenAPIOperation{}
+		}
+		for _, name := range params {
+			if !hasOpenAPIPathParameter(op.Parameters, name) {
+				op.Parameters = append(op.Parameters, OpenAPIParameter{
+					Name:     name,
+					In:       "path",
+					Required: true,
+					Schema:   map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		if len(op.Responses) == 0 {
+			op.Responses = map[string]OpenAPIResponse{"default": {Description: "Default response"}}
+		}
+
+		if doc.Paths[p] == nil {
+			doc.Paths[p] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[p][strings.ToLower(route.Method)] = op
+	}
+	return doc
+}
+
+// openAPIPath converts a route path pattern to an OpenAPI path template, e.g.
+// "/users/:seg1" to "/users/{seg1}", returning the names of its parameters.
+func openAPIPath(pattern string) (string, []string) {
+	var params []string
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			name := seg[1:]
+			segs[i] = "{" + name + "}"
+			params = append(params, name)
+		}
+	}
+	return strings.Join(segs, "/"), params
+}
+
+func hasOpenAPIPathParameter(params []OpenAPIParameter, name string) bool {
+	for _, p := range params {
+		if p.In == "path" && p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) addOpenAPIRoute() {
+	s.addRoute(s.globalRouter, http.MethodGet, s.config.OpenAPI.URIPath, func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set(HeaderContentType, ContentTypeJson)
+		_ = WriteResponse(rw, http.StatusOK, s.OpenAPI(ContextApiVersion(req.Context())))
+	})
+}
@@ -0,0 +1,65 @@
+package luddite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type documentedResource struct {
+	gadgetResource
+}
+
+func (r *documentedResource) Get(req *http.Request, id string) (int, interface{}) {
+	return http.StatusOK, &gadget{Name: id}
+}
+
+func (r *documentedResource) OpenAPIOperation(method, path string) *OpenAPIOperation {
+	if method != "GET" {
+		return nil
+	}
+	return &OpenAPIOperation{
+		OperationId: "getGadget",
+		Responses:   map[string]OpenAPIResponse{"200": {Description: "A gadget"}},
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.OpenAPI.Enabled = true
+		config.OpenAPI.Title = "Gadgets"
+	})
+	if err := s.AddResource(1, "/gadgets", &documentedResource{}); err != nil {
+		t.Fatal(err)
+	}
+	s.addOpenAPIRoute()
+
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200/OK, got %d", rw.Code)
+	}
+
+	var doc OpenAPIDocument
+	if err := json.Unmarshal(rw.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != openAPIVersion || doc.Info.Title != "Gadgets" || doc.Info.Version != "1" {
+		t.Errorf("unexpected document header: %s %+v", doc.OpenAPI, doc.Info)
+	}
+	if op := doc.Paths["/gadgets"]["post"]; op == nil || op.Responses["default"].Description == "" {
+		t.Errorf("expected skeleton POST operation, got %+v", op)
+	}
+	op := doc.Paths["/gadgets/{seg1}"]["get"]
+	if op == nil || op.OperationId != "getGadget" || op.Responses["200"].Description != "A gadget" {
+		t.Fatalf("expected contributed GET operation, got %+v", op)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "seg1" || op.Parameters[0].In != "path" {
+		t.Errorf("expected seg1 path parameter, got %+v", op.Parameters)
+	}
+	if _, ok := doc.Paths["/openapi.json"]; ok {
+		t.Error("unexpected global route in document")
+	}
+}
@@ -0,0 +1,60 @@
+package luddite
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	PaginationLinksSpirent = "spirent"
+	PaginationLinksLink    = "link"
+	PaginationLinksBoth    = "both"
+)
+
+// PageCursors holds the cursors of the pages adjacent to the current page of a
+// paginated collection. Empty cursors are omitted.
+type PageCursors struct {
+	First string
+	Prev  string
+	Next  string
+}
+
+// RequestPageLink returns the URL of the page of a paginated collection that
+// starts at cursor, i.e. the request's URL with its "cursor" query parameter
+// replaced.
+func RequestPageLink(r *http.Request, cursor string) *url.URL {
+	link := *r.URL
+	v := link.Query()
+	v.Set("cursor", cursor)
+	link.RawQuery = v.Encode()
+	return &link
+}
+
+// SetPageLinks adds pagination headers for a page of a collection to a
+// response. Depending on the service's Response.PaginationLinks config, the
+// next page is linked using the X-Spirent-Next-Link header (the default),
+// RFC 8288 Link headers with "first", "prev" and "next" relations, or both.
+func SetPageLinks(rw http.ResponseWriter, r *http.Request, cursors PageCursors) {
+	style := PaginationLinksSpirent
+	if s := ContextService(r.Context()); s != nil && s.config.Response.PaginationLinks != "" {
+		style = s.config.Response.PaginationLinks
+	}
+
+	h := rw.Header()
+	if cursors.Next != "" && style != PaginationLinksLink {
+		h.Set(HeaderSpirentNextLink, RequestPageLink(r, cursors.Next).String())
+	}
+	if style == PaginationLinksSpirent {
+		return
+	}
+	for _, rel := range []struct{ name, cursor string }{
+		{"first", cursors.First},
+		{"prev", cursors.Prev},
+		{"next", cursors.Next},
+	} {
+		if rel.cursor != "" {
+			h.Add(HeaderLink, fmt.Sprintf("<%s>; rel=%q", RequestPageLink(r, rel.cursor), rel.name))
+		}
+	}
+}
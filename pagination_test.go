@@ -0,0 +1,97 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSetPageLinks(t *testing.T) {
+	cursors := PageCursors{First: "a", Prev: "b", Next: "d"}
+
+	// W/o a service the Spirent header is used
+	req, _ := http.NewRequest("GET", "/widgets?cursor=c&sort=name", nil)
+	rw := httptest.NewRecorder()
+	SetPageLinks(rw, req, cursors)
+	if next := rw.Header().Get(HeaderSpirentNextLink); next != "/widgets?cursor=d&sort=name" {
+		t.Errorf("unexpected next link: %s", next)
+	}
+	if links := rw.Header()[HeaderLink]; links != nil {
+		t.Errorf("unexpected Link headers: %v", links)
+	}
+
+	for _, style := range []string{PaginationLinksLink, PaginationLinksBoth} {
+		s := newTestService(t, func(config *ServiceConfig) {
+			config.Response.PaginationLinks = style
+		})
+		router, _ := s.Router(1)
+		router.GET("/widgets", func(rw http.ResponseWriter, req *http.Request) {
+			SetPageLinks(rw, req, PageCursors{Prev: "b", Next: "d"})
+		})
+
+		rw = httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		expected := []string{
+			`</widgets?cursor=b&sort=name>; rel="prev"`,
+			`</widgets?cursor=d&sort=name>; rel="next"`,
+		}
+		if links := rw.Header()[HeaderLink]; !reflect.DeepEqual(links, expected) {
+			t.Errorf("%s: unexpected Link headers: %v", style, links)
+		}
+		if next := rw.Header().Get(HeaderSpirentNextLink); (next != "") != (style == PaginationLinksBoth) {
+			t.Errorf("%s: unexpected next link: %q", style, next)
+		}
+	}
+
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.Response.ErrorFormat = ErrorFormatLuddite
+	config.Response.PaginationLinks = "rfc"
+	if err := config.Validate(); err != ErrInvalidPaginationLinks {
+		t.Errorf("expected ErrInvalidPaginationLinks, got %v", err)
+	}
+}
+
+type countedResource struct {
+	counted bool
+}
+
+func (r *countedResource) List(req *http.Request) (int, interface{}) {
+	return http.StatusOK, []string{"a", "b"}
+}
+
+func (r *countedResource) Count(req *http.Request) (int, interface{}) {
+	r.counted = true
+	return http.StatusOK, 1234
+}
+
+func TestListTotalCount(t *testing.T) {
+	s := newTestService(t, nil)
+	r := &countedResource{}
+	if err := s.AddResource(1, "/counted", r); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/counted", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK || r.counted || rw.Header().Get(HeaderTotalCount) != "" {
+		t.Errorf("expected listing without count by default, got %d %q", rw.Code, rw.Header().Get(HeaderTotalCount))
+	}
+
+	req, _ = http.NewRequest("GET", "/counted", nil)
+	req.Header.Set(HeaderPrefer, "count=exact")
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200/OK, got %d", rw.Code)
+	}
+	if count := rw.Header().Get(HeaderTotalCount); count != "1234" {
+		t.Errorf("expected total count 1234, got %q", count)
+	}
+	if applied := rw.Header().Get(HeaderPreferenceApplied); applied != "count=exact" {
+		t.Errorf("expected count preference to be applied, got %q", applied)
+	}
+}
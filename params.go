@@ -0,0 +1,71 @@
+package luddite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	ParamPatternNumeric = `[0-9]+`
+	ParamPatternUUID    = `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`
+)
+
+// ParamConstrained may be implemented by resource handler types to constrain
+// the values of their routes' path parameters. Requests whose parameters don't
+// match are rejected with 404 Not Found before the handler runs, just as if no
+// route matched.
+type ParamConstrained interface {
+	// ParamPatterns maps path parameter names (e.g. RouteParamId) to regular
+	// expressions, e.g. ParamPatternUUID, that must match entire values.
+	ParamPatterns() map[string]string
+}
+
+type resourceParams struct {
+	patterns map[string]*regexp.Regexp
+}
+
+func newResourceParams(patterns map[string]string) (*resourceParams, error) {
+	p := &resourceParams{patterns: make(map[string]*regexp.Regexp, len(patterns))}
+	for name, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s parameter pattern: %v", name, err)
+		}
+		p.patterns[name] = re
+	}
+	return p, nil
+}
+
+// allows returns true if the path parameters of the route that serves a
+// request match their patterns, given the request's path segments.
+func (p *resourceParams) allows(route *allowedRoute, segs []string) bool {
+	if route == nil {
+		return true
+	}
+	for i, seg := range route.segs {
+		var name, value string
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name, value = seg[1:], segs[i]
+		case strings.HasPrefix(seg, "*"):
+			name, value = seg[1:], strings.Join(segs[i:], "/")
+		default:
+			continue
+		}
+		if re := p.patterns[name]; re != nil && !re.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// resourceParams returns the path parameter constraints for the resource that
+// serves the request, if any.
+func (d *handlerDetails) resourceParams() *resourceParams {
+	r := d.resource.find(func(r *resourceRegistration) bool { return r.params != nil })
+	if r == nil {
+		return nil
+	}
+	return r.params
+}
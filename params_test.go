@@ -0,0 +1,71 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type numberedResource struct{}
+
+func (r *numberedResource) ParamPatterns() map[string]string {
+	return map[string]string{RouteParamId: ParamPatternNumeric}
+}
+
+func (r *numberedResource) Get(req *http.Request, id string) (int, interface{}) {
+	return http.StatusOK, id
+}
+
+type keyedResource struct{}
+
+func (r *keyedResource) ParamPatterns() map[string]string {
+	return map[string]string{RouteParamId: ParamPatternUUID}
+}
+
+func (r *keyedResource) Get(req *http.Request, id string) (int, interface{}) {
+	return http.StatusOK, id
+}
+
+func TestParamPatterns(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/widgets", &numberedResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/keys", &keyedResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/widgets/42", http.StatusOK},
+		{"/widgets/abc", http.StatusNotFound},
+		{"/widgets/42abc", http.StatusNotFound},
+		{"/keys/6ba7b810-9dad-11d1-80b4-00c04fd430c8", http.StatusOK},
+		{"/keys/6ba7b810", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		if rw.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.path, test.expected, rw.Code)
+		}
+	}
+}
+
+type badPatternResource struct {
+	numberedResource
+}
+
+func (r *badPatternResource) ParamPatterns() map[string]string {
+	return map[string]string{RouteParamId: "[0-9"}
+}
+
+func TestInvalidParamPattern(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/widgets", &badPatternResource{}); err == nil {
+		t.Error("expected invalid pattern error")
+	}
+}
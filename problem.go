@@ -0,0 +1,52 @@
+package luddite
+
+import (
+	"net/http"
+	"strings"
+)
+
+const problemTypePrefix = "urn:luddite:error:"
+
+var problemTypes = make(map[string]string)
+
+func init() {
+	for code := range commonErrorMap {
+		problemTypes[code] = problemTypePrefix + strings.ToLower(strings.Replace(code, "_", "-", -1))
+	}
+}
+
+// Problem is a transfer object that is serialized as the body in 4xx and 5xx
+// responses when RFC 7807 problem details are enabled.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	Stack    string `json:"stack,omitempty"`
+	HelpURL  string `json:"help_url,omitempty"`
+}
+
+// RegisterProblemType registers the problem type URI for an error code. Error
+// codes without a registered URI use "about:blank".
+func RegisterProblemType(code string, uri string) {
+	problemTypes[code] = uri
+}
+
+func newProblem(e *Error, status int, instance string) *Problem {
+	typ, ok := problemTypes[e.Code]
+	if !ok {
+		typ = "about:blank"
+	}
+	return &Problem{
+		Type:     typ,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Message,
+		Instance: instance,
+		Code:     e.Code,
+		Stack:    e.Stack,
+		HelpURL:  e.HelpURL,
+	}
+}
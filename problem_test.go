@@ -0,0 +1,42 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteProblem(t *testing.T) {
+	rw := httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+	res := new(responseWriter)
+	res.init(rw)
+	res.problemDetails = true
+	res.instance = "/users/dave"
+
+	if err := WriteResponse(res, http.StatusBadRequest, NewError(nil, EcodeResourceIdMismatch)); err != nil {
+		t.Fatal(err)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeProblemJson {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	expected := "{\"type\":\"urn:luddite:error:resource-id-mismatch\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"Resource identifier in URL doesn't match value in body\",\"instance\":\"/users/dave\",\"code\":\"RESOURCE_ID_MISMATCH\"}"
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("problem serialization failed, got: %s, expected: %s\n", body, expected)
+	}
+}
+
+func TestRegisterProblemType(t *testing.T) {
+	RegisterProblemType(EcodeHelloWorld, "https://example.com/problems/hello-world")
+	defer delete(problemTypes, EcodeHelloWorld)
+
+	p := newProblem(NewError(errorMap, EcodeHelloWorld, "dave"), http.StatusConflict, "")
+	if p.Type != "https://example.com/problems/hello-world" {
+		t.Errorf("unexpected problem type: %s", p.Type)
+	}
+
+	p = newProblem(&Error{Code: "UNREGISTERED"}, http.StatusConflict, "")
+	if p.Type != "about:blank" {
+		t.Errorf("unexpected problem type: %s", p.Type)
+	}
+}
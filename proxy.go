@@ -0,0 +1,108 @@
+package luddite
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// proxyPolicy decides whether a request's forwarded headers (X-Forwarded-For,
+// X-Forwarded-Host and X-Forwarded-Proto) may be trusted. Forwarded headers are
+// only trusted when the immediate peer is in one of the trusted proxy networks.
+//
+// NB: A nil policy, or one without trusted networks, preserves the historical
+// behavior: X-Forwarded-Host and X-Forwarded-Proto are trusted unconditionally
+// and X-Forwarded-For only when trustForwardedFor is true.
+type proxyPolicy struct {
+	trusted           []*net.IPNet
+	trustForwardedFor bool
+}
+
+func newProxyPolicy(trustedCIDRs []string, trustForwardedFor bool) (*proxyPolicy, error) {
+	p := &proxyPolicy{trustForwardedFor: trustForwardedFor}
+	for _, cidr := range trustedCIDRs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		p.trusted = append(p.trusted, n)
+	}
+	return p, nil
+}
+
+func (p *proxyPolicy) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range p.trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustsForwardedHeaders returns true if a request's forwarded headers may be
+// used.
+func (p *proxyPolicy) trustsForwardedHeaders(req *http.Request) bool {
+	if p == nil || len(p.trusted) == 0 {
+		return true
+	}
+	return p.isTrusted(remoteIP(req))
+}
+
+// clientIP returns a request's client IP address. When the immediate peer is a
+// trusted proxy, X-Forwarded-For is walked from the nearest hop outwards and
+// the first address that isn't itself a trusted proxy is returned.
+func (p *proxyPolicy) clientIP(req *http.Request) string {
+	if p == nil || len(p.trusted) == 0 {
+		return requestClientIP(req, p != nil && p.trustForwardedFor)
+	}
+
+	ip := remoteIP(req)
+	if !p.isTrusted(ip) {
+		return ip
+	}
+	var hops []string
+	for _, xff := range req.Header[HeaderForwardedFor] {
+		hops = append(hops, strings.Split(xff, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !p.isTrusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// RequestClientIP returns the IP address of the client that made a request.
+// Forwarded headers are honored according to the service's trusted proxy
+// configuration, so the address is suitable for logging, rate limiting and
+// access decisions.
+func RequestClientIP(r *http.Request) string {
+	var p *proxyPolicy
+	if s := ContextService(r.Context()); s != nil {
+		p = s.proxies
+	}
+	return p.clientIP(r)
+}
+
+func requestTrustsForwardedHeaders(r *http.Request) bool {
+	if s := ContextService(r.Context()); s != nil {
+		return s.proxies.trustsForwardedHeaders(r)
+	}
+	return true
+}
+
+func remoteIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
@@ -0,0 +1,64 @@
+package luddite
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProxyPolicy(t *testing.T) {
+	p, err := newProxyPolicy([]string{"10.0.0.0/8"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Untrusted peers can't spoof forwarded headers
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set(HeaderForwardedFor, "198.51.100.1")
+	if ip := p.clientIP(req); ip != "192.0.2.1" {
+		t.Errorf("expected peer address, got %s", ip)
+	}
+	if p.trustsForwardedHeaders(req) {
+		t.Error("untrusted peer's forwarded headers were trusted")
+	}
+
+	// Trusted proxies are skipped, nearest hop first
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(HeaderForwardedFor, "203.0.113.9, 198.51.100.1, 10.0.0.2")
+	if ip := p.clientIP(req); ip != "198.51.100.1" {
+		t.Errorf("expected forwarded client address, got %s", ip)
+	}
+	if !p.trustsForwardedHeaders(req) {
+		t.Error("trusted proxy's forwarded headers were ignored")
+	}
+
+	if _, err = newProxyPolicy([]string{"bogus"}, false); err == nil {
+		t.Error("expected invalid CIDR to be rejected")
+	}
+}
+
+func TestRequestExternalHostTrust(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Proxy.TrustedCIDRs = []string{"10.0.0.0/8"}
+	})
+
+	req, _ := http.NewRequest("GET", "http://internal/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set(HeaderForwardedHost, "evil.example.com")
+	req.Header.Set(HeaderForwardedProto, "https")
+	req = req.WithContext(withHandlerDetails(req.Context(), &handlerDetails{s: s}))
+	if host := RequestExternalHost(req); host != "internal" {
+		t.Errorf("expected untrusted X-Forwarded-Host to be ignored, got %s", host)
+	}
+	if scheme := RequestExternalScheme(req); scheme != "http" {
+		t.Errorf("expected untrusted X-Forwarded-Proto to be ignored, got %s", scheme)
+	}
+
+	req.RemoteAddr = "10.1.1.1:1234"
+	if host := RequestExternalHost(req); host != "evil.example.com" {
+		t.Errorf("expected trusted X-Forwarded-Host, got %s", host)
+	}
+	if ip := RequestClientIP(req); ip != "10.1.1.1" {
+		t.Errorf("expected peer address without X-Forwarded-For, got %s", ip)
+	}
+}
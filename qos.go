@@ -0,0 +1,118 @@
+package luddite
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Priority is a request's quality of service class. When the service
+// approaches its in-flight request limit, lower priority requests are shed
+// first.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	defaultPriorityHeadroom = 0.1
+)
+
+var (
+	qosRequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "luddite",
+		Subsystem: "qos",
+		Name:      "requests_in_flight",
+		Help:      "Number of requests being served by priority.",
+	}, []string{"priority"})
+
+	qosRequestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "qos",
+		Name:      "requests_shed_total",
+		Help:      "Number of requests rejected by priority because the service was near its in-flight limit.",
+	}, []string{"priority"})
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// QoSClassifier assigns a priority to an HTTP request, e.g. based on its path,
+// method or a header set by a trusted proxy.
+type QoSClassifier func(req *http.Request) Priority
+
+// SetQoSClassifier sets the function used to prioritize requests when the
+// service's in-flight request limit is configured. Requests are PriorityNormal
+// by default.
+func (s *Service) SetQoSClassifier(classifier QoSClassifier) {
+	s.qosClassifier = classifier
+}
+
+// qosLimiter caps the number of requests served at once. Each priority below
+// PriorityHigh is admitted up to a lower share of the limit so that capacity
+// remains for more important requests.
+type qosLimiter struct {
+	sync.Mutex
+	limits   [PriorityHigh + 1]int
+	inFlight int
+}
+
+func newQoSLimiter(max int, headroom float64) *qosLimiter {
+	l := &qosLimiter{}
+	for p := PriorityLow; p <= PriorityHigh; p++ {
+		limit := int(float64(max) * (1 - float64(PriorityHigh-p)*headroom))
+		if limit < 1 {
+			limit = 1
+		}
+		l.limits[p] = limit
+	}
+	return l
+}
+
+// acquire reserves a request slot for a priority. It returns false if the
+// priority's share of the limit is exhausted.
+func (l *qosLimiter) acquire(p Priority) bool {
+	if p < PriorityLow || p > PriorityHigh {
+		p = PriorityNormal
+	}
+	l.Lock()
+	if l.inFlight >= l.limits[p] {
+		l.Unlock()
+		qosRequestsShed.WithLabelValues(p.String()).Inc()
+		return false
+	}
+	l.inFlight++
+	l.Unlock()
+	qosRequestsInFlight.WithLabelValues(p.String()).Inc()
+	return true
+}
+
+func (l *qosLimiter) release(p Priority) {
+	if p < PriorityLow || p > PriorityHigh {
+		p = PriorityNormal
+	}
+	l.Lock()
+	l.inFlight--
+	l.Unlock()
+	qosRequestsInFlight.WithLabelValues(p.String()).Dec()
+}
+
+// reject writes a 503 response. Requests are shed before content negotiation,
+// so the response defaults to JSON.
+func (l *qosLimiter) reject(rw http.ResponseWriter) {
+	if rw.Header().Get(HeaderContentType) == "" {
+		rw.Header().Set(HeaderContentType, ContentTypeJson)
+	}
+	rw.Header().Set(HeaderRetryAfter, "1")
+	_ = WriteResponse(rw, ErrorStatus(EcodeServiceUnavailable), NewError(nil, EcodeServiceUnavailable, "overloaded"))
+}
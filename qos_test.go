@@ -0,0 +1,78 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQoSShedding(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Limits.MaxInFlight = 3
+		config.Limits.PriorityHeadroom = 0.3
+	})
+	s.SetQoSClassifier(func(req *http.Request) Priority {
+		switch req.Header.Get("X-Priority") {
+		case "low":
+			return PriorityLow
+		case "high":
+			return PriorityHigh
+		}
+		return PriorityNormal
+	})
+	held := &heldResource{started: make(chan struct{}), done: make(chan struct{})}
+	if err := s.AddResource(1, "/held", held); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(priority string) int {
+		req, _ := http.NewRequest("GET", "/held", nil)
+		req.Header.Set("X-Priority", priority)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	codes := make(chan int)
+	hold := func(priority string) {
+		go func() { codes <- serve(priority) }()
+		<-held.started
+	}
+
+	// Low priority requests are admitted up to 1 in flight, normal up to 2
+	// and high up to 3
+	shed := testutil.ToFloat64(qosRequestsShed.WithLabelValues("low"))
+	hold("low")
+	if code := serve("low"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected low priority request to be shed, got %d", code)
+	}
+	if n := testutil.ToFloat64(qosRequestsShed.WithLabelValues("low")) - shed; n != 1 {
+		t.Errorf("expected 1 shed low priority request, got %v", n)
+	}
+	hold("normal")
+	if code := serve("normal"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected normal priority request to be shed, got %d", code)
+	}
+	hold("high")
+	if active := testutil.ToFloat64(qosRequestsInFlight.WithLabelValues("high")); active != 1 {
+		t.Errorf("expected 1 high priority request in flight, got %v", active)
+	}
+	if code := serve("high"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected high priority request over the limit to be shed, got %d", code)
+	}
+
+	for i := 0; i < 3; i++ {
+		held.done <- struct{}{}
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("expected 200/OK, got %d", code)
+		}
+	}
+
+	// Once requests finish low priority requests are admitted again
+	hold("low")
+	held.done <- struct{}{}
+	if code := <-codes; code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", code)
+	}
+}
@@ -0,0 +1,233 @@
+package luddite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidRange occurs when a Range header can't be parsed, or requests
+	// too many or overlapping ranges.
+	ErrInvalidRange = errors.New("invalid range")
+
+	// ErrUnsatisfiableRange occurs when none of a Range header's ranges overlap the content.
+	ErrUnsatisfiableRange = errors.New("unsatisfiable range")
+)
+
+// maxRanges caps the number of ranges that a Range header may request.
+const maxRanges = 16
+
+// HTTPRange is a byte range requested using the Range header.
+type HTTPRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats the range as a Content-Range header value.
+func (r HTTPRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a request's Range header given the size of the content.
+// If the request doesn't include a Range header then no ranges are returned.
+// So that requests can't amplify responses, Range headers that request more
+// than 16 ranges, or overlapping ranges, are invalid.
+func ParseRange(req *http.Request, size int64) ([]HTTPRange, error) {
+	s := req.Header.Get(HeaderRange)
+	if s == "" {
+		return nil, nil
+	}
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, ErrInvalidRange
+	}
+
+	var (
+		ranges      []HTTPRange
+		noOverlap   bool
+		specs       = strings.Split(s[len(b):], ",")
+		parseNonNeg = func(v string) (int64, error) {
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || i < 0 {
+				return 0, ErrInvalidRange
+			}
+			return i, nil
+		}
+	)
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return nil, ErrInvalidRange
+		}
+		start, end := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+		var r HTTPRange
+		if start == "" {
+			// Suffix range, e.g. "-500" means the final 500 bytes
+			n, err := parseNonNeg(end)
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				// A zero-length suffix overlaps nothing
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r.Start = size - n
+			r.Length = size - r.Start
+		} else {
+			i, err := parseNonNeg(start)
+			if err != nil {
+				return nil, err
+			}
+			if i >= size {
+				// The range begins after the content ends
+				noOverlap = true
+				continue
+			}
+			r.Start = i
+			if end == "" {
+				// Open range, e.g. "500-" means everything from byte 500 on
+				r.Length = size - r.Start
+			} else {
+				i, err := parseNonNeg(end)
+				if err != nil || r.Start > i {
+					return nil, ErrInvalidRange
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.Length = i - r.Start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, ErrUnsatisfiableRange
+	}
+	if len(ranges) > maxRanges || rangesOverlap(ranges) {
+		return nil, ErrInvalidRange
+	}
+	return ranges, nil
+}
+
+func rangesOverlap(ranges []HTTPRange) bool {
+	sorted := append([]HTTPRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Start < sorted[i-1].Start+sorted[i-1].Length {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatches returns true if a request's If-Range header, if any, matches
+// the response's validator, i.e. its ETag (compared strongly) or Last-Modified
+// date, so that the requested ranges may be sent.
+func ifRangeMatches(req *http.Request, h http.Header) bool {
+	ir := req.Header.Get(HeaderIfRange)
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		etag := h.Get(HeaderETag)
+		return etag != "" && !strings.HasPrefix(etag, "W/") && ir == etag
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get(HeaderLastModified))
+	return err == nil && t.Equal(lm)
+}
+
+// WriteRangeResponse writes the ranges of content requested by a request's
+// Range header. A 206 response is written for satisfiable ranges (as a
+// multipart/byteranges body when multiple ranges are requested) and a 416
+// response is written for unsatisfiable ranges. Requests without a valid Range
+// header receive the entire content in a 200 response, as do requests whose
+// If-Range header doesn't match the ETag or Last-Modified header that the
+// handler set on the response.
+func WriteRangeResponse(rw http.ResponseWriter, req *http.Request, content io.ReadSeeker, size int64, contentType string) error {
+	ExemptResponseSizeLimit(rw)
+	rw.Header().Set(HeaderAcceptRanges, "bytes")
+	if contentType == "" {
+		contentType = ContentTypeOctetStream
+	}
+
+	var (
+		ranges []HTTPRange
+		err    error
+	)
+	if ifRangeMatches(req, rw.Header()) {
+		ranges, err = ParseRange(req, size)
+	}
+	switch err {
+	case nil:
+	case ErrUnsatisfiableRange:
+		rw.Header().Set(HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		rw.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return err
+	default:
+		// Invalid Range headers are ignored
+		ranges = nil
+	}
+
+	switch len(ranges) {
+	case 0:
+		rw.Header().Set(HeaderContentType, contentType)
+		rw.Header().Set(HeaderContentLength, strconv.FormatInt(size, 10))
+		rw.WriteHeader(http.StatusOK)
+		if _, err = content.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err = io.CopyN(rw, content, size)
+		return err
+	case 1:
+		r := ranges[0]
+		rw.Header().Set(HeaderContentType, contentType)
+		rw.Header().Set(HeaderContentRange, r.ContentRange(size))
+		rw.Header().Set(HeaderContentLength, strconv.FormatInt(r.Length, 10))
+		rw.WriteHeader(http.StatusPartialContent)
+		if _, err = content.Seek(r.Start, io.SeekStart); err != nil {
+			return err
+		}
+		_, err = io.CopyN(rw, content, r.Length)
+		return err
+	default:
+		mw := multipart.NewWriter(rw)
+		rw.Header().Set(HeaderContentType, ContentTypeMultipartByteranges+"; boundary="+mw.Boundary())
+		rw.WriteHeader(http.StatusPartialContent)
+		for _, r := range ranges {
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				HeaderContentType:  {contentType},
+				HeaderContentRange: {r.ContentRange(size)},
+			})
+			if err != nil {
+				return err
+			}
+			if _, err = content.Seek(r.Start, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err = io.CopyN(part, content, r.Length); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}
+}
@@ -0,0 +1,143 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const sampleRangeContent = "0123456789"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		ranges []HTTPRange
+		err    error
+	}{
+		{"", nil, nil},
+		{"bytes=0-4", []HTTPRange{{0, 5}}, nil},
+		{"bytes=5-", []HTTPRange{{5, 5}}, nil},
+		{"bytes=-3", []HTTPRange{{7, 3}}, nil},
+		{"bytes=8-20", []HTTPRange{{8, 2}}, nil},
+		{"bytes=0-1, 4-5", []HTTPRange{{0, 2}, {4, 2}}, nil},
+		{"bytes=10-", nil, ErrUnsatisfiableRange},
+		{"bytes=-0", nil, ErrUnsatisfiableRange},
+		{"bytes=0-4,-0", []HTTPRange{{0, 5}}, nil},
+		{"bytes=0-4,3-6", nil, ErrInvalidRange},
+		{"bytes=0-,0-,0-", nil, ErrInvalidRange},
+		{"bytes=" + strings.Repeat("0-0,", maxRanges) + "1-1", nil, ErrInvalidRange},
+		{"bytes=5-4", nil, ErrInvalidRange},
+		{"items=0-4", nil, ErrInvalidRange},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			req.Header.Set(HeaderRange, test.header)
+		}
+		ranges, err := ParseRange(req, int64(len(sampleRangeContent)))
+		if err != test.err {
+			t.Errorf("%q: unexpected error: %v", test.header, err)
+			continue
+		}
+		if len(ranges) != len(test.ranges) {
+			t.Errorf("%q: unexpected ranges: %v", test.header, ranges)
+			continue
+		}
+		for i := range ranges {
+			if ranges[i] != test.ranges[i] {
+				t.Errorf("%q: unexpected ranges: %v", test.header, ranges)
+			}
+		}
+	}
+}
+
+func TestWriteRangeResponse(t *testing.T) {
+	size := int64(len(sampleRangeContent))
+
+	// Single range
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderRange, "bytes=2-5")
+	rw := httptest.NewRecorder()
+	if err := WriteRangeResponse(rw, req, strings.NewReader(sampleRangeContent), size, ContentTypePlain); err != nil {
+		t.Fatal(err)
+	}
+	if rw.Code != http.StatusPartialContent {
+		t.Errorf("expected 206/Partial Content, got %d", rw.Code)
+	}
+	if cr := rw.Header().Get(HeaderContentRange); cr != "bytes 2-5/10" {
+		t.Errorf("unexpected %s header: %s", HeaderContentRange, cr)
+	}
+	if body := rw.Body.String(); body != "2345" {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	// Multiple ranges
+	req.Header.Set(HeaderRange, "bytes=0-1,8-9")
+	rw = httptest.NewRecorder()
+	if err := WriteRangeResponse(rw, req, strings.NewReader(sampleRangeContent), size, ContentTypePlain); err != nil {
+		t.Fatal(err)
+	}
+	if ct := rw.Header().Get(HeaderContentType); !strings.HasPrefix(ct, ContentTypeMultipartByteranges) {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	if body := rw.Body.String(); !strings.Contains(body, "bytes 0-1/10") || !strings.Contains(body, "bytes 8-9/10") {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	// Unsatisfiable range
+	req.Header.Set(HeaderRange, "bytes=20-30")
+	rw = httptest.NewRecorder()
+	if err := WriteRangeResponse(rw, req, strings.NewReader(sampleRangeContent), size, ContentTypePlain); err != ErrUnsatisfiableRange {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if rw.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected 416/Requested Range Not Satisfiable, got %d", rw.Code)
+	}
+
+	// Zero-length suffix range
+	req.Header.Set(HeaderRange, "bytes=-0")
+	rw = httptest.NewRecorder()
+	if err := WriteRangeResponse(rw, req, strings.NewReader(sampleRangeContent), size, ContentTypePlain); err != ErrUnsatisfiableRange {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if rw.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected 416/Requested Range Not Satisfiable, got %d", rw.Code)
+	}
+
+	// Ranges of a representation that changed are ignored
+	for _, test := range []struct {
+		ifRange string
+		status  int
+	}{
+		{`"v2"`, http.StatusPartialContent},
+		{`"v1"`, http.StatusOK},
+		{`W/"v2"`, http.StatusOK},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", http.StatusPartialContent},
+		{"Tue, 03 Jan 2006 15:04:05 GMT", http.StatusOK},
+	} {
+		req.Header.Set(HeaderRange, "bytes=2-5")
+		req.Header.Set(HeaderIfRange, test.ifRange)
+		rw = httptest.NewRecorder()
+		rw.Header().Set(HeaderETag, `"v2"`)
+		rw.Header().Set(HeaderLastModified, "Mon, 02 Jan 2006 15:04:05 GMT")
+		if err := WriteRangeResponse(rw, req, strings.NewReader(sampleRangeContent), size, ContentTypePlain); err != nil {
+			t.Fatal(err)
+		}
+		if rw.Code != test.status {
+			t.Errorf("If-Range %s: expected %d, got %d", test.ifRange, test.status, rw.Code)
+		}
+	}
+	req.Header.Del(HeaderIfRange)
+
+	// No range
+	req.Header.Del(HeaderRange)
+	rw = httptest.NewRecorder()
+	if err := WriteRangeResponse(rw, req, strings.NewReader(sampleRangeContent), size, ContentTypePlain); err != nil {
+		t.Fatal(err)
+	}
+	if rw.Code != http.StatusOK || rw.Body.String() != sampleRangeContent {
+		t.Errorf("unexpected response: %d %s", rw.Code, rw.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package luddite
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rateLimitSweepInterval sets how often idle rate limit keys are forgotten.
+const rateLimitSweepInterval = time.Minute
+
+var (
+	resourceRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "resource",
+		Name:      "rate_limited_total",
+		Help:      "Number of requests rejected because they exceeded a resource's rate limit.",
+	}, []string{"api_version", "resource"})
+
+	resourceRateLimitKeys = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "luddite",
+		Subsystem: "resource",
+		Name:      "rate_limit_keys",
+		Help:      "Number of keys (e.g. clients) tracked by a resource's rate limiter.",
+	}, []string{"api_version", "resource"})
+)
+
+// RateLimitKey returns the key that a request is rate limited by, e.g. its
+// client's IP address. Requests with the same key share a limit.
+type RateLimitKey func(req *http.Request) string
+
+// RateLimitByClientIP limits requests per client IP address, as returned by
+// RequestClientIP.
+func RateLimitByClientIP(req *http.Request) string {
+	return RequestClientIP(req)
+}
+
+// RateLimitBySession limits requests per session, falling back to the client
+// IP address for requests without a session id.
+func RateLimitBySession(req *http.Request) string {
+	if sessionId := ContextSessionId(req.Context()); sessionId != "" {
+		return "session:" + sessionId
+	}
+	return RateLimitByClientIP(req)
+}
+
+// RateLimitByIdentity limits requests per authenticated identity (see
+// ContextIdentity), falling back to the client IP address for anonymous
+// requests.
+func RateLimitByIdentity(req *http.Request) string {
+	if identity, ok := ContextIdentity(req.Context()); ok && identity.ID != "" {
+		return "identity:" + identity.ID
+	}
+	return RateLimitByClientIP(req)
+}
+
+// RateLimitSpec describes a resource's rate limit.
+type RateLimitSpec struct {
+	// RPS sets the sustained number of requests per second allowed per key.
+	// Zero or negative values disable the limit.
+	RPS float64
+	// Burst sets the number of requests per key allowed at once. Defaults to
+	// RPS, rounded up.
+	Burst int
+	// KeyBy selects what requests are limited by. Defaults to
+	// RateLimitByClientIP.
+	KeyBy RateLimitKey
+}
+
+// RateLimited may be implemented by resource handler types to limit the rate
+// of their requests, in addition to any service-wide limits. Requests over the
+// limit are rejected with 429 Too Many Requests and a Retry-After header.
+type RateLimited interface {
+	RateLimit() RateLimitSpec
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type resourceRateLimiter struct {
+	sync.Mutex
+	rps       float64
+	burst     float64
+	keyBy     RateLimitKey
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	limited   prometheus.Counter
+	keys      prometheus.Gauge
+}
+
+func newResourceRateLimiter(version int, basePath string, spec RateLimitSpec) *resourceRateLimiter {
+	burst := spec.Burst
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(spec.RPS)))
+	}
+	keyBy := spec.KeyBy
+	if keyBy == nil {
+		keyBy = RateLimitByClientIP
+	}
+	labels := prometheus.Labels{"api_version": strconv.Itoa(version), "resource": basePath}
+	return &resourceRateLimiter{
+		rps:     spec.RPS,
+		burst:   float64(burst),
+		keyBy:   keyBy,
+		buckets: make(map[string]*tokenBucket),
+		limited: resourceRateLimited.With(labels),
+		keys:    resourceRateLimitKeys.With(labels),
+	}
+}
+
+// allow takes a token from the request key's bucket as of now. If the bucket
+// is empty it returns false along with the time until a token is available.
+func (l *resourceRateLimiter) allow(req *http.Request, now time.Time) (bool, time.Duration) {
+	key := l.keyBy(req)
+
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		l.keys.Set(float64(len(l.buckets)))
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	l.limited.Inc()
+	return false, time.Duration((1 - b.tokens) / l.rps * float64(time.Second))
+}
+
+func (l *resourceRateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(l.burst, b.tokens+elapsed*l.rps)
+}
+
+// sweep forgets keys whose buckets have refilled, which behave the same as
+// new buckets.
+func (l *resourceRateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+	l.keys.Set(float64(len(l.buckets)))
+}
+
+func (l *resourceRateLimiter) reject(rw http.ResponseWriter, wait time.Duration) {
+	rw.Header().Set(HeaderRetryAfter, strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+	_ = WriteResponse(rw, ErrorStatus(EcodeRateLimited), NewError(nil, EcodeRateLimited))
+}
+
+// resourceRateLimiter returns the rate limiter for the resource that serves the
+// request, if any.
+func (d *handlerDetails) resourceRateLimiter() *resourceRateLimiter {
+	r := d.resource.find(func(r *resourceRegistration) bool { return r.rateLimiter != nil })
+	if r == nil {
+		return nil
+	}
+	return r.rateLimiter
+}
@@ -0,0 +1,120 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type quotesResource struct{}
+
+func (r *quotesResource) RateLimit() RateLimitSpec {
+	return RateLimitSpec{RPS: 1, Burst: 2}
+}
+
+func (r *quotesResource) Get(req *http.Request) (int, interface{}) {
+	return http.StatusOK, "quote"
+}
+
+func TestResourceRateLimit(t *testing.T) {
+	s := newTestService(t, nil)
+	clock := newFakeClock()
+	s.SetClock(clock)
+	if err := s.AddResource(1, "/quotes", &quotesResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	// Bursts are allowed up to the limit
+	for i := 0; i < 2; i++ {
+		if code := serve("/quotes", "10.0.0.1:1234").Code; code != http.StatusOK {
+			t.Errorf("expected 200/OK within the burst, got %d", code)
+		}
+	}
+	rw := serve("/quotes", "10.0.0.1:1234")
+	if rw.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429/Too Many Requests over the limit, got %d", rw.Code)
+	}
+	if retryAfter := rw.Header().Get(HeaderRetryAfter); retryAfter != "1" {
+		t.Errorf("expected Retry-After of 1, got %q", retryAfter)
+	}
+	counter := resourceRateLimited.WithLabelValues("1", "/quotes")
+	if limited := testutil.ToFloat64(counter); limited != 1 {
+		t.Errorf("expected 1 rate limited request, got %v", limited)
+	}
+
+	// Other clients and other resources are unaffected
+	if code := serve("/quotes", "10.0.0.2:1234").Code; code != http.StatusOK {
+		t.Errorf("expected other client to be served, got %d", code)
+	}
+	if code := serve("/ping", "10.0.0.1:1234").Code; code != http.StatusOK {
+		t.Errorf("expected unlimited resource to be served, got %d", code)
+	}
+
+	// Tokens refill over time
+	clock.Advance(time.Second)
+	if code := serve("/quotes", "10.0.0.1:1234").Code; code != http.StatusOK {
+		t.Errorf("expected 200/OK after refilling, got %d", code)
+	}
+}
+
+type unlimitedQuotesResource struct {
+	quotesResource
+}
+
+func (r *unlimitedQuotesResource) RateLimit() RateLimitSpec {
+	return RateLimitSpec{Burst: 1}
+}
+
+func TestResourceRateLimitZeroRPS(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/quotes", &unlimitedQuotesResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if r := s.lookupResource(1, "/quotes"); r.rateLimiter != nil {
+		t.Error("expected no rate limiter for a spec w/o RPS")
+	}
+
+	// Requests aren't limited, even past the burst
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/quotes", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		if rw.Code != http.StatusOK {
+			t.Errorf("expected 200/OK, got %d", rw.Code)
+		}
+	}
+}
+
+func TestResourceRateLimiterSweep(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newResourceRateLimiter(1, "/swept", RateLimitSpec{RPS: 10})
+	req, _ := http.NewRequest("GET", "/swept", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	if ok, _ := l.allow(req, now); !ok {
+		t.Fatal("expected first request to be allowed")
+	}
+	if n := len(l.buckets); n != 1 {
+		t.Errorf("expected 1 tracked key, got %d", n)
+	}
+
+	req.RemoteAddr = "10.0.0.2:1234"
+	l.allow(req, now.Add(rateLimitSweepInterval))
+	if n := len(l.buckets); n != 1 {
+		t.Errorf("expected idle key to be forgotten, got %d keys", n)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"reflect"
+	"strconv"
 
 	"github.com/dimfeld/httptreemux"
 )
@@ -16,6 +18,27 @@ const (
 	RouteParamId     = RouteTagSeg1 // e.g. in `GET /resource/id`
 )
 
+// RouteAdder adds routes, either to a router or to the routes that AddResource
+// plans to register for a resource. RouteRegistrar resources are given one
+// that records the routes they add, so that the service knows about them.
+type RouteAdder interface {
+	// Handle adds a route for a method and path pattern, like a router's
+	// Handle method.
+	Handle(method, path string, handler http.HandlerFunc)
+}
+
+// recordingRouter adds routes to one of a service's routers, recording them in
+// the router's route table.
+type recordingRouter struct {
+	router *httptreemux.ContextMux
+	table  *routeTable
+}
+
+func (r recordingRouter) Handle(method, path string, handler http.HandlerFunc) {
+	r.router.Handle(method, path, handler)
+	r.table.add(method, path)
+}
+
 // CollectionLister is a collection-style resource that returns all its elements
 // in response to `GET /resource`.
 type CollectionLister interface {
@@ -25,10 +48,21 @@ type CollectionLister interface {
 
 // AddListCollectionRoute adds a route for a CollectionLister.
 func AddListCollectionRoute(router *httptreemux.ContextMux, basePath string, r CollectionLister) {
-	router.GET(basePath, func(rw http.ResponseWriter, req *http.Request) {
+	addListCollectionRoute(router, basePath, r)
+}
+
+func addListCollectionRoute(a RouteAdder, basePath string, r CollectionLister) {
+	a.Handle(http.MethodGet, basePath, func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.ListCollectionRoute.begin")
 		if status, v := r.List(req); status > 0 {
+			if status/100 == 2 && writeMultipleChoices(rw, req, r) {
+				return
+			}
+			setCacheControl(rw, r, status, false)
+			if x, ok := r.(CollectionCounter); ok && status/100 == 2 && RequestPreferCount(req) != "" {
+				setTotalCount(rw, req, x)
+			}
 			SetContextRequestProgress(ctx, "luddite.ListCollectionRoute.write")
 			_ = WriteResponse(rw, status, v)
 		}
@@ -44,16 +78,42 @@ type CollectionCounter interface {
 
 // AddCountCollectionRoute adds a route for a CollectionCounter.
 func AddCountCollectionRoute(router *httptreemux.ContextMux, basePath string, r CollectionCounter) {
-	router.GET(path.Join(basePath, "all", "count"), func(rw http.ResponseWriter, req *http.Request) {
+	addCountCollectionRoute(router, basePath, r)
+}
+
+func addCountCollectionRoute(a RouteAdder, basePath string, r CollectionCounter) {
+	a.Handle(http.MethodGet, path.Join(basePath, "all", "count"), func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.CountCollectionRoute.begin")
 		if status, v := r.Count(req); status > 0 {
+			setCacheControl(rw, r, status, false)
 			SetContextRequestProgress(ctx, "luddite.CountCollectionRoute.write")
 			_ = WriteResponse(rw, status, v)
 		}
 	})
 }
 
+// setTotalCount adds an X-Total-Count header to a listing, for clients that
+// prefer "count=exact", using the resource's count. Counts that fail or aren't
+// integers are omitted.
+func setTotalCount(rw http.ResponseWriter, req *http.Request, r CollectionCounter) {
+	status, v := r.Count(req)
+	if status/100 != 2 {
+		return
+	}
+	var count string
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		count = strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		count = strconv.FormatUint(rv.Uint(), 10)
+	default:
+		return
+	}
+	rw.Header().Set(HeaderTotalCount, count)
+	rw.Header().Add(HeaderPreferenceApplied, "count="+PreferCountExact)
+}
+
 // CollectionGetter is a collection-style resource that returns a specific element
 // in response to `GET /resource/id`.
 type CollectionGetter interface {
@@ -63,11 +123,19 @@ type CollectionGetter interface {
 
 // AddGetCollectionRoute adds a route for a CollectionGetter.
 func AddGetCollectionRoute(router *httptreemux.ContextMux, basePath string, r CollectionGetter) {
-	router.GET(path.Join(basePath, ":"+RouteParamId), func(rw http.ResponseWriter, req *http.Request) {
+	addGetCollectionRoute(router, basePath, r)
+}
+
+func addGetCollectionRoute(a RouteAdder, basePath string, r CollectionGetter) {
+	a.Handle(http.MethodGet, path.Join(basePath, ":"+RouteParamId), func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.GetCollectionRoute.begin")
 		params := httptreemux.ContextParams(ctx)
 		if status, v := r.Get(req, params[RouteParamId]); status > 0 {
+			if status/100 == 2 && writeMultipleChoices(rw, req, r) {
+				return
+			}
+			setCacheControl(rw, r, status, false)
 			SetContextRequestProgress(ctx, "luddite.GetCollectionRoute.write")
 			_ = WriteResponse(rw, status, v)
 		}
@@ -89,13 +157,17 @@ type CollectionCreator interface {
 
 // AddCreateCollectionRoute adds a route for a CollectionCreator.
 func AddCreateCollectionRoute(router *httptreemux.ContextMux, basePath string, r CollectionCreator) {
-	router.POST(basePath, func(rw http.ResponseWriter, req *http.Request) {
+	addCreateCollectionRoute(router, basePath, r)
+}
+
+func addCreateCollectionRoute(a RouteAdder, basePath string, r CollectionCreator) {
+	a.Handle(http.MethodPost, basePath, func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.CreateCollectionRoute.begin")
 		v0 := r.New()
 		if err := ReadRequest(req, v0); err != nil {
 			SetContextRequestProgress(ctx, "luddite.CreateCollectionRoute.body_error")
-			_ = WriteResponse(rw, http.StatusBadRequest, err)
+			_ = WriteResponse(rw, requestBodyErrorStatus(err), err)
 			return
 		}
 		if status, v1 := r.Create(req, v0); status > 0 {
@@ -107,6 +179,7 @@ func AddCreateCollectionRoute(router *httptreemux.ContextMux, basePath string, r
 				}
 				rw.Header().Add(HeaderLocation, url.String())
 			}
+			setCacheControl(rw, r, status, true)
 			SetContextRequestProgress(ctx, "luddite.CreateCollectionRoute.write")
 			_ = WriteResponse(rw, status, v1)
 		}
@@ -128,23 +201,28 @@ type CollectionUpdater interface {
 
 // AddUpdateCollectionRoute adds a route for a CollectionUpdater.
 func AddUpdateCollectionRoute(router *httptreemux.ContextMux, basePath string, r CollectionUpdater) {
-	router.PUT(path.Join(basePath, ":"+RouteParamId), func(rw http.ResponseWriter, req *http.Request) {
+	addUpdateCollectionRoute(router, basePath, r)
+}
+
+func addUpdateCollectionRoute(a RouteAdder, basePath string, r CollectionUpdater) {
+	a.Handle(http.MethodPut, path.Join(basePath, ":"+RouteParamId), func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.UpdateCollectionRoute.begin")
 		v0 := r.New()
 		if err := ReadRequest(req, v0); err != nil {
 			SetContextRequestProgress(ctx, "luddite.UpdateCollectionRoute.body_error")
-			_ = WriteResponse(rw, http.StatusBadRequest, err)
+			_ = WriteResponse(rw, requestBodyErrorStatus(err), err)
 			return
 		}
 		params := httptreemux.ContextParams(ctx)
 		id := params[RouteParamId]
 		if id != r.Id(v0) {
 			SetContextRequestProgress(ctx, "luddite.UpdateCollectionRoute.id_error")
-			_ = WriteResponse(rw, http.StatusBadRequest, NewError(nil, EcodeResourceIdMismatch))
+			_ = WriteResponse(rw, ErrorStatus(EcodeResourceIdMismatch), NewError(nil, EcodeResourceIdMismatch))
 			return
 		}
 		if status, v1 := r.Update(req, id, v0); status > 0 {
+			setCacheControl(rw, r, status, true)
 			SetContextRequestProgress(ctx, "luddite.UpdateCollectionRoute.write")
 			_ = WriteResponse(rw, status, v1)
 		}
@@ -161,19 +239,25 @@ type CollectionDeleter interface {
 
 // AddDeleteCollectionRoute adds routes for a CollectionDeleter.
 func AddDeleteCollectionRoute(router *httptreemux.ContextMux, basePath string, r CollectionDeleter) {
-	router.DELETE(path.Join(basePath, ":"+RouteParamId), func(rw http.ResponseWriter, req *http.Request) {
+	addDeleteCollectionRoute(router, basePath, r)
+}
+
+func addDeleteCollectionRoute(a RouteAdder, basePath string, r CollectionDeleter) {
+	a.Handle(http.MethodDelete, path.Join(basePath, ":"+RouteParamId), func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.DeleteCollectionRoute.begin")
 		params := httptreemux.ContextParams(ctx)
 		if status, v := r.Delete(req, params[RouteParamId]); status > 0 {
+			setCacheControl(rw, r, status, true)
 			SetContextRequestProgress(ctx, "luddite.DeleteCollectionRoute.write")
 			_ = WriteResponse(rw, status, v)
 		}
 	})
-	router.DELETE(basePath, func(rw http.ResponseWriter, req *http.Request) {
+	a.Handle(http.MethodDelete, basePath, func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.DeleteCollectionRoute.begin")
 		if status, v := r.Delete(req, ""); status > 0 {
+			setCacheControl(rw, r, status, true)
 			SetContextRequestProgress(ctx, "luddite.DeleteCollectionRoute.write")
 			_ = WriteResponse(rw, status, v)
 		}
@@ -189,11 +273,16 @@ type CollectionActioner interface {
 
 // AddActionCollectionRoute adds a route for a CollectionActioner.
 func AddActionCollectionRoute(router *httptreemux.ContextMux, basePath string, r CollectionActioner) {
-	router.POST(path.Join(basePath, ":"+RouteParamId, ":"+RouteParamAction), func(rw http.ResponseWriter, req *http.Request) {
+	addActionCollectionRoute(router, basePath, r)
+}
+
+func addActionCollectionRoute(a RouteAdder, basePath string, r CollectionActioner) {
+	a.Handle(http.MethodPost, path.Join(basePath, ":"+RouteParamId, ":"+RouteParamAction), func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.ActionCollectionRoute.begin")
 		params := httptreemux.ContextParams(ctx)
 		if status, v := r.Action(req, params[RouteParamId], params[RouteParamAction]); status > 0 {
+			setCacheControl(rw, r, status, true)
 			SetContextRequestProgress(ctx, "luddite.ActionCollectionRoute.write")
 			_ = WriteResponse(rw, status, v)
 		}
@@ -209,10 +298,18 @@ type SingletonGetter interface {
 
 // AddGetSingletonRoute adds a route for a SingletonGetter.
 func AddGetSingletonRoute(router *httptreemux.ContextMux, basePath string, r SingletonGetter) {
-	router.GET(basePath, func(rw http.ResponseWriter, req *http.Request) {
+	addGetSingletonRoute(router, basePath, r)
+}
+
+func addGetSingletonRoute(a RouteAdder, basePath string, r SingletonGetter) {
+	a.Handle(http.MethodGet, basePath, func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.GetSingletonRoute.begin")
 		if status, v := r.Get(req); status > 0 {
+			if status/100 == 2 && writeMultipleChoices(rw, req, r) {
+				return
+			}
+			setCacheControl(rw, r, status, false)
 			SetContextRequestProgress(ctx, "luddite.GetSingletonRoute.write")
 			_ = WriteResponse(rw, status, v)
 		}
@@ -231,16 +328,21 @@ type SingletonUpdater interface {
 
 // AddUpdateSingletonRoute adds a route for a SingletonUpdater.
 func AddUpdateSingletonRoute(router *httptreemux.ContextMux, basePath string, r SingletonUpdater) {
-	router.PUT(basePath, func(rw http.ResponseWriter, req *http.Request) {
+	addUpdateSingletonRoute(router, basePath, r)
+}
+
+func addUpdateSingletonRoute(a RouteAdder, basePath string, r SingletonUpdater) {
+	a.Handle(http.MethodPut, basePath, func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.UpdateSingletonRoute.begin")
 		v0 := r.New()
 		if err := ReadRequest(req, v0); err != nil {
 			SetContextRequestProgress(ctx, "luddite.UpdateSingletonRoute.body_error")
-			_ = WriteResponse(rw, http.StatusBadRequest, err)
+			_ = WriteResponse(rw, requestBodyErrorStatus(err), err)
 			return
 		}
 		if status, v1 := r.Update(req, v0); status > 0 {
+			setCacheControl(rw, r, status, true)
 			SetContextRequestProgress(ctx, "luddite.UpdateSingletonRoute.write")
 			_ = WriteResponse(rw, status, v1)
 		}
@@ -256,13 +358,27 @@ type SingletonActioner interface {
 
 // AddActionSingletonRoute adds a route for a SingletonActioner.
 func AddActionSingletonRoute(router *httptreemux.ContextMux, basePath string, r SingletonActioner) {
-	router.POST(path.Join(basePath, ":"+RouteParamAction), func(rw http.ResponseWriter, req *http.Request) {
+	addActionSingletonRoute(router, basePath, r)
+}
+
+func addActionSingletonRoute(a RouteAdder, basePath string, r SingletonActioner) {
+	a.Handle(http.MethodPost, path.Join(basePath, ":"+RouteParamAction), func(rw http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		SetContextRequestProgress(ctx, "luddite.ActionSingletonRoute.begin")
 		params := httptreemux.ContextParams(ctx)
 		if status, v := r.Action(req, params[RouteParamAction]); status > 0 {
+			setCacheControl(rw, r, status, true)
 			SetContextRequestProgress(ctx, "luddite.ActionSingletonRoute.write")
 			_ = WriteResponse(rw, status, v)
 		}
 	})
 }
+
+// RouteRegistrar is a resource that registers its own routes, e.g. for nested
+// sub-resources that don't fit the collection or singleton patterns.
+type RouteRegistrar interface {
+	// RegisterRoutes adds the resource's routes relative to basePath. The
+	// routes are known to the service, e.g. for Service.Routes and route
+	// conflict detection.
+	RegisterRoutes(routes RouteAdder, basePath string)
+}
@@ -0,0 +1,56 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+type resettableResource struct {
+	pingResource
+	reset string
+}
+
+func (r *resettableResource) RegisterRoutes(routes RouteAdder, basePath string) {
+	routes.Handle(http.MethodPost, basePath+"/:id/reset", func(rw http.ResponseWriter, req *http.Request) {
+		r.reset = httptreemux.ContextParams(req.Context())["id"]
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestRouteRegistrar(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Prefix = "/api"
+	})
+	r := &resettableResource{}
+	if err := s.AddResource(1, "/devices", r); err != nil {
+		t.Fatal(err)
+	}
+
+	// The resource's own routes are served relative to its base path...
+	req, _ := http.NewRequest("POST", "/api/devices/42/reset", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNoContent || r.reset != "42" {
+		t.Errorf("expected 204/No Content resetting 42, got %d resetting %q", rw.Code, r.reset)
+	}
+
+	// ...alongside the routes of the interfaces it implements
+	req, _ = http.NewRequest("GET", "/api/devices", nil)
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", rw.Code)
+	}
+	found := false
+	for _, route := range s.Routes() {
+		if route.Method == http.MethodPost && route.Path == "/api/devices/:id/reset" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected registered route to be listed, got %v", s.Routes())
+	}
+}
@@ -2,10 +2,22 @@ package luddite
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"net"
 	"net/http"
 )
 
+// ErrResponseTooLarge is returned by response writes that would exceed the
+// service's Response.MaxResponseBytes limit.
+var ErrResponseTooLarge = errors.New("response exceeds the maximum response size")
+
+// ErrResponseCanceled is returned by WriteResponse when the request's context
+// is done, e.g. because the client disconnected, before or while the response
+// is written. The rest of the response is discarded and the request is logged
+// with the 418 status marker rather than as an error.
+var ErrResponseCanceled = errors.New("response canceled")
+
 // ResponseWriter is a wrapper around http.ResponseWriter that
 // provides extra information about the response.
 type ResponseWriter interface {
@@ -29,14 +41,59 @@ type ResponseWriter interface {
 // init method below. This enables pool-based allocation.
 type responseWriter struct {
 	http.ResponseWriter
-	status int
-	size   int64
+	status           int
+	size             int64
+	jsonIndent       string
+	jsonEscapeHTML   bool
+	jsonOmitNull     bool
+	jsonFieldNames   func(string) string
+	jsonTimeFormat   string
+	bufferHint       int
+	autoETag         bool
+	ifNoneMatch      string
+	jsonpCallback    string
+	problemDetails   bool
+	jsonAPIErrors    bool
+	instance         string
+	validation       *resourceValidation
+	bodylessStatuses map[int]bool
+	maxBytes         int64
+	truncated        bool
+	ctx              context.Context
+	canceled         bool
 }
 
 func (rw *responseWriter) init(base http.ResponseWriter) {
 	rw.ResponseWriter = base
 	rw.status = 0
 	rw.size = 0
+	rw.jsonIndent = ""
+	rw.jsonEscapeHTML = true
+	rw.jsonOmitNull = false
+	rw.jsonFieldNames = nil
+	rw.jsonTimeFormat = ""
+	rw.bufferHint = 0
+	rw.autoETag = false
+	rw.ifNoneMatch = ""
+	rw.jsonpCallback = ""
+	rw.problemDetails = false
+	rw.jsonAPIErrors = false
+	rw.instance = ""
+	rw.validation = nil
+	rw.bodylessStatuses = nil
+	rw.maxBytes = 0
+	rw.truncated = false
+	rw.ctx = nil
+	rw.canceled = false
+}
+
+// checkCanceled returns true, and marks the response as canceled, if the
+// request's context is done.
+func (rw *responseWriter) checkCanceled() bool {
+	if rw.ctx != nil && rw.ctx.Err() != nil {
+		rw.canceled = true
+	}
+	return rw.canceled
 }
 
 func (rw *responseWriter) WriteHeader(s int) {
@@ -49,6 +106,16 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 		// The status will be StatusOK if WriteHeader has not been called yet
 		rw.WriteHeader(http.StatusOK)
 	}
+	if rw.maxBytes > 0 && rw.size+int64(len(b)) > rw.maxBytes {
+		// Drop everything beyond the limit; the service logs the truncation
+		rw.truncated = true
+		var size int
+		if remaining := rw.maxBytes - rw.size; remaining > 0 {
+			size, _ = rw.ResponseWriter.Write(b[:remaining])
+			rw.size += int64(size)
+		}
+		return size, ErrResponseTooLarge
+	}
 	size, err := rw.ResponseWriter.Write(b)
 	rw.size += int64(size)
 	return size, err
@@ -66,6 +133,16 @@ func (rw *responseWriter) Size() int64 {
 	return rw.size
 }
 
+// ExemptResponseSizeLimit exempts a response from the service's
+// Response.MaxResponseBytes limit. Streaming responses (Server-Sent Events,
+// ranges and static files) are exempt automatically; other handlers that
+// legitimately stream large bodies should call this before writing.
+func ExemptResponseSizeLimit(rw http.ResponseWriter) {
+	if res, ok := rw.(*responseWriter); ok {
+		res.maxBytes = 0
+	}
+}
+
 func (rw *responseWriter) Flush() {
 	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
 		flusher.Flush()
@@ -0,0 +1,24 @@
+package luddite
+
+import "math/rand"
+
+// responseIdAlphabet is Crockford's base32 alphabet, which omits letters that
+// are easily confused when read aloud (I, L, O and U).
+const responseIdAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const responseIdLen = 8
+
+// newResponseId returns a short, random, human-dictatable id for a response,
+// e.g. "7KQ2M9XD". Response ids identify individual responses in support
+// workflows; unlike trace ids they aren't meant to be globally unique.
+func newResponseId() string {
+	var (
+		b [responseIdLen]byte
+		n = rand.Int63()
+	)
+	for i := range b {
+		b[i] = responseIdAlphabet[n&31]
+		n >>= 5
+	}
+	return string(b[:])
+}
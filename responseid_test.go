@@ -0,0 +1,53 @@
+package luddite
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestResponseId(t *testing.T) {
+	s := newTestService(t, nil)
+	var logs bytes.Buffer
+	s.accessLogger.Out = &logs
+	s.accessLogger.Formatter = &log.JSONFormatter{}
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	serve := func() *httptest.ResponseRecorder {
+		logs.Reset()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if id := serve().Header().Get(HeaderResponseId); id != "" {
+		t.Errorf("expected no response id by default, got %q", id)
+	}
+
+	s.config.Response.ResponseId = true
+	rw := serve()
+	id := rw.Header().Get(HeaderResponseId)
+	if len(id) != responseIdLen || strings.Trim(id, responseIdAlphabet) != "" {
+		t.Errorf("expected %d base32 characters, got %q", responseIdLen, id)
+	}
+	if id == rw.Header().Get(HeaderRequestId) {
+		t.Error("expected response id to differ from request id")
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["response_id"] != id {
+		t.Errorf("expected response id %s in access log, got %v", id, fields["response_id"])
+	}
+	if other := serve().Header().Get(HeaderResponseId); other == id {
+		t.Errorf("expected a new response id per request, got %s twice", id)
+	}
+}
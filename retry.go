@@ -0,0 +1,109 @@
+package luddite
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryMultiplier     = 2
+)
+
+// RetryOptions configures DoWithRetry.
+type RetryOptions struct {
+	// Name identifies the call in trace annotations, e.g. the name of the
+	// downstream service.
+	Name string
+	// MaxAttempts sets the maximum number of calls, including the first.
+	// Defaults to 3.
+	MaxAttempts int
+	// InitialBackoff sets the delay before the first retry. Defaults to
+	// 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries. Defaults to 5s.
+	MaxBackoff time.Duration
+	// Multiplier sets the factor by which the delay grows after each retry.
+	// Defaults to 2.
+	Multiplier float64
+	// Jitter sets the fraction, between 0 and 1, of each delay that is
+	// randomized so that clients don't retry in lockstep. Defaults to 0.
+	Jitter float64
+	// Retryable, when set, limits retries to errors for which it returns
+	// true. By default all errors are retried.
+	Retryable func(err error) bool
+	// Clock sets the clock used to wait between retries. Defaults to the
+	// real clock.
+	Clock Clock
+}
+
+// DoWithRetry calls fn until it succeeds or the maximum number of attempts is
+// reached, waiting with exponential backoff between attempts. It is meant for
+// idempotent calls to flaky downstream services.
+//
+// Retrying stops early if ctx is canceled, in which case the context's error
+// is returned, or if ctx's deadline would expire before the next attempt, in
+// which case the last error from fn is returned. The number of retries
+// annotates the current trace span as "retry.<name>".
+func DoWithRetry(ctx context.Context, fn func() error, opts RetryOptions) error {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = defaultRetryMultiplier
+	}
+	if opts.Jitter < 0 || opts.Jitter > 1 {
+		opts.Jitter = 0
+	}
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
+
+	var (
+		backoff = opts.InitialBackoff
+		retries int
+		err     error
+	)
+	defer func() {
+		if retries > 0 {
+			ContextTraceAnnotate(ctx)["retry."+opts.Name] = retries
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == opts.MaxAttempts || (opts.Retryable != nil && !opts.Retryable(err)) {
+			return err
+		}
+
+		delay := backoff
+		if opts.Jitter > 0 {
+			delay -= time.Duration(opts.Jitter * rand.Float64() * float64(delay))
+		}
+		if deadline, ok := ctx.Deadline(); ok && opts.Clock.Now().Add(delay).After(deadline) {
+			return err
+		}
+		timer := opts.Clock.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+
+		retries++
+		if backoff = time.Duration(float64(backoff) * opts.Multiplier); backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package luddite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errFlaky = errors.New("flaky")
+
+func TestDoWithRetrySuccessAfterRetry(t *testing.T) {
+	calls := 0
+	err := DoWithRetry(context.Background(), func() error {
+		if calls++; calls < 3 {
+			return errFlaky
+		}
+		return nil
+	}, RetryOptions{Name: "flaky", InitialBackoff: time.Millisecond, Jitter: 0.5})
+	if err != nil {
+		t.Errorf("expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	calls = 0
+	err = DoWithRetry(context.Background(), func() error {
+		calls++
+		return errFlaky
+	}, RetryOptions{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	if err != errFlaky || calls != 2 {
+		t.Errorf("expected 2 failed calls, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	err = DoWithRetry(context.Background(), func() error {
+		calls++
+		return errFlaky
+	}, RetryOptions{InitialBackoff: time.Millisecond, Retryable: func(error) bool { return false }})
+	if err != errFlaky || calls != 1 {
+		t.Errorf("expected non-retryable error after 1 call, got %d calls and %v", calls, err)
+	}
+}
+
+func TestDoWithRetryDeadlineAbort(t *testing.T) {
+	// Retries that can't start before the deadline are skipped
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	calls := 0
+	start := time.Now()
+	err := DoWithRetry(ctx, func() error {
+		calls++
+		return errFlaky
+	}, RetryOptions{InitialBackoff: time.Second})
+	if err != errFlaky || calls != 1 {
+		t.Errorf("expected 1 failed call, got %d calls and %v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("expected retry to abort immediately, took %v", elapsed)
+	}
+
+	// Cancelation interrupts the wait between retries
+	ctx, cancel = context.WithCancel(context.Background())
+	calls = 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err = DoWithRetry(ctx, func() error {
+		calls++
+		return errFlaky
+	}, RetryOptions{InitialBackoff: time.Second})
+	if err != context.Canceled || calls != 1 {
+		t.Errorf("expected cancelation after 1 call, got %d calls and %v", calls, err)
+	}
+}
@@ -0,0 +1,225 @@
+package luddite
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+// ErrRouteConflict is wrapped by errors describing routes that conflict with
+// routes already registered with an API router.
+var ErrRouteConflict = errors.New("route conflict")
+
+// RouteConflictError describes a route that can't be registered because it
+// conflicts with an existing route, either by duplicating its method and path
+// or by naming its path parameters differently.
+type RouteConflictError struct {
+	// Version is the API version of the router.
+	Version int
+	// Method and Path describe the conflicting route. Method is empty when
+	// the conflict was detected by the router itself.
+	Method string
+	Path   string
+	// Resource identifies the resource whose route conflicts.
+	Resource string
+	// Existing identifies the resource that owns the existing route.
+	Existing string
+	// Detail describes the conflict.
+	Detail string
+}
+
+func (e *RouteConflictError) Error() string {
+	if e.Method == "" {
+		return fmt.Sprintf("API v%d routes of %s conflict with existing routes: %s", e.Version, e.Resource, e.Detail)
+	}
+	return fmt.Sprintf("API v%d route %s %s of %s %s %s", e.Version, e.Method, e.Path, e.Resource, e.Detail, e.Existing)
+}
+
+func (e *RouteConflictError) Unwrap() error {
+	return ErrRouteConflict
+}
+
+// RouteConflictsError lists all of the route conflicts detected together.
+type RouteConflictsError []*RouteConflictError
+
+func (e RouteConflictsError) Error() string {
+	msgs := make([]string, len(e))
+	for i, c := range e {
+		msgs[i] = c.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e RouteConflictsError) Unwrap() error {
+	return ErrRouteConflict
+}
+
+// Validate returns a RouteConflictsError listing the route conflicts detected
+// by all AddResource calls, or nil if there were none. Run calls it before
+// starting the service, so that misconfigured services fail at startup even if
+// AddResource errors were ignored.
+func (s *Service) Validate() error {
+	if len(s.routeConflicts) == 0 {
+		return nil
+	}
+	return append(RouteConflictsError(nil), s.routeConflicts...)
+}
+
+// plannedRoute is a route that AddResource registers for a resource.
+type plannedRoute struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+}
+
+// plannedRoutes collects the routes that AddResource registers for a resource
+// so that they can be checked for conflicts before any are added to a router.
+type plannedRoutes []plannedRoute
+
+func (p *plannedRoutes) Handle(method, path string, handler http.HandlerFunc) {
+	*p = append(*p, plannedRoute{method, path, handler})
+}
+
+// resourceRoutes returns the collection and singleton routes that AddResource
+// registers for a resource, followed by those it registers itself if it's a
+// RouteRegistrar.
+func (s *Service) resourceRoutes(basePath string, r interface{}) []plannedRoute {
+	var routes plannedRoutes
+	s.addCollectionRoutes(&routes, basePath, r)
+	s.addSingletonRoutes(&routes, basePath, r)
+	if x, ok := r.(RouteRegistrar); ok {
+		x.RegisterRoutes(&routes, basePath)
+	}
+	return routes
+}
+
+// routeShape returns a path pattern with its parameter names elided, along
+// with the names. httptreemux requires routes with the same shape to use the
+// same parameter names, whatever their methods.
+func routeShape(p string) (string, []string) {
+	segs := strings.Split(p, "/")
+	var names []string
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			names = append(names, seg)
+			segs[i] = seg[:1]
+		}
+	}
+	return strings.Join(segs, "/"), names
+}
+
+// directRouteOwner identifies routes that were added to API routers other than
+// by AddResource.
+const directRouteOwner = "a route added directly to the router"
+
+func routeOwnerKey(version int, method, p string) string {
+	return fmt.Sprintf("%d %s %s", version, method, p)
+}
+
+// checkRouteConflicts compares the routes a resource would register against
+// those already registered with the version's router and against each other.
+func (s *Service) checkRouteConflicts(version int, routes []plannedRoute, resource string) []*RouteConflictError {
+	existing := s.routerTable(s.apiRouters[version]).load().routes
+	var (
+		planned   []RouteInfo
+		conflicts []*RouteConflictError
+	)
+	for _, route := range routes {
+		p := path.Join("/", s.config.Prefix, route.path)
+		owner, detail := "", ""
+		for _, other := range existing {
+			if detail = routeConflict(route.method, p, other); detail != "" {
+				owner = s.routeOwners[routeOwnerKey(version, other.Method, other.Path)]
+				break
+			}
+		}
+		if detail == "" {
+			for _, other := range planned {
+				if detail = routeConflict(route.method, p, other); detail != "" {
+					owner = resource
+					break
+				}
+			}
+		}
+		if detail != "" {
+			conflicts = append(conflicts, &RouteConflictError{
+				Version:  version,
+				Method:   route.method,
+				Path:     p,
+				Resource: resource,
+				Existing: owner,
+				Detail:   detail,
+			})
+		}
+		planned = append(planned, RouteInfo{Method: route.method, Path: p})
+	}
+	return conflicts
+}
+
+// routeConflict describes how a route conflicts with another, or returns ""
+// if it doesn't.
+func routeConflict(method, p string, other RouteInfo) string {
+	shape, names := routeShape(p)
+	otherShape, otherNames := routeShape(other.Path)
+	switch {
+	case otherShape != shape:
+		return ""
+	case other.Method == method:
+		return "duplicates a route of"
+	case strings.Join(otherNames, "/") != strings.Join(names, "/"):
+		return "has path parameters ambiguous with " + other.Method + " " + other.Path + " of"
+	}
+	return ""
+}
+
+// recordRouteOwners attributes a version's routes that were added since the
+// last call to an owner.
+func (s *Service) recordRouteOwners(version int, owner string) {
+	if s.routeOwners == nil {
+		s.routeOwners = make(map[string]string)
+		s.ownedRoutes = make(map[int]int)
+	}
+	routes := s.routerTable(s.apiRouters[version]).load().routes
+	for _, route := range routes[s.ownedRoutes[version]:] {
+		s.routeOwners[routeOwnerKey(version, route.Method, route.Path)] = owner
+	}
+	s.ownedRoutes[version] = len(routes)
+}
+
+// registerRoutes adds a resource's planned routes to a router. Routes added
+// directly to the router aren't recorded, so the router may still panic on a
+// conflict with one partway through. The panic is converted to an error, and
+// the routes that were already added are forgotten and answer 404 Not Found,
+// so that a partially registered resource is never served.
+func (s *Service) registerRoutes(version int, router *httptreemux.ContextMux, basePath, resource string, routes []plannedRoute) (conflict *RouteConflictError) {
+	table := s.routerTable(router)
+	prev := table.load()
+	failed := false
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			failed = true
+			table.reset(prev)
+			conflict = &RouteConflictError{
+				Version:  version,
+				Path:     basePath,
+				Resource: resource,
+				Detail:   fmt.Sprint(rcv),
+			}
+		}
+	}()
+	for _, route := range routes {
+		handler := route.handler
+		s.addRoute(router, route.method, route.path, func(rw http.ResponseWriter, req *http.Request) {
+			if failed {
+				s.notFoundHandler(rw, req)
+				return
+			}
+			handler(rw, req)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package luddite
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type registrarResource struct {
+	path string
+}
+
+func (r *registrarResource) RegisterRoutes(routes RouteAdder, basePath string) {
+	routes.Handle(http.MethodGet, basePath+r.path, func(http.ResponseWriter, *http.Request) {})
+}
+
+// listingSingletonResource is both a CollectionLister and a SingletonGetter,
+// whose routes are the same.
+type listingSingletonResource struct{}
+
+func (r *listingSingletonResource) List(req *http.Request) (int, interface{}) {
+	return http.StatusOK, []string{}
+}
+
+func (r *listingSingletonResource) Get(req *http.Request) (int, interface{}) {
+	return http.StatusOK, "singleton"
+}
+
+func TestRouteConflicts(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Prefix = "/api"
+		config.Version.Max = 2
+	})
+	if err := s.AddResource(1, "/users", &routeResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(2, "/users", &routeResource{}); err != nil {
+		t.Errorf("expected routes in different versions not to conflict, got %v", err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("expected no conflicts, got %v", err)
+	}
+
+	// Duplicate method and path
+	err := s.AddResource(1, "/users", &pingResource{})
+	if !errors.Is(err, ErrRouteConflict) {
+		t.Fatalf("expected route conflict, got %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "*luddite.pingResource at /users") || !strings.Contains(msg, "*luddite.routeResource at /users") {
+		t.Errorf("expected conflict to name both resources, got %q", msg)
+	}
+
+	// Ambiguous path parameters of a route added by a RouteAdder
+	a, _ := s.RouteAdder(1)
+	a.Handle(http.MethodPut, "/things/:name", func(http.ResponseWriter, *http.Request) {})
+	err = s.AddResource(1, "/things", &routeResource{})
+	var conflicts RouteConflictsError
+	if !errors.As(err, &conflicts) || len(conflicts) != 1 {
+		t.Fatalf("expected one route conflict, got %v", err)
+	}
+	if c := conflicts[0]; c.Method != "GET" || c.Path != "/api/things/:"+RouteParamId || c.Existing != directRouteOwner {
+		t.Errorf("unexpected conflict: %+v", c)
+	}
+
+	// Routes that resources register themselves
+	err = s.AddResource(1, "/users", &registrarResource{path: "/:name"})
+	if !errors.As(err, &conflicts) || len(conflicts) != 1 {
+		t.Fatalf("expected one route conflict from registrar, got %v", err)
+	}
+	if c := conflicts[0]; c.Method != "GET" || c.Path != "/api/users/:name" || c.Existing != "*luddite.routeResource at /users" {
+		t.Errorf("unexpected conflict: %+v", c)
+	}
+
+	err = s.Validate()
+	if !errors.As(err, &conflicts) || len(conflicts) != 3 {
+		t.Errorf("expected all three conflicts to be reported, got %v", err)
+	}
+}
+
+func TestRouteConflictsWithinResource(t *testing.T) {
+	s := newTestService(t, nil)
+	err := s.AddResource(1, "/both", &listingSingletonResource{})
+	var conflicts RouteConflictsError
+	if !errors.As(err, &conflicts) || len(conflicts) != 1 {
+		t.Fatalf("expected one route conflict, got %v", err)
+	}
+	if c := conflicts[0]; c.Method != "GET" || c.Path != "/both" || c.Existing != c.Resource {
+		t.Errorf("unexpected conflict: %+v", c)
+	}
+}
+
+func TestRouteConflictsWithDirectRoutes(t *testing.T) {
+	s := newTestService(t, nil)
+
+	// Routes added directly to the router are only detected by the router
+	router, _ := s.Router(1)
+	router.GET("/ping", func(http.ResponseWriter, *http.Request) {})
+	err := s.AddResource(1, "/ping", &pingResource{})
+	var conflicts RouteConflictsError
+	if !errors.As(err, &conflicts) || len(conflicts) != 1 {
+		t.Fatalf("expected one route conflict, got %v", err)
+	}
+	if c := conflicts[0]; c.Method != "" || !strings.Contains(c.Detail, "already handles GET") {
+		t.Errorf("unexpected conflict: %+v", c)
+	}
+	if err = s.Validate(); !errors.Is(err, ErrRouteConflict) {
+		t.Errorf("expected Validate to report the conflict, got %v", err)
+	}
+}
+
+// partialResource is a singleton resource that also registers a route of its
+// own.
+type partialResource struct {
+	pingResource
+	registrarResource
+}
+
+func TestRouteConflictsPartwayThrough(t *testing.T) {
+	s := newTestService(t, nil)
+	router, _ := s.Router(1)
+	router.GET("/ping/extra", func(http.ResponseWriter, *http.Request) {})
+	err := s.AddResource(1, "/ping", &partialResource{registrarResource: registrarResource{path: "/extra"}})
+	if !errors.Is(err, ErrRouteConflict) {
+		t.Fatalf("expected route conflict, got %v", err)
+	}
+
+	// The singleton route was registered before the conflict but isn't served
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a partially registered resource, got %d", rw.Code)
+	}
+	if routes := s.Routes(); len(routes) != 0 {
+		t.Errorf("expected no recorded routes, got %v", routes)
+	}
+	if methods := s.AllowedMethods("/ping"); methods != nil {
+		t.Errorf("expected no allowed methods, got %v", methods)
+	}
+}
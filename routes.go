@@ -0,0 +1,162 @@
+package luddite
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+// RouteInfo describes a route registered with one of the service's routers.
+type RouteInfo struct {
+	// Method is the route's HTTP method.
+	Method string
+	// Path is the route's path pattern, including the service's path prefix,
+	// e.g. "/users/:seg1".
+	Path string
+	// Version is the API version of the router that serves the route, or 0
+	// for global routes.
+	Version int
+	// Global is true for routes served w/o regard to API version, e.g. the
+	// schema, metrics and health routes.
+	Global bool
+}
+
+// Routes returns the routes registered with the service's global and API
+// routers, e.g. to generate an API index or to detect unregistered resources in
+// tests. Routes are known to the service if they were added by AddResource,
+// including the routes of RouteRegistrar resources, or by a RouteAdder; routes
+// added directly to a router, e.g. with its GET method, aren't included. Global
+// routes enabled by the service config, e.g. the schema, metrics and health
+// routes, are added by Run and so are only included once the service is
+// running. Implicit HEAD routes for GET routes are omitted. Routes are sorted
+// by version, path and method.
+func (s *Service) Routes() []RouteInfo {
+	routes := append([]RouteInfo(nil), s.routerTable(s.globalRouter).load().routes...)
+	for _, t := range s.toggles() {
+		if t.isEnabled() {
+			routes = append(routes, s.routerTable(t.router).load().routes...)
+		}
+	}
+	for _, router := range s.apiRouters {
+		routes = append(routes, s.routerTable(router).load().routes...)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Version != routes[j].Version {
+			return routes[i].Version < routes[j].Version
+		}
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// RouteAdder returns a RouteAdder that adds routes to the service's router for
+// the given API version. Routes added with it are known to the service, and so
+// are included in its Routes and OpenAPI document, its Allow headers and its
+// route conflict detection.
+func (s *Service) RouteAdder(version int) (RouteAdder, error) {
+	router, err := s.Router(version)
+	if err != nil {
+		return nil, err
+	}
+	return s.recordingRouter(router), nil
+}
+
+// routeTable records the routes added to one of a service's routers.
+// httptreemux doesn't expose its routing tree, so routes are recorded as they
+// are added. Tables are copied on write so that requests may consult them
+// without locking.
+type routeTable struct {
+	sync.Mutex
+	version  int
+	prefix   string
+	paths    map[string]int // indexes of snapshot.allowed
+	snapshot atomic.Value
+}
+
+// routeSnapshot is an immutable view of a route table.
+type routeSnapshot struct {
+	routes  []RouteInfo
+	allowed []*allowedRoute // by path pattern, in order of addition
+}
+
+// newRouter creates a router for an API version, or for global routes when
+// version is 0, along with its route table.
+func (s *Service) newRouter(version int) *httptreemux.ContextMux {
+	prefix := s.config.Prefix
+	router := httptreemux.NewContextMux()
+	router.NotFoundHandler = notFoundHandler
+	if prefix != "" {
+		router.ContextGroup = router.NewGroup(prefix)
+	}
+	t := &routeTable{
+		version: version,
+		prefix:  strings.TrimSuffix(prefix, "/"),
+		paths:   make(map[string]int),
+	}
+	t.snapshot.Store(&routeSnapshot{})
+	s.routeTables[router] = t
+	return router
+}
+
+// routerTable returns the route table of one of the service's routers.
+// Routers are only created along with the service, so the tables are read
+// w/o locking.
+func (s *Service) routerTable(router *httptreemux.ContextMux) *routeTable {
+	return s.routeTables[router]
+}
+
+// recordingRouter returns a RouteAdder that adds routes to one of the
+// service's routers and records them in its route table.
+func (s *Service) recordingRouter(router *httptreemux.ContextMux) recordingRouter {
+	return recordingRouter{router: router, table: s.routerTable(router)}
+}
+
+// addRoute adds a route to one of the service's routers and records it.
+func (s *Service) addRoute(router *httptreemux.ContextMux, method, path string, handler http.HandlerFunc) {
+	s.recordingRouter(router).Handle(method, path, handler)
+}
+
+func (t *routeTable) load() *routeSnapshot {
+	return t.snapshot.Load().(*routeSnapshot)
+}
+
+// reset discards the routes recorded since an earlier snapshot.
+func (t *routeTable) reset(snap *routeSnapshot) {
+	t.Lock()
+	defer t.Unlock()
+	for p, i := range t.paths {
+		if i >= len(snap.allowed) {
+			delete(t.paths, p)
+		}
+	}
+	t.snapshot.Store(snap)
+}
+
+// add records a route that was added to the table's router, updating the
+// methods allowed on its path pattern.
+func (t *routeTable) add(method, path string) {
+	t.Lock()
+	defer t.Unlock()
+	cur := t.load()
+
+	// NB: Appending only writes beyond the length of earlier snapshots
+	route := RouteInfo{Method: method, Path: t.prefix + path, Version: t.version, Global: t.version == 0}
+	next := &routeSnapshot{routes: append(cur.routes, route)}
+	methods := routeMethods(method)
+	if i, ok := t.paths[route.Path]; ok {
+		next.allowed = append([]*allowedRoute(nil), cur.allowed...)
+		prev := cur.allowed[i]
+		next.allowed[i] = &allowedRoute{path: prev.path, segs: prev.segs, methods: sortedMethods(append(methods, prev.methods...))}
+	} else {
+		t.paths[route.Path] = len(cur.allowed)
+		next.allowed = append(cur.allowed, &allowedRoute{path: route.Path, segs: splitPath(route.Path), methods: methods})
+	}
+	t.snapshot.Store(next)
+}
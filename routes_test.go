@@ -0,0 +1,77 @@
+package luddite
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type routeResource struct{}
+
+func (r *routeResource) List(req *http.Request) (int, interface{}) {
+	return http.StatusOK, []string{}
+}
+
+func (r *routeResource) Get(req *http.Request, id string) (int, interface{}) {
+	return http.StatusOK, id
+}
+
+func (r *routeResource) Action(req *http.Request, id string, action string) (int, interface{}) {
+	return http.StatusOK, action
+}
+
+func TestRoutes(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Prefix = "/api"
+		config.Version.Max = 2
+		config.Health.Enabled = true
+		config.Health.URIPath = "/health/ready"
+	})
+	if err := s.AddResource(2, "/users", &routeResource{}); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := s.RouteAdder(2)
+	a.Handle(http.MethodGet, "/files/*filepath", func(http.ResponseWriter, *http.Request) {})
+	a.Handle(http.MethodGet, "/a b/c", func(http.ResponseWriter, *http.Request) {})
+	router, _ := s.Router(2)
+	router.GET("/direct", func(http.ResponseWriter, *http.Request) {})
+	s.addHealthRoute() // as Run would
+
+	var global, api []RouteInfo
+	for _, route := range s.Routes() {
+		if route.Global {
+			global = append(global, route)
+		} else {
+			api = append(api, route)
+		}
+	}
+
+	if !reflect.DeepEqual(global, []RouteInfo{{Method: "GET", Path: "/api/health/ready", Global: true}}) {
+		t.Errorf("unexpected global routes: %v", global)
+	}
+	for _, expected := range []RouteInfo{
+		{Method: "GET", Path: "/api/a b/c", Version: 2},
+		{Method: "GET", Path: "/api/files/*filepath", Version: 2},
+		{Method: "GET", Path: "/api/users", Version: 2},
+		{Method: "GET", Path: "/api/users/:" + RouteParamId, Version: 2},
+		{Method: "POST", Path: "/api/users/:" + RouteParamId + "/:" + RouteParamAction, Version: 2},
+	} {
+		found := false
+		for _, route := range api {
+			if route == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected route %v in %v", expected, api)
+		}
+	}
+	for _, route := range api {
+		if route.Method == "HEAD" {
+			t.Errorf("unexpected implicit HEAD route %v", route)
+		}
+		if route.Path == "/api/direct" {
+			t.Errorf("unexpected route added directly to the router %v", route)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package luddite
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/SpirentOrion/trace.v2"
+)
+
+// PanicError is the error returned by SafeGo and Group when a goroutine panics.
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// SafeGo runs fn in a new goroutine and returns a channel that receives its
+// result. A panic in fn is recovered, logged, recorded in a trace span (when
+// tracing is active in ctx) and delivered on the channel as a *PanicError.
+//
+// Handlers that fan out to multiple backends should use SafeGo or Group rather
+// than bare go statements: the service only recovers panics that occur on the
+// request goroutine, so a panic in a stray goroutine still crashes the process.
+func SafeGo(ctx context.Context, fn func() error) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- safeCall(ctx, fn)
+	}()
+	return ch
+}
+
+func safeCall(ctx context.Context, fn func() error) (err error) {
+	trace.Do(ctx, "go", "SafeGo", func(ctx context.Context) {
+		defer func() {
+			if rcv := recover(); rcv != nil {
+				stackBuffer := make([]byte, maxStackSize)
+				stack := string(stackBuffer[:runtime.Stack(stackBuffer, false)])
+				err = &PanicError{Value: rcv, Stack: stack}
+
+				if s := ContextService(ctx); s != nil {
+					s.defaultLogger.WithFields(log.Fields{"stack": stack}).Error(rcv)
+				}
+				if data := trace.Annotate(ctx); data != nil {
+					data["panic"] = rcv
+					data["stack"] = stack
+				}
+			}
+		}()
+		err = fn()
+	})
+	return
+}
+
+// Group is a collection of goroutines started with SafeGo semantics, similar
+// to a sync.WaitGroup that also collects errors. The zero value is not usable;
+// create groups with NewGroup.
+type Group struct {
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// NewGroup returns a new Group and a derived context. The derived context is
+// canceled the first time a goroutine in the group returns an error (or
+// panics) or when Wait returns, whichever occurs first.
+func NewGroup(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{ctx: ctx, cancel: cancel}, ctx
+}
+
+// Go runs fn in a new goroutine with panic recovery.
+func (g *Group) Go(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := safeCall(g.ctx, fn); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// Wait blocks until all goroutines in the group have returned and then
+// returns the first non-nil error (if any) from them.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
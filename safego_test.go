@@ -0,0 +1,44 @@
+package luddite
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSafeGoRecoversPanic(t *testing.T) {
+	err := <-SafeGo(context.Background(), func() error {
+		panic("boom")
+	})
+	pe, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("expected *PanicError, got %v", err)
+	}
+	if pe.Value != "boom" || pe.Stack == "" {
+		t.Errorf("unexpected panic error: %v", pe)
+	}
+
+	if err = <-SafeGo(context.Background(), func() error { return nil }); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	errFailed := errors.New("failed")
+	g, ctx := NewGroup(context.Background())
+	g.Go(func() error { return nil })
+	g.Go(func() error { return errFailed })
+	g.Go(func() error {
+		<-ctx.Done()
+		return nil
+	})
+	if err := g.Wait(); err != errFailed {
+		t.Errorf("expected errFailed, got %v", err)
+	}
+
+	g, _ = NewGroup(context.Background())
+	g.Go(func() error { panic("boom") })
+	if _, ok := g.Wait().(*PanicError); !ok {
+		t.Error("expected *PanicError from panicking goroutine")
+	}
+}
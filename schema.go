@@ -1,8 +1,12 @@
 package luddite
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"os"
 	"path"
 	"strconv"
 	"strings"
@@ -10,17 +14,54 @@ import (
 	"github.com/dimfeld/httptreemux"
 )
 
+var defaultSchemaContentTypes = map[string]string{
+	".yaml": ContentTypeYaml + "; charset=utf-8",
+	".yml":  ContentTypeYaml + "; charset=utf-8",
+}
+
+// schemaEncodings lists the content encodings of precompressed schema
+// sidecar files (e.g. "openapi.json.gz") in order of preference.
+var schemaEncodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
 type schemaHandler struct {
-	fileServer http.Handler
+	fs           http.FileSystem
+	versionFS    map[int]http.FileSystem
+	contentTypes map[string]string
+	compress     bool
+}
+
+func newSchemaHandler(fs http.FileSystem, contentTypes map[string]string) *schemaHandler {
+	h := &schemaHandler{
+		fs:           fs,
+		versionFS:    make(map[int]http.FileSystem),
+		contentTypes: make(map[string]string),
+	}
+	for ext, ct := range defaultSchemaContentTypes {
+		h.contentTypes[ext] = ct
+	}
+	for ext, ct := range contentTypes {
+		h.contentTypes[strings.ToLower(ext)] = ct
+	}
+	return h
 }
 
-func newSchemaHandler(fs http.FileSystem) http.Handler {
-	return &schemaHandler{
-		fileServer: http.FileServer(fs),
+// setVersionSchemas serves schemas for the given versions from per-version
+// filesystems, which contain no "/vN/" prefix.
+func (h *schemaHandler) setVersionSchemas(schemas map[int]http.FileSystem) {
+	for version, fs := range schemas {
+		h.versionFS[version] = fs
 	}
 }
 
 func (h *schemaHandler) ServeHTTP(rw http.ResponseWriter, req0 *http.Request) {
+	ExemptResponseSizeLimit(rw)
+
 	// Transform the request path to a path compatible with the schema directory
 	params := httptreemux.ContextParams(req0.Context())
 
@@ -36,19 +77,145 @@ func (h *schemaHandler) ServeHTTP(rw http.ResponseWriter, req0 *http.Request) {
 		return
 	}
 
+	// Prefer the version's own filesystem over the global one
 	filepath := params["filepath"]
-	req1, err := http.NewRequest("GET", fmt.Sprintf("/v%d/%s", version, filepath), nil)
+	fs, ok := h.versionFS[version]
+	urlPath := "/" + filepath
+	if !ok {
+		fs = h.fs
+		urlPath = fmt.Sprintf("/v%d/%s", version, filepath)
+	}
+	if fs == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	req1, err := http.NewRequest("GET", urlPath, nil)
 	if err != nil {
 		panic(err)
 	}
 
-	switch strings.ToLower(path.Ext(filepath)) {
-	case ".yaml", ".yml":
-		rw.Header().Set(HeaderContentType, ContentTypeOctetStream)
-	default:
+	ct := h.contentTypes[strings.ToLower(path.Ext(filepath))]
+	if ct != "" {
+		rw.Header().Set(HeaderContentType, ct)
+	} else {
 		rw.Header().Del(HeaderContentType)
 	}
 
+	// Serve compressed content to clients that accept it: precompressed
+	// sidecar files when present, otherwise optionally gzip on the fly
+	rw.Header().Add(HeaderVary, HeaderAcceptEncoding)
+	accepted := acceptedEncodings(req0)
+	if len(accepted) != 0 {
+		if ct == "" {
+			if ct = mime.TypeByExtension(path.Ext(filepath)); ct == "" {
+				ct = ContentTypeOctetStream
+			}
+		}
+		for _, enc := range schemaEncodings {
+			if accepted[enc.name] && h.serveEncoded(rw, req1, fs, urlPath+enc.ext, enc.name, ct) {
+				return
+			}
+		}
+		if h.compress && accepted["gzip"] && h.serveGzipped(rw, fs, urlPath, ct) {
+			return
+		}
+	}
+
 	// Delegate request handling to the standard fileserver
-	h.fileServer.ServeHTTP(rw, req1)
+	http.FileServer(fs).ServeHTTP(rw, req1)
+}
+
+// serveEncoded serves a precompressed sidecar file, if it exists.
+func (h *schemaHandler) serveEncoded(rw http.ResponseWriter, req *http.Request, fs http.FileSystem, name, encoding, ct string) bool {
+	f, fi, ok := openSchemaFile(fs, name)
+	if !ok {
+		return false
+	}
+	defer f.Close()
+	rw.Header().Set(HeaderContentType, ct)
+	rw.Header().Set(HeaderContentEncoding, encoding)
+	http.ServeContent(rw, req, fi.Name(), fi.ModTime(), f)
+	return true
+}
+
+// serveGzipped serves a file compressed on the fly, if it exists.
+func (h *schemaHandler) serveGzipped(rw http.ResponseWriter, fs http.FileSystem, name, ct string) bool {
+	f, _, ok := openSchemaFile(fs, name)
+	if !ok {
+		return false
+	}
+	defer f.Close()
+	rw.Header().Set(HeaderContentType, ct)
+	rw.Header().Set(HeaderContentEncoding, "gzip")
+	rw.Header().Del(HeaderContentLength)
+	rw.WriteHeader(http.StatusOK)
+	gz := gzip.NewWriter(rw)
+	_, _ = io.Copy(gz, f)
+	_ = gz.Close()
+	return true
+}
+
+// openSchemaFile opens a regular file in a schema filesystem.
+func openSchemaFile(fs http.FileSystem, name string) (http.File, os.FileInfo, bool) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, nil, false
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		_ = f.Close()
+		return nil, nil, false
+	}
+	return f, fi, true
+}
+
+// acceptedEncodings returns the content encodings that a request's
+// Accept-Encoding header accepts, ignoring those with zero quality values.
+func acceptedEncodings(req *http.Request) map[string]bool {
+	var accepted map[string]bool
+	for _, v := range strings.Split(req.Header.Get(HeaderAcceptEncoding), ",") {
+		enc, params := v, ""
+		if i := strings.IndexByte(v, ';'); i >= 0 {
+			enc, params = v[:i], v[i+1:]
+		}
+		enc = strings.ToLower(strings.TrimSpace(enc))
+		if enc == "" {
+			continue
+		}
+		params = strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		if strings.HasPrefix(params, "q=") {
+			if q, err := strconv.ParseFloat(params[2:], 64); err == nil && q <= 0 {
+				continue
+			}
+		}
+		if accepted == nil {
+			accepted = make(map[string]bool)
+		}
+		if enc == "*" {
+			accepted["br"], accepted["gzip"] = true, true
+		} else {
+			accepted[enc] = true
+		}
+	}
+	return accepted
+}
+
+// SetVersionSchemas allows a service to provide its own HTTP filesystem to be
+// used for a single API version's schema assets. Unlike the filesystem given to
+// SetSchemas, it holds the version's schemas at its root rather than beneath a
+// "/vN/" directory. Versions without their own filesystem fall back to the
+// global one.
+func (s *Service) SetVersionSchemas(version int, schemas http.FileSystem) {
+	if s.versionSchemas == nil {
+		s.versionSchemas = make(map[int]http.FileSystem)
+	}
+	s.versionSchemas[version] = schemas
+}
+
+// schemaFile returns the filesystem and path of a version's schema file.
+func (s *Service) schemaFile(version int, name string) (http.FileSystem, string) {
+	if fs, ok := s.versionSchemas[version]; ok {
+		return fs, "/" + strings.TrimPrefix(name, "/")
+	}
+	return s.schemas, fmt.Sprintf("/v%d/%s", version, name)
 }
@@ -1,7 +1,10 @@
 package luddite
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -30,7 +33,7 @@ func TestSchemaHandlerDefaultContentType(t *testing.T) {
 	rw := httptest.NewRecorder()
 	rw.Header().Set(HeaderContentType, ContentTypeJson)
 
-	s := newSchemaHandler(fakeFS)
+	s := newSchemaHandler(fakeFS, nil)
 	s.ServeHTTP(rw, req)
 	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJson {
 		t.Errorf("incorrrect content type negotiated: %s", ct)
@@ -41,6 +44,32 @@ func TestSchemaHandlerDefaultContentType(t *testing.T) {
 	}
 }
 
+func TestSchemaHandlerYAMLContentType(t *testing.T) {
+	fakeFS := httpfs.New(mapfs.New(map[string]string{
+		"v1/schema.yml": sampleYAMLSchema,
+	}))
+	v := make(map[string]string)
+	v["version"] = "v1"
+	v["filepath"] = "schema.yml"
+
+	ctx := httptreemux.AddParamsToContext(context.Background(), v)
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = req.WithContext(ctx)
+	rw := httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+
+	s := newSchemaHandler(fakeFS, nil)
+	s.ServeHTTP(rw, req)
+
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeYaml+"; charset=utf-8" {
+		t.Errorf("incorrrect content type negotiated: %s", ct)
+	}
+
+	if body := string(rw.Body.String()); body != sampleYAMLSchema {
+		t.Errorf("YAML serialization failed, got: %s, expected: %s\n", body, sampleYAMLSchema)
+	}
+}
+
 func TestSchemaHandlerOctetStreamContentType(t *testing.T) {
 	fakeFS := httpfs.New(mapfs.New(map[string]string{
 		"v1/schema.yml": sampleYAMLSchema,
@@ -55,7 +84,7 @@ func TestSchemaHandlerOctetStreamContentType(t *testing.T) {
 	rw := httptest.NewRecorder()
 	rw.Header().Set(HeaderContentType, ContentTypeJson)
 
-	s := newSchemaHandler(fakeFS)
+	s := newSchemaHandler(fakeFS, map[string]string{".yml": ContentTypeOctetStream})
 	s.ServeHTTP(rw, req)
 
 	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeOctetStream {
@@ -76,7 +105,7 @@ func TestSchemaHandlerGivenInvalidVersionStringLength(t *testing.T) {
 	rw := httptest.NewRecorder()
 	rw.Header().Set(HeaderContentType, ContentTypeJson)
 
-	s := newSchemaHandler(nil)
+	s := newSchemaHandler(nil, nil)
 	s.ServeHTTP(rw, req)
 
 	if rw.Code != http.StatusNotFound {
@@ -93,7 +122,7 @@ func TestSchemaHandlerGivenInvalidVersionValue(t *testing.T) {
 	rw := httptest.NewRecorder()
 	rw.Header().Set(HeaderContentType, ContentTypeJson)
 
-	s := newSchemaHandler(nil)
+	s := newSchemaHandler(nil, nil)
 	s.ServeHTTP(rw, req)
 
 	if rw.Code != http.StatusNotFound {
@@ -110,10 +139,121 @@ func TestSchemaHandlerGivenInvalidVersionNumber(t *testing.T) {
 	rw := httptest.NewRecorder()
 	rw.Header().Set(HeaderContentType, ContentTypeJson)
 
-	s := newSchemaHandler(nil)
+	s := newSchemaHandler(nil, nil)
 	s.ServeHTTP(rw, req)
 
 	if rw.Code != http.StatusNotFound {
 		t.Error("expected 400/Not found")
 	}
 }
+
+func TestSchemaHandlerVersionSchemas(t *testing.T) {
+	globalFS := httpfs.New(mapfs.New(map[string]string{
+		"v1/schema.json": sampleJSONSchema,
+	}))
+	v2FS := httpfs.New(mapfs.New(map[string]string{
+		"schema.yml": sampleYAMLSchema,
+	}))
+
+	s := newSchemaHandler(globalFS, nil)
+	s.setVersionSchemas(map[int]http.FileSystem{2: v2FS})
+	serve := func(version, filepath string) *httptest.ResponseRecorder {
+		ctx := httptreemux.AddParamsToContext(context.Background(), map[string]string{"version": version, "filepath": filepath})
+		req, _ := http.NewRequest("GET", "/", nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req.WithContext(ctx))
+		return rw
+	}
+
+	if rw := serve("v2", "schema.yml"); rw.Code != http.StatusOK || rw.Body.String() != sampleYAMLSchema {
+		t.Errorf("expected v2 schema from its own filesystem, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if rw := serve("v1", "schema.json"); rw.Code != http.StatusOK || rw.Body.String() != sampleJSONSchema {
+		t.Errorf("expected v1 schema from the global filesystem, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if rw := serve("v2", "schema.json"); rw.Code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found for schema missing from v2 filesystem, got %d", rw.Code)
+	}
+
+	s = newSchemaHandler(nil, nil)
+	s.setVersionSchemas(map[int]http.FileSystem{2: v2FS})
+	if rw := serve("v1", "schema.json"); rw.Code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found without a global filesystem, got %d", rw.Code)
+	}
+}
+
+func gzipString(t *testing.T, s string) string {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestSchemaHandlerCompression(t *testing.T) {
+	fakeFS := httpfs.New(mapfs.New(map[string]string{
+		"v1/openapi.json":    sampleJSONSchema,
+		"v1/openapi.json.gz": gzipString(t, sampleJSONSchema),
+		"v1/openapi.json.br": "brotli bytes",
+		"v1/schema.yml":      sampleYAMLSchema,
+	}))
+	s := newSchemaHandler(fakeFS, nil)
+	serve := func(filepath, acceptEncoding string) *httptest.ResponseRecorder {
+		ctx := httptreemux.AddParamsToContext(context.Background(), map[string]string{"version": "v1", "filepath": filepath})
+		req, _ := http.NewRequest("GET", "/", nil)
+		if acceptEncoding != "" {
+			req.Header.Set(HeaderAcceptEncoding, acceptEncoding)
+		}
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req.WithContext(ctx))
+		return rw
+	}
+
+	// Precompressed sidecar files
+	rw := serve("openapi.json", "gzip, br")
+	if ce := rw.Header().Get(HeaderContentEncoding); ce != "br" || rw.Body.String() != "brotli bytes" {
+		t.Errorf("expected Brotli sidecar, got %q: %q", ce, rw.Body.String())
+	}
+	if vary := rw.Header().Get(HeaderVary); vary != HeaderAcceptEncoding {
+		t.Errorf("expected Vary: Accept-Encoding, got %q", vary)
+	}
+	rw = serve("openapi.json", "gzip, br;q=0")
+	if ce := rw.Header().Get(HeaderContentEncoding); ce != "gzip" || rw.Body.String() != gzipString(t, sampleJSONSchema) {
+		t.Errorf("expected gzip sidecar, got %q", ce)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeJson {
+		t.Errorf("expected original content type, got %q", ct)
+	}
+	rw = serve("openapi.json", "")
+	if ce := rw.Header().Get(HeaderContentEncoding); ce != "" || rw.Body.String() != sampleJSONSchema {
+		t.Errorf("expected uncompressed schema, got %q: %q", ce, rw.Body.String())
+	}
+
+	// On-the-fly compression
+	rw = serve("schema.yml", "gzip")
+	if ce := rw.Header().Get(HeaderContentEncoding); ce != "" {
+		t.Errorf("expected no on-the-fly compression by default, got %q", ce)
+	}
+	s.compress = true
+	rw = serve("schema.yml", "gzip")
+	if ce := rw.Header().Get(HeaderContentEncoding); ce != "gzip" {
+		t.Fatalf("expected on-the-fly gzip, got %q", ce)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeYaml+"; charset=utf-8" {
+		t.Errorf("expected YAML content type, got %q", ct)
+	}
+	gz, err := gzip.NewReader(rw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(gz); string(b) != sampleYAMLSchema {
+		t.Errorf("expected gzipped YAML schema, got %q", b)
+	}
+	if rw = serve("missing.yml", "gzip"); rw.Code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found for missing schema, got %d", rw.Code)
+	}
+}
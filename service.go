@@ -2,7 +2,7 @@ package luddite
 
 import (
 	"context"
-	"errors"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -14,12 +14,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
-	"time"
 
 	"github.com/dimfeld/httptreemux"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/rs/cors"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/SpirentOrion/trace.v2"
 )
@@ -47,12 +46,48 @@ type Service struct {
 	accessLogger    *log.Logger
 	globalRouter    *httptreemux.ContextMux
 	apiRouters      map[int]*httptreemux.ContextMux
+	routeTables     map[*httptreemux.ContextMux]*routeTable
 	handlers        []http.Handler
-	cors            *cors.Cors
+	cors            *corsPolicy
 	tracer          context.Context
+	traceQueue      *queuedRecorder
+	traceSpans      int32
 	schemas         http.FileSystem
+	versionSchemas  map[int]http.FileSystem
+	static          http.FileSystem
 	once            sync.Once
 	recoveryHandler func(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request)
+	startHooks      []func()
+	shutdownHooks   []func()
+	closers         []orderedCloser
+	resources       []*resourceRegistration
+	routeOwners     map[string]string
+	ownedRoutes     map[int]int
+	routeConflicts  []*RouteConflictError
+	ready           int32
+	sessions        *sessionCounter
+	clientLimiter   *clientLimiter
+	qosLimiter      *qosLimiter
+	workers         *workerPool
+	qosClassifier   QoSClassifier
+	proxies         *proxyPolicy
+	idGenerator     IDGenerator
+	clock           Clock
+	metrics         requestMetrics
+	metricsToggle   routeToggle
+	profilerToggle  routeToggle
+	accessLogHook   func(ctx context.Context, fields log.Fields)
+	errorHandlers   []func(ctx context.Context, status int, rw http.ResponseWriter, req *http.Request)
+	flagProvider    FeatureFlagProvider
+	tenantResolver  TenantResolver
+	spanNamer       SpanNamer
+	memTraces       *MemoryRecorder
+	bodyless        map[int]bool
+	fieldNames      func(string) string
+	timeFormat      string
+	getCertificate  func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	capturer        *requestCapturer
+	errorPages      map[int]*errorPage
 }
 
 // NewService creates a new Service instance based on the given config.
@@ -68,12 +103,28 @@ func NewService(config *ServiceConfig) (*Service, error) {
 	// Create the service and its routers
 	s := &Service{
 		config:          config,
-		globalRouter:    newRouter(config.Prefix),
 		apiRouters:      make(map[int]*httptreemux.ContextMux, config.Version.Max-config.Version.Min+1),
+		routeTables:     make(map[*httptreemux.ContextMux]*routeTable),
 		recoveryHandler: defaultRecoveryHandler,
+		idGenerator:     trace.GenerateID,
+		clock:           realClock{},
 	}
+	s.globalRouter = s.newRouter(0)
 	for v := config.Version.Min; v <= config.Version.Max; v++ {
-		s.apiRouters[v] = newRouter(config.Prefix)
+		s.apiRouters[v] = s.newRouter(v)
+		s.apiRouters[v].NotFoundHandler = s.notFoundHandler
+		s.apiRouters[v].MethodNotAllowedHandler = s.methodNotAllowedHandler
+		if config.Response.AutoOptions {
+			s.apiRouters[v].OptionsHandler = s.apiOptionsHandler
+		}
+	}
+	if config.Response.AutoOptions {
+		s.globalRouter.OptionsHandler = s.routerOptionsHandler(s.globalRouter)
+	}
+	s.metricsToggle = newRouteToggle(s, s.addMetricsRoute)
+	s.profilerToggle = newRouteToggle(s, s.addProfilerRoutes)
+	if !config.StartUnready {
+		s.ready = 1
 	}
 
 	// Create the service loggers
@@ -120,15 +171,111 @@ func NewService(config *ServiceConfig) (*Service, error) {
 		s.accessLogger = s.defaultLogger
 	}
 
+	// Optionally capture requests for later replay (debug only)
+	if config.Debug.CaptureRequestsPath != "" {
+		var err error
+		if s.capturer, err = newRequestCapturer(config.Debug.CaptureRequestsPath, config.Debug.CaptureBodyLimit, config.Debug.CaptureRedactHeaders, config.Debug.CaptureRedactQueryParams); err != nil {
+			return nil, err
+		}
+		s.defaultLogger.Warnf("capturing requests to %s: this is a debug tool and should not be enabled in production", config.Debug.CaptureRequestsPath)
+	}
+
+	// Determine how JSON field names and times are serialized
+	s.fieldNames = fieldNameFunc(config.Response.FieldNameStyle)
+	if config.Response.TimeFormat != TimeFormatRFC3339 {
+		s.timeFormat = config.Response.TimeFormat
+	}
+
+	// Determine which response statuses never carry a body
+	s.bodyless = make(map[int]bool, len(defaultBodylessStatuses)+len(config.Response.BodylessStatuses))
+	for status := range defaultBodylessStatuses {
+		s.bodyless[status] = true
+	}
+	for _, status := range config.Response.BodylessStatuses {
+		s.bodyless[status] = true
+	}
+
+	// Optionally reserve trace ID bits for the node
+	if config.Trace.NodeID > 0 {
+		s.idGenerator = newNodeIDGenerator(config.Trace.NodeID, config.Trace.NodeBits)
+	}
+
+	// Decide when forwarded headers may be trusted
+	var err error
+	if s.proxies, err = newProxyPolicy(config.Proxy.TrustedCIDRs, config.Limits.TrustForwardedFor); err != nil {
+		return nil, err
+	}
+
+	// Optionally limit concurrent requests per client
+	if config.Limits.MaxRequestsPerClient > 0 {
+		if s.clientLimiter, err = newClientLimiter(config.Limits.MaxRequestsPerClient, s.proxies, config.Limits.ExemptCIDRs); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Limits.MaxInFlight > 0 {
+		s.qosLimiter = newQoSLimiter(config.Limits.MaxInFlight, config.Limits.PriorityHeadroom)
+		if config.Metrics.Enabled {
+			// NB: Multiple services may share the default registry
+			_ = prometheus.Register(qosRequestsInFlight)
+			_ = prometheus.Register(qosRequestsShed)
+		}
+	}
+
+	if config.Workers.Enabled {
+		s.workers = newWorkerPool(config.Workers.Size, config.Workers.Wait)
+		if config.Metrics.Enabled {
+			// NB: Multiple services may share the default registry
+			_ = prometheus.Register(workersBusy)
+			_ = prometheus.Register(workersRejections)
+		}
+	}
+
+	// Expose the metrics of helpers that resource handlers may use
+	if config.Metrics.Enabled {
+		// NB: Multiple services may share the default registry
+		_ = prometheus.Register(circuitBreakerStates)
+		_ = prometheus.Register(circuitBreakerTransitions)
+		_ = prometheus.Register(dependencyFailures)
+	}
+
+	// Register additional formats declared in the service config
+	for _, f := range config.Response.Formats {
+		RegisterFormat(f.Name, f.MimeTypes)
+	}
+
 	// Add default middleware handlers
-	s.AddHandler(newNegotiatorHandler(negotiatedContentTypes))
-	s.AddHandler(newVersionHandler(s.config.Version.Min, s.config.Version.Max))
+	if config.Response.ForceContentType != "" {
+		s.AddHandler(newNegotiatorHandler([]string{config.Response.ForceContentType}))
+	} else {
+		s.AddHandler(newNegotiatorHandler(config.negotiatedContentTypes()))
+	}
+	s.AddHandler(newVersionHandler(s.config.Version.Min, s.config.Version.Max, s.config.Version.Deprecated, s.config.Version.MigrationURL))
+	if config.Metrics.Enabled && config.Metrics.SessionLimit > 0 {
+		s.sessions = newSessionCounter(config.Metrics.SessionLimit)
+		_ = prometheus.Register(sessionRequests)
+	}
+	if config.Metrics.Enabled && len(config.Version.Deprecated) != 0 {
+		// NB: Multiple services may share the default registry
+		_ = prometheus.Register(deprecatedApiVersionRequests)
+	}
+	if config.Metrics.Enabled && config.Metrics.Backend == MetricsBackendStatsD {
+		statsd := config.Metrics.StatsD
+		if s.metrics, err = newStatsdMetrics(statsd.Addr, statsd.Prefix, statsd.Format); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create the default schema filesystem
 	if config.Schema.Enabled {
 		s.schemas = http.Dir(config.Schema.FilePath)
 	}
 
+	// Create the default static asset filesystem
+	if config.Static.Enabled {
+		s.static = http.Dir(config.Static.FilePath)
+	}
+
 	// Dump goroutine stacks on demand
 	dumpGoroutineStacks()
 	return s, nil
@@ -163,15 +310,96 @@ func (s *Service) AddHandler(h http.Handler) {
 // a resource handler and adds routes as appropriate based on what interfaces
 // are implemented. The same effect can be achieved by calling the various
 // "Add*CollectionResource" and "Add*SingletonResource" functions with the
-// appropriate router instance.
+// appropriate router instance. Resources that implement RouteRegistrar are
+// additionally given the opportunity to register their own routes.
 func (s *Service) AddResource(version int, basePath string, r interface{}) error {
+	return s.AddResourceWithMiddleware(version, basePath, r)
+}
+
+// AddResourceWithMiddleware adds a resource handler like AddResource, along
+// with middleware handlers that run only for requests to the resource's paths,
+// e.g. extra authorization for an administrative resource. Resource middleware
+// runs in order after the service's middleware handlers and the resource's
+// path parameter checks, but before upload precondition checks, concurrency
+// limits and the resource handler itself. If a middleware handler generates a
+// response then the resource handler isn't called.
+func (s *Service) AddResourceWithMiddleware(version int, basePath string, r interface{}, middleware ...http.Handler) error {
 	router, err := s.Router(version)
 	if err != nil {
 		return err
 	}
 
-	s.addCollectionRoutes(router, basePath, r)
-	s.addSingletonRoutes(router, basePath, r)
+	// Detect conflicting routes before httptreemux panics on them
+	resource := fmt.Sprintf("%T at %s", r, basePath)
+	routes := s.resourceRoutes(basePath, r)
+	s.recordRouteOwners(version, directRouteOwner)
+	if conflicts := s.checkRouteConflicts(version, routes, resource); len(conflicts) != 0 {
+		s.routeConflicts = append(s.routeConflicts, conflicts...)
+		return RouteConflictsError(conflicts)
+	}
+
+	reg := resourceRegistration{version: version, basePath: basePath, middleware: middleware}
+	if x, ok := r.(SchemaValidated); ok {
+		if reg.validation, err = s.loadResourceValidation(version, x); err != nil {
+			mode := s.config.Schema.Validation.FailMode
+			if p, ok := r.(SchemaFailModePolicy); ok && p.SchemaFailMode() != "" {
+				mode = p.SchemaFailMode()
+			}
+			if mode != FailOpen {
+				return err
+			}
+			recordDependencyFailure(context.Background(), s.defaultLogger, "schema_validation", FailOpen, err)
+		}
+	}
+	if x, ok := r.(ContentTypeAccepter); ok {
+		reg.accepted = newResourceAccepted(x.AcceptedContentTypes())
+	}
+	if x, ok := r.(ParamConstrained); ok {
+		if reg.params, err = newResourceParams(x.ParamPatterns()); err != nil {
+			return err
+		}
+	}
+	if x, ok := r.(OpenAPIDescriber); ok {
+		reg.describer = x
+	}
+	if x, ok := r.(ContinueChecker); ok {
+		reg.continuer = x
+	}
+	if x, ok := r.(UnknownFieldsPolicy); ok {
+		reg.unknownFields = x
+	}
+	if x, ok := r.(AutoETagPolicy); ok {
+		reg.autoETag = x
+	}
+	if x, ok := r.(RateLimited); ok {
+		// NB: Buckets that never refill would never be swept, so specs
+		// w/o a sustained rate don't limit requests at all.
+		if spec := x.RateLimit(); spec.RPS > 0 {
+			reg.rateLimiter = newResourceRateLimiter(version, basePath, spec)
+		}
+		if s.config.Metrics.Enabled {
+			// NB: Multiple services may share the default registry
+			_ = prometheus.Register(resourceRateLimited)
+			_ = prometheus.Register(resourceRateLimitKeys)
+		}
+	}
+	if x, ok := r.(ConcurrencyLimited); ok {
+		max, wait := x.ConcurrencyLimit()
+		reg.limiter = newResourceLimiter(version, basePath, max, wait)
+		if s.config.Metrics.Enabled {
+			// NB: Multiple services may share the default registry
+			_ = prometheus.Register(resourceConcurrentRequests)
+			_ = prometheus.Register(resourceConcurrencyRejections)
+		}
+	}
+
+	conflict := s.registerRoutes(version, router, basePath, resource, routes)
+	s.recordRouteOwners(version, resource)
+	if conflict != nil {
+		s.routeConflicts = append(s.routeConflicts, conflict)
+		return RouteConflictsError{conflict}
+	}
+	s.addResourceRegistration(&reg)
 	return nil
 }
 
@@ -182,35 +410,115 @@ func (s *Service) SetSchemas(schemas http.FileSystem) {
 	s.schemas = schemas
 }
 
-// Run starts the service's HTTP server and runs it forever or until SIGINT is
-// received. This method should be invoked once per service.
+// SetStatic allows a service to provide its own HTTP filesystem to be used for
+// static assets, e.g. an embedded UI. This overrides the use of the local
+// filesystem and path given in the service config.
+func (s *Service) SetStatic(static http.FileSystem) {
+	s.static = static
+}
+
+// SetIDGenerator allows a service to provide its own trace (and request) ID
+// generator, e.g. to make IDs unique across regions. Generated IDs must be
+// positive. This overrides the use of the node ID given in the service config.
+func (s *Service) SetIDGenerator(generator IDGenerator) {
+	if generator == nil {
+		generator = trace.GenerateID
+	}
+	s.idGenerator = generator
+}
+
+// SetAccessLogHook allows a service to customize access log entries, e.g. by
+// adding tenant or cache fields. The hook is invoked once the standard fields
+// are populated, just before each entry is logged, and may add or override
+// fields. Panics in the hook are recovered and logged.
+func (s *Service) SetAccessLogHook(hook func(ctx context.Context, fields log.Fields)) {
+	s.accessLogHook = hook
+}
+
+// AddErrorHandler adds a handler that runs only for error (4xx and 5xx)
+// responses, e.g. to capture extra context or emit metrics. Error handlers run
+// in registration order once the response is written, with the final status
+// and the request's context. Panics in error handlers are recovered and
+// logged.
+func (s *Service) AddErrorHandler(h func(ctx context.Context, status int, rw http.ResponseWriter, req *http.Request)) {
+	s.errorHandlers = append(s.errorHandlers, h)
+}
+
+// SetGetCertificate allows a service to select TLS certificates itself, e.g.
+// by SNI server name from a certificate store. The callback takes precedence
+// over the certificates given in the service config.
+func (s *Service) SetGetCertificate(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) {
+	s.getCertificate = getCertificate
+}
+
+// SetReady opens (true) or closes (false) the service's readiness gate. While
+// the gate is closed, requests for resources receive 503 responses. Routes that
+// are served w/o regard to API version, e.g. metrics and health, are unaffected.
+func (s *Service) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
+
+// Ready returns true if the service's readiness gate is open.
+func (s *Service) Ready() bool {
+	return atomic.LoadInt32(&s.ready) != 0
+}
+
+// OnStart registers a hook that is invoked once the service is listening, just
+// before it begins serving requests. Hooks run in registration order and must be
+// registered before Run is called.
+func (s *Service) OnStart(hook func()) {
+	s.startHooks = append(s.startHooks, hook)
+}
+
+// OnShutdown registers a hook that is invoked when the service begins a
+// graceful shutdown, before its listener is closed. Hooks run in registration
+// order and must be registered before Run is called. Hooks that don't complete
+// within the configured shutdown timeout are abandoned.
+func (s *Service) OnShutdown(hook func()) {
+	s.shutdownHooks = append(s.shutdownHooks, hook)
+}
+
+// Run starts the service's HTTP server and runs it forever or until one of the
+// configured shutdown signals (by default SIGINT or SIGTERM) is received. This
+// method should be invoked once per service.
 func (s *Service) Run() (err error) {
 	s.once.Do(func() { err = s.run() })
 	return
 }
 
-func (s *Service) addMetricsRoute() {
+func (s *Service) addMetricsRoute(router *httptreemux.ContextMux) {
+	uriPath := s.config.Metrics.URIPath
+	if uriPath == "" {
+		uriPath = defaultMetricsURIPath
+	}
 	h := prometheus.UninstrumentedHandler()
-	s.globalRouter.GET(s.config.Metrics.URIPath, h.ServeHTTP)
+	s.addRoute(router, http.MethodGet, uriPath, h.ServeHTTP)
 }
 
-func (s *Service) addProfilerRoutes() {
-	router := s.globalRouter
-	uriPath := path.Clean(s.config.Profiler.URIPath)
-	router.GET(strings.TrimRight(uriPath, "/")+"/", pprof.Index)
-	router.GET(path.Join(uriPath, "/allocs"), pprof.Handler("allocs").ServeHTTP)
-	router.GET(path.Join(uriPath, "/block"), pprof.Handler("block").ServeHTTP)
-	router.GET(path.Join(uriPath, "/cmdline"), pprof.Cmdline)
-	router.GET(path.Join(uriPath, "/goroutine"), pprof.Handler("goroutine").ServeHTTP)
-	router.GET(path.Join(uriPath, "/heap"), pprof.Handler("heap").ServeHTTP)
-	router.GET(path.Join(uriPath, "/mutex"), pprof.Handler("mutex").ServeHTTP)
-	router.GET(path.Join(uriPath, "/profile"), pprof.Profile)
-	router.POST(path.Join(uriPath, "/profile"), pprof.Profile)
-	router.GET(path.Join(uriPath, "/symbol"), pprof.Symbol)
-	router.POST(path.Join(uriPath, "/symbol"), pprof.Symbol)
-	router.GET(path.Join(uriPath, "/threadcreate"), pprof.Handler("threadcreate").ServeHTTP)
-	router.GET(path.Join(uriPath, "/trace"), pprof.Trace)
-	router.POST(path.Join(uriPath, "/trace"), pprof.Trace)
+func (s *Service) addProfilerRoutes(router *httptreemux.ContextMux) {
+	uriPath := s.config.Profiler.URIPath
+	if uriPath == "" {
+		uriPath = defaultProfilerURIPath
+	}
+	uriPath = path.Clean(uriPath)
+	s.addRoute(router, http.MethodGet, strings.TrimRight(uriPath, "/")+"/", pprof.Index)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/allocs"), pprof.Handler("allocs").ServeHTTP)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/block"), pprof.Handler("block").ServeHTTP)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/cmdline"), pprof.Cmdline)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/goroutine"), pprof.Handler("goroutine").ServeHTTP)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/heap"), pprof.Handler("heap").ServeHTTP)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/mutex"), pprof.Handler("mutex").ServeHTTP)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/profile"), pprof.Profile)
+	s.addRoute(router, http.MethodPost, path.Join(uriPath, "/profile"), pprof.Profile)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/symbol"), pprof.Symbol)
+	s.addRoute(router, http.MethodPost, path.Join(uriPath, "/symbol"), pprof.Symbol)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/threadcreate"), pprof.Handler("threadcreate").ServeHTTP)
+	s.addRoute(router, http.MethodGet, path.Join(uriPath, "/trace"), pprof.Trace)
+	s.addRoute(router, http.MethodPost, path.Join(uriPath, "/trace"), pprof.Trace)
 }
 
 func (s *Service) addSchemaRoutes() {
@@ -218,132 +526,163 @@ func (s *Service) addSchemaRoutes() {
 	router := s.globalRouter
 
 	// Serve the various schemas, e.g. /schema/v1, /schema/v2, etc.
-	h := newSchemaHandler(s.schemas)
-	router.GET(path.Join(config.Schema.URIPath, ":version/*filepath"), h.ServeHTTP)
+	h := newSchemaHandler(s.schemas, config.Schema.ContentTypes)
+	h.setVersionSchemas(s.versionSchemas)
+	h.compress = config.Schema.Compress
+	s.addRoute(router, http.MethodGet, path.Join(config.Schema.URIPath, ":version/*filepath"), h.ServeHTTP)
 
 	// Temporarily redirect (307) the base schema path to the default schema file, e.g. /schema -> /schema/v2/fileName
 	defaultSchemaPath := path.Join(config.Prefix, config.Schema.URIPath, fmt.Sprintf("v%d", config.Version.Max), config.Schema.FileName)
-	router.GET(config.Schema.URIPath, func(rw http.ResponseWriter, req *http.Request) {
+	s.addRoute(router, http.MethodGet, config.Schema.URIPath, func(rw http.ResponseWriter, req *http.Request) {
 		http.Redirect(rw, req, defaultSchemaPath, http.StatusTemporaryRedirect)
 	})
 
 	// Temporarily redirect (307) the version schema path to the default schema file, e.g. /schema/v2 -> /schema/v2/fileName
-	router.GET(path.Join(config.Schema.URIPath, ":version"), func(rw http.ResponseWriter, req *http.Request) {
+	s.addRoute(router, http.MethodGet, path.Join(config.Schema.URIPath, ":version"), func(rw http.ResponseWriter, req *http.Request) {
 		http.Redirect(rw, req, defaultSchemaPath, http.StatusTemporaryRedirect)
 	})
 
 	// Optionally temporarily redirect (307) the root to the base schema path, e.g. / -> /schema
 	if config.Schema.RootRedirect {
-		router.GET("/", func(rw http.ResponseWriter, req *http.Request) {
+		s.addRoute(router, http.MethodGet, "/", func(rw http.ResponseWriter, req *http.Request) {
 			http.Redirect(rw, req, defaultSchemaPath, http.StatusTemporaryRedirect)
 		})
 	}
 }
 
-func (s *Service) addCollectionRoutes(router *httptreemux.ContextMux, basePath string, r interface{}) {
+func (s *Service) addStaticRoutes() {
+	config := s.config
+	router := s.globalRouter
+
+	// Serve static assets, e.g. /ui/index.html, /ui/js/app.js, etc.
+	h := newStaticHandler(s.static, config.Static.SPA)
+	s.addRoute(router, http.MethodGet, path.Join(config.Static.URIPath, "*filepath"), h.ServeHTTP)
+}
+
+func (s *Service) addHealthRoute() {
+	// Readiness probe: 200 when ready, 503 during warmup
+	s.addRoute(s.globalRouter, http.MethodGet, s.config.Health.URIPath, func(rw http.ResponseWriter, req *http.Request) {
+		if s.Ready() {
+			rw.WriteHeader(http.StatusOK)
+		} else {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
+
+func (s *Service) addCollectionRoutes(a RouteAdder, basePath string, r interface{}) {
 	if x, ok := r.(CollectionLister); ok {
-		AddListCollectionRoute(router, basePath, x)
+		addListCollectionRoute(a, basePath, x)
 	}
 	if x, ok := r.(CollectionCounter); ok {
-		AddCountCollectionRoute(router, basePath, x)
+		addCountCollectionRoute(a, basePath, x)
 	}
 	if x, ok := r.(CollectionGetter); ok {
-		AddGetCollectionRoute(router, basePath, x)
+		addGetCollectionRoute(a, basePath, x)
 	}
 	if x, ok := r.(CollectionCreator); ok {
-		AddCreateCollectionRoute(router, basePath, x)
+		addCreateCollectionRoute(a, basePath, x)
 	}
 	if x, ok := r.(CollectionUpdater); ok {
-		AddUpdateCollectionRoute(router, basePath, x)
+		addUpdateCollectionRoute(a, basePath, x)
 	}
 	if x, ok := r.(CollectionDeleter); ok {
-		AddDeleteCollectionRoute(router, basePath, x)
+		addDeleteCollectionRoute(a, basePath, x)
 	}
 	if x, ok := r.(CollectionActioner); ok {
-		AddActionCollectionRoute(router, basePath, x)
+		addActionCollectionRoute(a, basePath, x)
 	}
 }
 
-func (s *Service) addSingletonRoutes(router *httptreemux.ContextMux, basePath string, r interface{}) {
+func (s *Service) addSingletonRoutes(a RouteAdder, basePath string, r interface{}) {
 	if x, ok := r.(SingletonGetter); ok {
-		AddGetSingletonRoute(router, basePath, x)
+		addGetSingletonRoute(a, basePath, x)
 	}
 	if x, ok := r.(SingletonUpdater); ok {
-		AddUpdateSingletonRoute(router, basePath, x)
+		addUpdateSingletonRoute(a, basePath, x)
 	}
 	if x, ok := r.(SingletonActioner); ok {
-		AddActionSingletonRoute(router, basePath, x)
+		addActionSingletonRoute(a, basePath, x)
 	}
 }
 
 func (s *Service) run() error {
 	config := s.config
 
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
 	// Optionally enable CORS
 	if config.CORS.Enabled {
-		opts := cors.Options{
-			AllowedOrigins:   config.CORS.AllowedOrigins,
-			AllowedMethods:   config.CORS.AllowedMethods,
-			AllowedHeaders:   config.CORS.AllowedHeaders,
-			ExposedHeaders:   config.CORS.ExposedHeaders,
-			AllowCredentials: config.CORS.AllowCredentials,
+		var credentialsDropped bool
+		s.cors, credentialsDropped = newCORSPolicy(config)
+		if credentialsDropped {
+			s.defaultLogger.Warn("CORS credentials are not allowed for wildcard origins")
 		}
-		s.cors = cors.New(opts)
 	}
 
 	// Optionally enable trace recording
 	if config.Trace.Enabled {
-		var (
-			rec trace.Recorder
-			err error
-		)
-		if rec = recorders[config.Trace.Recorder]; rec == nil {
-			// Automatically create JSON and YAML recorders if they are not otherwise registered
-			switch config.Trace.Recorder {
-			case "json":
-				if p := config.Trace.Params["path"]; p != "" {
-					var f *os.File
-					if f, err = os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666); err != nil {
-						break
-					}
-					rec = trace.NewJSONRecorder(f)
-				} else {
-					err = errors.New("JSON trace recorders require a 'path' parameter")
-				}
-			case "yaml":
-				if p := config.Trace.Params["path"]; p != "" {
-					var f *os.File
-					if f, err = os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666); err != nil {
-						break
-					}
-					rec = &yamlRecorder{f}
-				} else {
-					err = errors.New("YAML trace recorders require a 'path' parameter")
+		fanout := newFanoutRecorder(s.defaultLogger)
+		for _, name := range config.Trace.Recorders {
+			rec, flush, err := s.openTraceRecorder(name)
+			if err != nil {
+				if config.Trace.Required {
+					return fmt.Errorf("%s trace recorder: %v", name, err)
 				}
-			default:
-				err = fmt.Errorf("unknown trace recorder: %s", config.Trace.Recorder)
+				s.defaultLogger.Warnf("%s trace recorder is not active: %s", name, err)
+				continue
 			}
+			fanout.add(name, rec, flush)
 		}
-		if rec != nil {
+		if len(fanout.recorders) != 0 {
+			q := newQueuedRecorder(fanout, fanout.Flush, config.Trace.QueueSize, config.Trace.HighWater, config.Trace.OverflowPolicy, config.Trace.FlushInterval, s.defaultLogger)
+			if config.Metrics.Enabled {
+				q.registerMetrics()
+			}
+			s.traceQueue = q
 			ctx := trace.WithBuffer(context.Background(), config.Trace.Buffer)
 			ctx = trace.WithLogger(ctx, s.defaultLogger)
-			s.tracer, _ = trace.Record(ctx, rec)
-		}
-		if err != nil {
-			s.defaultLogger.Warn("trace recording is not active: ", err)
+			var err error
+			if s.tracer, err = trace.Record(ctx, q); err != nil && config.Trace.Required {
+				return err
+			}
+		} else if config.Trace.Required {
+			return ErrNoTraceRecorders
+		} else {
+			s.defaultLogger.Warn("trace recording is not active: no trace recorders")
 		}
 	}
 
 	// Add optional HTTP handlers
-	if s.config.Metrics.Enabled {
-		s.addMetricsRoute()
+	if s.config.Metrics.Enabled && s.config.Metrics.Backend == MetricsBackendPrometheus {
+		s.EnableMetrics(true)
 	}
 	if s.config.Profiler.Enabled {
-		s.addProfilerRoutes()
+		s.EnableProfiler(true)
 	}
 	if config.Schema.Enabled {
 		s.addSchemaRoutes()
 	}
+	if config.Health.Enabled {
+		s.addHealthRoute()
+	}
+	if config.Static.Enabled {
+		s.addStaticRoutes()
+	}
+	if config.Capabilities.Enabled {
+		s.addCapabilitiesRoute()
+	}
+	if config.BuildInfo.Enabled {
+		s.addBuildInfoRoute()
+	}
+	if config.OpenAPI.Enabled {
+		s.addOpenAPIRoute()
+	}
+	if config.Debug.TracesURIPath != "" && s.memTraces != nil {
+		s.addTracesRoute()
+	}
 
 	// Serve HTTP or HTTPS, depending on config. Use stoppable listener so
 	// we can exit gracefully if signaled to do so.
@@ -351,35 +690,101 @@ func (s *Service) run() error {
 		l   net.Listener
 		err error
 	)
+	stop := make(chan os.Signal, 1)
 	if config.Transport.TLS {
 		s.defaultLogger.Debugf("HTTPS listening on %s", config.Addr)
-		l, err = NewStoppableTLSListener(config.Addr, true, config.Transport.CertFilePath, config.Transport.KeyFilePath)
+		var tlsConfig *tls.Config
+		if tlsConfig, err = newTLSConfig(config.tlsCertificates(), s.getCertificate); err != nil {
+			return err
+		}
+		l, err = newStoppableTLSListener(config.Addr, true, tlsConfig, stop)
 	} else {
 		s.defaultLogger.Debugf("HTTP listening on %s", config.Addr)
-		l, err = NewStoppableTCPListener(config.Addr, true)
+		l, err = newStoppableListener(config.Addr, true, stop)
 	}
 	if err != nil {
 		return err
 	}
 
-	// If metrics are enabled let Prometheus have a look at the request first
+	// Run shutdown hooks before stopping the listener
+	shutdownSignals, err := parseSignals(config.Shutdown.Signals)
+	if err != nil {
+		return err
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, shutdownSignals...)
+	go func() {
+		sig := <-sigs
+		s.shutdown(sig)
+		stop <- sig
+	}()
+
+	// If Prometheus metrics are enabled let Prometheus have a look at the
+	// request first. Other backends are fed by ServeHTTP.
 	var h http.HandlerFunc
-	if config.Metrics.Enabled {
+	if config.Metrics.Enabled && config.Metrics.Backend == MetricsBackendPrometheus {
 		h = prometheus.InstrumentHandler("service", s)
 	} else {
 		h = s.ServeHTTP
 	}
 
+	// Announce that the service has started and run start hooks
+	s.defaultLogger.WithFields(log.Fields{
+		"addr":            config.Addr,
+		"tls":             config.Transport.TLS,
+		"api_version_min": config.Version.Min,
+		"api_version_max": config.Version.Max,
+		"cors":            config.CORS.Enabled,
+		"metrics":         config.Metrics.Enabled,
+		"profiler":        config.Profiler.Enabled,
+		"schema":          config.Schema.Enabled,
+		"trace":           s.tracer != nil,
+	}).Info("service started")
+	for _, hook := range s.startHooks {
+		hook()
+	}
+
 	// Run the HTTP server
-	if err = http.Serve(l, h); err != nil {
-		// Ignore ListenerStoppedError
+	server := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: config.Transport.ReadHeaderTimeout,
+		ReadTimeout:       config.Transport.ReadTimeout,
+		WriteTimeout:      config.Transport.WriteTimeout,
+		IdleTimeout:       config.Transport.IdleTimeout,
+	}
+	if err = server.Serve(l); err != nil {
+		// Ignore ListenerStoppedError, then drain requests and close
+		// dependencies
 		if _, ok := err.(*ListenerStoppedError); ok {
 			err = nil
+			s.teardown(server)
 		}
 	}
 	return err
 }
 
+func (s *Service) shutdown(sig os.Signal) {
+	s.defaultLogger.WithFields(log.Fields{
+		"signal": sig.String(),
+	}).Info("service stopping")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, hook := range s.shutdownHooks {
+			hook()
+		}
+	}()
+
+	timer := s.clock.NewTimer(s.config.Shutdown.Timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C():
+		s.defaultLogger.Warnf("shutdown hooks did not complete within %s", s.config.Shutdown.Timeout)
+	}
+}
+
 func (s *Service) SetRecoveryHandler(handler func(h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request)) {
 	if handler == nil {
 		handler = defaultRecoveryHandler
@@ -389,7 +794,7 @@ func (s *Service) SetRecoveryHandler(handler func(h func(http.ResponseWriter, *h
 
 func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	var (
-		start    = time.Now()
+		start    = s.clock.Now()
 		traceId  int64
 		parentId int64
 		res      *responseWriter
@@ -414,17 +819,24 @@ func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 	}()
 
-	// Handle CORS prior to tracing
+	// Handle CORS prior to tracing. Preflight requests end here; other
+	// OPTIONS requests are routed.
 	if s.cors != nil {
 		s.cors.HandlerFunc(rw, req)
-		if req.Method == "OPTIONS" {
+		if isCORSPreflight(req) {
 			return
 		}
 	}
 
+	// Match the API route and resource that serve the request just once
+	segs, route, resource := s.matchRequest(req)
+
 	// If tracing is enabled then join the request and trace contexts
 	ctx0 := req.Context()
-	if s.tracer != nil {
+	spanName := req.URL.Path
+	if s.tracer != nil && s.acquireTraceSpan() {
+		defer s.releaseTraceSpan()
+		spanName = s.spanName(req, route)
 		if ctx0, err = trace.Join(ctx0, s.tracer); err != nil {
 			// NB: This shouldn't happen but if they do, silently
 			// recover from them on the basis that tracing failures
@@ -434,42 +846,84 @@ func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	// Trace using either using an existing trace id (recovered from the
-	// X-Request-Id header in the form "traceId:parentId") or a newly
-	// generated one. Add the trace id to the request context.
+	// X-Request-Id header in the form "traceId:parentId" or "traceId") or a
+	// newly generated one. Add the trace id to the request context.
 	if hdr := req.Header.Get(HeaderRequestId); hdr != "" {
-		if parts := strings.Split(hdr, ":"); len(parts) == 2 {
+		switch parts := strings.Split(hdr, ":"); len(parts) {
+		case 1:
+			traceId, _ = strconv.ParseInt(parts[0], 10, 64)
+		case 2:
 			traceId, _ = strconv.ParseInt(parts[0], 10, 64)
 			parentId, _ = strconv.ParseInt(parts[1], 10, 64)
 		}
 	}
 	if traceId > 0 && parentId > 0 {
 		ctx0 = trace.WithTraceID(trace.WithParentID(ctx0, parentId), traceId)
+	} else if traceId > 0 {
+		ctx0 = trace.WithTraceID(ctx0, traceId)
 	} else {
-		traceId, _ = trace.GenerateID(ctx0)
+		traceId, _ = s.idGenerator(ctx0)
 		ctx0 = trace.WithTraceID(ctx0, traceId)
 	}
 	requestId := strconv.FormatInt(traceId, 10)
 	rw.Header().Set(HeaderRequestId, requestId)
+	var responseId string
+	if s.config.Response.ResponseId {
+		responseId = newResponseId()
+		rw.Header().Set(HeaderResponseId, responseId)
+	}
 
 	// Handle the remainder of request processing in a trace span
-	trace.Do(ctx0, TraceKindRequest, req.URL.Path, func(ctx1 context.Context) {
+	trace.Do(ctx0, TraceKindRequest, spanName, func(ctx1 context.Context) {
+		if s.metrics != nil {
+			s.metrics.requestStarted()
+		}
+
 		// Create a new response writer
 		res = responseWriterPool.Get().(*responseWriter)
 		res.init(rw)
+		s.initEncoding(res, req)
 
 		// Create new handler details and to the request context
 		d = handlerDetailsPool.Get().(*handlerDetails)
-		d.init(s, res, req, requestId, "luddite.ServeHTTP.begin")
+		d.init(s, res, req, requestId, "luddite.ServeHTTP.begin", start, segs, route, resource)
 		ctx1 = withHandlerDetails(ctx1, d)
+		res.ctx = ctx1
+		if s.tenantResolver != nil {
+			d.tenant = s.tenantResolver(req)
+		}
 
 		// Create a shallow copy of the request so that it references
 		// the final and correct context
 		req = req.WithContext(ctx1)
 		d.request = req
 
+		// Optionally cap the size of the request body
+		if max := s.config.Limits.MaxRequestBodyBytes; max > 0 && req.Body != nil {
+			req.Body = http.MaxBytesReader(res, req.Body, max)
+		}
+
+		// Optionally capture the request for later replay (debug only)
+		if s.capturer != nil {
+			if err := s.capturer.capture(req, requestId, start); err != nil {
+				s.defaultLogger.WithFields(log.Fields{"error": err.Error()}).Warn("failed to capture request")
+			}
+		}
+
+		// Detect and echo the client's return preference
+		if d.preferReturn = RequestPreferReturn(req); d.preferReturn != "" {
+			res.Header().Set(HeaderPreferenceApplied, "return="+d.preferReturn)
+		}
+
+		// Detect and echo dry run requests
+		if s.config.DryRun.Enabled && s.requestDryRun(req) {
+			d.dryRun = true
+			res.Header().Set(HeaderDryRun, "true")
+		}
+
 		defer func() {
 			var (
-				latency = time.Since(start)
+				latency = s.clock.Since(start)
 				status  = res.Status()
 				rcv     interface{}
 				stack   string
@@ -497,7 +951,20 @@ func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 					}
 					status = http.StatusInternalServerError
 				}
-				_ = WriteResponse(res, status, resp)
+				if resp == nil || !s.writeErrorPage(res, req, status) {
+					_ = WriteResponse(res, status, resp)
+				}
+			}
+			if res.canceled {
+				// The client went away while the response was written
+				status = http.StatusTeapot
+			}
+
+			// Run error handlers
+			if status >= 400 {
+				for _, h := range s.errorHandlers {
+					s.runErrorHandler(ctx1, h, status, res, req)
+				}
 			}
 
 			// Log the request
@@ -507,6 +974,7 @@ func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			}
 			fields := log.Fields{
 				"client_addr":   req.RemoteAddr,
+				"client_ip":     s.proxies.clientIP(req),
 				"forwarded_for": req.Header.Get(HeaderForwardedFor),
 				"proto":         req.Proto,
 				"method":        req.Method,
@@ -518,10 +986,40 @@ func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 				"api_version":   apiVersion,
 				"latency":       fmt.Sprintf("%.6f", latency.Seconds()),
 			}
-			sessionId := req.Header.Get(HeaderSessionId)
+			sessionId := d.sessionId
 			if sessionId != "" {
 				fields["session_id"] = sessionId
 			}
+			if d.tenant != "" {
+				fields["tenant"] = d.tenant
+			}
+			if responseId != "" {
+				fields["response_id"] = responseId
+			}
+			traceHex, spanHex, traced := traceCorrelationIds(ctx1)
+			if traced {
+				fields["trace_id"] = traceHex
+				fields["span_id"] = spanHex
+			}
+			if res.truncated {
+				fields["truncated"] = true
+				s.defaultLogger.WithFields(log.Fields{
+					"method":     req.Method,
+					"uri":        req.RequestURI,
+					"route":      s.routePattern(d.segs, d.route),
+					"request_id": requestId,
+					"limit":      res.maxBytes,
+				}).Error("response truncated: maximum response size exceeded")
+			}
+			if s.sessions != nil {
+				s.sessions.observe(sessionId)
+			}
+			if s.metrics != nil {
+				s.metrics.requestFinished(req.Method, s.routePattern(d.segs, d.route), status, latency)
+			}
+			if s.accessLogHook != nil {
+				s.runAccessLogHook(ctx1, fields)
+			}
 			entry := s.accessLogger.WithFields(fields)
 			if status/100 != 5 {
 				entry.Info()
@@ -542,6 +1040,19 @@ func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 				if sessionId != "" {
 					data["session_id"] = sessionId
 				}
+				if d.tenant != "" {
+					data["tenant"] = d.tenant
+				}
+				if responseId != "" {
+					data["response_id"] = responseId
+				}
+				if traced {
+					data["trace_id"] = traceHex
+					data["span_id"] = spanHex
+				}
+				if len(d.flags) > 0 {
+					data["feature_flags"] = formatFlags(d.flags)
+				}
 				if rcv != nil {
 					data["panic"] = rcv
 					data["stack"] = stack
@@ -549,6 +1060,30 @@ func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			}
 		}()
 
+		// Shed requests when the service is near its in-flight limit, lowest
+		// priority first
+		if s.qosLimiter != nil {
+			priority := PriorityNormal
+			if s.qosClassifier != nil {
+				priority = s.qosClassifier(req)
+			}
+			if !s.qosLimiter.acquire(priority) {
+				s.qosLimiter.reject(res)
+				return
+			}
+			defer s.qosLimiter.release(priority)
+		}
+
+		// Reject requests from clients that are at their in-flight request limit
+		if s.clientLimiter != nil {
+			key, ok := s.clientLimiter.acquire(req)
+			if !ok {
+				s.clientLimiter.reject(res)
+				return
+			}
+			defer s.clientLimiter.release(key)
+		}
+
 		// Run the request through the service's middleware handlers. If
 		// any handler generates a response then we are done.
 		for _, h := range s.handlers {
@@ -558,27 +1093,135 @@ func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			}
 		}
 
-		// Try a route lookup using the global router. Routes registered
-		// here have preference over API version-specific routes and are
-		// served w/o regard to requested API version number.
+		// Try a route lookup using the global router and the enabled
+		// optional global routes. Routes registered here have preference
+		// over API version-specific routes and are served w/o regard to
+		// requested API version number.
+		if s.serveToggledRoute(res, req) {
+			return
+		}
 		if lr, ok := s.globalRouter.Lookup(nil, req); ok {
 			s.globalRouter.ServeLookupResult(res, req, lr)
 			return
 		}
 
+		// Reject resource requests until the service is ready
+		if !s.Ready() {
+			_ = WriteResponse(res, ErrorStatus(EcodeServiceNotReady), NewError(nil, EcodeServiceNotReady))
+			return
+		}
+
+		// Attach schema validation for the resource that serves the request
+		if v := d.resourceValidation(); v != nil {
+			d.validation = v
+			res.validation = v
+		}
+		d.disallowUnknownFields = s.disallowUnknownFields(d)
+		if (req.Method == http.MethodGet || req.Method == http.MethodHead) && s.autoETag(d) {
+			res.autoETag = true
+			res.ifNoneMatch = req.Header.Get(HeaderIfNoneMatch)
+		}
+
+		// Reject request bodies that the resource doesn't accept
+		if a := d.resourceAccepted(); a != nil && !a.allows(req) {
+			a.reject(res, req)
+			return
+		}
+
+		// Reject path parameters that don't match the resource's constraints
+		if p := d.resourceParams(); p != nil && !p.allows(d.route, d.segs) {
+			s.notFoundHandler(res, req)
+			return
+		}
+
+		// Run the request through the resource's own middleware handlers
+		if r := d.resource.find(func(r *resourceRegistration) bool { return len(r.middleware) != 0 }); r != nil {
+			for _, h := range r.middleware {
+				s.recoveryHandler(h.ServeHTTP)(res, req)
+				if res.Written() {
+					return
+				}
+			}
+		}
+
+		// Reject uploads whose preconditions fail before their bodies are sent
+		if expectsContinue(req) && !s.checkContinue(res, req, d) {
+			return
+		}
+
+		// Enforce resources' rate limits
+		if l := d.resourceRateLimiter(); l != nil {
+			if ok, wait := l.allow(req, s.clock.Now()); !ok {
+				l.reject(res, wait)
+				return
+			}
+		}
+
+		// Wait for an execution slot in concurrency-limited resources
+		if l := d.resourceLimiter(); l != nil {
+			if !l.acquire(ctx1, s.clock) {
+				l.reject(res)
+				return
+			}
+			defer l.release()
+		}
+
+		// Wait for a worker when the worker pool is enabled
+		if s.workers != nil {
+			if !s.workers.acquire(ctx1, s.clock) {
+				s.workers.reject(res)
+				return
+			}
+			defer s.workers.release()
+		}
+
 		// Finally, dispatch to a resource via an API router
 		router := s.apiRouters[d.apiVersion]
 		s.recoveryHandler(router.ServeHTTP)(res, req)
 	})
 }
 
-func newRouter(prefix string) *httptreemux.ContextMux {
-	router := httptreemux.NewContextMux()
-	router.NotFoundHandler = notFoundHandler
-	if prefix != "" {
-		router.ContextGroup = router.NewGroup(prefix)
+func (s *Service) requestDryRun(req *http.Request) bool {
+	config := s.config
+	if v := req.URL.Query().Get(config.DryRun.QueryParam); v != "" {
+		dryRun, _ := strconv.ParseBool(v)
+		return dryRun
+	}
+	dryRun, _ := strconv.ParseBool(req.Header.Get(config.DryRun.Header))
+	return dryRun
+}
+
+func (s *Service) initEncoding(res *responseWriter, req *http.Request) {
+	config := s.config
+	switch config.Response.ErrorFormat {
+	case ErrorFormatProblem:
+		res.problemDetails = true
+		res.instance = req.URL.Path
+	case ErrorFormatJSONAPI:
+		res.jsonAPIErrors = true
+	}
+	res.jsonIndent = config.Response.JSONIndent
+	res.bodylessStatuses = s.bodyless
+	res.maxBytes = config.Response.MaxResponseBytes
+	res.jsonEscapeHTML = !config.Response.DisableHTMLEscape
+	res.jsonOmitNull = config.Response.OmitNullFields
+	res.jsonFieldNames = s.fieldNames
+	res.jsonTimeFormat = s.timeFormat
+	res.bufferHint = config.Response.BufferHint
+	if config.Response.JSONP && req.Method == http.MethodGet {
+		res.jsonpCallback = jsonpCallback(req)
+	}
+
+	// Optionally allow clients to override indentation, e.g. ?pretty=true
+	if config.Debug.Pretty {
+		if pretty, err := strconv.ParseBool(req.URL.Query().Get("pretty")); err == nil {
+			if !pretty {
+				res.jsonIndent = ""
+			} else if res.jsonIndent == "" {
+				res.jsonIndent = defaultJSONIndent
+			}
+		}
 	}
-	return router
 }
 
 func notFoundHandler(rw http.ResponseWriter, _ *http.Request) {
@@ -617,6 +1260,32 @@ func openLogFile(logger *log.Logger, logPath string) {
 	<-logging
 }
 
+func (s *Service) runAccessLogHook(ctx context.Context, fields log.Fields) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			stack := make([]byte, maxStackSize)
+			stack = stack[:runtime.Stack(stack, false)]
+			s.defaultLogger.WithFields(log.Fields{
+				"stack": string(stack),
+			}).Error(rcv)
+		}
+	}()
+	s.accessLogHook(ctx, fields)
+}
+
+func (s *Service) runErrorHandler(ctx context.Context, h func(ctx context.Context, status int, rw http.ResponseWriter, req *http.Request), status int, rw http.ResponseWriter, req *http.Request) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			stack := make([]byte, maxStackSize)
+			stack = stack[:runtime.Stack(stack, false)]
+			s.defaultLogger.WithFields(log.Fields{
+				"stack": string(stack),
+			}).Error(rcv)
+		}
+	}()
+	h(ctx, status, rw, req)
+}
+
 // Default recovery handler - equivalent to the identity
 func defaultRecoveryHandler(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return handler
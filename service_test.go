@@ -0,0 +1,268 @@
+package luddite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// newTestService creates a service that serves API version 1, after letting
+// configure (if non-nil) adjust its config.
+func newTestService(t *testing.T, configure func(config *ServiceConfig)) *Service {
+	t.Helper()
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	if configure != nil {
+		configure(config)
+	}
+	s, err := NewService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+type pingResource struct{}
+
+func (r *pingResource) Get(req *http.Request) (int, interface{}) {
+	return http.StatusOK, "pong"
+}
+
+func TestReadinessGate(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.StartUnready = true
+		config.Health.Enabled = true
+	})
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	s.addHealthRoute()
+
+	serve := func(path string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	if code := serve("/ping"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503/Service Unavailable before ready, got %d", code)
+	}
+	if code := serve("/health/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503/Service Unavailable readiness before ready, got %d", code)
+	}
+
+	s.SetReady(true)
+	if code := serve("/ping"); code != http.StatusOK {
+		t.Errorf("expected 200/OK once ready, got %d", code)
+	}
+	if code := serve("/health/ready"); code != http.StatusOK {
+		t.Errorf("expected 200/OK readiness once ready, got %d", code)
+	}
+}
+
+type dryRunResource struct {
+	dryRun bool
+}
+
+func (r *dryRunResource) Get(req *http.Request) (int, interface{}) {
+	r.dryRun = ContextDryRun(req.Context())
+	return http.StatusOK, "ok"
+}
+
+func TestDryRun(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.DryRun.Enabled = true
+	})
+	r := &dryRunResource{}
+	if err := s.AddResource(1, "/validate", r); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/validate?dry_run=true", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if !r.dryRun {
+		t.Error("dry run query parameter not detected")
+	}
+	if rw.Header().Get(HeaderDryRun) != "true" {
+		t.Errorf("missing %s header in response", HeaderDryRun)
+	}
+
+	req, _ = http.NewRequest("GET", "/validate", nil)
+	req.Header.Set(HeaderDryRun, "1")
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if !r.dryRun {
+		t.Error("dry run header not detected")
+	}
+
+	req, _ = http.NewRequest("GET", "/validate", nil)
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if r.dryRun {
+		t.Error("unexpected dry run")
+	}
+	if _, ok := rw.Header()[HeaderDryRun]; ok {
+		t.Errorf("unexpected %s header in response", HeaderDryRun)
+	}
+}
+
+func TestAccessLogHook(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	s.accessLogger.Out = out
+
+	serve := func() {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		s.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	s.SetAccessLogHook(func(ctx context.Context, fields log.Fields) {
+		fields["tenant"] = "acme"
+		fields["method"] = "PING"
+	})
+	serve()
+	if entry := out.String(); !strings.Contains(entry, `"tenant":"acme"`) || !strings.Contains(entry, `"method":"PING"`) {
+		t.Errorf("expected hook fields in access log entry, got %s", entry)
+	}
+
+	out.Reset()
+	s.SetAccessLogHook(func(ctx context.Context, fields log.Fields) {
+		panic("buggy hook")
+	})
+	serve()
+	if entry := out.String(); !strings.Contains(entry, `"status":200`) {
+		t.Errorf("expected access log entry despite panicking hook, got %s", entry)
+	}
+}
+
+func TestAddErrorHandler(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	s.AddErrorHandler(func(ctx context.Context, status int, rw http.ResponseWriter, req *http.Request) {
+		calls = append(calls, fmt.Sprintf("first %d %s", status, ContextRequestId(ctx)))
+		panic("buggy error handler")
+	})
+	s.AddErrorHandler(func(ctx context.Context, status int, rw http.ResponseWriter, req *http.Request) {
+		calls = append(calls, fmt.Sprintf("second %d %s", status, req.URL.Path))
+	})
+
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if len(calls) != 0 {
+		t.Errorf("expected no error handler calls for 200/OK, got %v", calls)
+	}
+
+	req, _ = http.NewRequest("GET", "/missing", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found, got %d", rw.Code)
+	}
+	requestId := rw.Header().Get(HeaderRequestId)
+	if len(calls) != 2 || calls[0] != "first 404 "+requestId || calls[1] != "second 404 /missing" {
+		t.Errorf("expected both error handlers to run in order, got %v", calls)
+	}
+}
+
+type bigResource struct{}
+
+func (r *bigResource) Get(req *http.Request) (int, interface{}) {
+	return http.StatusOK, strings.Repeat("x", 100)
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Response.MaxResponseBytes = 10
+	})
+	if err := s.AddResource(1, "/big", &bigResource{}); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	s.defaultLogger.Out = out
+
+	req, _ := http.NewRequest("GET", "/big", nil)
+	req.Header.Set(HeaderAccept, ContentTypePlain)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+
+	if rw.Body.Len() != 10 {
+		t.Errorf("expected body truncated to 10 bytes, got %d", rw.Body.Len())
+	}
+	if log := out.String(); !strings.Contains(log, "maximum response size exceeded") || !strings.Contains(log, `"truncated":true`) || !strings.Contains(log, `"route":"/big"`) {
+		t.Errorf("expected truncation to be logged, got %s", log)
+	}
+
+	// Exempt responses aren't limited
+	res := &responseWriter{}
+	res.init(httptest.NewRecorder())
+	res.maxBytes = 10
+	ExemptResponseSizeLimit(res)
+	if n, err := res.Write(make([]byte, 100)); n != 100 || err != nil {
+		t.Errorf("expected exempt write to succeed, got %d, %v", n, err)
+	}
+}
+
+func TestAddResourceWithMiddleware(t *testing.T) {
+	s := newTestService(t, nil)
+	var order []string
+	s.AddHandler(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		order = append(order, "service")
+	}))
+	admin := &identityResource{}
+	public := &identityResource{}
+	err := s.AddResourceWithMiddleware(1, "/admin", admin,
+		http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			order = append(order, "resource")
+		}),
+		NewAPIKeyHandler(func(key string) (Identity, bool) {
+			return Identity{ID: "root"}, key == "secret"
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddResource(1, "/public", public); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path, key string) int {
+		order = nil
+		req, _ := http.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set(HeaderApiKey, key)
+		}
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	if code := serve("/admin", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401/Unauthorized without key, got %d", code)
+	}
+	if len(order) != 2 || order[0] != "service" || order[1] != "resource" {
+		t.Errorf("expected service then resource middleware, got %v", order)
+	}
+	if code := serve("/admin", "secret"); code != http.StatusOK || admin.identity.ID != "root" {
+		t.Errorf("expected 200/OK with identity root, got %d and %q", code, admin.identity.ID)
+	}
+	if code := serve("/public", ""); code != http.StatusOK {
+		t.Errorf("expected resource middleware not to apply to other resources, got %d", code)
+	}
+	if len(order) != 1 {
+		t.Errorf("expected only service middleware for other resources, got %v", order)
+	}
+}
@@ -0,0 +1,141 @@
+//go:build !windows
+// +build !windows
+
+package luddite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// runTestService runs a service on a free loopback port until the returned
+// stop function signals it to shut down. The returned URL addresses the
+// service.
+func runTestService(t *testing.T, s *Service) (url string, stop func() error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config.Addr = l.Addr().String()
+	l.Close()
+
+	started := make(chan struct{})
+	s.OnStart(func() { close(started) })
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	select {
+	case <-started:
+	case err = <-done:
+		t.Fatalf("service failed to start: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("service failed to start")
+	}
+
+	url = "http://" + s.config.Addr
+	stop = func() error {
+		http.DefaultClient.CloseIdleConnections()
+		if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("service failed to stop")
+			return nil
+		}
+	}
+	return
+}
+
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+func TestServiceLifecycle(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	out := new(syncBuffer)
+	s.defaultLogger.Out = out
+
+	var hooks []string
+	s.OnStart(func() { hooks = append(hooks, "start") })
+	s.OnShutdown(func() { hooks = append(hooks, "shutdown") })
+	url, stop := runTestService(t, s)
+
+	// Start hooks have run by the time requests are served
+	res, err := http.Get(url + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", res.StatusCode)
+	}
+
+	// Shutdown hooks run on a shutdown signal, after which Run returns
+	if err = stop(); err != nil {
+		t.Errorf("expected graceful shutdown, got %v", err)
+	}
+	if actual := strings.Join(hooks, ","); actual != "start,shutdown" {
+		t.Errorf("unexpected hooks: %s", actual)
+	}
+	log := out.String()
+	if !strings.Contains(log, "service started") || !strings.Contains(log, `"signal":"interrupt"`) || !strings.Contains(log, "service stopping") {
+		t.Errorf("expected lifecycle to be logged, got %s", log)
+	}
+}
+
+func TestServiceTimeouts(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Transport.ReadHeaderTimeout = 50 * time.Millisecond
+	})
+	config := s.config
+	if config.Transport.IdleTimeout != defaultIdleTimeout {
+		t.Errorf("expected default idle timeout, got %s", config.Transport.IdleTimeout)
+	}
+	s.defaultLogger.Out = ioutil.Discard
+	_, stop := runTestService(t, s)
+	defer stop()
+
+	// Clients that are slow to send headers are disconnected
+	conn, err := net.Dial("tcp", config.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("GET /ping HTTP/1.1\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected connection to be closed, got %v", err)
+	}
+	if len(buf) != 0 && !strings.HasPrefix(string(buf), "HTTP/1.1 408") {
+		t.Errorf("unexpected response: %q", buf)
+	}
+}
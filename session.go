@@ -0,0 +1,55 @@
+package luddite
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	sessionLabelNone  = "none"
+	sessionLabelOther = "other"
+)
+
+var sessionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "luddite",
+	Name:      "session_requests_total",
+	Help:      "Number of requests by session ID.",
+}, []string{"session_id"})
+
+// sessionCounter counts requests by session ID while bounding the number of
+// distinct label values. Once the limit is reached, requests from new
+// sessions are counted as "other".
+type sessionCounter struct {
+	sync.Mutex
+	limit    int
+	sessions map[string]struct{}
+}
+
+func newSessionCounter(limit int) *sessionCounter {
+	return &sessionCounter{
+		limit:    limit,
+		sessions: make(map[string]struct{}, limit),
+	}
+}
+
+func (c *sessionCounter) observe(sessionId string) {
+	sessionRequests.WithLabelValues(c.label(sessionId)).Inc()
+}
+
+func (c *sessionCounter) label(sessionId string) string {
+	if sessionId == "" {
+		return sessionLabelNone
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.sessions[sessionId]; ok {
+		return sessionId
+	}
+	if len(c.sessions) < c.limit {
+		c.sessions[sessionId] = struct{}{}
+		return sessionId
+	}
+	return sessionLabelOther
+}
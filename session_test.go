@@ -0,0 +1,18 @@
+package luddite
+
+import "testing"
+
+func TestSessionCounterLabel(t *testing.T) {
+	c := newSessionCounter(2)
+	for _, test := range []struct{ sessionId, label string }{
+		{"", sessionLabelNone},
+		{"a", "a"},
+		{"b", "b"},
+		{"c", sessionLabelOther},
+		{"a", "a"},
+	} {
+		if label := c.label(test.sessionId); label != test.label {
+			t.Errorf("session %q: expected label %q, got %q", test.sessionId, test.label, label)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package luddite
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// shutdownSignals maps the signal names that may be used to trigger graceful
+// shutdown to their values. SIGHUP (log rotation) and SIGUSR1 (goroutine
+// dumps) are deliberately excluded since luddite handles them itself.
+var shutdownSignals = map[string]os.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// parseSignals converts a list of signal names, e.g. "SIGTERM" or "term", to
+// their values.
+func parseSignals(names []string) ([]os.Signal, error) {
+	sigs := make([]os.Signal, 0, len(names))
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		sig, ok := shutdownSignals[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported shutdown signal: %s", name)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
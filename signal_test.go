@@ -0,0 +1,20 @@
+package luddite
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignals(t *testing.T) {
+	sigs, err := parseSignals([]string{"SIGINT", "term"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 2 || sigs[0] != syscall.SIGINT || sigs[1] != syscall.SIGTERM {
+		t.Errorf("unexpected signals: %v", sigs)
+	}
+
+	if _, err = parseSignals([]string{"SIGHUP"}); err == nil {
+		t.Error("expected SIGHUP to be rejected")
+	}
+}
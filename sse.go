@@ -0,0 +1,115 @@
+package luddite
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrStreamingUnsupported occurs when a response writer can't be flushed.
+	ErrStreamingUnsupported = errors.New("response writer does not support streaming")
+
+	// ErrEventStreamClosed occurs when sending to an event stream that has ended.
+	ErrEventStreamClosed = errors.New("event stream closed")
+)
+
+// EventStream writes Server-Sent Events to a client. Events are flushed to the
+// client as they are sent. It is safe to send events from multiple goroutines.
+//
+// Note that a non-zero transport write timeout bounds the lifetime of every
+// response, including event streams.
+type EventStream struct {
+	sync.Mutex
+	rw      http.ResponseWriter
+	flusher http.Flusher
+	done    <-chan struct{}
+	closed  bool
+}
+
+// NewEventStream begins a Server-Sent Events response. The stream ends when
+// the request's context is done or Close is called. Resource handlers must
+// call Close before returning.
+func NewEventStream(rw http.ResponseWriter, req *http.Request) (*EventStream, error) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	ExemptResponseSizeLimit(rw)
+
+	// Ensure that proxies neither buffer nor compress the stream
+	h := rw.Header()
+	h.Set(HeaderContentType, ContentTypeEventStream)
+	h.Set(HeaderCacheControl, "no-cache")
+	h.Set(HeaderContentEncoding, "identity")
+	h.Set(HeaderAccelBuffering, "no")
+	h.Del(HeaderContentLength)
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &EventStream{
+		rw:      rw,
+		flusher: flusher,
+		done:    req.Context().Done(),
+	}, nil
+}
+
+// Send writes an event to the stream. The event name is optional. Multi-line
+// data is split across multiple data fields.
+func (es *EventStream) Send(event, data string) error {
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return es.write(b.String())
+}
+
+// Heartbeat periodically writes a comment to the stream, which keeps idle
+// connections from being closed by clients and proxies. It returns once the
+// stream ends or a write fails and is typically run in its own goroutine.
+func (es *EventStream) Heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := es.write(":\n\n"); err != nil {
+				return
+			}
+		case <-es.done:
+			return
+		}
+	}
+}
+
+// Close ends the stream. Subsequent sends fail.
+func (es *EventStream) Close() {
+	es.Lock()
+	defer es.Unlock()
+	es.closed = true
+}
+
+func (es *EventStream) write(s string) error {
+	es.Lock()
+	defer es.Unlock()
+	if es.closed {
+		return ErrEventStreamClosed
+	}
+	select {
+	case <-es.done:
+		return ErrEventStreamClosed
+	default:
+	}
+	if _, err := es.rw.Write([]byte(s)); err != nil {
+		return err
+	}
+	es.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,39 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventStream(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/events", nil)
+	rw := httptest.NewRecorder()
+
+	es, err := NewEventStream(rw, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct != ContentTypeEventStream {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	if !rw.Flushed {
+		t.Error("event stream headers not flushed")
+	}
+
+	if err = es.Send("greeting", "hello\nworld"); err != nil {
+		t.Fatal(err)
+	}
+	if err = es.Send("", "bye"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "event: greeting\ndata: hello\ndata: world\n\ndata: bye\n\n"
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("unexpected event stream, got: %q, expected: %q", body, expected)
+	}
+
+	es.Close()
+	if err = es.Send("", "closed"); err != ErrEventStreamClosed {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package luddite
+
+import (
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+const staticIndexFile = "/index.html"
+
+type staticHandler struct {
+	fs         http.FileSystem
+	fileServer http.Handler
+	spa        bool
+}
+
+func newStaticHandler(fs http.FileSystem, spa bool) http.Handler {
+	fs = noListingFileSystem{fs}
+	return &staticHandler{
+		fs:         fs,
+		fileServer: http.FileServer(fs),
+		spa:        spa,
+	}
+}
+
+func (h *staticHandler) ServeHTTP(rw http.ResponseWriter, req0 *http.Request) {
+	ExemptResponseSizeLimit(rw)
+
+	// Transform the request path to a path relative to the static filesystem
+	params := httptreemux.ContextParams(req0.Context())
+	filepath := path.Clean("/" + params["filepath"])
+
+	// Let the standard fileserver determine the content type from the file
+	// rather than using the negotiated one
+	rw.Header().Del(HeaderContentType)
+
+	// Single-page applications handle their own routing: serve the index
+	// file in place of anything that doesn't exist
+	if h.spa {
+		if f, err := h.fs.Open(filepath); err == nil {
+			_ = f.Close()
+		} else if os.IsNotExist(err) {
+			h.serveIndex(rw, req0)
+			return
+		}
+	}
+
+	// Delegate request handling to the standard fileserver
+	req1 := req0.WithContext(req0.Context())
+	url := *req0.URL
+	url.Path = filepath
+	req1.URL = &url
+	h.fileServer.ServeHTTP(rw, req1)
+}
+
+func (h *staticHandler) serveIndex(rw http.ResponseWriter, req *http.Request) {
+	// NB: http.FileServer redirects requests for index files, so serve the
+	// content directly
+	f, err := h.fs.Open(staticIndexFile)
+	if err != nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	http.ServeContent(rw, req, fi.Name(), fi.ModTime(), f)
+}
+
+// noListingFileSystem hides directories without an index file, so that the
+// standard fileserver doesn't list their contents.
+type noListingFileSystem struct {
+	http.FileSystem
+}
+
+func (fs noListingFileSystem) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		index, err := fs.FileSystem.Open(path.Join(name, staticIndexFile))
+		if err != nil {
+			_ = f.Close()
+			return nil, os.ErrNotExist
+		}
+		_ = index.Close()
+	}
+	return f, nil
+}
@@ -0,0 +1,91 @@
+package luddite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dimfeld/httptreemux"
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+const (
+	sampleIndexHtml = "<html><body>index</body></html>"
+	sampleAppJs     = "console.log('hello');"
+)
+
+func serveStatic(spa bool, filepath string) *httptest.ResponseRecorder {
+	fakeFS := httpfs.New(mapfs.New(map[string]string{
+		"index.html": sampleIndexHtml,
+		"js/app.js":  sampleAppJs,
+		"docs/a.txt": "a",
+	}))
+
+	ctx := httptreemux.AddParamsToContext(context.Background(), map[string]string{"filepath": filepath})
+	req, _ := http.NewRequest("GET", "/ui/"+filepath, nil)
+	req = req.WithContext(ctx)
+	rw := httptest.NewRecorder()
+	rw.Header().Set(HeaderContentType, ContentTypeJson)
+
+	s := newStaticHandler(fakeFS, spa)
+	s.ServeHTTP(rw, req)
+	return rw
+}
+
+func TestStaticHandler(t *testing.T) {
+	rw := serveStatic(false, "js/app.js")
+	if rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", rw.Code)
+	}
+	if ct := rw.Header().Get(HeaderContentType); ct == ContentTypeJson {
+		t.Errorf("negotiated content type was not replaced: %s", ct)
+	}
+	if body := rw.Body.String(); body != sampleAppJs {
+		t.Errorf("unexpected body, got: %s, expected: %s\n", body, sampleAppJs)
+	}
+
+	rw = serveStatic(false, "users/1234")
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found, got %d", rw.Code)
+	}
+
+	// Directories aren't listed
+	for _, dir := range []string{"docs/", "js/"} {
+		if rw = serveStatic(false, dir); rw.Code != http.StatusNotFound {
+			t.Errorf("expected 404/Not Found for %s, got %d: %s", dir, rw.Code, rw.Body.String())
+		}
+	}
+	if rw = serveStatic(false, "docs/a.txt"); rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", rw.Code)
+	}
+}
+
+func TestStaticURIPath(t *testing.T) {
+	for _, uriPath := range []string{"", "/", "//"} {
+		config := new(ServiceConfig)
+		config.Version.Min = 1
+		config.Version.Max = 1
+		config.Static.Enabled = true
+		config.Static.URIPath = uriPath
+		if _, err := NewService(config); err != ErrInvalidStaticURIPath {
+			t.Errorf("expected ErrInvalidStaticURIPath for %q, got %v", uriPath, err)
+		}
+	}
+}
+
+func TestStaticHandlerSPA(t *testing.T) {
+	rw := serveStatic(true, "users/1234")
+	if rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK, got %d", rw.Code)
+	}
+	if body := rw.Body.String(); body != sampleIndexHtml {
+		t.Errorf("unexpected body, got: %s, expected: %s\n", body, sampleIndexHtml)
+	}
+
+	rw = serveStatic(true, "js/app.js")
+	if body := rw.Body.String(); body != sampleAppJs {
+		t.Errorf("unexpected body, got: %s, expected: %s\n", body, sampleAppJs)
+	}
+}
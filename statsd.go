@@ -0,0 +1,126 @@
+package luddite
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MetricsBackendPrometheus = "prometheus"
+	MetricsBackendStatsD     = "statsd"
+
+	StatsDFormatStatsD    = "statsd"
+	StatsDFormatDogStatsD = "dogstatsd"
+
+	defaultStatsDAddr   = "127.0.0.1:8125"
+	defaultStatsDPrefix = "luddite."
+)
+
+// requestMetrics receives per-request measurements from ServeHTTP for a
+// metrics backend. The prometheus backend doesn't need one: its request
+// metrics are collected by prometheus.InstrumentHandler, which keeps their
+// established names.
+type requestMetrics interface {
+	requestStarted()
+	requestFinished(method, route string, status int, latency time.Duration)
+}
+
+// statsdMetrics emits request counts, latencies and in-flight gauges to a
+// StatsD or DogStatsD collector over UDP. Send errors are ignored: metrics
+// are best-effort and must never fail requests.
+type statsdMetrics struct {
+	conn     net.Conn
+	prefix   string
+	tags     bool
+	inFlight int64
+}
+
+func newStatsdMetrics(addr, prefix, format string) (*statsdMetrics, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdMetrics{
+		conn:   conn,
+		prefix: prefix,
+		tags:   format != StatsDFormatStatsD,
+	}, nil
+}
+
+func (m *statsdMetrics) requestStarted() {
+	m.send("requests_in_flight", strconv.FormatInt(atomic.AddInt64(&m.inFlight, 1), 10), "g", "")
+}
+
+func (m *statsdMetrics) requestFinished(method, route string, status int, latency time.Duration) {
+	var tags string
+	if m.tags {
+		tags = "method:" + statsdMethod(method) + ",route:" + statsdTagValue(route) + ",status:" + strconv.Itoa(status)
+	}
+	m.send("requests", "1", "c", tags)
+	m.send("request_latency_ms", strconv.FormatFloat(latency.Seconds()*1000, 'f', 3, 64), "ms", tags)
+	m.send("requests_in_flight", strconv.FormatInt(atomic.AddInt64(&m.inFlight, -1), 10), "g", "")
+}
+
+// send writes a single metric line, e.g. "luddite.requests:1|c|#status:200".
+func (m *statsdMetrics) send(name, value, kind, tags string) {
+	var b strings.Builder
+	b.Grow(len(m.prefix) + len(name) + len(value) + len(kind) + len(tags) + 4)
+	b.WriteString(m.prefix)
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+	if tags != "" {
+		b.WriteString("|#")
+		b.WriteString(tags)
+	}
+	_, _ = m.conn.Write([]byte(b.String()))
+}
+
+// statsdTagReplacer replaces characters that are reserved in DogStatsD tags.
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_")
+
+// statsdTagValue replaces characters that are reserved in DogStatsD tags.
+func statsdTagValue(v string) string {
+	return statsdTagReplacer.Replace(v)
+}
+
+// statsdMethod returns a request method for use as a tag. Method tokens may
+// contain reserved characters and are chosen by clients, so methods other than
+// the standard ones are reported as "other" to bound tag cardinality.
+func statsdMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// routePattern returns the path pattern of the global or API route that
+// serves a request, given its path segments and matched API route, e.g.
+// "/widgets/:seg1", to bound metric cardinality. Global routes have
+// preference, as in ServeHTTP. Requests that no known route matches are
+// reported as "other".
+func (s *Service) routePattern(segs []string, route *allowedRoute) string {
+	for _, t := range s.toggles() {
+		if !t.isEnabled() {
+			continue
+		}
+		if route := matchAllowedRoute(s.routerTable(t.router).load().allowed, segs); route != nil {
+			return route.path
+		}
+	}
+	if route := matchAllowedRoute(s.routerTable(s.globalRouter).load().allowed, segs); route != nil {
+		return route.path
+	}
+	if route != nil {
+		return route.path
+	}
+	return "other"
+}
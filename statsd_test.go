@@ -0,0 +1,72 @@
+package luddite
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsDMetrics(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Metrics.Enabled = true
+		config.Metrics.Backend = MetricsBackendStatsD
+		config.Metrics.StatsD.Addr = pc.LocalAddr().String()
+		config.Health.Enabled = true
+	})
+	if err = s.AddResource(1, "/widgets", &numberedResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.addHealthRoute() // as Run would
+
+	read := func(method, path string) []string {
+		req, _ := http.NewRequest(method, path, nil)
+		s.ServeHTTP(httptest.NewRecorder(), req)
+
+		var lines []string
+		buf := make([]byte, 1024)
+		for len(lines) < 4 {
+			_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("expected 4 metrics for %s %s, got %v: %v", method, path, lines, err)
+			}
+			lines = append(lines, string(buf[:n]))
+		}
+		return lines
+	}
+	lines := read("GET", "/widgets/42")
+
+	tags := "|#method:GET,route:/widgets/:seg1,status:200"
+	if lines[0] != "luddite.requests_in_flight:1|g" {
+		t.Errorf("unexpected in-flight gauge: %s", lines[0])
+	}
+	if lines[1] != "luddite.requests:1|c"+tags {
+		t.Errorf("unexpected request counter: %s", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "luddite.request_latency_ms:") || !strings.HasSuffix(lines[2], "|ms"+tags) {
+		t.Errorf("unexpected latency timer: %s", lines[2])
+	}
+	if lines[3] != "luddite.requests_in_flight:0|g" {
+		t.Errorf("unexpected in-flight gauge: %s", lines[3])
+	}
+
+	// Global routes are reported by pattern too
+	if lines = read("GET", "/health/ready"); !strings.Contains(lines[1], ",route:/health/ready,") {
+		t.Errorf("unexpected global route tags: %s", lines[1])
+	}
+
+	// Unknown methods can't inject tags
+	if lines = read("X|#a", "/widgets/42"); !strings.HasPrefix(lines[1], "luddite.requests:1|c|#method:other,route:") {
+		t.Errorf("unexpected tags for unknown method: %s", lines[1])
+	}
+}
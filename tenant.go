@@ -0,0 +1,43 @@
+package luddite
+
+import (
+	"context"
+	"net/http"
+)
+
+// TenantResolver resolves the tenant of an HTTP request, e.g. from its host,
+// path or a header. An empty string means the request has no tenant.
+type TenantResolver func(req *http.Request) string
+
+// TenantFromHeader returns a TenantResolver that uses a request header's value
+// as the tenant.
+func TenantFromHeader(header string) TenantResolver {
+	return func(req *http.Request) string {
+		return req.Header.Get(header)
+	}
+}
+
+// SetTenantResolver sets the function used to resolve each request's tenant
+// before it is dispatched to middleware handlers. The tenant is available to
+// handlers via ContextTenant and is included in access logs and traces.
+func (s *Service) SetTenantResolver(resolver TenantResolver) {
+	s.tenantResolver = resolver
+}
+
+// ContextTenant returns the current HTTP request's tenant from a
+// context.Context, if possible.
+func ContextTenant(ctx context.Context) (tenant string) {
+	if d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok {
+		tenant = d.tenant
+	}
+	return
+}
+
+// SetContextTenant sets the current HTTP request's tenant in a
+// context.Context. This may be used by middleware handlers that resolve the
+// tenant themselves, e.g. from an authenticated identity.
+func SetContextTenant(ctx context.Context, tenant string) {
+	if d, ok := ctx.Value(contextHandlerDetailsKey).(*handlerDetails); ok {
+		d.tenant = tenant
+	}
+}
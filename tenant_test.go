@@ -0,0 +1,55 @@
+package luddite
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type tenantResource struct {
+	tenant string
+}
+
+func (r *tenantResource) Get(req *http.Request) (int, interface{}) {
+	r.tenant = ContextTenant(req.Context())
+	return http.StatusOK, "ok"
+}
+
+func TestTenantResolver(t *testing.T) {
+	s := newTestService(t, nil)
+	var logs bytes.Buffer
+	s.accessLogger.Out = &logs
+	s.accessLogger.Formatter = &log.JSONFormatter{}
+	s.SetTenantResolver(TenantFromHeader("X-Tenant"))
+	tenants := &tenantResource{}
+	if err := s.AddResource(1, "/tenants", tenants); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/tenants", nil)
+	req.Header.Set("X-Tenant", "acme")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if tenants.tenant != "acme" {
+		t.Errorf("expected tenant acme, got %q", tenants.tenant)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["tenant"] != "acme" {
+		t.Errorf("expected tenant acme in access log, got %v", fields["tenant"])
+	}
+
+	// Middleware may override the resolved tenant
+	s.AddHandler(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		SetContextTenant(req.Context(), "globex")
+	}))
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if tenants.tenant != "globex" {
+		t.Errorf("expected tenant globex, got %q", tenants.tenant)
+	}
+}
@@ -12,6 +12,7 @@ func TestDispatch(rw http.ResponseWriter, req *http.Request, h http.Handler) {
 	s := &Service{
 		config:        new(ServiceConfig),
 		defaultLogger: log.New(),
+		clock:         realClock{},
 	}
 
 	res := responseWriterPool.Get().(*responseWriter)
@@ -22,6 +23,8 @@ func TestDispatch(rw http.ResponseWriter, req *http.Request, h http.Handler) {
 		s:          s,
 		rw:         res,
 		request:    req,
+		sessionId:  req.Header.Get(HeaderSessionId),
+		start:      s.clock.Now(),
 		apiVersion: 1,
 	}
 
@@ -0,0 +1,265 @@
+package luddite
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TimeFormatRFC3339   = "rfc3339"
+	TimeFormatUnix      = "unix"
+	TimeFormatUnixMilli = "unixmilli"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	// timeTypesCache maps types to whether their values may contain times.
+	timeTypesCache sync.Map
+)
+
+// validTimeFormat returns true for the named time formats and for layouts
+// that contain at least one layout element.
+func validTimeFormat(format string) bool {
+	switch format {
+	case TimeFormatRFC3339, TimeFormatUnix, TimeFormatUnixMilli:
+		return true
+	}
+	return time.Unix(0, 0).UTC().Format(format) != format
+}
+
+// formatJSONTime encodes a time as a JSON value in a time format: a number for
+// "unix" and "unixmilli", otherwise a string formatted using the layout.
+func formatJSONTime(t time.Time, format string) ([]byte, error) {
+	switch format {
+	case TimeFormatUnix:
+		return []byte(strconv.FormatInt(t.Unix(), 10)), nil
+	case TimeFormatUnixMilli:
+		return []byte(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)), nil
+	}
+	return json.Marshal(t.Format(format))
+}
+
+// parseJSONTime decodes a JSON value in a time format.
+func parseJSONTime(b []byte, format string) (time.Time, error) {
+	switch format {
+	case TimeFormatUnix, TimeFormatUnixMilli:
+		n, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			return time.Time{}, &json.UnmarshalTypeError{Value: string(b), Type: timeType}
+		}
+		if format == TimeFormatUnix {
+			return time.Unix(n, 0), nil
+		}
+		return time.Unix(0, n*int64(time.Millisecond)), nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return time.Time{}, &json.UnmarshalTypeError{Value: string(b), Type: timeType}
+	}
+	return time.Parse(format, s)
+}
+
+// mayContainTime returns true if values of a type may contain times that
+// encoding/json serializes itself, i.e. not within custom marshalers.
+// Interfaces may contain anything.
+func mayContainTime(t reflect.Type) bool {
+	if v, ok := timeTypesCache.Load(t); ok {
+		return v.(bool)
+	}
+	may := typeMayContainTime(t, make(map[reflect.Type]bool))
+	timeTypesCache.Store(t, may)
+	return may
+}
+
+func typeMayContainTime(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if t == timeType || t.Kind() == reflect.Interface {
+		return true
+	}
+	// NB: Recursive types contain times elsewhere if at all
+	if visiting[t] || hasCustomMarshaler(t) {
+		return false
+	}
+	visiting[t] = true
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return typeMayContainTime(t.Elem(), visiting)
+	case reflect.Struct:
+		for _, f := range jsonFields(t, identityFieldName) {
+			if typeMayContainTime(f.typ, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasCustomMarshaler(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	return pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType)
+}
+
+func identityFieldName(s string) string {
+	return s
+}
+
+// formatJSONTimes rewrites the times within a compact JSON encoding of v, which
+// encoding/json formats as RFC 3339 strings, in a time format. Values are
+// matched to the document by their JSON field names, so this must happen
+// before field names are transformed.
+func formatJSONTimes(b []byte, v reflect.Value, format string, escapeHTML bool) ([]byte, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return b, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return b, nil
+	}
+	t := v.Type()
+	if t == timeType {
+		return formatJSONTime(v.Interface().(time.Time), format)
+	}
+	if !mayContainTime(t) {
+		return b, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFields(t, identityFieldName)
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			f, ok := fields[key]
+			if !ok {
+				return key, elem, nil
+			}
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok {
+				return key, elem, nil
+			}
+			elem, err := formatJSONTimes(elem, fv, format, escapeHTML)
+			return key, elem, err
+		}, escapeHTML)
+	case reflect.Map:
+		values := make(map[string]reflect.Value, v.Len())
+		for _, k := range v.MapKeys() {
+			if name, ok := jsonMapKey(k); ok {
+				values[name] = v.MapIndex(k)
+			}
+		}
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			mv, ok := values[key]
+			if !ok {
+				return key, elem, nil
+			}
+			elem, err := formatJSONTimes(elem, mv, format, escapeHTML)
+			return key, elem, err
+		}, escapeHTML)
+	case reflect.Slice, reflect.Array:
+		i := 0
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			if i >= v.Len() {
+				return key, elem, nil
+			}
+			elem, err := formatJSONTimes(elem, v.Index(i), format, escapeHTML)
+			i++
+			return key, elem, err
+		}, escapeHTML)
+	}
+	return b, nil
+}
+
+// parseJSONTimes reverses formatJSONTimes for a request body that is decoded
+// into a value of type t: times in a time format are replaced with RFC 3339
+// strings. Values decoded into interfaces are left as they are.
+func parseJSONTimes(b []byte, t reflect.Type, format string) ([]byte, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() == reflect.Interface {
+		return b, nil
+	}
+	if t == timeType {
+		if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+			return b, nil
+		}
+		tm, err := parseJSONTime(bytes.TrimSpace(b), format)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(tm)
+	}
+	if !mayContainTime(t) || reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return b, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFields(t, identityFieldName)
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			f, ok := fields[key]
+			if !ok {
+				// NB: encoding/json matches keys case-insensitively
+				for name, field := range fields {
+					if strings.EqualFold(name, key) {
+						f, ok = field, true
+						break
+					}
+				}
+				if !ok {
+					return key, elem, nil
+				}
+			}
+			elem, err := parseJSONTimes(elem, f.typ, format)
+			return key, elem, err
+		}, false)
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return rewriteJSONObjects(b, func(key string, elem json.RawMessage) (string, json.RawMessage, error) {
+			elem, err := parseJSONTimes(elem, t.Elem(), format)
+			return key, elem, err
+		}, false)
+	}
+	return b, nil
+}
+
+// fieldByIndex returns a struct's (possibly promoted) field, or false if an
+// embedded struct pointer on the way is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// jsonMapKey returns the JSON object key of a map key, as encoding/json would
+// encode it.
+func jsonMapKey(k reflect.Value) (string, bool) {
+	if k.Kind() == reflect.String {
+		return k.String(), true
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		b, err := tm.MarshalText()
+		return string(b), err == nil
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), true
+	}
+	return "", false
+}
@@ -0,0 +1,164 @@
+package luddite
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type timedEvent struct {
+	EventID  string
+	At       time.Time
+	Ended    *time.Time
+	Missing  *time.Time
+	History  []time.Time
+	Marks    map[string]time.Time
+	Extra    interface{}
+	Children []timedEvent
+}
+
+type timedResource struct {
+	created *timedEvent
+}
+
+func (r *timedResource) New() interface{} {
+	return new(timedEvent)
+}
+
+func (r *timedResource) Id(value interface{}) string {
+	return value.(*timedEvent).EventID
+}
+
+func (r *timedResource) Create(req *http.Request, value interface{}) (int, interface{}) {
+	r.created = value.(*timedEvent)
+	return http.StatusCreated, value
+}
+
+func (r *timedResource) List(req *http.Request) (int, interface{}) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	ended := at.Add(time.Second)
+	return http.StatusOK, []*timedEvent{{
+		EventID:  "1",
+		At:       at,
+		Ended:    &ended,
+		History:  []time.Time{at},
+		Marks:    map[string]time.Time{"start": at},
+		Extra:    at,
+		Children: []timedEvent{{EventID: "2", At: ended}},
+	}}
+}
+
+func newTimedService(t *testing.T, format string) (*Service, *timedResource) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Response.TimeFormat = format
+		config.Response.FieldNameStyle = FieldNameStyleSnake
+	})
+	r := &timedResource{}
+	if err := s.AddResource(1, "/events", r); err != nil {
+		t.Fatal(err)
+	}
+	return s, r
+}
+
+func TestTimeFormatResponse(t *testing.T) {
+	for _, c := range []struct {
+		format, at, ended, child string
+	}{
+		{
+			TimeFormatRFC3339,
+			`"2020-01-02T03:04:05.6Z"`,
+			`"2020-01-02T03:04:06.6Z"`,
+			`"2020-01-02T03:04:06.6Z"`,
+		},
+		{
+			TimeFormatUnix,
+			`1577934245`,
+			`1577934246`,
+			`1577934246`,
+		},
+		{
+			TimeFormatUnixMilli,
+			`1577934245600`,
+			`1577934246600`,
+			`1577934246600`,
+		},
+		{
+			"2006-01-02 15:04:05",
+			`"2020-01-02 03:04:05"`,
+			`"2020-01-02 03:04:06"`,
+			`"2020-01-02 03:04:06"`,
+		},
+	} {
+		s, _ := newTimedService(t, c.format)
+		req, _ := http.NewRequest("GET", "/events", nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("expected 200/OK, got %d: %s", rw.Code, rw.Body.String())
+		}
+		expected := `[{"event_id":"1","at":` + c.at + `,"ended":` + c.ended + `,"missing":null,"history":[` + c.at + `],"marks":{"start":` + c.at + `},"extra":` + c.at +
+			`,"children":[{"event_id":"2","at":` + c.child + `,"ended":null,"missing":null,"history":null,"marks":null,"extra":null,"children":null}]}]`
+		if rw.Body.String() != expected {
+			t.Errorf("expected %s response %s, got %s", c.format, expected, rw.Body.String())
+		}
+	}
+}
+
+func TestTimeFormatRequest(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, c := range []struct {
+		format, at string
+	}{
+		{TimeFormatRFC3339, `"2020-01-02T03:04:05Z"`},
+		{TimeFormatUnix, `1577934245`},
+		{TimeFormatUnixMilli, `1577934245000`},
+		{"2006-01-02 15:04:05", `"2020-01-02 03:04:05"`},
+	} {
+		s, r := newTimedService(t, c.format)
+		body := `{"event_id":"1","at":` + c.at + `,"ended":null,"history":[` + c.at + `],"marks":{"start":` + c.at + `},"extra":` + c.at + `,"children":[{"at":` + c.at + `}]}`
+		req, _ := http.NewRequest("POST", "/events", bytes.NewBufferString(body))
+		req.Header.Set(HeaderContentType, ContentTypeJson)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		if rw.Code != http.StatusCreated {
+			t.Fatalf("expected 201/Created for %s, got %d: %s", c.format, rw.Code, rw.Body.String())
+		}
+		e := r.created
+		if !e.At.Equal(at) || e.Ended != nil || len(e.History) != 1 || !e.History[0].Equal(at) || !e.Marks["start"].Equal(at) || len(e.Children) != 1 || !e.Children[0].At.Equal(at) {
+			t.Errorf("expected %s times to be decoded, got %+v", c.format, e)
+		}
+
+		// Values decoded into interfaces are left as they are
+		if _, ok := e.Extra.(time.Time); ok {
+			t.Errorf("expected %s time in interface to be left undecoded, got %v", c.format, e.Extra)
+		}
+	}
+
+	// Times in another format are rejected
+	s, _ := newTimedService(t, TimeFormatUnix)
+	req, _ := http.NewRequest("POST", "/events", bytes.NewBufferString(`{"at":"2020-01-02T03:04:05Z"}`))
+	req.Header.Set(HeaderContentType, ContentTypeJson)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("expected 400/Bad Request, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
+
+func TestTimeFormatInvalid(t *testing.T) {
+	for _, format := range []string{"rfc3339", "unix", "unixmilli", "2006-01-02", time.Kitchen} {
+		if !validTimeFormat(format) {
+			t.Errorf("expected %q to be a valid time format", format)
+		}
+	}
+
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.Response.TimeFormat = "iso"
+	if _, err := NewService(config); err != ErrInvalidTimeFormat {
+		t.Errorf("expected ErrInvalidTimeFormat, got %v", err)
+	}
+}
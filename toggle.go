@@ -0,0 +1,79 @@
+package luddite
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+// routeToggle gates a group of optional global routes that may be enabled
+// and disabled at runtime. The routes are added to the toggle's own router
+// when the service is created, so that enabling them doesn't add routes to a
+// router that is serving requests, and the router is only consulted while
+// the toggle is enabled. Requests for disabled routes are served as though
+// the routes didn't exist, typically with 404 Not Found.
+type routeToggle struct {
+	enabled int32
+	router  *httptreemux.ContextMux
+}
+
+func newRouteToggle(s *Service, add func(router *httptreemux.ContextMux)) routeToggle {
+	router := s.newRouter(0)
+	if s.config.Response.AutoOptions {
+		router.OptionsHandler = s.routerOptionsHandler(router)
+	}
+	add(router)
+	return routeToggle{router: router}
+}
+
+func (t *routeToggle) isEnabled() bool {
+	return atomic.LoadInt32(&t.enabled) != 0
+}
+
+func (t *routeToggle) set(enable bool) {
+	var v int32
+	if enable {
+		v = 1
+	}
+	atomic.StoreInt32(&t.enabled, v)
+}
+
+// toggles returns the service's route toggles.
+func (s *Service) toggles() []*routeToggle {
+	return []*routeToggle{&s.metricsToggle, &s.profilerToggle}
+}
+
+// serveToggledRoute serves a request using the enabled route toggles' routers
+// and reports whether one of them had a matching route.
+func (s *Service) serveToggledRoute(rw http.ResponseWriter, req *http.Request) bool {
+	for _, t := range s.toggles() {
+		if !t.isEnabled() {
+			continue
+		}
+		if lr, ok := t.router.Lookup(nil, req); ok {
+			t.router.ServeLookupResult(rw, req, lr)
+			return true
+		}
+	}
+	return false
+}
+
+// EnableMetrics enables or disables the service's metrics route at runtime,
+// e.g. to reduce its debug surface area during an incident. It is safe to
+// call while the service is running. The route uses the configured metrics
+// path (by default "/metrics") and isn't served while disabled. Metrics are
+// collected whether or not the route is enabled, but luddite only registers
+// its own metrics when metrics are enabled in the service's config, so
+// otherwise the route serves just the default registry's collectors.
+func (s *Service) EnableMetrics(enable bool) {
+	s.metricsToggle.set(enable)
+}
+
+// EnableProfiler enables or disables the service's profiling routes at
+// runtime. It is safe to call while the service is running. The routes use the
+// configured profiler path (by default "/debug/pprof") and aren't served while
+// disabled.
+func (s *Service) EnableProfiler(enable bool) {
+	s.profilerToggle.set(enable)
+}
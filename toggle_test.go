@@ -0,0 +1,72 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestEnableRoutes(t *testing.T) {
+	s := newTestService(t, nil)
+	serve := func(path string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	if code := serve("/metrics"); code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found before enabling metrics, got %d", code)
+	}
+
+	// Toggle routes while requests are being served
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				serve("/debug/pprof/cmdline")
+			}
+		}()
+	}
+	s.EnableMetrics(true)
+	s.EnableProfiler(true)
+	wg.Wait()
+
+	if code := serve("/metrics"); code != http.StatusOK {
+		t.Errorf("expected 200/OK once metrics are enabled, got %d", code)
+	}
+	if code := serve("/debug/pprof/cmdline"); code != http.StatusOK {
+		t.Errorf("expected 200/OK once the profiler is enabled, got %d", code)
+	}
+
+	s.EnableMetrics(false)
+	s.EnableProfiler(false)
+	if code := serve("/metrics"); code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found once metrics are disabled, got %d", code)
+	}
+	if code := serve("/debug/pprof/cmdline"); code != http.StatusNotFound {
+		t.Errorf("expected 404/Not Found once the profiler is disabled, got %d", code)
+	}
+
+	for _, route := range s.Routes() {
+		if route.Path == "/metrics" {
+			t.Error("expected disabled metrics route to be omitted from routes")
+		}
+	}
+
+	// Re-enabling doesn't register the routes again
+	s.EnableMetrics(true)
+	if code := serve("/metrics"); code != http.StatusOK {
+		t.Errorf("expected 200/OK once metrics are re-enabled, got %d", code)
+	}
+	var listed bool
+	for _, route := range s.Routes() {
+		listed = listed || route.Path == "/metrics"
+	}
+	if !listed {
+		t.Error("expected enabled metrics route to be listed in routes")
+	}
+}
@@ -1,9 +1,21 @@
 package luddite
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/SpirentOrion/trace.v2"
 	"gopkg.in/yaml.v2"
 )
@@ -13,9 +25,78 @@ const (
 	TraceKindProcess = "process"
 	TraceKindRequest = "request"
 	TraceKindWorker  = "worker"
+
+	TraceOverflowBlock = "block"
+	TraceOverflowDrop  = "drop"
 )
 
-var recorders = make(map[string]trace.Recorder)
+var (
+	// ErrNoTraceRecorders occurs when tracing is required but no trace
+	// recorders are configured.
+	ErrNoTraceRecorders = errors.New("trace recording is required but no trace recorders are configured")
+
+	recorders = make(map[string]trace.Recorder)
+
+	traceSpansDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "trace",
+		Name:      "spans_dropped_total",
+		Help:      "Number of trace spans dropped because the trace recorder fell behind.",
+	})
+
+	traceSpansEnqueued = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "trace",
+		Name:      "spans_enqueued_total",
+		Help:      "Number of trace spans queued for the trace recorder.",
+	})
+
+	traceSpansFlushed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "trace",
+		Name:      "spans_flushed_total",
+		Help:      "Number of queued trace spans handed to the trace recorder.",
+	})
+
+	// traceQueues holds the open queued recorders, whose lengths make up the
+	// queue depth.
+	traceQueues sync.Map
+
+	traceQueueDepth = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "luddite",
+		Subsystem: "trace",
+		Name:      "queue_depth",
+		Help:      "Number of trace spans queued for the trace recorder.",
+	}, func() float64 {
+		var depth int
+		traceQueues.Range(func(q, _ interface{}) bool {
+			depth += len(q.(*queuedRecorder).spans)
+			return true
+		})
+		return float64(depth)
+	})
+
+	traceQueueHighWater = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "trace",
+		Name:      "queue_high_water_total",
+		Help:      "Number of times the trace span queue reached its high water mark.",
+	})
+
+	traceSpansSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "trace",
+		Name:      "spans_skipped_total",
+		Help:      "Number of requests served without trace spans because too many spans were in flight.",
+	})
+
+	traceRecorderErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "trace",
+		Name:      "recorder_errors_total",
+		Help:      "Number of trace recorder failures by recorder.",
+	}, []string{"recorder"})
+)
 
 func RegisterTraceRecorder(name string, recorder trace.Recorder) {
 	if name == "" {
@@ -30,6 +111,412 @@ func RegisterTraceRecorder(name string, recorder trace.Recorder) {
 	recorders[name] = recorder
 }
 
+// acquireTraceSpan returns true if a request may be traced, i.e. the number of
+// requests traced at once is below the configured maximum. Callers that get
+// true must later call releaseTraceSpan.
+func (s *Service) acquireTraceSpan() bool {
+	max := int32(s.config.Trace.MaxSpans)
+	if max <= 0 {
+		return true
+	}
+	if atomic.AddInt32(&s.traceSpans, 1) > max {
+		atomic.AddInt32(&s.traceSpans, -1)
+		traceSpansSkipped.Inc()
+		return false
+	}
+	return true
+}
+
+func (s *Service) releaseTraceSpan() {
+	if s.config.Trace.MaxSpans > 0 {
+		atomic.AddInt32(&s.traceSpans, -1)
+	}
+}
+
+// PropagateTraceHeaders prepares an outbound request to another service so
+// that it continues the current trace and session. The X-Request-Id header is
+// set in the "traceId:parentId" form when a trace span is active in ctx, or
+// to the current request ID otherwise. The X-Session-Id header is set when the
+// current request has a session ID.
+func PropagateTraceHeaders(ctx context.Context, outReq *http.Request) {
+	if traceId, spanId := trace.CurrentTraceID(ctx), trace.CurrentSpanID(ctx); traceId > 0 && spanId > 0 {
+		outReq.Header.Set(HeaderRequestId, strconv.FormatInt(traceId, 10)+":"+strconv.FormatInt(spanId, 10))
+	} else if requestId := ContextRequestId(ctx); requestId != "" {
+		outReq.Header.Set(HeaderRequestId, requestId)
+	}
+	if sessionId := ContextSessionId(ctx); sessionId != "" {
+		outReq.Header.Set(HeaderSessionId, sessionId)
+	}
+}
+
+// traceCorrelationIds returns the current trace and span ids in the
+// zero-padded hex form of W3C Trace Context (32 and 16 digits), for
+// correlating logs with tracing backends. ok is false when no trace span is
+// active in ctx.
+func traceCorrelationIds(ctx context.Context) (traceId, spanId string, ok bool) {
+	t, sp := trace.CurrentTraceID(ctx), trace.CurrentSpanID(ctx)
+	if t <= 0 || sp <= 0 {
+		return "", "", false
+	}
+	return fmt.Sprintf("%032x", t), fmt.Sprintf("%016x", sp), true
+}
+
+// ContextTraceAnnotate returns the annotations of the current trace span from
+// a context.Context, e.g. for handlers to record a query count or cache hit.
+// When tracing is disabled it returns a throwaway map, so callers needn't
+// check.
+func ContextTraceAnnotate(ctx context.Context) map[string]interface{} {
+	if data := trace.Annotate(ctx); data != nil {
+		return data
+	}
+	return make(map[string]interface{})
+}
+
+// ContextStartChildSpan starts a trace span for a sub-operation of the current
+// span, e.g. a database query within a request. It returns a context that
+// represents the child span, which may be annotated using
+// ContextTraceAnnotate, and a function that finishes the span. Calling the
+// finish function again does nothing. If ctx is done first, e.g. because the
+// request was canceled, the span is finished then; otherwise the span stays
+// open until finish is called, so it must be called eventually. When tracing
+// is disabled the original context and a no-op finish function are returned.
+func ContextStartChildSpan(ctx context.Context, kind, name string) (context.Context, func()) {
+	if trace.CurrentSpanID(ctx) == 0 {
+		return ctx, func() {}
+	}
+
+	// trace.Do finishes the span when its activity function returns, so the
+	// span is kept open in another goroutine until finish is called. Waiting on
+	// ctx too keeps spans whose finish is never called from leaking it.
+	started := make(chan context.Context)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		trace.Do(ctx, kind, name, func(childCtx context.Context) {
+			started <- childCtx
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	var once sync.Once
+	return <-started, func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
+
+// SpanNamer names the trace span of an HTTP request.
+type SpanNamer func(req *http.Request) string
+
+// SetSpanNamer sets the function used to name requests' trace spans. By
+// default spans are named after the pattern of the resource route that serves
+// the request (e.g. "/widgets/:seg1"), so that traces aggregate by operation
+// rather than by resource id, falling back to the raw request path.
+func (s *Service) SetSpanNamer(namer SpanNamer) {
+	s.spanNamer = namer
+}
+
+// spanName names a request's trace span, given the API route that serves it.
+func (s *Service) spanName(req *http.Request, route *allowedRoute) string {
+	if s.spanNamer != nil {
+		return s.spanNamer(req)
+	}
+	if route != nil {
+		return "/" + strings.Join(route.segs, "/")
+	}
+	return req.URL.Path
+}
+
+// IDGenerator generates positive trace (and request) IDs.
+type IDGenerator func(ctx context.Context) (int64, error)
+
+// newNodeIDGenerator returns an IDGenerator that reserves the most significant
+// bits of each ID for a node (e.g. region) number, making IDs unique across
+// nodes and identifiable by node.
+func newNodeIDGenerator(node, bits int) IDGenerator {
+	shift := uint(63 - bits)
+	prefix := int64(node) << shift
+	mask := int64(1)<<shift - 1
+	return func(ctx context.Context) (int64, error) {
+		id, err := trace.GenerateID(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return prefix | id&mask, nil
+	}
+}
+
+// traceFlusher may be implemented by registered trace recorders that buffer
+// their output. Flush is invoked periodically when a flush interval is
+// configured.
+type traceFlusher interface {
+	Flush() error
+}
+
+// queuedRecorder decouples the trace package's dispatch goroutine from the
+// underlying recorder. Spans are queued and written by a dedicated goroutine
+// which also periodically flushes buffered output. When the queue is full,
+// spans either wait for space (block) or are discarded and counted (drop).
+// When a high water mark is set, reaching it is logged and counted, and the
+// drop policy discards spans from then on rather than once the queue is full.
+//
+// NB: Request handling never blocks on trace recording: the trace package
+// itself discards spans when its own buffer is full. The block policy applies
+// backpressure to that buffer whereas the drop policy keeps it drained.
+//
+// Close stops the goroutine once the queued spans are recorded and flushes
+// buffered output. Spans recorded after that are discarded.
+type queuedRecorder struct {
+	rec       trace.Recorder
+	flush     func() error
+	spans     chan *trace.Span
+	drop      bool
+	highWater int
+	backedUp  int32
+	logger    *log.Logger
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+func newQueuedRecorder(rec trace.Recorder, flush func() error, size, highWater int, policy string, flushInterval time.Duration, logger *log.Logger) *queuedRecorder {
+	if size < 1 {
+		size = 1
+	}
+	if highWater > size {
+		highWater = size
+	}
+	q := &queuedRecorder{
+		rec:       rec,
+		spans:     make(chan *trace.Span, size),
+		drop:      policy == TraceOverflowDrop,
+		highWater: highWater,
+		logger:    logger,
+		flush:     flush,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	traceQueues.Store(q, struct{}{})
+	go q.run(flushInterval)
+	return q
+}
+
+func (q *queuedRecorder) registerMetrics() {
+	// NB: Multiple services may share the default registry
+	_ = prometheus.Register(traceSpansDropped)
+	_ = prometheus.Register(traceSpansEnqueued)
+	_ = prometheus.Register(traceSpansFlushed)
+	_ = prometheus.Register(traceQueueDepth)
+	_ = prometheus.Register(traceQueueHighWater)
+	_ = prometheus.Register(traceSpansSkipped)
+	_ = prometheus.Register(traceRecorderErrors)
+}
+
+func (q *queuedRecorder) Record(s *trace.Span) error {
+	if q.drop {
+		if q.highWater > 0 && len(q.spans) >= q.highWater {
+			q.reachedHighWater()
+			traceSpansDropped.Inc()
+			return nil
+		}
+		select {
+		case <-q.stop:
+			return nil
+		default:
+		}
+		select {
+		case q.spans <- s:
+		default:
+			traceSpansDropped.Inc()
+			return nil
+		}
+	} else {
+		select {
+		case q.spans <- s:
+		case <-q.stop:
+			return nil
+		}
+	}
+	traceSpansEnqueued.Inc()
+	if q.highWater > 0 && len(q.spans) >= q.highWater {
+		q.reachedHighWater()
+	}
+	return nil
+}
+
+// reachedHighWater logs and counts the queue reaching its high water mark,
+// once until it drains to half of the mark.
+func (q *queuedRecorder) reachedHighWater() {
+	if atomic.CompareAndSwapInt32(&q.backedUp, 0, 1) {
+		traceQueueHighWater.Inc()
+		q.logger.Warnf("trace: recorder is falling behind: %d spans queued", q.highWater)
+	}
+}
+
+// Close records the queued spans, flushes buffered output and stops the
+// recorder's goroutine.
+func (q *queuedRecorder) Close() error {
+	q.stopOnce.Do(func() { close(q.stop) })
+	<-q.done
+	traceQueues.Delete(q)
+	return nil
+}
+
+func (q *queuedRecorder) run(flushInterval time.Duration) {
+	defer close(q.done)
+	var flushes <-chan time.Time
+	if q.flush != nil && flushInterval > 0 {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		flushes = ticker.C
+	}
+	for {
+		select {
+		case s := <-q.spans:
+			q.record(s)
+		case <-flushes:
+			q.flushOutput()
+		case <-q.stop:
+			for {
+				select {
+				case s := <-q.spans:
+					q.record(s)
+				default:
+					q.flushOutput()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (q *queuedRecorder) record(s *trace.Span) {
+	if err := q.rec.Record(s); err != nil {
+		q.logger.Warnf("trace: failed to record trace %x span %x: %s", s.TraceID, s.SpanID, err)
+	}
+	traceSpansFlushed.Inc()
+	if q.highWater > 0 && len(q.spans) <= q.highWater/2 {
+		atomic.StoreInt32(&q.backedUp, 0)
+	}
+}
+
+func (q *queuedRecorder) flushOutput() {
+	if q.flush == nil {
+		return
+	}
+	if err := q.flush(); err != nil {
+		q.logger.Warn("trace: failed to flush trace recorder: ", err)
+	}
+}
+
+// openTraceRecorder returns the named trace recorder along with a function that
+// flushes its output (if any). JSON, YAML and memory recorders are
+// automatically created if they are not otherwise registered. Their "path"
+// parameter may be given per recorder, e.g. "json.path", to allow both to be
+// used at once.
+func (s *Service) openTraceRecorder(name string) (rec trace.Recorder, flush func() error, err error) {
+	config := s.config
+	if rec = recorders[name]; rec != nil {
+		if f, ok := rec.(traceFlusher); ok {
+			flush = f.Flush
+		}
+		return
+	}
+
+	p := config.Trace.Params[name+".path"]
+	if p == "" {
+		p = config.Trace.Params["path"]
+	}
+
+	var w io.Writer
+	switch name {
+	case "json":
+		if p == "" {
+			err = errors.New("JSON trace recorders require a 'path' parameter")
+			return
+		}
+		if w, flush, err = openTraceFile(p, config.Trace.FlushInterval > 0); err == nil {
+			rec = trace.NewJSONRecorder(w)
+		}
+	case "yaml":
+		if p == "" {
+			err = errors.New("YAML trace recorders require a 'path' parameter")
+			return
+		}
+		if w, flush, err = openTraceFile(p, config.Trace.FlushInterval > 0); err == nil {
+			rec = &yamlRecorder{w}
+		}
+	case "memory":
+		rec = s.openMemoryRecorder()
+	default:
+		err = fmt.Errorf("unknown trace recorder: %s", name)
+	}
+	return
+}
+
+// fanoutRecorder records each span using several recorders. A failure in one
+// recorder is logged and counted but doesn't prevent the others from recording.
+type fanoutRecorder struct {
+	recorders []namedRecorder
+	logger    *log.Logger
+}
+
+type namedRecorder struct {
+	name  string
+	rec   trace.Recorder
+	flush func() error
+}
+
+func newFanoutRecorder(logger *log.Logger) *fanoutRecorder {
+	return &fanoutRecorder{logger: logger}
+}
+
+func (f *fanoutRecorder) add(name string, rec trace.Recorder, flush func() error) {
+	f.recorders = append(f.recorders, namedRecorder{name, rec, flush})
+}
+
+func (f *fanoutRecorder) Record(s *trace.Span) error {
+	for _, r := range f.recorders {
+		if err := r.rec.Record(s); err != nil {
+			traceRecorderErrors.WithLabelValues(r.name).Inc()
+			f.logger.Warnf("trace: %s recorder failed to record trace %x span %x: %s", r.name, s.TraceID, s.SpanID, err)
+		}
+	}
+	return nil
+}
+
+func (f *fanoutRecorder) Flush() error {
+	for _, r := range f.recorders {
+		if r.flush == nil {
+			continue
+		}
+		if err := r.flush(); err != nil {
+			traceRecorderErrors.WithLabelValues(r.name).Inc()
+			f.logger.Warnf("trace: %s recorder failed to flush: %s", r.name, err)
+		}
+	}
+	return nil
+}
+
+// openTraceFile opens a trace file for appending. If buffered is true then
+// writes are buffered and a flush function is also returned.
+func openTraceFile(path string, buffered bool) (io.Writer, func() error, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !buffered {
+		return f, nil, nil
+	}
+	w := bufio.NewWriter(f)
+	return w, w.Flush, nil
+}
+
 // yamlRecorder is included in luddite for backwards compatibility with v1 of
 // github.com/SpirentOrion/trace since v2 of that package no longer supports
 // YAML directly.
@@ -0,0 +1,465 @@
+package luddite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/SpirentOrion/trace.v2"
+)
+
+type discardRecorder struct{}
+
+func (r *discardRecorder) Record(s *trace.Span) error {
+	return nil
+}
+
+func TestPropagateTraceHeaders(t *testing.T) {
+	// W/o an active trace span the request ID is propagated
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderSessionId, "session")
+	rw := httptest.NewRecorder()
+	TestDispatch(rw, req, http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		contextHandlerDetails(req.Context()).requestId = "1234"
+		outReq, _ := http.NewRequest("GET", "http://other/", nil)
+		PropagateTraceHeaders(req.Context(), outReq)
+		if id := outReq.Header.Get(HeaderRequestId); id != "1234" {
+			t.Errorf("unexpected %s header: %s", HeaderRequestId, id)
+		}
+		if id := outReq.Header.Get(HeaderSessionId); id != "session" {
+			t.Errorf("unexpected %s header: %s", HeaderSessionId, id)
+		}
+	}))
+
+	// W/ an active trace span the trace and span IDs are propagated
+	ctx, err := trace.Record(context.Background(), &discardRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = trace.WithTraceID(ctx, 42)
+	trace.Do(ctx, TraceKindRequest, "/", func(ctx context.Context) {
+		outReq, _ := http.NewRequest("GET", "http://other/", nil)
+		PropagateTraceHeaders(ctx, outReq)
+		expected := fmt.Sprintf("42:%d", trace.CurrentSpanID(ctx))
+		if id := outReq.Header.Get(HeaderRequestId); id != expected {
+			t.Errorf("unexpected %s header: %s, expected: %s", HeaderRequestId, id, expected)
+		}
+	})
+}
+
+type failingRecorder struct{}
+
+func (r *failingRecorder) Record(s *trace.Span) error {
+	return errors.New("recorder failure")
+}
+
+type countingRecorder struct {
+	count int
+}
+
+func (r *countingRecorder) Record(s *trace.Span) error {
+	r.count++
+	return nil
+}
+
+func TestFanoutRecorder(t *testing.T) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	counter := &countingRecorder{}
+	f := newFanoutRecorder(logger)
+	f.add("failing", &failingRecorder{}, nil)
+	f.add("counting", counter, nil)
+
+	if err := f.Record(&trace.Span{}); err != nil {
+		t.Fatal(err)
+	}
+	if counter.count != 1 {
+		t.Error("recorder failure prevented other recorders from recording")
+	}
+}
+
+type stalledRecorder struct {
+	received chan *trace.Span
+	release  chan struct{}
+}
+
+func (r *stalledRecorder) Record(s *trace.Span) error {
+	r.received <- s
+	<-r.release
+	return nil
+}
+
+func TestQueuedRecorderHighWater(t *testing.T) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	enqueued := testutil.ToFloat64(traceSpansEnqueued)
+	flushed := testutil.ToFloat64(traceSpansFlushed)
+	dropped := testutil.ToFloat64(traceSpansDropped)
+	highWater := testutil.ToFloat64(traceQueueHighWater)
+
+	rec := &stalledRecorder{received: make(chan *trace.Span, 4), release: make(chan struct{})}
+	q := newQueuedRecorder(rec, nil, 4, 2, TraceOverflowDrop, 0, logger)
+	defer q.Close()
+
+	// The first span stalls the recorder, the next two reach the high water
+	// mark and the last is dropped although the queue isn't full
+	_ = q.Record(&trace.Span{SpanID: 1})
+	<-rec.received
+	for id := int64(2); id <= 4; id++ {
+		_ = q.Record(&trace.Span{SpanID: id})
+	}
+	if n := testutil.ToFloat64(traceQueueDepth); n != 2 {
+		t.Errorf("expected queue depth 2, got %v", n)
+	}
+	if n := testutil.ToFloat64(traceSpansEnqueued) - enqueued; n != 3 {
+		t.Errorf("expected 3 spans enqueued, got %v", n)
+	}
+	if n := testutil.ToFloat64(traceSpansDropped) - dropped; n != 1 {
+		t.Errorf("expected 1 span dropped, got %v", n)
+	}
+	if n := testutil.ToFloat64(traceQueueHighWater) - highWater; n != 1 {
+		t.Errorf("expected high water mark to be reached once, got %v", n)
+	}
+
+	close(rec.release)
+	for i := 0; i < 2; i++ {
+		<-rec.received
+	}
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(traceSpansFlushed)-flushed != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := testutil.ToFloat64(traceSpansFlushed) - flushed; n != 3 {
+		t.Errorf("expected 3 spans flushed, got %v", n)
+	}
+	if n := testutil.ToFloat64(traceQueueDepth); n != 0 {
+		t.Errorf("expected empty queue, got depth %v", n)
+	}
+}
+
+func TestQueuedRecorderClose(t *testing.T) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	counter := &countingRecorder{}
+	flushed := 0
+	q := newQueuedRecorder(counter, func() error { flushed++; return nil }, 4, 0, TraceOverflowBlock, time.Hour, logger)
+	for id := int64(1); id <= 3; id++ {
+		_ = q.Record(&trace.Span{SpanID: id})
+	}
+
+	// Queued spans are recorded and output is flushed
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if counter.count != 3 {
+		t.Errorf("expected 3 spans recorded, got %d", counter.count)
+	}
+	if flushed != 1 {
+		t.Errorf("expected 1 flush, got %d", flushed)
+	}
+
+	// Later spans are discarded rather than blocking, even when full
+	for id := int64(4); id <= 9; id++ {
+		_ = q.Record(&trace.Span{SpanID: id})
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if counter.count != 3 {
+		t.Errorf("expected spans recorded after close to be discarded, got %d", counter.count)
+	}
+}
+
+func TestTraceTeardown(t *testing.T) {
+	s := newTestService(t, nil)
+	var closed []string
+	s.AddCloser(0, closerFunc(func() error {
+		closed = append(closed, "db")
+		return nil
+	}))
+
+	// As Run would with a buffered recorder
+	counter := &countingRecorder{}
+	flush := func() error {
+		closed = append(closed, "trace")
+		return nil
+	}
+	s.traceQueue = newQueuedRecorder(counter, flush, 4, 0, TraceOverflowBlock, time.Hour, s.defaultLogger)
+	_ = s.traceQueue.Record(&trace.Span{SpanID: 1})
+
+	// Trace output is flushed after closers have run
+	s.teardown(&http.Server{})
+	if counter.count != 1 {
+		t.Errorf("expected queued span to be recorded, got %d", counter.count)
+	}
+	if actual := strings.Join(closed, ","); actual != "db,trace" {
+		t.Errorf("unexpected teardown order: %s", actual)
+	}
+}
+
+func TestNodeIDGenerator(t *testing.T) {
+	gen := newNodeIDGenerator(0x5a, 8)
+	for i := 0; i < 100; i++ {
+		id, err := gen(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= 0 {
+			t.Fatalf("expected positive id, got %d", id)
+		}
+		if node := id >> 55; node != 0x5a {
+			t.Fatalf("expected node 0x5a, got %#x", node)
+		}
+	}
+}
+
+func TestNodeIDGeneratorConfig(t *testing.T) {
+	config := ServiceConfig{}
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.Trace.NodeID = 300
+	config.Normalize()
+	if config.Trace.NodeBits != defaultTraceNodeBits {
+		t.Errorf("expected default node bits, got %d", config.Trace.NodeBits)
+	}
+	if err := config.Validate(); err != ErrInvalidTraceNodeID {
+		t.Errorf("expected ErrInvalidTraceNodeID, got %v", err)
+	}
+	config.Trace.NodeBits = 9
+	if err := config.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestContextStartChildSpan(t *testing.T) {
+	// W/o tracing the helpers are no-ops
+	ctx, finish := ContextStartChildSpan(context.Background(), "db", "query")
+	ContextTraceAnnotate(ctx)["rows"] = 3
+	finish()
+
+	rec := NewMemoryRecorder(10)
+	ctx, err := trace.Record(context.Background(), rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requestSpanId int64
+	trace.Do(ctx, TraceKindRequest, "/", func(ctx context.Context) {
+		requestSpanId = trace.CurrentSpanID(ctx)
+		childCtx, finish := ContextStartChildSpan(ctx, "db", "query")
+		ContextTraceAnnotate(childCtx)["rows"] = 3
+		finish()
+		finish() // NB: Extra calls do nothing
+		ContextTraceAnnotate(ctx)["cache"] = "miss"
+	})
+
+	var spans []trace.Span
+	for i := 0; i < 100 && len(spans) < 2; i++ {
+		time.Sleep(time.Millisecond)
+		spans = rec.Spans()
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	child, parent := spans[0], spans[1]
+	if child.Kind != "db" || child.Name != "query" || child.ParentID != requestSpanId || child.Data["rows"] != 3 {
+		t.Errorf("unexpected child span: %+v", child)
+	}
+	if parent.SpanID != requestSpanId || parent.Data["cache"] != "miss" {
+		t.Errorf("unexpected request span: %+v", parent)
+	}
+
+	// Spans whose finish isn't called are finished once the context is done
+	trace.Do(ctx, TraceKindRequest, "/", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		ContextStartChildSpan(ctx, "db", "abandoned")
+		cancel()
+	})
+	for i := 0; i < 100 && len(spans) < 4; i++ {
+		time.Sleep(time.Millisecond)
+		spans = rec.Spans()
+	}
+	if len(spans) != 4 || spans[2].Name != "abandoned" && spans[3].Name != "abandoned" {
+		t.Errorf("expected the abandoned span to be finished, got %+v", spans)
+	}
+}
+
+func TestTraceRequired(t *testing.T) {
+	config := new(ServiceConfig)
+	config.Version.Min = 1
+	config.Version.Max = 1
+	config.Trace.Enabled = true
+	config.Trace.Required = true
+	config.Trace.Recorders = []string{"json"} // w/o a path parameter
+
+	s, err := NewService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Run(); err == nil || !strings.Contains(err.Error(), "json trace recorder") {
+		t.Errorf("expected json trace recorder error, got %v", err)
+	}
+
+	config.Trace.Recorders = nil
+	if s, err = NewService(config); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Run(); err != ErrNoTraceRecorders {
+		t.Errorf("expected ErrNoTraceRecorders, got %v", err)
+	}
+}
+
+type heldResource struct {
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (r *heldResource) Get(req *http.Request) (int, interface{}) {
+	r.started <- struct{}{}
+	<-r.done
+	return http.StatusOK, "held"
+}
+
+func TestTraceMaxSpans(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Trace.MaxSpans = 1
+	})
+	rec := NewMemoryRecorder(10)
+	var err error
+	if s.tracer, err = trace.Record(context.Background(), rec); err != nil {
+		t.Fatal(err)
+	}
+	held := &heldResource{started: make(chan struct{}), done: make(chan struct{})}
+	if err = s.AddResource(1, "/held", held); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest("GET", "/held", nil)
+		s.ServeHTTP(httptest.NewRecorder(), req)
+		close(first)
+	}()
+	<-held.started
+
+	skipped := testutil.ToFloat64(traceSpansSkipped)
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Errorf("expected untraced request to be served, got %d", rw.Code)
+	}
+	if rw.Header().Get(HeaderRequestId) == "" {
+		t.Error("expected untraced request to have a request id")
+	}
+	if n := testutil.ToFloat64(traceSpansSkipped) - skipped; n != 1 {
+		t.Errorf("expected 1 skipped span, got %v", n)
+	}
+
+	held.done <- struct{}{}
+	<-first
+
+	// Once the traced request finishes new requests are traced again
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	var spans []trace.Span
+	for i := 0; i < 100 && len(spans) < 2; i++ {
+		time.Sleep(time.Millisecond)
+		spans = rec.Spans()
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 request spans, got %d", len(spans))
+	}
+	if spans[0].Name != "/held" || spans[1].Name != "/ping" {
+		t.Errorf("expected /held and /ping spans, got %s and %s", spans[0].Name, spans[1].Name)
+	}
+}
+
+func TestSpanName(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Version.Max = 2
+	})
+	if err := s.AddResource(1, "/routes", &routeResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	name := func(path, version string) string {
+		req, _ := http.NewRequest("GET", path, nil)
+		if version != "" {
+			req.Header.Set(HeaderSpirentApiVersion, version)
+		}
+		_, route, _ := s.matchRequest(req)
+		return s.spanName(req, route)
+	}
+
+	tests := []struct {
+		path     string
+		version  string
+		expected string
+	}{
+		{"/routes/123", "1", "/routes/:seg1"},
+		{"/routes", "1", "/routes"},
+		{"/routes/123", "", "/routes/123"},
+		{"/routes/123", "x", "/routes/123"},
+		{"/nope/123", "1", "/nope/123"},
+	}
+	for _, test := range tests {
+		if actual := name(test.path, test.version); actual != test.expected {
+			t.Errorf("%s (v%s): expected span name %q, got %q", test.path, test.version, test.expected, actual)
+		}
+	}
+
+	s.SetSpanNamer(func(req *http.Request) string { return req.Method + " " + req.URL.Path })
+	if actual := name("/routes/123", "1"); actual != "GET /routes/123" {
+		t.Errorf("expected custom span name, got %q", actual)
+	}
+}
+
+func TestAccessLogTraceIds(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+	out := new(strings.Builder)
+	s.accessLogger.Out = out
+
+	serve := func() (requestId string, entry string) {
+		out.Reset()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw.Header().Get(HeaderRequestId), out.String()
+	}
+
+	// Untraced requests only log the numeric request id
+	if _, entry := serve(); strings.Contains(entry, `"trace_id"`) || strings.Contains(entry, `"span_id"`) {
+		t.Errorf("expected no trace ids without tracing, got %s", entry)
+	}
+
+	var err error
+	if s.tracer, err = trace.Record(context.Background(), NewMemoryRecorder(10)); err != nil {
+		t.Fatal(err)
+	}
+	requestId, entry := serve()
+	traceId, _ := strconv.ParseInt(requestId, 10, 64)
+	if expected := fmt.Sprintf(`"trace_id":"%032x"`, traceId); !strings.Contains(entry, expected) {
+		t.Errorf("expected %s in access log entry, got %s", expected, entry)
+	}
+	if !strings.Contains(entry, `"span_id":"`) || !strings.Contains(entry, `"request_id":"`+requestId+`"`) {
+		t.Errorf("expected span and request ids in access log entry, got %s", entry)
+	}
+}
@@ -0,0 +1,74 @@
+package luddite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+)
+
+// DeclareTrailers announces the trailer headers that a response will send
+// after its body. It must be called before the response is written. Responses
+// with trailers are sent using chunked encoding, so any Content-Length header
+// is removed.
+func DeclareTrailers(rw http.ResponseWriter, names ...string) {
+	h := rw.Header()
+	h.Del(HeaderContentLength)
+	for _, name := range names {
+		h.Add(HeaderTrailer, http.CanonicalHeaderKey(name))
+	}
+}
+
+// SetTrailer sets a trailer header value once a response's body has been
+// written. Trailers that weren't declared using DeclareTrailers are still sent
+// to HTTP/1.1 and HTTP/2 clients, but clients can't anticipate them.
+func SetTrailer(rw http.ResponseWriter, name, value string) {
+	h := rw.Header()
+	name = http.CanonicalHeaderKey(name)
+	for _, declared := range h[HeaderTrailer] {
+		if http.CanonicalHeaderKey(declared) == name {
+			h.Set(name, value)
+			return
+		}
+	}
+	h.Set(http.TrailerPrefix+name, value)
+}
+
+// ChecksumWriter streams a response body while computing its SHA-256 digest,
+// which Close sends as the hex-encoded X-Content-Sha256 trailer. This lets
+// clients verify the integrity of large streamed responses. Responses written
+// using a ChecksumWriter are exempt from the service's response size limit.
+type ChecksumWriter struct {
+	rw   http.ResponseWriter
+	hash hash.Hash
+}
+
+// NewChecksumWriter declares the X-Content-Sha256 trailer and returns a
+// ChecksumWriter for a response. It must be called before the response is
+// written.
+func NewChecksumWriter(rw http.ResponseWriter) *ChecksumWriter {
+	ExemptResponseSizeLimit(rw)
+	DeclareTrailers(rw, HeaderContentSHA256)
+	return &ChecksumWriter{rw: rw, hash: sha256.New()}
+}
+
+// Write writes to the response body and adds the bytes written to the digest.
+func (w *ChecksumWriter) Write(b []byte) (int, error) {
+	n, err := w.rw.Write(b)
+	w.hash.Write(b[:n])
+	return n, err
+}
+
+// Flush sends any buffered body data to the client.
+func (w *ChecksumWriter) Flush() {
+	if flusher, ok := w.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close sets the X-Content-Sha256 trailer. It must be called once the body
+// has been written, before the handler returns.
+func (w *ChecksumWriter) Close() error {
+	SetTrailer(w.rw, HeaderContentSHA256, hex.EncodeToString(w.hash.Sum(nil)))
+	return nil
+}
@@ -0,0 +1,54 @@
+package luddite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChecksumTrailer(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Response.MaxResponseBytes = 16
+	})
+	body := strings.Repeat("export,", 100)
+	router, _ := s.Router(1)
+	router.GET("/export", func(rw http.ResponseWriter, req *http.Request) {
+		w := NewChecksumWriter(rw)
+		for i := 0; i < 100; i++ {
+			_, _ = w.Write([]byte("export,"))
+			w.Flush()
+		}
+		_ = w.Close()
+		SetTrailer(rw, "X-Rows", "100")
+	})
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+	res, err := http.Get(server.URL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != body {
+		t.Errorf("unexpected body of %d bytes", len(b))
+	}
+	if res.ProtoMajor != 1 || res.ProtoMinor != 1 || len(res.TransferEncoding) == 0 || res.TransferEncoding[0] != "chunked" {
+		t.Errorf("expected a chunked HTTP/1.1 response, got %s %v", res.Proto, res.TransferEncoding)
+	}
+	sum := sha256.Sum256([]byte(body))
+	if checksum := res.Trailer.Get(HeaderContentSHA256); checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected checksum trailer: %q", checksum)
+	}
+	if rows := res.Trailer.Get("X-Rows"); rows != "100" {
+		t.Errorf("unexpected undeclared trailer: %q", rows)
+	}
+}
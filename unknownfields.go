@@ -0,0 +1,42 @@
+package luddite
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// UnknownFieldsPolicy may be implemented by resource handler types to
+// override the service's request.disallow_unknown_fields setting for their
+// JSON request bodies, e.g. to make a single endpoint strict.
+type UnknownFieldsPolicy interface {
+	DisallowUnknownFields() bool
+}
+
+// disallowUnknownFields returns true if JSON request bodies for a request must
+// not contain fields that the target value lacks.
+func (s *Service) disallowUnknownFields(d *handlerDetails) bool {
+	r := d.resource.find(func(r *resourceRegistration) bool { return r.unknownFields != nil })
+	if r == nil {
+		return s.config.Request.DisallowUnknownFields
+	}
+	return r.unknownFields.DisallowUnknownFields()
+}
+
+// decodeJSONRequest decodes a JSON request body, optionally rejecting unknown
+// fields with an EcodeBadRequest error that names the offending field.
+func decodeJSONRequest(req *http.Request, r io.Reader, v interface{}, disallowUnknown bool) error {
+	decoder := json.NewDecoder(r)
+	if disallowUnknown {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		// NB: encoding/json doesn't export an error type for unknown fields
+		if msg := err.Error(); disallowUnknown && strings.HasPrefix(msg, "json: unknown field ") {
+			return NewError(nil, EcodeBadRequest, "unknown field "+strings.TrimPrefix(msg, "json: unknown field "))
+		}
+		return decodeError(req, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package luddite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type strictGadgetResource struct {
+	gadgetResource
+}
+
+func (r *strictGadgetResource) DisallowUnknownFields() bool {
+	return true
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+	s := newTestService(t, nil)
+	if err := s.AddResource(1, "/gadgets", &gadgetResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/strict", &strictGadgetResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set(HeaderContentType, ContentTypeJson)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if rw := post("/gadgets", `{"name":"widget","nmae":"typo"}`); rw.Code != http.StatusOK {
+		t.Errorf("expected unknown fields to be ignored by default, got %d", rw.Code)
+	}
+	rw := post("/strict", `{"name":"widget","nmae":"typo"}`)
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("expected 400/Bad Request for unknown field, got %d", rw.Code)
+	}
+	if body := rw.Body.String(); !strings.Contains(body, EcodeBadRequest) || !strings.Contains(body, `unknown field \"nmae\"`) {
+		t.Errorf("expected error naming the unknown field, got %s", body)
+	}
+	if rw := post("/strict", `{"name":"widget"}`); rw.Code != http.StatusOK {
+		t.Errorf("expected 200/OK without unknown fields, got %d", rw.Code)
+	}
+
+	// The service default applies to resources without their own policy
+	s.config.Request.DisallowUnknownFields = true
+	if rw := post("/gadgets", `{"name":"widget","nmae":"typo"}`); rw.Code != http.StatusBadRequest {
+		t.Errorf("expected 400/Bad Request with service default, got %d", rw.Code)
+	}
+}
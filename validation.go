@@ -0,0 +1,181 @@
+package luddite
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNoSchemaFileSystem occurs when a resource requests schema validation but
+// the service has no schema filesystem.
+var ErrNoSchemaFileSystem = errors.New("schema validation requires schemas to be enabled or set using SetSchemas or SetVersionSchemas")
+
+// SchemaValidated is implemented by resources whose request and response
+// bodies are described by documents in the service's schema filesystem. When
+// schema validation is enabled in the service config, JSON request bodies that
+// violate the request schema are rejected with 422 responses and JSON response
+// bodies that violate the response schema are logged (and optionally failed).
+type SchemaValidated interface {
+	// Schemas returns the names of the request and response body schema
+	// documents relative to the API version's schema directory, e.g.
+	// "widget.json". Either name may be empty.
+	Schemas() (request, response string)
+}
+
+// SchemaFailModePolicy may be implemented by SchemaValidated resource handler
+// types to override the service's schema.validation.fail_mode setting, e.g. to
+// let a non-critical resource be served without validation when its schemas
+// can't be loaded.
+type SchemaFailModePolicy interface {
+	SchemaFailMode() FailMode
+}
+
+type resourceValidation struct {
+	s        *Service
+	request  *jsonSchema
+	response *jsonSchema
+}
+
+func (s *Service) loadResourceValidation(version int, r SchemaValidated) (*resourceValidation, error) {
+	config := s.config.Schema.Validation
+	if !config.Requests && !config.Responses {
+		return nil, nil
+	}
+	fs, _ := s.schemaFile(version, "")
+	if fs == nil {
+		return nil, ErrNoSchemaFileSystem
+	}
+
+	var (
+		v   = &resourceValidation{s: s}
+		err error
+	)
+	request, response := r.Schemas()
+	if config.Requests && request != "" {
+		if v.request, err = loadJSONSchema(s.schemaFile(version, request)); err != nil {
+			return nil, err
+		}
+	}
+	if config.Responses && response != "" {
+		if v.response, err = loadJSONSchema(s.schemaFile(version, response)); err != nil {
+			return nil, err
+		}
+	}
+	if v.request == nil && v.response == nil {
+		return nil, nil
+	}
+	return v, nil
+}
+
+// resourceValidation returns the validation for the resource that serves the
+// request, if any.
+func (d *handlerDetails) resourceValidation() *resourceValidation {
+	r := d.resource.find(func(r *resourceRegistration) bool { return r.validation != nil })
+	if r == nil {
+		return nil
+	}
+	return r.validation
+}
+
+// lookupResource finds the registration of the resource that serves a request
+// path, i.e. the first one with the longest matching base path, if any. A
+// nested resource thus never inherits the features of its parent resource.
+// Later resources registered at the same base path follow it in turn.
+func (s *Service) lookupResource(version int, p string) *resourceRegistration {
+	if prefix := strings.TrimSuffix(s.config.Prefix, "/"); prefix != "" {
+		if !strings.HasPrefix(p, prefix) {
+			return nil
+		}
+		p = p[len(prefix):]
+	}
+
+	var found *resourceRegistration
+	for _, r := range s.resources {
+		if r.version != version || (found != nil && len(r.basePath) <= len(found.basePath)) {
+			continue
+		}
+		base := strings.TrimSuffix(r.basePath, "/")
+		if p == base || strings.HasPrefix(p, base+"/") {
+			found = r
+		}
+	}
+	return found
+}
+
+// addResourceRegistration adds a resource's registration, after those of the
+// resources already registered at the same base path.
+func (s *Service) addResourceRegistration(reg *resourceRegistration) {
+	for _, r := range s.resources {
+		if r.version == reg.version && r.basePath == reg.basePath && r.next == nil {
+			r.next = reg
+			break
+		}
+	}
+	s.resources = append(s.resources, reg)
+}
+
+// find returns the first of the registrations at a resource's base path that
+// match accepts, or nil.
+func (r *resourceRegistration) find(match func(r *resourceRegistration) bool) *resourceRegistration {
+	for ; r != nil; r = r.next {
+		if match(r) {
+			return r
+		}
+	}
+	return nil
+}
+
+// checkRequest validates a serialized JSON request body.
+func (v *resourceValidation) checkRequest(b []byte) error {
+	if v.request == nil {
+		return nil
+	}
+	var body interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return NewError(nil, EcodeDeserializationFailed, err)
+	}
+	if err := v.request.validate(body); err != nil {
+		return NewError(nil, EcodeValidationFailed, err)
+	}
+	return nil
+}
+
+// checkResponse validates a serialized JSON response body. Violations are
+// logged and returned. When the schema describes a single element but the
+// body is an array (e.g. a collection listing) each element is validated.
+func (v *resourceValidation) checkResponse(b []byte) error {
+	if v.response == nil {
+		return nil
+	}
+
+	var err error
+	if !v.response.isArray() && len(b) > 0 && b[0] == '[' {
+		var elems []interface{}
+		if err = json.Unmarshal(b, &elems); err == nil {
+			for _, elem := range elems {
+				if err = v.response.validate(elem); err != nil {
+					break
+				}
+			}
+		}
+	} else {
+		err = v.response.validateBytes(b)
+	}
+	if err != nil {
+		v.s.defaultLogger.WithFields(log.Fields{"error": err.Error()}).Error("response violates schema")
+	}
+	return err
+}
+
+// requestBodyErrorStatus maps a ReadRequest error to a response status.
+func requestBodyErrorStatus(err error) int {
+	if e, ok := err.(*Error); ok {
+		switch e.Code {
+		case EcodeValidationFailed, EcodeDecodeTooLarge, EcodeRequestTooLarge:
+			return ErrorStatus(e.Code)
+		}
+	}
+	return ErrorStatus(EcodeDeserializationFailed)
+}
@@ -0,0 +1,191 @@
+package luddite
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+const widgetSchema = `{
+  "type": "object",
+  "required": ["id", "name"],
+  "properties": {
+    "id": {"type": "string"},
+    "name": {"$ref": "#/definitions/name"},
+    "size": {"type": "integer", "minimum": 1}
+  },
+  "additionalProperties": false,
+  "definitions": {
+    "name": {"type": "string", "minLength": 1}
+  }
+}`
+
+type widget struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Size int    `json:"size,omitempty"`
+}
+
+type widgetResource struct {
+	created interface{}
+	invalid bool
+}
+
+func (r *widgetResource) Schemas() (string, string) {
+	return "widget.json", "widget.yaml"
+}
+
+func (r *widgetResource) New() interface{} {
+	return &widget{}
+}
+
+func (r *widgetResource) Id(value interface{}) string {
+	return value.(*widget).Id
+}
+
+func (r *widgetResource) List(req *http.Request) (int, interface{}) {
+	if r.invalid {
+		return http.StatusOK, []*widget{{Id: "1", Name: "a"}, {Id: "2"}}
+	}
+	return http.StatusOK, []*widget{{Id: "1", Name: "a"}}
+}
+
+func (r *widgetResource) Create(req *http.Request, value interface{}) (int, interface{}) {
+	r.created = value
+	return http.StatusCreated, value
+}
+
+func newValidationService(t *testing.T, failResponses bool) (*Service, *widgetResource) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Schema.Validation.Requests = true
+		config.Schema.Validation.Responses = true
+		config.Schema.Validation.FailResponses = failResponses
+	})
+	s.SetSchemas(httpfs.New(mapfs.New(map[string]string{
+		"v1/widget.json": widgetSchema,
+		"v1/widget.yaml": "type: object\nrequired: [id, name]\nproperties:\n  name: {type: string, minLength: 1}\n",
+	})))
+	r := &widgetResource{}
+	if err := s.AddResource(1, "/widgets", r); err != nil {
+		t.Fatal(err)
+	}
+	return s, r
+}
+
+func TestSchemaValidationRequests(t *testing.T) {
+	s, r := newValidationService(t, false)
+
+	post := func(body string) int {
+		req, _ := http.NewRequest("POST", "/widgets", bytes.NewBufferString(body))
+		req.Header.Set(HeaderContentType, ContentTypeJson)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	if code := post(`{"id": "1", "name": "a", "size": 2}`); code != http.StatusCreated {
+		t.Errorf("expected 201/Created for valid body, got %d", code)
+	}
+	if r.created == nil {
+		t.Error("expected valid body to be passed to the resource")
+	}
+	for _, body := range []string{
+		`{"id": "1"}`,
+		`{"id": "1", "name": ""}`,
+		`{"id": "1", "name": "a", "size": 0}`,
+		`{"id": "1", "name": "a", "color": "red"}`,
+	} {
+		if code := post(body); code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422/Unprocessable Entity for %s, got %d", body, code)
+		}
+	}
+	if code := post(`{"id": `); code != http.StatusBadRequest {
+		t.Errorf("expected 400/Bad Request for malformed body, got %d", code)
+	}
+}
+
+func TestSchemaValidationResponses(t *testing.T) {
+	get := func(s *Service) int {
+		req, _ := http.NewRequest("GET", "/widgets", nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	s, r := newValidationService(t, false)
+	r.invalid = true
+	if code := get(s); code != http.StatusOK {
+		t.Errorf("expected 200/OK for logged-only violation, got %d", code)
+	}
+
+	s, r = newValidationService(t, true)
+	if code := get(s); code != http.StatusOK {
+		t.Errorf("expected 200/OK for valid response, got %d", code)
+	}
+	r.invalid = true
+	if code := get(s); code != http.StatusInternalServerError {
+		t.Errorf("expected 500/Internal Server Error for invalid response, got %d", code)
+	}
+}
+
+func TestSchemaValidationRequiresSchemas(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Schema.Validation.Requests = true
+	})
+	if err := s.AddResource(1, "/widgets", &widgetResource{}); err != ErrNoSchemaFileSystem {
+		t.Errorf("expected ErrNoSchemaFileSystem, got %v", err)
+	}
+}
+
+func TestSchemaValidationFailMode(t *testing.T) {
+	for _, mode := range []FailMode{FailClosed, FailOpen} {
+		s := newTestService(t, func(config *ServiceConfig) {
+			config.Schema.Validation.Requests = true
+			config.Schema.Validation.FailMode = mode
+		})
+		s.SetSchemas(httpfs.New(mapfs.New(map[string]string{})))
+		err := s.AddResource(1, "/widgets", &widgetResource{})
+		if mode == FailClosed && err == nil {
+			t.Error("expected missing schema to fail closed")
+		}
+		if mode == FailOpen {
+			if err != nil {
+				t.Fatalf("expected missing schema to fail open, got %v", err)
+			}
+			req, _ := http.NewRequest("POST", "/widgets", bytes.NewBufferString(`{"id": "1"}`))
+			req.Header.Set(HeaderContentType, ContentTypeJson)
+			rw := httptest.NewRecorder()
+			s.ServeHTTP(rw, req)
+			if rw.Code != http.StatusCreated {
+				t.Errorf("expected unvalidated request to succeed, got %d", rw.Code)
+			}
+		}
+	}
+}
+
+type lenientWidgetResource struct {
+	widgetResource
+}
+
+func (r *lenientWidgetResource) SchemaFailMode() FailMode {
+	return FailOpen
+}
+
+func TestSchemaFailModePolicy(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Schema.Validation.Requests = true
+	})
+	s.SetSchemas(httpfs.New(mapfs.New(map[string]string{})))
+
+	// Resources may fail open although the service fails closed
+	if err := s.AddResource(1, "/widgets", &widgetResource{}); err == nil {
+		t.Error("expected missing schema to fail closed")
+	}
+	if err := s.AddResource(1, "/lenient", &lenientWidgetResource{}); err != nil {
+		t.Errorf("expected missing schema to fail open, got %v", err)
+	}
+}
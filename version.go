@@ -1,19 +1,32 @@
 package luddite
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+var deprecatedApiVersionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "luddite",
+	Name:      "deprecated_api_version_requests_total",
+	Help:      "Number of requests for deprecated API versions.",
+}, []string{"api_version"})
+
 type version struct {
-	minVersion int
-	maxVersion int
+	minVersion   int
+	maxVersion   int
+	deprecated   map[int]DeprecationInfo
+	migrationURL string
 }
 
-func newVersionHandler(minVersion, maxVersion int) http.Handler {
+func newVersionHandler(minVersion, maxVersion int, deprecated map[int]DeprecationInfo, migrationURL string) http.Handler {
 	return &version{
-		minVersion: minVersion,
-		maxVersion: maxVersion,
+		minVersion:   minVersion,
+		maxVersion:   maxVersion,
+		deprecated:   deprecated,
+		migrationURL: migrationURL,
 	}
 }
 
@@ -24,7 +37,7 @@ func (v *version) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		i, err := strconv.Atoi(s)
 		if err != nil || i < 1 {
 			e := NewError(nil, EcodeApiVersionInvalid)
-			_ = WriteResponse(rw, http.StatusBadRequest, e)
+			_ = WriteResponse(rw, ErrorStatus(e.Code), e)
 			return
 		}
 		version = i
@@ -33,18 +46,31 @@ func (v *version) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	// Range check the requested API version and reject requests that fall outside supported version numbers
 	if version < v.minVersion {
 		e := NewError(nil, EcodeApiVersionTooOld, v.minVersion)
-		_ = WriteResponse(rw, http.StatusGone, e)
+		e.HelpURL = v.migrationURL
+		_ = WriteResponse(rw, ErrorStatus(e.Code), e)
 		return
 	}
 	if version > v.maxVersion {
 		e := NewError(nil, EcodeApiVersionTooNew, v.maxVersion)
-		_ = WriteResponse(rw, http.StatusNotImplemented, e)
+		_ = WriteResponse(rw, ErrorStatus(e.Code), e)
 		return
 	}
 
 	// Add the requested API version to response headers (useful for clients when a default version was negotiated)
 	rw.Header().Add(HeaderSpirentApiVersion, strconv.Itoa(version))
 
+	// Warn clients that are using a deprecated API version
+	if info, ok := v.deprecated[version]; ok {
+		rw.Header().Set(HeaderDeprecation, "true")
+		if !info.Sunset.IsZero() {
+			rw.Header().Set(HeaderSunset, info.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if info.Message != "" {
+			rw.Header().Set(HeaderWarning, fmt.Sprintf("299 - %q", info.Message))
+		}
+		deprecatedApiVersionRequests.WithLabelValues(strconv.Itoa(version)).Inc()
+	}
+
 	// Add the requested API version to handler context so that downstream handlers can access
 	d := contextHandlerDetails(req.Context())
 	d.apiVersion = version
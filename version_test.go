@@ -3,7 +3,9 @@ package luddite
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNonPositiveApiVersionConstraint(t *testing.T) {
@@ -12,7 +14,7 @@ func TestNonPositiveApiVersionConstraint(t *testing.T) {
 	rw := httptest.NewRecorder()
 	rw.Header().Set(HeaderContentType, ContentTypeJson)
 
-	v := newVersionHandler(2, 42)
+	v := newVersionHandler(2, 42, nil, "")
 	v.ServeHTTP(rw, req)
 	if rw.Code != http.StatusBadRequest {
 		t.Error("expected 400/Bad request")
@@ -25,11 +27,14 @@ func TestMinApiVersionConstraint(t *testing.T) {
 	rw := httptest.NewRecorder()
 	rw.Header().Set(HeaderContentType, ContentTypeJson)
 
-	v := newVersionHandler(2, 42)
+	v := newVersionHandler(2, 42, nil, "https://example.com/migrating")
 	v.ServeHTTP(rw, req)
 	if rw.Code != http.StatusGone {
 		t.Error("expected 410/Gone response for outdated version")
 	}
+	if body := rw.Body.String(); !strings.Contains(body, `"help_url":"https://example.com/migrating"`) {
+		t.Errorf("expected migration guide link in body, got %s", body)
+	}
 }
 
 func TestMaxApiVersionConstraint(t *testing.T) {
@@ -38,7 +43,7 @@ func TestMaxApiVersionConstraint(t *testing.T) {
 	rw := httptest.NewRecorder()
 	rw.Header().Set(HeaderContentType, ContentTypeJson)
 
-	v := newVersionHandler(2, 42)
+	v := newVersionHandler(2, 42, nil, "")
 	v.ServeHTTP(rw, req)
 	if rw.Code != http.StatusNotImplemented {
 		t.Error("expected 501/Not Implemented response for future version")
@@ -51,7 +56,7 @@ func TestApiVersionContext(t *testing.T) {
 	req = req.WithContext(withHandlerDetails(req.Context(), &handlerDetails{}))
 	rw := httptest.NewRecorder()
 
-	v := newVersionHandler(1, 1)
+	v := newVersionHandler(1, 1, nil, "")
 	v.ServeHTTP(rw, req)
 	if ContextApiVersion(req.Context()) != 1 {
 		t.Error("missing API version in request context")
@@ -60,3 +65,31 @@ func TestApiVersionContext(t *testing.T) {
 		t.Errorf("missing %s header in response", HeaderSpirentApiVersion)
 	}
 }
+
+func TestDeprecatedApiVersion(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add(HeaderSpirentApiVersion, "1")
+	req = req.WithContext(withHandlerDetails(req.Context(), &handlerDetails{}))
+	rw := httptest.NewRecorder()
+
+	v := newVersionHandler(1, 2, map[int]DeprecationInfo{
+		1: {Sunset: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), Message: "Use API version 2"},
+	}, "")
+	v.ServeHTTP(rw, req)
+	if dep := rw.Header().Get(HeaderDeprecation); dep != "true" {
+		t.Errorf("unexpected %s header: %s", HeaderDeprecation, dep)
+	}
+	if sunset := rw.Header().Get(HeaderSunset); sunset != "Tue, 01 Jan 2030 00:00:00 GMT" {
+		t.Errorf("unexpected %s header: %s", HeaderSunset, sunset)
+	}
+	if warning := rw.Header().Get(HeaderWarning); warning != "299 - \"Use API version 2\"" {
+		t.Errorf("unexpected %s header: %s", HeaderWarning, warning)
+	}
+
+	req.Header.Set(HeaderSpirentApiVersion, "2")
+	rw = httptest.NewRecorder()
+	v.ServeHTTP(rw, req)
+	if _, ok := rw.Header()[HeaderDeprecation]; ok {
+		t.Errorf("unexpected %s header for current API version", HeaderDeprecation)
+	}
+}
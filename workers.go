@@ -0,0 +1,84 @@
+package luddite
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	workersBusy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "luddite",
+		Subsystem: "workers",
+		Name:      "busy",
+		Help:      "Number of workers executing resource handlers.",
+	})
+
+	workersRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "luddite",
+		Subsystem: "workers",
+		Name:      "rejections_total",
+		Help:      "Number of requests rejected because no worker became available.",
+	})
+)
+
+// workerPool bounds the number of resource handlers that execute at once,
+// independent of the number of connections. Handlers still run on their
+// requests' goroutines, so that panic recovery and response writers behave as
+// usual, but only after reserving one of the pool's workers.
+type workerPool struct {
+	sem        chan struct{}
+	wait       time.Duration
+	retryAfter string
+}
+
+func newWorkerPool(size int, wait time.Duration) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{
+		sem:        make(chan struct{}, size),
+		wait:       wait,
+		retryAfter: strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))),
+	}
+}
+
+// acquire reserves a worker, waiting up to the pool's wait duration as
+// measured by clock. It returns false if no worker became available or the
+// request was canceled (e.g. the client disconnected) while waiting.
+func (p *workerPool) acquire(ctx context.Context, clock Clock) bool {
+	select {
+	case p.sem <- struct{}{}:
+		workersBusy.Inc()
+		return true
+	default:
+	}
+
+	if p.wait > 0 {
+		timer := clock.NewTimer(p.wait)
+		defer timer.Stop()
+		select {
+		case p.sem <- struct{}{}:
+			workersBusy.Inc()
+			return true
+		case <-timer.C():
+		case <-ctx.Done():
+		}
+	}
+	workersRejections.Inc()
+	return false
+}
+
+func (p *workerPool) release() {
+	workersBusy.Dec()
+	<-p.sem
+}
+
+func (p *workerPool) reject(rw http.ResponseWriter) {
+	rw.Header().Set(HeaderRetryAfter, p.retryAfter)
+	_ = WriteResponse(rw, ErrorStatus(EcodeServiceUnavailable), NewError(nil, EcodeServiceUnavailable, "no worker available"))
+}
@@ -0,0 +1,63 @@
+package luddite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	s := newTestService(t, func(config *ServiceConfig) {
+		config.Workers.Enabled = true
+		config.Workers.Size = 1
+		config.Workers.Wait = 10 * time.Millisecond
+	})
+	held := &heldResource{started: make(chan struct{}), done: make(chan struct{})}
+	if err := s.AddResource(1, "/held", held); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddResource(1, "/ping", &pingResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := make(chan int)
+	go func() {
+		req, _ := http.NewRequest("GET", "/held", nil)
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, req)
+		first <- rw.Code
+	}()
+	<-held.started
+
+	// The only worker is busy, so requests wait and are then rejected
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusServiceUnavailable || rw.Header().Get(HeaderRetryAfter) == "" {
+		t.Errorf("expected 503/Service Unavailable with Retry-After, got %d", rw.Code)
+	}
+
+	// Canceled requests stop waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ = http.NewRequest("GET", "/ping", nil)
+	rw = httptest.NewRecorder()
+	start := time.Now()
+	s.ServeHTTP(rw, req.WithContext(ctx))
+	if rw.Body.Len() != 0 || time.Since(start) >= s.config.Workers.Wait {
+		t.Errorf("expected canceled request to be abandoned, got %d %q", rw.Code, rw.Body.String())
+	}
+
+	held.done <- struct{}{}
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("expected held request to succeed, got %d", code)
+	}
+	req, _ = http.NewRequest("GET", "/ping", nil)
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Errorf("expected request to be served by the free worker, got %d", rw.Code)
+	}
+}